@@ -0,0 +1,94 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+
+	"cloud_native/pkg/auth"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// AuthInterceptors authenticate every call with the same authenticators as
+// the REST API. Credentials are read from the call metadata ("authorization",
+// "x-api-key") and the peer's TLS client certificate. Per-key authorization
+// happens in the handlers.
+func AuthInterceptors(authenticator auth.Authenticator, policy auth.Policy) []grpclib.ServerOption {
+	authenticate := func(ctx context.Context) (context.Context, error) {
+		p, err := authenticator.Authenticate(requestFromContext(ctx))
+		if err != nil {
+			return nil, toStatus(err)
+		}
+
+		return auth.WithPolicy(auth.WithPrincipal(ctx, p), policy), nil
+	}
+
+	unary := func(ctx context.Context, req interface{}, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpclib.ServerStream, info *grpclib.StreamServerInfo, handler grpclib.StreamHandler) error {
+		ctx, err := authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+
+	return []grpclib.ServerOption{
+		grpclib.ChainUnaryInterceptor(unary),
+		grpclib.ChainStreamInterceptor(stream),
+	}
+}
+
+type authenticatedStream struct {
+	grpclib.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// requestFromContext presents the call's metadata and TLS state as an HTTP
+// request, so the authenticators can be shared with the REST API.
+func requestFromContext(ctx context.Context) *http.Request {
+	r := &http.Request{Header: make(http.Header)}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, vs := range md {
+			for _, v := range vs {
+				r.Header.Add(k, v)
+			}
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+
+	return r
+}
+
+func principalName(ctx context.Context) string {
+	p, _ := auth.PrincipalFrom(ctx)
+	return p.Name
+}
+
+func authorize(ctx context.Context, key string, perm auth.Permission) error {
+	if !auth.Allowed(ctx, key, perm) {
+		return toStatus(auth.ErrForbidden)
+	}
+
+	return nil
+}
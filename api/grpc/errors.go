@@ -0,0 +1,35 @@
+package grpc
+
+import (
+	"errors"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errReadOnly = status.Error(codes.FailedPrecondition, "read-only follower, write to the leader")
+
+// toStatus maps store and auth errors onto gRPC codes, mirroring the HTTP
+// statuses returned by the REST API.
+func toStatus(err error) error {
+	var code codes.Code
+
+	switch {
+	case errors.Is(err, store.ErrNoSuchKey):
+		code = codes.NotFound
+	case errors.Is(err, store.ErrEmptyKey), errors.Is(err, store.ErrKeyTooLong), errors.Is(err, store.ErrInvalidTxn):
+		code = codes.InvalidArgument
+	case errors.Is(err, store.ErrValueTooLarge), errors.Is(err, store.ErrStoreFull):
+		code = codes.ResourceExhausted
+	case errors.Is(err, auth.ErrNoCredentials), errors.Is(err, auth.ErrInvalidCredentials):
+		code = codes.Unauthenticated
+	case errors.Is(err, auth.ErrForbidden):
+		code = codes.PermissionDenied
+	default:
+		code = codes.Internal
+	}
+
+	return status.Error(code, err.Error())
+}
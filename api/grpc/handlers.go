@@ -0,0 +1,189 @@
+package grpc
+
+import (
+	"context"
+
+	"cloud_native/api/grpc/kvpb"
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) Get(ctx context.Context, req *kvpb.GetRequest) (*kvpb.GetResponse, error) {
+	if err := authorize(ctx, req.Key, auth.PermissionRead); err != nil {
+		return nil, err
+	}
+
+	e, err := store.GetEntry(req.Key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &kvpb.GetResponse{Entry: toEntry(e)}, nil
+}
+
+func (s *Server) Put(ctx context.Context, req *kvpb.PutRequest) (*kvpb.PutResponse, error) {
+	if s.readOnly {
+		return nil, errReadOnly
+	}
+
+	if err := authorize(ctx, req.Key, auth.PermissionWrite); err != nil {
+		return nil, err
+	}
+
+	// Hold the key until the write is logged, so the log sees concurrent
+	// writes in the store's order.
+	defer store.LockKeys(req.Key)()
+
+	res, err := store.Txn(nil, []store.Op{{Type: store.OpPut, Key: req.Key, Value: string(req.Value)}}, nil)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	s.transactionLog.WritePut(req.Key, string(req.Value), principalName(ctx))
+
+	return &kvpb.PutResponse{Version: res.Revision}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *kvpb.DeleteRequest) (*kvpb.DeleteResponse, error) {
+	if s.readOnly {
+		return nil, errReadOnly
+	}
+
+	if err := authorize(ctx, req.Key, auth.PermissionWrite); err != nil {
+		return nil, err
+	}
+
+	if err := store.CheckKey(req.Key); err != nil {
+		return nil, toStatus(err)
+	}
+
+	defer store.LockKeys(req.Key)()
+
+	if err := store.Delete(req.Key); err != nil {
+		return nil, toStatus(err)
+	}
+
+	s.transactionLog.WriteDelete(req.Key, principalName(ctx))
+
+	return &kvpb.DeleteResponse{}, nil
+}
+
+// List returns the entries under prefix that the caller may read.
+func (s *Server) List(ctx context.Context, req *kvpb.ListRequest) (*kvpb.ListResponse, error) {
+	res := &kvpb.ListResponse{}
+
+	for _, e := range store.List(req.Prefix) {
+		if auth.Allowed(ctx, e.Key, auth.PermissionRead) {
+			res.Entries = append(res.Entries, toEntry(e))
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Server) Txn(ctx context.Context, req *kvpb.TxnRequest) (*kvpb.TxnResponse, error) {
+	if s.readOnly && (len(req.Success) > 0 || len(req.Failure) > 0) {
+		return nil, errReadOnly
+	}
+
+	compares := make([]store.Compare, len(req.Compare))
+	for i, c := range req.Compare {
+		if err := authorize(ctx, c.Key, auth.PermissionRead); err != nil {
+			return nil, err
+		}
+
+		compares[i] = store.Compare{
+			Key:     c.Key,
+			Target:  store.CompareVersion,
+			Version: c.Version,
+			Value:   string(c.Value),
+		}
+		if c.Target == kvpb.Compare_VALUE {
+			compares[i].Target = store.CompareValue
+		}
+	}
+
+	success, err := toOps(ctx, req.Success)
+	if err != nil {
+		return nil, err
+	}
+
+	failure, err := toOps(ctx, req.Failure)
+	if err != nil {
+		return nil, err
+	}
+
+	defer store.LockKeys(append(store.OpKeys(success), store.OpKeys(failure)...)...)()
+
+	res, err := store.Txn(compares, success, failure)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	events := make([]transcationlog.Event, len(res.Applied))
+	for i, op := range res.Applied {
+		events[i] = transcationlog.Event{Key: op.Key, Value: op.Value, Principal: principalName(ctx)}
+
+		switch op.Type {
+		case store.OpPut:
+			events[i].EventType = transcationlog.EventPut
+		case store.OpDelete:
+			events[i].EventType = transcationlog.EventDelete
+		}
+	}
+
+	s.transactionLog.WriteBatch(events)
+
+	return &kvpb.TxnResponse{Succeeded: res.Succeeded, Revision: res.Revision}, nil
+}
+
+// Watch streams changes under prefix that the caller may read. If the client
+// falls too far behind, the stream ends with RESOURCE_EXHAUSTED.
+func (s *Server) Watch(req *kvpb.WatchRequest, stream kvpb.KeyValue_WatchServer) error {
+	ctx := stream.Context()
+
+	for c := range store.Watch(ctx, req.Prefix) {
+		if !auth.Allowed(ctx, c.Entry.Key, auth.PermissionRead) {
+			continue
+		}
+
+		ev := &kvpb.WatchEvent{Type: kvpb.WatchEvent_PUT, Entry: toEntry(c.Entry)}
+		if c.Type == store.ChangeDelete {
+			ev.Type = kvpb.WatchEvent_DELETE
+		}
+
+		if err := stream.Send(ev); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return status.Error(codes.ResourceExhausted, "watcher fell behind")
+}
+
+func toOps(ctx context.Context, ops []*kvpb.Op) ([]store.Op, error) {
+	res := make([]store.Op, len(ops))
+
+	for i, op := range ops {
+		if err := authorize(ctx, op.Key, auth.PermissionWrite); err != nil {
+			return nil, err
+		}
+
+		res[i] = store.Op{Type: store.OpPut, Key: op.Key, Value: string(op.Value)}
+		if op.Type == kvpb.Op_DELETE {
+			res[i].Type = store.OpDelete
+		}
+	}
+
+	return res, nil
+}
+
+func toEntry(e store.Entry) *kvpb.Entry {
+	return &kvpb.Entry{Key: e.Key, Value: []byte(e.Value), Version: e.Version}
+}
@@ -0,0 +1,34 @@
+package grpc
+
+import (
+	"cloud_native/api/grpc/kvpb"
+	"cloud_native/pkg/transcationlog"
+	grpclib "google.golang.org/grpc"
+)
+
+type TransactionLogger interface {
+	WritePut(key, value, principal string)
+	WriteDelete(key, principal string)
+	WriteBatch(events []transcationlog.Event)
+}
+
+// Server implements the KeyValue gRPC service over the same store and
+// transaction log as the REST API.
+type Server struct {
+	kvpb.UnimplementedKeyValueServer
+	transactionLog TransactionLogger
+	readOnly       bool
+}
+
+func NewServer(transactionLog TransactionLogger) *Server {
+	return &Server{transactionLog: transactionLog}
+}
+
+// ReadOnly makes the server reject writes, as on a replication follower.
+func (s *Server) ReadOnly() {
+	s.readOnly = true
+}
+
+func (s *Server) Register(g *grpclib.Server) {
+	kvpb.RegisterKeyValueServer(g, s)
+}
@@ -0,0 +1,325 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud_native/api/grpc/kvpb"
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// memLog is a TransactionLogger keeping the events in memory.
+type memLog struct {
+	m      sync.Mutex
+	events []transcationlog.Event
+}
+
+func (l *memLog) WritePut(key, value, principal string) {
+	l.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventPut, Key: key, Value: value, Principal: principal}})
+}
+
+func (l *memLog) WriteDelete(key, principal string) {
+	l.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventDelete, Key: key, Principal: principal}})
+}
+
+func (l *memLog) WriteBatch(events []transcationlog.Event) {
+	l.m.Lock()
+	l.events = append(l.events, events...)
+	l.m.Unlock()
+}
+
+func (l *memLog) logged() []transcationlog.Event {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return append([]transcationlog.Event(nil), l.events...)
+}
+
+// newTestClient serves s on an in-memory listener, over an empty store, and
+// returns a client of it. The store is global, so tests using it must not
+// run in parallel.
+func newTestClient(t *testing.T, s *Server, opts ...grpclib.ServerOption) kvpb.KeyValueClient {
+	t.Helper()
+
+	store.Restore(nil)
+	t.Cleanup(func() { store.Restore(nil) })
+
+	lis := bufconn.Listen(1 << 20)
+	g := grpclib.NewServer(opts...)
+	s.Register(g)
+
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+
+	conn, err := grpclib.NewClient("passthrough:///bufconn",
+		grpclib.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpclib.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return kvpb.NewKeyValueClient(conn)
+}
+
+func wantCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != want {
+		t.Fatalf("error %v has code %v, want %v", err, got, want)
+	}
+}
+
+func TestGetPutDelete(t *testing.T) {
+	log := &memLog{}
+	c := newTestClient(t, NewServer(log))
+	ctx := t.Context()
+
+	put, err := c.Put(ctx, &kvpb.PutRequest{Key: "a", Value: []byte("1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get(ctx, &kvpb.GetRequest{Key: "a"})
+	if err != nil || string(got.Entry.Value) != "1" || got.Entry.Version != put.Version {
+		t.Fatalf("Get() = %v, %v, want 1 at version %d", got, err, put.Version)
+	}
+
+	if _, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Get(ctx, &kvpb.GetRequest{Key: "a"})
+	wantCode(t, err, codes.NotFound)
+
+	_, err = c.Put(ctx, &kvpb.PutRequest{Key: "", Value: []byte("1")})
+	wantCode(t, err, codes.InvalidArgument)
+
+	events := log.logged()
+	if len(events) != 2 || events[0].EventType != transcationlog.EventPut || events[1].EventType != transcationlog.EventDelete {
+		t.Fatalf("logged %+v, want the put and the delete", events)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	log := &memLog{}
+	c := newTestClient(t, NewServer(log))
+	ctx := t.Context()
+
+	put, err := c.Put(ctx, &kvpb.PutRequest{Key: "a", Value: []byte("1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare-and-swap on the version: the first succeeds, a second with
+	// the same version runs the failure branch.
+	casTxn := &kvpb.TxnRequest{
+		Compare: []*kvpb.Compare{{Key: "a", Target: kvpb.Compare_VERSION, Version: put.Version}},
+		Success: []*kvpb.Op{{Type: kvpb.Op_PUT, Key: "a", Value: []byte("2")}, {Type: kvpb.Op_DELETE, Key: "b"}},
+		Failure: []*kvpb.Op{{Type: kvpb.Op_PUT, Key: "conflict", Value: []byte("1")}},
+	}
+
+	res, err := c.Txn(ctx, casTxn)
+	if err != nil || !res.Succeeded {
+		t.Fatalf("Txn() = %v, %v, want it to succeed", res, err)
+	}
+
+	res, err = c.Txn(ctx, casTxn)
+	if err != nil || res.Succeeded {
+		t.Fatalf("Txn() on a stale version = %v, %v, want the failure branch", res, err)
+	}
+
+	value, err := c.Get(ctx, &kvpb.GetRequest{Key: "a"})
+	if err != nil || string(value.Entry.Value) != "2" {
+		t.Fatalf("Get() = %v, %v, want 2", value, err)
+	}
+
+	// Only the ops applied are logged: deleting the missing b was not.
+	var keys []string
+	for _, e := range log.logged() {
+		keys = append(keys, e.Key)
+	}
+	if fmt.Sprint(keys) != "[a a conflict]" {
+		t.Fatalf("logged writes to %v, want [a a conflict]", keys)
+	}
+
+	_, err = c.Txn(ctx, &kvpb.TxnRequest{Success: []*kvpb.Op{{Type: kvpb.Op_PUT, Key: ""}}})
+	wantCode(t, err, codes.InvalidArgument)
+}
+
+func TestWatch(t *testing.T) {
+	c := newTestClient(t, NewServer(&memLog{}))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	stream, err := c.Watch(ctx, &kvpb.WatchRequest{Prefix: "w/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server starts watching once the handler runs, which the client
+	// cannot tell: write a marker until the stream sees it.
+	seen := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-seen:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			c.Put(ctx, &kvpb.PutRequest{Key: "w/first", Value: []byte("1")})
+		}
+	}()
+
+	ev, err := stream.Recv()
+	close(seen)
+	if err != nil || ev.Entry.Key != "w/first" {
+		t.Fatalf("Recv() = %v, %v, want the put of w/first", ev, err)
+	}
+
+	for _, req := range []*kvpb.PutRequest{{Key: "other", Value: []byte("1")}, {Key: "w/a", Value: []byte("1")}} {
+		if _, err = c.Put(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: "w/a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A last marker may still be in flight.
+	var got []string
+	for len(got) < 2 {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Entry.Key == "w/first" {
+			continue
+		}
+		got = append(got, fmt.Sprintf("%v %s", ev.Type, ev.Entry.Key))
+	}
+
+	if fmt.Sprint(got) != "[PUT w/a DELETE w/a]" {
+		t.Fatalf("watched %v, want the put and delete of w/a only", got)
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{store.ErrNoSuchKey, codes.NotFound},
+		{store.ErrEmptyKey, codes.InvalidArgument},
+		{store.ErrKeyTooLong, codes.InvalidArgument},
+		{store.ErrInvalidTxn, codes.InvalidArgument},
+		{store.ErrValueTooLarge, codes.ResourceExhausted},
+		{store.ErrStoreFull, codes.ResourceExhausted},
+		{auth.ErrNoCredentials, codes.Unauthenticated},
+		{fmt.Errorf("%w: expired", auth.ErrInvalidCredentials), codes.Unauthenticated},
+		{auth.ErrForbidden, codes.PermissionDenied},
+		{errors.New("anything else"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		if got := status.Code(toStatus(tt.err)); got != tt.want {
+			t.Errorf("toStatus(%v) has code %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	log := &memLog{}
+	c := newTestClient(t, NewServer(log), AuthInterceptors(
+		auth.APIKeys{"writer-key": "writer", "reader-key": "reader"},
+		auth.Policy{
+			{Principal: "writer", Prefix: "jobs/", Permission: auth.PermissionWrite},
+			{Principal: "reader", Prefix: "jobs/public/", Permission: auth.PermissionRead},
+		},
+	)...)
+
+	as := func(apiKey string) context.Context {
+		return metadata.AppendToOutgoingContext(t.Context(), "x-api-key", apiKey)
+	}
+
+	_, err := c.Get(t.Context(), &kvpb.GetRequest{Key: "jobs/1"})
+	wantCode(t, err, codes.Unauthenticated)
+
+	_, err = c.Get(as("guess"), &kvpb.GetRequest{Key: "jobs/1"})
+	wantCode(t, err, codes.Unauthenticated)
+
+	stream, err := c.Watch(as("guess"), &kvpb.WatchRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	wantCode(t, err, codes.Unauthenticated)
+
+	for _, key := range []string{"jobs/1", "jobs/public/1"} {
+		if _, err = c.Put(as("writer-key"), &kvpb.PutRequest{Key: key, Value: []byte("v")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = c.Put(as("writer-key"), &kvpb.PutRequest{Key: "other", Value: []byte("v")})
+	wantCode(t, err, codes.PermissionDenied)
+
+	_, err = c.Put(as("reader-key"), &kvpb.PutRequest{Key: "jobs/public/1", Value: []byte("v")})
+	wantCode(t, err, codes.PermissionDenied)
+
+	_, err = c.Txn(as("reader-key"), &kvpb.TxnRequest{Compare: []*kvpb.Compare{{Key: "jobs/1"}}})
+	wantCode(t, err, codes.PermissionDenied)
+
+	// List leaves out the entries the caller may not read.
+	list, err := c.List(as("reader-key"), &kvpb.ListRequest{Prefix: "jobs/"})
+	if err != nil || len(list.Entries) != 1 || list.Entries[0].Key != "jobs/public/1" {
+		t.Fatalf("List() = %v, %v, want jobs/public/1 only", list, err)
+	}
+
+	if events := log.logged(); len(events) != 2 || events[0].Principal != "writer" {
+		t.Fatalf("logged %+v, want the two writes by writer", events)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := NewServer(&memLog{})
+	s.ReadOnly()
+	c := newTestClient(t, s)
+	ctx := t.Context()
+
+	if err := store.Put("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.Put(ctx, &kvpb.PutRequest{Key: "a", Value: []byte("2")})
+	wantCode(t, err, codes.FailedPrecondition)
+
+	_, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: "a"})
+	wantCode(t, err, codes.FailedPrecondition)
+
+	_, err = c.Txn(ctx, &kvpb.TxnRequest{Success: []*kvpb.Op{{Type: kvpb.Op_DELETE, Key: "a"}}})
+	wantCode(t, err, codes.FailedPrecondition)
+
+	// Reads, and transactions that only compare, are served.
+	if _, err = c.Get(ctx, &kvpb.GetRequest{Key: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := c.Txn(ctx, &kvpb.TxnRequest{Compare: []*kvpb.Compare{{Key: "a", Target: kvpb.Compare_VALUE, Value: []byte("1")}}}); err != nil || !res.Succeeded {
+		t.Fatalf("comparing Txn() on a read-only server = %v, %v, want it to succeed", res, err)
+	}
+}
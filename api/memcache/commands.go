@@ -0,0 +1,380 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+// dispatch runs one command line and reports whether the client quit.
+func (s *Server) dispatch(r *bufio.Reader, w *bufio.Writer, line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		w.WriteString("ERROR\r\n")
+		return false
+	}
+
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "get", "gets":
+		s.get(w, args, name == "gets")
+	case "set", "add", "replace", "cas":
+		return s.store(r, w, name, args)
+	case "delete":
+		s.delete(w, args)
+	case "incr", "decr":
+		s.incr(w, args, name == "decr")
+	case "touch":
+		s.touch(w, args)
+	case "version":
+		w.WriteString("VERSION 1.6.21\r\n")
+	case "verbosity":
+		w.WriteString("OK\r\n")
+	case "quit":
+		return true
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+
+	return false
+}
+
+func clientError(w *bufio.Writer, err error) {
+	w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+}
+
+func serverError(w *bufio.Writer, err error) {
+	w.WriteString("SERVER_ERROR " + err.Error() + "\r\n")
+}
+
+// writable replies with an error if the server is a read-only follower.
+func (s *Server) writable(w *bufio.Writer) bool {
+	if s.readOnly {
+		serverError(w, errors.New("read-only replica"))
+		return false
+	}
+
+	return true
+}
+
+func reply(w *bufio.Writer, quiet bool, msg string) {
+	if !quiet {
+		w.WriteString(msg + "\r\n")
+	}
+}
+
+func (s *Server) principal() string {
+	p, _ := auth.PrincipalFrom(s.ctx)
+	return p.Name
+}
+
+func (s *Server) get(w *bufio.Writer, keys []string, withCAS bool) {
+	if len(keys) == 0 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+
+	for _, k := range keys {
+		if !validKey(k) {
+			clientError(w, errBadFormat)
+			return
+		}
+	}
+
+	for _, k := range keys {
+		if !auth.Allowed(s.ctx, k, auth.PermissionRead) {
+			continue // memcached has no notion of forbidden; treat as a miss
+		}
+
+		e, err := store.GetEntry(k)
+		if err != nil {
+			continue
+		}
+
+		w.WriteString("VALUE " + k + " " + strconv.FormatUint(uint64(e.Flags), 10) + " " + strconv.Itoa(len(e.Value)))
+		if withCAS {
+			w.WriteString(" " + strconv.FormatUint(e.Version, 10))
+		}
+		w.WriteString("\r\n" + e.Value + "\r\n")
+	}
+
+	w.WriteString("END\r\n")
+}
+
+func exists(key string) bool {
+	_, err := store.GetEntry(key)
+	return err == nil
+}
+
+// store handles set, add, replace and cas, and reports whether the client
+// must be disconnected, after a data block too large to skip:
+//
+//	<cmd> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+func (s *Server) store(r *bufio.Reader, w *bufio.Writer, name string, args []string) bool {
+	args, quiet := noreply(args)
+
+	want := 4
+	if name == "cas" {
+		want = 5
+	}
+	if len(args) != want || !validKey(args[0]) {
+		clientError(w, errBadFormat)
+		return false
+	}
+
+	key := args[0]
+	flags, err1 := parseUint(args[1], 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	size, err3 := strconv.Atoi(args[3])
+
+	var casUnique uint64
+	var err4 error
+	if name == "cas" {
+		casUnique, err4 = parseUint(args[4], 64)
+	}
+
+	if err := errors.Join(err1, err2, err3, err4); err != nil || size < 0 {
+		clientError(w, errBadFormat)
+		return false
+	}
+
+	limit := int64(maxItemSize)
+	if max := store.CurrentLimits().MaxValueSize; max > 0 && max < limit {
+		limit = max
+	}
+
+	if int64(size) > limit {
+		serverError(w, errors.New("object too large for cache"))
+		if size > maxItemSize {
+			return true
+		}
+
+		// Swallow the data block to stay in sync with the client.
+		io.CopyN(io.Discard, r, int64(size)+2)
+		return false
+	}
+
+	value, err := readData(r, size)
+	if err != nil {
+		clientError(w, err)
+		return false
+	}
+
+	if !s.writable(w) {
+		return false
+	}
+
+	if !auth.Allowed(s.ctx, key, auth.PermissionWrite) {
+		serverError(w, auth.ErrForbidden)
+		return false
+	}
+
+	// No entry has version 0, which the store takes to mean absent.
+	if name == "cas" && casUnique == 0 {
+		if exists(key) {
+			reply(w, quiet, "EXISTS")
+		} else {
+			reply(w, quiet, "NOT_FOUND")
+		}
+		return false
+	}
+
+	var compares []store.Compare
+	switch name {
+	case "add":
+		compares = []store.Compare{{Key: key, Target: store.CompareVersion, Version: 0}}
+	case "replace":
+		compares = []store.Compare{{Key: key, Target: store.CompareExists}}
+	case "cas":
+		compares = []store.Compare{{Key: key, Target: store.CompareVersion, Version: casUnique}}
+	}
+
+	op := store.Op{Type: store.OpPut, Key: key, Value: value, ExpiresAt: expiresAt(exptime), Flags: uint32(flags)}
+
+	// Hold the key until the write is logged, so the log sees concurrent
+	// writes in the store's order.
+	defer store.LockKeys(key)()
+
+	res, err := store.Txn(compares, []store.Op{op}, nil)
+	if err != nil {
+		serverError(w, err)
+		return false
+	}
+
+	if !res.Succeeded {
+		switch {
+		case name != "cas":
+			reply(w, quiet, "NOT_STORED")
+		case !exists(key):
+			reply(w, quiet, "NOT_FOUND")
+		default:
+			reply(w, quiet, "EXISTS")
+		}
+		return false
+	}
+
+	s.transactionLog.WriteBatch(transcationlog.PutEvents(key, value, op.ExpiresAt, op.Flags, s.principal()))
+
+	reply(w, quiet, "STORED")
+
+	return false
+}
+
+// delete handles "delete <key> [0] [noreply]".
+func (s *Server) delete(w *bufio.Writer, args []string) {
+	args, quiet := noreply(args)
+
+	if len(args) == 2 && args[1] == "0" {
+		args = args[:1]
+	}
+	if len(args) != 1 || !validKey(args[0]) {
+		clientError(w, errBadFormat)
+		return
+	}
+
+	key := args[0]
+
+	if !s.writable(w) {
+		return
+	}
+
+	if !auth.Allowed(s.ctx, key, auth.PermissionWrite) {
+		serverError(w, auth.ErrForbidden)
+		return
+	}
+
+	defer store.LockKeys(key)()
+
+	res, err := store.Txn(nil, []store.Op{{Type: store.OpDelete, Key: key}}, nil)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	if len(res.Applied) == 0 {
+		reply(w, quiet, "NOT_FOUND")
+		return
+	}
+
+	s.transactionLog.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventDelete, Key: key, Principal: s.principal()}})
+
+	reply(w, quiet, "DELETED")
+}
+
+// incr handles "incr|decr <key> <delta> [noreply]". Values are unsigned 64-bit
+// integers: incr wraps around, decr stops at 0.
+func (s *Server) incr(w *bufio.Writer, args []string, decr bool) {
+	args, quiet := noreply(args)
+
+	if len(args) != 2 || !validKey(args[0]) {
+		clientError(w, errBadFormat)
+		return
+	}
+
+	key := args[0]
+
+	delta, err := parseUint(args[1], 64)
+	if err != nil {
+		clientError(w, errors.New("invalid numeric delta argument"))
+		return
+	}
+
+	if !s.writable(w) {
+		return
+	}
+
+	if !auth.Allowed(s.ctx, key, auth.PermissionWrite) {
+		serverError(w, auth.ErrForbidden)
+		return
+	}
+
+	defer store.LockKeys(key)()
+
+	// Retry until no other write slips in between reading and writing.
+	for {
+		e, err := store.GetEntry(key)
+		if err != nil {
+			reply(w, quiet, "NOT_FOUND")
+			return
+		}
+
+		n, err := parseUint(e.Value, 64)
+		if err != nil {
+			clientError(w, errors.New("cannot increment or decrement non-numeric value"))
+			return
+		}
+
+		switch {
+		case !decr:
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+
+		value := strconv.FormatUint(n, 10)
+		op := store.Op{Type: store.OpPut, Key: key, Value: value, ExpiresAt: e.ExpiresAt, Flags: e.Flags}
+
+		res, err := store.Txn([]store.Compare{{Key: key, Target: store.CompareVersion, Version: e.Version}}, []store.Op{op}, nil)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		if !res.Succeeded {
+			continue
+		}
+
+		s.transactionLog.WriteBatch(transcationlog.PutEvents(key, value, e.ExpiresAt, e.Flags, s.principal()))
+
+		reply(w, quiet, value)
+		return
+	}
+}
+
+// touch handles "touch <key> <exptime> [noreply]".
+func (s *Server) touch(w *bufio.Writer, args []string) {
+	args, quiet := noreply(args)
+
+	if len(args) != 2 || !validKey(args[0]) {
+		clientError(w, errBadFormat)
+		return
+	}
+
+	key := args[0]
+
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		clientError(w, errBadFormat)
+		return
+	}
+
+	if !s.writable(w) {
+		return
+	}
+
+	if !auth.Allowed(s.ctx, key, auth.PermissionWrite) {
+		serverError(w, auth.ErrForbidden)
+		return
+	}
+
+	at := expiresAt(exptime)
+
+	defer store.LockKeys(key)()
+
+	if err = store.Expire(key, at); err != nil {
+		reply(w, quiet, "NOT_FOUND")
+		return
+	}
+
+	s.transactionLog.WriteBatch([]transcationlog.Event{transcationlog.ExpireEvent(key, at, s.principal())})
+
+	reply(w, quiet, "TOUCHED")
+}
@@ -0,0 +1,106 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxLineLength = 2048
+	maxKeyLength  = 250
+
+	// maxItemSize caps data blocks whatever the store limits, like
+	// memcached's default item size, since they are read before the
+	// command is authorized.
+	maxItemSize = 1 << 20
+
+	// Expiration times beyond 30 days are absolute Unix timestamps.
+	relativeExpiryLimit = 60 * 60 * 24 * 30
+)
+
+var (
+	errLineTooLong = errors.New("line too long")
+	errBadFormat   = errors.New("bad command line format")
+	errBadChunk    = errors.New("bad data chunk")
+)
+
+func readLine(r *bufio.Reader) (string, error) {
+	var b []byte
+
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+
+		b = append(b, chunk...)
+		if len(b) > maxLineLength {
+			return "", errLineTooLong
+		}
+
+		if !isPrefix {
+			return string(b), nil
+		}
+	}
+}
+
+// readData reads a data block of n bytes terminated by CRLF.
+func readData(r *bufio.Reader, n int) (string, error) {
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+
+	if b[n] != '\r' || b[n+1] != '\n' {
+		return "", errBadChunk
+	}
+
+	return string(b[:n]), nil
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expiresAt converts a memcached exptime: 0 never expires, up to 30 days is
+// relative to now, larger values are Unix timestamps and negative values are
+// already expired.
+func expiresAt(exptime int64) time.Time {
+	switch {
+	case exptime == 0:
+		return time.Time{}
+	case exptime < 0:
+		return time.Now()
+	case exptime <= relativeExpiryLimit:
+		return time.Now().Add(time.Duration(exptime) * time.Second)
+	default:
+		return time.Unix(exptime, 0)
+	}
+}
+
+// noreply strips a trailing "noreply" from the arguments.
+func noreply(args []string) ([]string, bool) {
+	if n := len(args); n > 0 && args[n-1] == "noreply" {
+		return args[:n-1], true
+	}
+
+	return args, false
+}
+
+func parseUint(s string, bits int) (uint64, error) {
+	return strconv.ParseUint(strings.TrimSpace(s), 10, bits)
+}
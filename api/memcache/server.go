@@ -0,0 +1,92 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/transcationlog"
+)
+
+type TransactionLogger interface {
+	WriteBatch(events []transcationlog.Event)
+}
+
+// Server speaks the memcached ASCII protocol, backed by the key-value store.
+// CAS uniques are the store's entry versions.
+type Server struct {
+	transactionLog TransactionLogger
+	ctx            context.Context
+	readOnly       bool
+}
+
+func NewServer(transactionLog TransactionLogger) *Server {
+	return &Server{transactionLog: transactionLog, ctx: context.Background()}
+}
+
+// ActAs authorizes every command as principal under policy. The ASCII
+// protocol has no authentication, so a listener exposed while authentication
+// is enabled must be tied to a principal with suitably narrow grants.
+func (s *Server) ActAs(principal string, policy auth.Policy) {
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Name: principal, Method: "memcache"})
+	s.ctx = auth.WithPolicy(ctx, policy)
+}
+
+// ReadOnly makes the server reject writes, as on a replication follower.
+func (s *Server) ReadOnly() {
+	s.readOnly = true
+}
+
+func (s *Server) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer nc.Close()
+
+	// A bug in one command must not take down the other connections.
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("memcache: %s: panic: %v", nc.RemoteAddr(), err)
+		}
+	}()
+
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				w.WriteString("CLIENT_ERROR line too long\r\n")
+				w.Flush()
+			} else if !errors.Is(err, io.EOF) {
+				log.Printf("memcache: %s: %v", nc.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if quit := s.dispatch(r, w, line); quit {
+			w.Flush()
+			return
+		}
+
+		// Pipelined commands are answered together.
+		if r.Buffered() == 0 {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
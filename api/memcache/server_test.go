@@ -0,0 +1,263 @@
+package memcache
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+// memLog is a TransactionLogger keeping the events in memory.
+type memLog struct {
+	m      sync.Mutex
+	events []transcationlog.Event
+}
+
+func (l *memLog) WriteBatch(events []transcationlog.Event) {
+	l.m.Lock()
+	l.events = append(l.events, events...)
+	l.m.Unlock()
+}
+
+func (l *memLog) logged() []transcationlog.Event {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return append([]transcationlog.Event(nil), l.events...)
+}
+
+// newTestServer returns a server on an empty store with the given limits,
+// which are restored to the defaults when the test ends. The store is
+// global, so tests using it must not run in parallel.
+func newTestServer(t *testing.T, limits store.Limits) (*Server, *memLog) {
+	t.Helper()
+
+	store.Restore(nil)
+	store.SetLimits(limits)
+
+	t.Cleanup(func() {
+		store.Restore(nil)
+		store.SetLimits(store.Limits{MaxKeyLength: store.DefaultMaxKeyLength, MaxValueSize: store.DefaultMaxValueSize})
+	})
+
+	log := &memLog{}
+
+	return NewServer(log), log
+}
+
+// client talks to a server over an in-memory connection.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, s *Server) *client {
+	t.Helper()
+
+	cc, sc := net.Pipe()
+	go s.serveConn(sc)
+	t.Cleanup(func() { cc.Close() })
+
+	return &client{t: t, conn: cc, r: bufio.NewReader(cc)}
+}
+
+func (c *client) send(request string) {
+	c.t.Helper()
+
+	if _, err := io.WriteString(c.conn, request); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// line reads one reply line, without its CRLF.
+func (c *client) line() string {
+	c.t.Helper()
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// expect sends request, which may hold several commands, and checks the
+// reply lines.
+func (c *client) expect(request string, want ...string) {
+	c.t.Helper()
+
+	c.send(request)
+	for _, w := range want {
+		if got := c.line(); got != w {
+			c.t.Fatalf("%q: got %q, want %q", request, got, w)
+		}
+	}
+}
+
+func TestStorageCommands(t *testing.T) {
+	s, _ := newTestServer(t, store.Limits{})
+	c := dial(t, s)
+
+	c.expect("set k 5 0 1\r\na\r\n", "STORED")
+	c.expect("get k missing\r\n", "VALUE k 5 1", "a", "END")
+
+	c.expect("add k 0 0 1\r\nb\r\n", "NOT_STORED")
+	c.expect("add n 0 0 1\r\nb\r\n", "STORED")
+	c.expect("replace missing 0 0 1\r\nc\r\n", "NOT_STORED")
+	c.expect("replace k 7 0 1\r\nc\r\n", "STORED")
+	c.expect("get k\r\n", "VALUE k 7 1", "c", "END")
+
+	// The CAS unique is the entry's version.
+	e, err := store.GetEntry("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cas := " " + strconv.FormatUint(e.Version, 10)
+
+	c.expect("gets k\r\n", "VALUE k 7 1"+cas, "c", "END")
+	c.expect("cas k 0 0 1"+cas+"\r\nd\r\n", "STORED")
+	c.expect("cas k 0 0 1"+cas+"\r\ne\r\n", "EXISTS")
+	c.expect("cas missing 0 0 1 1\r\ne\r\n", "NOT_FOUND")
+	c.expect("cas k 0 0 1 0\r\ne\r\n", "EXISTS")
+	c.expect("get k\r\n", "VALUE k 0 1", "d", "END")
+
+	c.expect("delete k\r\n", "DELETED")
+	c.expect("delete k 0\r\n", "NOT_FOUND")
+	c.expect("get k\r\n", "END")
+
+	c.expect("set k 0 0 x\r\n", "CLIENT_ERROR bad command line format")
+	c.expect("set k 0 0\r\n", "CLIENT_ERROR bad command line format")
+	c.expect("get\r\n", "ERROR")
+	c.expect("bogus\r\n", "ERROR")
+	c.expect("version\r\n", "VERSION 1.6.21")
+}
+
+func TestIncrDecr(t *testing.T) {
+	s, log := newTestServer(t, store.Limits{})
+	c := dial(t, s)
+
+	c.expect("incr n 1\r\n", "NOT_FOUND")
+	c.expect("set n 3 0 2\r\n10\r\n", "STORED")
+	c.expect("incr n 5\r\n", "15")
+	c.expect("decr n 20\r\n", "0")
+	c.expect("set max 0 0 20\r\n18446744073709551615\r\n", "STORED")
+	c.expect("incr max 2\r\n", "1")
+	c.expect("incr n x\r\n", "CLIENT_ERROR invalid numeric delta argument")
+	c.expect("set s 0 0 1\r\nx\r\n", "STORED")
+	c.expect("incr s 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+
+	// Flags survive the increments.
+	c.expect("get n\r\n", "VALUE n 3 1", "0", "END")
+
+	var values []string
+	for _, e := range log.logged() {
+		if e.EventType == transcationlog.EventPut && e.Key == "n" {
+			values = append(values, e.Value)
+		}
+	}
+	if got := strings.Join(values, " "); got != "10 15 0" {
+		t.Fatalf("logged n = %q, want %q", got, "10 15 0")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	s, log := newTestServer(t, store.Limits{})
+	c := dial(t, s)
+
+	c.expect("touch k 100\r\n", "NOT_FOUND")
+	c.expect("set k 0 100\r\n", "CLIENT_ERROR bad command line format")
+	c.expect("set k 0 0 1\r\na\r\n", "STORED")
+	c.expect("touch k 100\r\n", "TOUCHED")
+
+	e, err := store.GetEntry("k")
+	if err != nil || e.ExpiresAt.IsZero() {
+		t.Fatalf("k = %+v, %v after touch, want an expiry", e, err)
+	}
+
+	// A negative expiry expires the key at once.
+	c.expect("touch k -1\r\n", "TOUCHED")
+	c.expect("get k\r\n", "END")
+
+	if events := log.logged(); len(events) != 3 || events[2].EventType != transcationlog.EventExpire {
+		t.Fatalf("logged %+v, want the put and both expiries", events)
+	}
+}
+
+func TestNoreply(t *testing.T) {
+	s, _ := newTestServer(t, store.Limits{})
+	c := dial(t, s)
+
+	// Quiet commands reply nothing, so the next reply is the version's.
+	c.expect("set k 0 0 1 noreply\r\na\r\n"+
+		"add k 0 0 1 noreply\r\nb\r\n"+
+		"set n 0 0 1 noreply\r\n1\r\n"+
+		"incr n 1 noreply\r\n"+
+		"touch k 100 noreply\r\n"+
+		"delete missing noreply\r\n"+
+		"version\r\n", "VERSION 1.6.21")
+
+	c.expect("get k n\r\n", "VALUE k 0 1", "a", "VALUE n 0 1", "2", "END")
+
+	// Errors are still reported.
+	c.expect("set k 0 0 x noreply\r\n", "CLIENT_ERROR bad command line format")
+}
+
+func TestOversizedValue(t *testing.T) {
+	s, _ := newTestServer(t, store.Limits{MaxValueSize: 4})
+	c := dial(t, s)
+
+	// A block over the store's limit is skipped, and the connection stays in
+	// sync for the next command.
+	c.expect("set k 0 0 10\r\n0123456789\r\nset k 0 0 4\r\n0123\r\n", "SERVER_ERROR object too large for cache", "STORED")
+	c.expect("get k\r\n", "VALUE k 0 4", "0123", "END")
+
+	// One over the item size is not read at all: the client is disconnected.
+	c.expect("set k 0 0 1048577\r\n", "SERVER_ERROR object too large for cache")
+	if _, err := c.r.ReadString('\n'); err != io.EOF {
+		t.Fatalf("read after an oversized block = %v, want EOF", err)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	s, log := newTestServer(t, store.Limits{})
+	s.ActAs("cache", auth.Policy{
+		{Principal: "cache", Prefix: "mine-", Permission: auth.PermissionWrite},
+		{Principal: "cache", Prefix: "shared-", Permission: auth.PermissionRead},
+	})
+
+	if err := store.Put("shared-1", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("other", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := dial(t, s)
+	c.expect("set mine-1 0 0 1\r\na\r\n", "STORED")
+	c.expect("set shared-1 0 0 1\r\na\r\n", "SERVER_ERROR "+auth.ErrForbidden.Error())
+	c.expect("delete shared-1\r\n", "SERVER_ERROR "+auth.ErrForbidden.Error())
+	// Unreadable keys look missing.
+	c.expect("get mine-1 shared-1 other\r\n", "VALUE mine-1 0 1", "a", "VALUE shared-1 0 1", "v", "END")
+
+	if events := log.logged(); len(events) != 1 || events[0].Principal != "cache" {
+		t.Fatalf("logged %+v, want only the put of mine-1, by cache", events)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s, _ := newTestServer(t, store.Limits{})
+	s.ReadOnly()
+
+	c := dial(t, s)
+	c.expect("set k 0 0 1\r\na\r\n", "SERVER_ERROR read-only replica")
+	c.expect("incr k 1\r\n", "SERVER_ERROR read-only replica")
+	c.expect("get k\r\n", "END")
+}
@@ -0,0 +1,521 @@
+package resp
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+type command struct {
+	arity  int // exact number of arguments including the name; negative means at least -arity
+	noAuth bool
+	write  bool
+	run    func(s *Server, c *conn, args []string)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":    {arity: -1, noAuth: true, run: (*Server).ping},
+		"HELLO":   {arity: -1, noAuth: true, run: (*Server).hello},
+		"AUTH":    {arity: -2, noAuth: true, run: (*Server).auth},
+		"QUIT":    {arity: 1, noAuth: true, run: (*Server).quit},
+		"SELECT":  {arity: 2, run: (*Server).selectDB},
+		"CLIENT":  {arity: -2, run: (*Server).client},
+		"COMMAND": {arity: -1, run: (*Server).command},
+		"GET":     {arity: 2, run: (*Server).get},
+		"SET":     {arity: -3, write: true, run: (*Server).set},
+		"DEL":     {arity: -2, write: true, run: (*Server).del},
+		"EXISTS":  {arity: -2, run: (*Server).exists},
+		"MGET":    {arity: -2, run: (*Server).mget},
+		"MSET":    {arity: -3, write: true, run: (*Server).mset},
+		"SCAN":    {arity: -2, run: (*Server).scan},
+		"EXPIRE":  {arity: 3, write: true, run: (*Server).expire},
+		"TTL":     {arity: 2, run: (*Server).ttl},
+		"INCR":    {arity: 2, write: true, run: (*Server).incr},
+	}
+}
+
+func (s *Server) dispatch(c *conn, args []string) {
+	name := strings.ToUpper(args[0])
+
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.error("ERR unknown command '" + args[0] + "'")
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.w.error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return
+	}
+
+	if !cmd.noAuth && !s.authenticated(c) {
+		c.w.error("NOAUTH Authentication required.")
+		return
+	}
+
+	if cmd.write && s.readOnly {
+		c.w.error("READONLY You can't write against a read only replica.")
+		return
+	}
+
+	cmd.run(s, c, args[1:])
+}
+
+// allowed checks the permission on every key and replies NOPERM if any is
+// denied, as Redis ACLs do.
+func (s *Server) allowed(c *conn, perm auth.Permission, keys ...string) bool {
+	for _, k := range keys {
+		if !auth.Allowed(c.ctx, k, perm) {
+			c.w.error("NOPERM this user has no permissions to access the '" + k + "' key")
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Server) principal(c *conn) string {
+	p, _ := auth.PrincipalFrom(c.ctx)
+	return p.Name
+}
+
+func (s *Server) storeError(c *conn, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotInteger):
+		c.w.error("ERR value is not an integer or out of range")
+	case errors.Is(err, store.ErrOverflow):
+		c.w.error("ERR increment or decrement would overflow")
+	default:
+		c.w.error("ERR " + err.Error())
+	}
+}
+
+func (s *Server) ping(c *conn, args []string) {
+	switch len(args) {
+	case 0:
+		c.w.simple("PONG")
+	case 1:
+		c.w.bulk(args[0])
+	default:
+		c.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) hello(c *conn, args []string) {
+	proto := c.w.proto
+
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < 2 || v > 3 {
+			c.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = v
+	}
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				c.w.error("ERR syntax error")
+				return
+			}
+			if !s.tryLogin(c, args[i+2]) {
+				return
+			}
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				c.w.error("ERR syntax error")
+				return
+			}
+			i++
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	if !s.authenticated(c) {
+		c.w.error("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+
+	c.w.proto = proto
+
+	c.w.mapHeader(7)
+	c.w.bulk("server")
+	c.w.bulk("redis")
+	c.w.bulk("version")
+	c.w.bulk("7.0.0")
+	c.w.bulk("proto")
+	c.w.integer(int64(proto))
+	c.w.bulk("id")
+	c.w.integer(0)
+	c.w.bulk("mode")
+	c.w.bulk("standalone")
+	c.w.bulk("role")
+	c.w.bulk("master")
+	c.w.bulk("modules")
+	c.w.array(0)
+}
+
+func (s *Server) auth(c *conn, args []string) {
+	if len(args) > 2 {
+		c.w.error("ERR syntax error")
+		return
+	}
+
+	if s.authenticator == nil {
+		c.w.error("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+
+	if s.tryLogin(c, args[len(args)-1]) {
+		c.w.simple("OK")
+	}
+}
+
+func (s *Server) tryLogin(c *conn, password string) bool {
+	if s.authenticator == nil {
+		return true
+	}
+
+	if err := s.login(c, password); err != nil {
+		c.w.error("WRONGPASS invalid username-password pair or user is disabled.")
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) quit(c *conn, args []string) {
+	c.w.simple("OK")
+	c.quit = true
+}
+
+func (s *Server) selectDB(c *conn, args []string) {
+	if args[0] != "0" {
+		c.w.error("ERR DB index is out of range")
+		return
+	}
+
+	c.w.simple("OK")
+}
+
+// client accepts CLIENT SETNAME, SETINFO and friends, which client libraries
+// send on connect, without acting on them.
+func (s *Server) client(c *conn, args []string) {
+	c.w.simple("OK")
+}
+
+// command replies with no command docs; redis-cli copes and skips its hints.
+func (s *Server) command(c *conn, args []string) {
+	c.w.array(0)
+}
+
+func (s *Server) get(c *conn, args []string) {
+	if !s.allowed(c, auth.PermissionRead, args[0]) {
+		return
+	}
+
+	value, err := store.Get(args[0])
+	if errors.Is(err, store.ErrNoSuchKey) {
+		c.w.null()
+		return
+	}
+	if err != nil {
+		s.storeError(c, err)
+		return
+	}
+
+	c.w.bulk(value)
+}
+
+func (s *Server) set(c *conn, args []string) {
+	key, value := args[0], args[1]
+
+	var compares []store.Compare
+	var expiresAt time.Time
+
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			compares = append(compares, store.Compare{Key: key, Target: store.CompareVersion, Version: 0})
+		case "XX":
+			compares = append(compares, store.Compare{Key: key, Target: store.CompareExists})
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				c.w.error("ERR syntax error")
+				return
+			}
+			i++
+
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n <= 0 {
+				c.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			expiresAt = time.Now().Add(time.Duration(n) * unit)
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	if len(compares) > 1 {
+		c.w.error("ERR syntax error")
+		return
+	}
+
+	if !s.allowed(c, auth.PermissionWrite, key) {
+		return
+	}
+
+	// Hold the key until the write is logged, so the log sees concurrent
+	// writes in the store's order.
+	defer store.LockKeys(key)()
+
+	res, err := store.Txn(compares, []store.Op{{Type: store.OpPut, Key: key, Value: value, ExpiresAt: expiresAt}}, nil)
+	if err != nil {
+		s.storeError(c, err)
+		return
+	}
+
+	if !res.Succeeded {
+		c.w.null()
+		return
+	}
+
+	s.transactionLog.WriteBatch(transcationlog.PutEvents(key, value, expiresAt, 0, s.principal(c)))
+
+	c.w.simple("OK")
+}
+
+func (s *Server) del(c *conn, args []string) {
+	if !s.allowed(c, auth.PermissionWrite, args...) {
+		return
+	}
+
+	ops := make([]store.Op, len(args))
+	for i, k := range args {
+		ops[i] = store.Op{Type: store.OpDelete, Key: k}
+	}
+
+	defer store.LockKeys(args...)()
+
+	res, err := store.Txn(nil, ops, nil)
+	if err != nil {
+		s.storeError(c, err)
+		return
+	}
+
+	events := make([]transcationlog.Event, len(res.Applied))
+	for i, op := range res.Applied {
+		events[i] = transcationlog.Event{EventType: transcationlog.EventDelete, Key: op.Key, Principal: s.principal(c)}
+	}
+	s.transactionLog.WriteBatch(events)
+
+	c.w.integer(int64(len(res.Applied)))
+}
+
+func (s *Server) exists(c *conn, args []string) {
+	if !s.allowed(c, auth.PermissionRead, args...) {
+		return
+	}
+
+	var n int64
+	for _, k := range args {
+		if _, err := store.GetEntry(k); err == nil {
+			n++
+		}
+	}
+
+	c.w.integer(n)
+}
+
+func (s *Server) mget(c *conn, args []string) {
+	if !s.allowed(c, auth.PermissionRead, args...) {
+		return
+	}
+
+	c.w.array(len(args))
+	for _, k := range args {
+		if value, err := store.Get(k); err == nil {
+			c.w.bulk(value)
+		} else {
+			c.w.null()
+		}
+	}
+}
+
+func (s *Server) mset(c *conn, args []string) {
+	if len(args)%2 != 0 {
+		c.w.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	ops := make([]store.Op, 0, len(args)/2)
+	events := make([]transcationlog.Event, 0, len(args)/2)
+
+	for i := 0; i < len(args); i += 2 {
+		if !s.allowed(c, auth.PermissionWrite, args[i]) {
+			return
+		}
+
+		ops = append(ops, store.Op{Type: store.OpPut, Key: args[i], Value: args[i+1]})
+		events = append(events, transcationlog.Event{EventType: transcationlog.EventPut, Key: args[i], Value: args[i+1], Principal: s.principal(c)})
+	}
+
+	defer store.LockKeys(store.OpKeys(ops)...)()
+
+	if _, err := store.Txn(nil, ops, nil); err != nil {
+		s.storeError(c, err)
+		return
+	}
+
+	s.transactionLog.WriteBatch(events)
+
+	c.w.simple("OK")
+}
+
+// scan pages through the keys in sorted order; the cursor is the index of the
+// next key. Keys the client may not read are skipped.
+func (s *Server) scan(c *conn, args []string) {
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		c.w.error("ERR invalid cursor")
+		return
+	}
+
+	pattern, count := "*", 10
+
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			c.w.error("ERR syntax error")
+			return
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				c.w.error("ERR value is not an integer or out of range")
+				return
+			}
+		case "TYPE":
+			if !strings.EqualFold(args[i+1], "string") {
+				count = 0
+			}
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+		i++
+	}
+
+	entries := store.List("")
+
+	keys := make([]string, 0, count)
+	next := cursor
+	for ; next < len(entries) && next < cursor+count; next++ {
+		k := entries[next].Key
+
+		if globMatch(pattern, k) && auth.Allowed(c.ctx, k, auth.PermissionRead) {
+			keys = append(keys, k)
+		}
+	}
+
+	if next >= len(entries) || count == 0 {
+		next = 0
+	}
+
+	c.w.array(2)
+	c.w.bulk(strconv.Itoa(next))
+	c.w.array(len(keys))
+	for _, k := range keys {
+		c.w.bulk(k)
+	}
+}
+
+func (s *Server) expire(c *conn, args []string) {
+	key := args[0]
+
+	seconds, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.w.error("ERR value is not an integer or out of range")
+		return
+	}
+
+	if !s.allowed(c, auth.PermissionWrite, key) {
+		return
+	}
+
+	at := time.Now().Add(time.Duration(seconds) * time.Second)
+
+	defer store.LockKeys(key)()
+
+	if err = store.Expire(key, at); errors.Is(err, store.ErrNoSuchKey) {
+		c.w.integer(0)
+		return
+	}
+	if err != nil {
+		s.storeError(c, err)
+		return
+	}
+
+	s.transactionLog.WriteBatch([]transcationlog.Event{transcationlog.ExpireEvent(key, at, s.principal(c))})
+
+	c.w.integer(1)
+}
+
+func (s *Server) ttl(c *conn, args []string) {
+	if !s.allowed(c, auth.PermissionRead, args[0]) {
+		return
+	}
+
+	e, err := store.GetEntry(args[0])
+	switch {
+	case err != nil:
+		c.w.integer(-2)
+	case e.ExpiresAt.IsZero():
+		c.w.integer(-1)
+	default:
+		c.w.integer(int64(time.Until(e.ExpiresAt).Round(time.Second) / time.Second))
+	}
+}
+
+func (s *Server) incr(c *conn, args []string) {
+	key := args[0]
+
+	if !s.allowed(c, auth.PermissionWrite, key) {
+		return
+	}
+
+	defer store.LockKeys(key)()
+
+	e, err := store.Incr(key, 1)
+	if err != nil {
+		s.storeError(c, err)
+		return
+	}
+
+	s.transactionLog.WriteBatch(transcationlog.PutEvents(key, e.Value, e.ExpiresAt, e.Flags, s.principal(c)))
+
+	n, _ := strconv.ParseInt(e.Value, 10, 64)
+	c.w.integer(n)
+}
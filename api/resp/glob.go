@@ -0,0 +1,109 @@
+package resp
+
+// globMatch reports whether s matches the glob pattern as Redis matches
+// SCAN and KEYS patterns: '*' matches any run of bytes, '/' included, '?'
+// any single byte, [abc], [^abc] and [a-z] a byte from a set, and '\'
+// escapes the next byte.
+func globMatch(pattern, s string) bool {
+	// On a mismatch, retry from the last '*', letting it eat one more byte.
+	starP, starS := -1, 0
+
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch c := pattern[p]; c {
+			case '*':
+				starP, starS = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if n, ok := matchClass(pattern[p:], s[i]); n > 0 {
+					if ok {
+						p += n
+						i++
+						continue
+					}
+					break
+				}
+				// An unterminated '[' is a literal.
+				if s[i] == '[' {
+					p++
+					i++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) {
+					c = pattern[p+1]
+					if s[i] == c {
+						p += 2
+						i++
+						continue
+					}
+					break
+				}
+				fallthrough
+			default:
+				if s[i] == c {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, i = starP+1, starS
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchClass matches b against the class at the start of pattern, which
+// begins with '['. It returns the length of the class, or 0 if it is not
+// terminated by ']'.
+func matchClass(pattern string, b byte) (int, bool) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+
+	matched := false
+	for ; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch {
+		case c == ']':
+			return i + 1, matched != negate
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == b {
+				matched = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			lo, hi := c, pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if lo <= b && b <= hi {
+				matched = true
+			}
+			i += 2
+		case c == b:
+			matched = true
+		}
+	}
+
+	return 0, false
+}
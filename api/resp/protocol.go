@@ -0,0 +1,174 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"cloud_native/pkg/store"
+)
+
+const (
+	maxLineLength = 64 << 10 // the Redis inline request limit
+	maxArgs       = 1 << 20
+	maxBulkSize   = 512 << 20 // the Redis default proto-max-bulk-len
+
+	// Until a client has authenticated, it can only send AUTH or HELLO, so
+	// it gets much smaller limits.
+	unauthenticatedMaxArgs     = 16
+	unauthenticatedMaxBulkSize = 4 << 10
+)
+
+// bulkLimit bounds bulk strings by the store's limits, so that oversized
+// values are refused before they are buffered.
+func bulkLimit(authenticated bool) int {
+	if !authenticated {
+		return unauthenticatedMaxBulkSize
+	}
+
+	l := store.CurrentLimits()
+
+	n := int64(l.MaxKeyLength)
+	if l.MaxValueSize > n {
+		n = l.MaxValueSize
+	}
+
+	if n <= 0 || n > maxBulkSize {
+		return maxBulkSize
+	}
+
+	return int(n)
+}
+
+var errProtocol = errors.New("protocol error")
+
+// readCommand reads a command either as a RESP array of bulk strings, as sent
+// by client libraries, or as an inline command typed into telnet.
+func readCommand(r *bufio.Reader, authenticated bool) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	limit := maxArgs
+	if !authenticated {
+		limit = unauthenticatedMaxArgs
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > limit {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	// Grown as the arguments arrive, so a large count costs nothing upfront.
+	args := make([]string, 0, min(n, 64))
+	for range n {
+		arg, err := readBulk(r, authenticated)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+func readBulk(r *bufio.Reader, authenticated bool) (string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(line, "$") {
+		return "", fmt.Errorf("%w: expected '$', got '%.1s'", errProtocol, line)
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > bulkLimit(authenticated) {
+		return "", fmt.Errorf("%w: invalid bulk length", errProtocol)
+	}
+
+	b := make([]byte, n+2)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+
+	if b[n] != '\r' || b[n+1] != '\n' {
+		return "", fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+	}
+
+	return string(b[:n]), nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	var b []byte
+
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+
+		b = append(b, chunk...)
+		if len(b) > maxLineLength {
+			return "", fmt.Errorf("%w: too big inline request", errProtocol)
+		}
+
+		if !isPrefix {
+			return string(b), nil
+		}
+	}
+}
+
+// writer encodes replies in RESP2 or, once the client has sent HELLO 3, RESP3.
+type writer struct {
+	*bufio.Writer
+	proto int
+}
+
+func (w *writer) simple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func (w *writer) error(s string) {
+	w.WriteString("-" + s + "\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w *writer) null() {
+	if w.proto >= 3 {
+		w.WriteString("_\r\n")
+		return
+	}
+
+	w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// mapHeader starts a map of n pairs; RESP2 has no maps, so it is flattened
+// into an array of 2n elements.
+func (w *writer) mapHeader(n int) {
+	if w.proto >= 3 {
+		w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+		return
+	}
+
+	w.array(2 * n)
+}
@@ -0,0 +1,127 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/transcationlog"
+)
+
+type TransactionLogger interface {
+	WritePut(key, value, principal string)
+	WriteDelete(key, principal string)
+	WriteBatch(events []transcationlog.Event)
+}
+
+// Server speaks the Redis serialization protocol (RESP2 and RESP3) for a
+// subset of Redis commands, backed by the key-value store.
+type Server struct {
+	transactionLog TransactionLogger
+
+	authenticator auth.Authenticator
+	policy        auth.Policy
+	readOnly      bool
+}
+
+func NewServer(transactionLog TransactionLogger) *Server {
+	return &Server{transactionLog: transactionLog}
+}
+
+// RequireAuth makes clients authenticate with AUTH, or HELLO ... AUTH, before
+// running any other command. The password is checked as an API key.
+func (s *Server) RequireAuth(authenticator auth.Authenticator, policy auth.Policy) {
+	s.authenticator = authenticator
+	s.policy = policy
+}
+
+// ReadOnly makes the server reject writes, as on a replication follower.
+func (s *Server) ReadOnly() {
+	s.readOnly = true
+}
+
+func (s *Server) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// conn is the per-connection state.
+type conn struct {
+	net.Conn
+	w    *writer
+	ctx  context.Context
+	quit bool
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer nc.Close()
+
+	r := bufio.NewReader(nc)
+	c := &conn{
+		Conn: nc,
+		w:    &writer{Writer: bufio.NewWriter(nc), proto: 2},
+		ctx:  context.Background(),
+	}
+
+	for !c.quit {
+		args, err := readCommand(r, s.authenticated(c))
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.w.error("ERR " + err.Error())
+				c.w.Flush()
+			} else if !errors.Is(err, io.EOF) {
+				log.Printf("resp: %s: %v", nc.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		s.dispatch(c, args)
+
+		// Pipelined commands are answered together.
+		if r.Buffered() == 0 {
+			if err = c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	c.w.Flush()
+}
+
+func (s *Server) authenticated(c *conn) bool {
+	if s.authenticator == nil {
+		return true
+	}
+
+	_, ok := auth.PrincipalFrom(c.ctx)
+	return ok
+}
+
+func (s *Server) login(c *conn, password string) error {
+	r := &http.Request{Header: make(http.Header)}
+	r.Header.Set("X-API-Key", password)
+
+	p, err := s.authenticator.Authenticate(r)
+	if err != nil {
+		return err
+	}
+
+	c.ctx = auth.WithPolicy(auth.WithPrincipal(context.Background(), p), s.policy)
+
+	return nil
+}
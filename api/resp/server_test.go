@@ -0,0 +1,373 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+// memLog is a TransactionLogger keeping the events in memory.
+type memLog struct {
+	m      sync.Mutex
+	events []transcationlog.Event
+}
+
+func (l *memLog) WritePut(key, value, principal string) {
+	l.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventPut, Key: key, Value: value, Principal: principal}})
+}
+
+func (l *memLog) WriteDelete(key, principal string) {
+	l.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventDelete, Key: key, Principal: principal}})
+}
+
+func (l *memLog) WriteBatch(events []transcationlog.Event) {
+	l.m.Lock()
+	l.events = append(l.events, events...)
+	l.m.Unlock()
+}
+
+func (l *memLog) logged() []transcationlog.Event {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return append([]transcationlog.Event(nil), l.events...)
+}
+
+// newTestServer returns a server on an empty store. The store is global, so
+// tests using it must not run in parallel.
+func newTestServer(t *testing.T) (*Server, *memLog) {
+	t.Helper()
+
+	store.Restore(nil)
+	t.Cleanup(func() { store.Restore(nil) })
+
+	log := &memLog{}
+
+	return NewServer(log), log
+}
+
+// client sends commands to a server over an in-memory connection.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, s *Server) *client {
+	t.Helper()
+
+	cc, sc := net.Pipe()
+	go s.serveConn(sc)
+	t.Cleanup(func() { cc.Close() })
+
+	return &client{t: t, conn: cc, r: bufio.NewReader(cc)}
+}
+
+// do sends a command and returns its reply, written as +simple, -error,
+// :integer, a bare bulk string, (nil), [array elements] or %[map elements].
+func (c *client) do(args ...string) string {
+	c.t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return c.reply()
+}
+
+func (c *client) reply() string {
+	c.t.Helper()
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+', '-', ':':
+		return line
+	case '_':
+		return "(nil)"
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(b[:n])
+	case '*', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+
+		elems := make([]string, n)
+		for i := range elems {
+			elems[i] = c.reply()
+		}
+
+		prefix := ""
+		if line[0] == '%' {
+			prefix = "%"
+		}
+		return prefix + "[" + strings.Join(elems, " ") + "]"
+	}
+
+	c.t.Fatalf("unexpected reply %q", line)
+	return ""
+}
+
+// expect runs the commands in order and checks each reply.
+func (c *client) expect(steps ...[2]string) {
+	c.t.Helper()
+
+	for _, step := range steps {
+		if got := c.do(strings.Fields(step[0])...); got != step[1] {
+			c.t.Fatalf("%s = %q, want %q", step[0], got, step[1])
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	s, log := newTestServer(t)
+	c := dial(t, s)
+
+	c.expect(
+		[2]string{"SET k v", "+OK"},
+		[2]string{"SET k v2 NX", "(nil)"},
+		[2]string{"SET new v XX", "(nil)"},
+		[2]string{"SET k v2 XX", "+OK"},
+		[2]string{"GET k", "v2"},
+		[2]string{"GET new", "(nil)"},
+		[2]string{"SET k v NX XX", "-ERR syntax error"},
+		[2]string{"SET k v EX", "-ERR syntax error"},
+		[2]string{"SET k v EX 0", "-ERR invalid expire time in 'set' command"},
+		[2]string{"SET e v EX 100", "+OK"},
+		[2]string{"TTL e", ":100"},
+		[2]string{"TTL k", ":-1"},
+		[2]string{"TTL missing", ":-2"},
+		[2]string{"SET", "-ERR wrong number of arguments for 'set' command"},
+	)
+
+	// Only the writes that happened are logged; SET EX logs its expiry.
+	events := log.logged()
+	want := []transcationlog.Event{
+		{EventType: transcationlog.EventPut, Key: "k"},
+		{EventType: transcationlog.EventPut, Key: "k"},
+		{EventType: transcationlog.EventPut, Key: "e"},
+		{EventType: transcationlog.EventExpire, Key: "e"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("logged %+v, want %d events", events, len(want))
+	}
+	for i, e := range events {
+		if e.EventType != want[i].EventType || e.Key != want[i].Key {
+			t.Fatalf("logged %+v, want %+v", events, want)
+		}
+	}
+}
+
+func TestDelAndMulti(t *testing.T) {
+	s, log := newTestServer(t)
+	c := dial(t, s)
+
+	c.expect(
+		[2]string{"MSET a 1 b 2", "+OK"},
+		[2]string{"MSET a", "-ERR wrong number of arguments for 'mset' command"},
+		[2]string{"MSET a 1 b", "-ERR wrong number of arguments for 'mset' command"},
+		[2]string{"MGET a missing b", "[1 (nil) 2]"},
+		[2]string{"DEL a missing", ":1"},
+		[2]string{"EXISTS a b b", ":2"},
+		[2]string{"DEL a", ":0"},
+	)
+
+	events := log.logged()
+	if len(events) != 3 || events[2].EventType != transcationlog.EventDelete || events[2].Key != "a" {
+		t.Fatalf("logged %+v, want the two puts and the delete of a", events)
+	}
+}
+
+func TestScan(t *testing.T) {
+	s, _ := newTestServer(t)
+	c := dial(t, s)
+
+	for _, k := range []string{"a", "jobs/1", "jobs/2", "user:1", "user:2", "user/x"} {
+		c.expect([2]string{"SET " + k + " v", "+OK"})
+	}
+
+	// Paging visits every key, those with a '/' included, and ends on the
+	// cursor 0.
+	var keys []string
+	cursor := "0"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("SCAN did not return to the cursor 0")
+		}
+
+		r := c.do("SCAN", cursor, "COUNT", "2")
+		if _, err := fmt.Sscanf(r, "[%s", &cursor); err != nil {
+			t.Fatalf("SCAN reply %q", r)
+		}
+		page := strings.TrimSuffix(strings.TrimPrefix(r, "["+cursor+" ["), "]]")
+		keys = append(keys, strings.Fields(page)...)
+
+		if cursor == "0" {
+			break
+		}
+	}
+	if got := strings.Join(keys, " "); got != "a jobs/1 jobs/2 user/x user:1 user:2" {
+		t.Fatalf("SCAN returned %q", got)
+	}
+
+	c.expect(
+		[2]string{"SCAN 0 MATCH *", "[0 [a jobs/1 jobs/2 user/x user:1 user:2]]"},
+		[2]string{"SCAN 0 MATCH jobs*", "[0 [jobs/1 jobs/2]]"},
+		[2]string{"SCAN 0 MATCH user?[12]", "[0 [user:1 user:2]]"},
+		[2]string{"SCAN 0 MATCH *x", "[0 [user/x]]"},
+		[2]string{"SCAN 0 TYPE hash", "[0 []]"},
+		[2]string{"SCAN 0 COUNT 0", "-ERR value is not an integer or out of range"},
+		[2]string{"SCAN x", "-ERR invalid cursor"},
+	)
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "a/b/c", true},
+		{"a*c", "a/b/c", true},
+		{"a*c", "a/b/d", false},
+		{"*b*", "abc", true},
+		{"a?c", "a/c", true},
+		{"a?c", "ac", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a[b", "a[b", true},
+		{"**a", "ba", true},
+		{"a", "ab", false},
+	}
+
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestExpire(t *testing.T) {
+	s, log := newTestServer(t)
+	c := dial(t, s)
+
+	c.expect(
+		[2]string{"SET k v", "+OK"},
+		[2]string{"EXPIRE k 100", ":1"},
+		[2]string{"TTL k", ":100"},
+		[2]string{"EXPIRE missing 100", ":0"},
+		[2]string{"EXPIRE k soon", "-ERR value is not an integer or out of range"},
+		[2]string{"EXPIRE k -1", ":1"},
+		[2]string{"GET k", "(nil)"},
+		[2]string{"TTL k", ":-2"},
+	)
+
+	if events := log.logged(); len(events) != 3 {
+		t.Fatalf("logged %+v, want the put and both expires", events)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	s, _ := newTestServer(t)
+	c := dial(t, s)
+
+	c.expect(
+		[2]string{"INCR n", ":1"},
+		[2]string{"INCR n", ":2"},
+		[2]string{"GET n", "2"},
+		[2]string{"SET s x", "+OK"},
+		[2]string{"INCR s", "-ERR value is not an integer or out of range"},
+		[2]string{"SET max 9223372036854775807", "+OK"},
+		[2]string{"INCR max", "-ERR increment or decrement would overflow"},
+	)
+}
+
+func TestAuth(t *testing.T) {
+	s, log := newTestServer(t)
+	s.RequireAuth(auth.APIKeys{"secret": "alice"}, auth.Policy{
+		{Principal: "alice", Prefix: "mine-", Permission: auth.PermissionWrite},
+		{Principal: "alice", Prefix: "shared-", Permission: auth.PermissionRead},
+	})
+
+	c := dial(t, s)
+	c.expect(
+		[2]string{"PING", "+PONG"},
+		[2]string{"GET mine-1", "-NOAUTH Authentication required."},
+		[2]string{"AUTH wrong", "-WRONGPASS invalid username-password pair or user is disabled."},
+		[2]string{"AUTH default secret", "+OK"},
+		[2]string{"SET mine-1 v", "+OK"},
+		[2]string{"GET mine-1", "v"},
+		[2]string{"GET shared-1", "(nil)"},
+		[2]string{"SET shared-1 v", "-NOPERM this user has no permissions to access the 'shared-1' key"},
+		[2]string{"GET other", "-NOPERM this user has no permissions to access the 'other' key"},
+		// One denied key refuses the whole command.
+		[2]string{"MSET mine-2 v shared-1 v", "-NOPERM this user has no permissions to access the 'shared-1' key"},
+		[2]string{"MGET mine-1 other", "-NOPERM this user has no permissions to access the 'other' key"},
+		[2]string{"DEL mine-1 shared-1", "-NOPERM this user has no permissions to access the 'shared-1' key"},
+	)
+
+	if events := log.logged(); len(events) != 1 || events[0].Key != "mine-1" || events[0].Principal != "alice" {
+		t.Fatalf("logged %+v, want only the put of mine-1, by alice", events)
+	}
+
+	// HELLO authenticates and switches to RESP3.
+	c = dial(t, s)
+	c.expect(
+		[2]string{"HELLO 3", "-NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"},
+		[2]string{"HELLO 3 AUTH default wrong", "-WRONGPASS invalid username-password pair or user is disabled."},
+		[2]string{"HELLO 4", "-NOPROTO unsupported protocol version"},
+		[2]string{"HELLO 3 AUTH default secret", "%[server redis version 7.0.0 proto :3 id :0 mode standalone role master modules []]"},
+		[2]string{"GET mine-2", "(nil)"},
+		[2]string{"SCAN 0", "[0 [mine-1]]"},
+	)
+}
+
+func TestReadOnly(t *testing.T) {
+	s, log := newTestServer(t)
+	s.ReadOnly()
+
+	c := dial(t, s)
+	c.expect(
+		[2]string{"SET k v", "-READONLY You can't write against a read only replica."},
+		[2]string{"GET k", "(nil)"},
+	)
+
+	if events := log.logged(); len(events) != 0 {
+		t.Fatalf("logged %+v on a read only server", events)
+	}
+}
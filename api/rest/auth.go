@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"cloud_native/pkg/auth"
+	"github.com/gorilla/mux"
+)
+
+// adminPaths hold the endpoints that expose or affect the whole store; they
+// need admin permission on every key.
+var adminPaths = []string{"/_replication/", "/_raft/", "/_cluster/", "/_admin/"}
+
+// AuthMiddleware authenticates every request and authorises it against the
+// policy for the key it addresses. Unauthenticated requests get 401, requests
+// without the needed permission get 403.
+func AuthMiddleware(authenticator auth.Authenticator, policy auth.Policy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := authenticator.Authenticate(r)
+			if err != nil {
+				if errors.Is(err, auth.ErrNoCredentials) {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="kvs"`)
+				}
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			key, hasKey := mux.Vars(r)["key"]
+			if hasKey && !policy.Allowed(p.Name, key, requiredPermission(r)) {
+				http.Error(w, auth.ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+
+			if isAdmin(r) && !policy.Allowed(p.Name, "", auth.PermissionAdmin) {
+				http.Error(w, auth.ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+
+			ctx := auth.WithPolicy(auth.WithPrincipal(r.Context(), p), policy)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// isAdmin reports whether r was routed to an admin endpoint. It matches the
+// template of the route rather than the path, which for a key route holds
+// the key, e.g. /v1/_raft/crdt for the key _raft.
+func isAdmin(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+
+	for _, p := range adminPaths {
+		if strings.HasPrefix(template, apiPrefix+p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func requiredPermission(r *http.Request) auth.Permission {
+	if isRead(r) {
+		return auth.PermissionRead
+	}
+
+	return auth.PermissionWrite
+}
+
+// principalName returns the name of the authenticated caller, if any.
+func principalName(r *http.Request) string {
+	p, _ := auth.PrincipalFrom(r.Context())
+	return p.Name
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	srv, log := newTestServer(t, store.Limits{})
+	srv.HandleFunc("/_raft/status", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	srv.Use(AuthMiddleware(
+		auth.APIKeys{"reader-key": "reader", "writer-key": "writer", "ops-key": "ops"},
+		auth.Policy{
+			{Principal: "reader", Prefix: "", Permission: auth.PermissionRead},
+			{Principal: "writer", Prefix: "jobs-", Permission: auth.PermissionWrite},
+			{Principal: "writer", Prefix: "_raft", Permission: auth.PermissionWrite},
+			{Principal: "ops", Prefix: "", Permission: auth.PermissionAdmin},
+		},
+	))
+
+	tests := []struct {
+		name, apiKey, method, target string
+		want                         int
+	}{
+		{"no credentials", "", "GET", "/v1/key", http.StatusUnauthorized},
+		{"unknown key", "guess", "GET", "/v1/key", http.StatusUnauthorized},
+		{"read granted", "reader-key", "GET", "/v1/key", http.StatusNotFound},
+		{"write not granted", "reader-key", "PUT", "/v1/key", http.StatusForbidden},
+		{"write granted", "writer-key", "PUT", "/v1/jobs-1", http.StatusCreated},
+		{"write outside the prefix", "writer-key", "PUT", "/v1/key", http.StatusForbidden},
+		{"admin route without admin", "writer-key", "GET", "/v1/_raft/status", http.StatusForbidden},
+		{"admin route with admin", "ops-key", "GET", "/v1/_raft/status", http.StatusOK},
+		// A key named like an admin route is only a key.
+		{"key named like an admin route", "writer-key", "POST", "/v1/_raft/crdt", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		r := request(tt.method, tt.target, "192.0.2.1:1234", "")
+		if tt.apiKey != "" {
+			r.Header.Set("X-API-Key", tt.apiKey)
+		}
+
+		w := serve(srv, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.target, w.Code, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && tt.apiKey == "" && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 without WWW-Authenticate", tt.name)
+		}
+	}
+
+	// The handler logs the writes under the authenticated principal.
+	if events := log.logged(); len(events) != 1 || events[0].Principal != "writer" {
+		t.Fatalf("logged %+v, want one write by writer", events)
+	}
+}
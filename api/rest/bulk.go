@@ -0,0 +1,278 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+const (
+	DefaultBulkMaxItems = 1000
+	DefaultBulkMaxBytes = 16 << 20 // 16 MiB
+)
+
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// BulkLimits bounds the requests accepted by the bulk endpoints.
+type BulkLimits struct {
+	MaxItems int
+	MaxBytes int64
+}
+
+type bulkItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+type bulkResult struct {
+	Key    string `json:"key"`
+	Status int    `json:"status"`
+	Value  string `json:"value,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (s *Server) bulkGetHandler() func(w http.ResponseWriter, r *http.Request) {
+	return s.bulkHandler(auth.PermissionRead, func(r *http.Request, items []bulkItem, results []bulkResult) {
+		if s.replication != nil {
+			s.replicateBulk(r, http.StatusOK, items, results, func(item bulkItem) (string, error) {
+				return s.replicatedGet(r, item.Key)
+			})
+			return
+		}
+
+		readErr := s.readIndex(r)
+
+		for i, item := range items {
+			if results[i].Status != 0 {
+				continue
+			}
+
+			if readErr != nil {
+				results[i] = errorResult(item.Key, readErr)
+				continue
+			}
+
+			value, err := store.Get(item.Key)
+			if err != nil {
+				results[i] = errorResult(item.Key, err)
+				continue
+			}
+
+			results[i] = bulkResult{Key: item.Key, Status: http.StatusOK, Value: value}
+		}
+	})
+}
+
+func (s *Server) bulkPutHandler() func(w http.ResponseWriter, r *http.Request) {
+	return s.bulkHandler(auth.PermissionWrite, func(r *http.Request, items []bulkItem, results []bulkResult) {
+		if s.consensus != nil {
+			s.proposeBulk(r, transcationlog.EventPut, http.StatusCreated, items, results)
+			return
+		}
+
+		if s.replication != nil {
+			s.replicateBulk(r, http.StatusCreated, items, results, func(item bulkItem) (string, error) {
+				return "", s.replicatedPut(r, item.Key, item.Value)
+			})
+			return
+		}
+
+		defer store.LockKeys(itemKeys(items)...)()
+
+		events := make([]transcationlog.Event, 0, len(items))
+
+		for i, item := range items {
+			if results[i].Status != 0 {
+				continue
+			}
+
+			if err := store.Put(item.Key, item.Value); err != nil {
+				results[i] = errorResult(item.Key, err)
+				continue
+			}
+
+			results[i] = bulkResult{Key: item.Key, Status: http.StatusCreated}
+			events = append(events, transcationlog.Event{
+				EventType: transcationlog.EventPut,
+				Key:       item.Key,
+				Value:     item.Value,
+				Principal: principalName(r),
+			})
+		}
+
+		s.transactionLog.WriteBatch(events)
+	})
+}
+
+func (s *Server) bulkDeleteHandler() func(w http.ResponseWriter, r *http.Request) {
+	return s.bulkHandler(auth.PermissionWrite, func(r *http.Request, items []bulkItem, results []bulkResult) {
+		if s.consensus != nil {
+			s.proposeBulk(r, transcationlog.EventDelete, http.StatusNoContent, items, results)
+			return
+		}
+
+		if s.replication != nil {
+			s.replicateBulk(r, http.StatusNoContent, items, results, func(item bulkItem) (string, error) {
+				return "", s.replicatedDelete(r, item.Key)
+			})
+			return
+		}
+
+		defer store.LockKeys(itemKeys(items)...)()
+
+		events := make([]transcationlog.Event, 0, len(items))
+
+		for i, item := range items {
+			if results[i].Status != 0 {
+				continue
+			}
+
+			if err := store.Delete(item.Key); err != nil {
+				results[i] = errorResult(item.Key, err)
+				continue
+			}
+
+			results[i] = bulkResult{Key: item.Key, Status: http.StatusNoContent}
+			events = append(events, transcationlog.Event{
+				EventType: transcationlog.EventDelete,
+				Key:       item.Key,
+				Principal: principalName(r),
+			})
+		}
+
+		s.transactionLog.WriteBatch(events)
+	})
+}
+
+// bulkHandler decodes the batch and fills in the results of the items that
+// are invalid or that the caller may not touch; apply must skip those. The
+// response uses the request's encoding: a JSON array in, a JSON array out;
+// NDJSON in, NDJSON out.
+func (s *Server) bulkHandler(perm auth.Permission, apply func(r *http.Request, items []bulkItem, results []bulkResult)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.BulkLimits.MaxBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, s.BulkLimits.MaxBytes)
+		}
+		defer r.Body.Close()
+
+		items, ndjson, err := decodeBulk(r.Body, s.BulkLimits.MaxItems)
+		if err != nil {
+			status := errorStatus(err)
+			if status == http.StatusInternalServerError {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		results := make([]bulkResult, len(items))
+
+		for i, item := range items {
+			if err := store.CheckKey(item.Key); err != nil {
+				results[i] = errorResult(item.Key, err)
+			} else if !auth.Allowed(r.Context(), item.Key, perm) {
+				results[i] = bulkResult{Key: item.Key, Status: http.StatusForbidden, Error: auth.ErrForbidden.Error()}
+			}
+		}
+
+		apply(r, items, results)
+
+		writeBulk(w, results, ndjson)
+	}
+}
+
+func decodeBulk(body io.Reader, maxItems int) ([]bulkItem, bool, error) {
+	br := bufio.NewReader(body)
+
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot read batch: %w", err)
+	}
+
+	dec := json.NewDecoder(br)
+	items := make([]bulkItem, 0)
+	ndjson := first != '['
+
+	if !ndjson {
+		if _, err = dec.Token(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	for dec.More() {
+		if maxItems > 0 && len(items) >= maxItems {
+			return nil, ndjson, fmt.Errorf("%w: more than %d items", ErrBatchTooLarge, maxItems)
+		}
+
+		var item bulkItem
+		if err = dec.Decode(&item); err != nil {
+			return nil, ndjson, fmt.Errorf("cannot decode item %d: %w", len(items), err)
+		}
+
+		items = append(items, item)
+	}
+
+	if !ndjson {
+		if _, err = dec.Token(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if _, err = dec.Token(); err != io.EOF {
+		return nil, ndjson, errors.New("unexpected data after the batch")
+	}
+
+	return items, ndjson, nil
+}
+
+func itemKeys(items []bulkItem) []string {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+
+	return keys
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+
+		return b, br.UnreadByte()
+	}
+}
+
+func writeBulk(w http.ResponseWriter, results []bulkResult, ndjson bool) {
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+
+		for _, res := range results {
+			enc.Encode(res)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func errorResult(key string, err error) bulkResult {
+	return bulkResult{Key: key, Status: errorStatus(err), Error: err.Error()}
+}
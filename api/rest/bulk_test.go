@@ -0,0 +1,184 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+func bulkResults(t *testing.T, body string) []bulkResult {
+	t.Helper()
+
+	var results []bulkResult
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatalf("cannot decode %q: %v", body, err)
+	}
+
+	return results
+}
+
+func statuses(results []bulkResult) []int {
+	codes := make([]int, len(results))
+	for i, res := range results {
+		codes[i] = res.Status
+	}
+
+	return codes
+}
+
+func TestBulk(t *testing.T) {
+	srv, log := newTestServer(t, store.Limits{MaxKeyLength: 8})
+
+	w := do(srv, "POST", "/v1/_bulk/put", `[{"key": "a", "value": "1"}, {"key": "", "value": "2"}, {"key": "too-long-key", "value": "3"}, {"key": "b", "value": "4"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk put = %d %s", w.Code, w.Body)
+	}
+	if got := fmt.Sprint(statuses(bulkResults(t, w.Body.String()))); got != "[201 400 414 201]" {
+		t.Fatalf("bulk put statuses = %s, want [201 400 414 201]", got)
+	}
+
+	// The items applied are logged together, and only they are.
+	batches := log.logBatches()
+	if len(batches) != 1 || len(batches[0]) != 2 || batches[0][0].Key != "a" || batches[0][1].Key != "b" {
+		t.Fatalf("logged batches %+v, want a single one with a and b", batches)
+	}
+
+	// NDJSON in, NDJSON out.
+	w = do(srv, "POST", "/v1/_bulk/get", "{\"key\": \"a\"}\n{\"key\": \"missing\"}\n{\"key\": \"b\"}\n")
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("bulk get of NDJSON answered in %q", ct)
+	}
+
+	var got []bulkResult
+	for line := range strings.Lines(w.Body.String()) {
+		var res bulkResult
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, res)
+	}
+	want := []bulkResult{{Key: "a", Status: 200, Value: "1"}, {Key: "missing", Status: 404, Error: store.ErrNoSuchKey.Error()}, {Key: "b", Status: 200, Value: "4"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("bulk get = %+v, want %+v", got, want)
+	}
+
+	w = do(srv, "POST", "/v1/_bulk/delete", `[{"key": "a"}, {"key": "missing"}]`)
+	if got := fmt.Sprint(statuses(bulkResults(t, w.Body.String()))); got != "[204 204]" {
+		t.Fatalf("bulk delete statuses = %s, want [204 204]", got)
+	}
+	if _, err := store.Get("a"); err == nil {
+		t.Fatal("a survived the bulk delete")
+	}
+	if events := log.logged(); len(events) != 4 || events[2].EventType != transcationlog.EventDelete {
+		t.Fatalf("logged %+v, want the deletes after the puts", events)
+	}
+}
+
+func TestBulkLimits(t *testing.T) {
+	srv, log := newTestServer(t, store.Limits{})
+	srv.BulkLimits = BulkLimits{MaxItems: 2, MaxBytes: 64}
+
+	tests := []struct {
+		name, body string
+		want       int
+	}{
+		{"too many items", `[{"key": "a"}, {"key": "b"}, {"key": "c"}]`, http.StatusRequestEntityTooLarge},
+		{"too many bytes", `[{"key": "a", "value": "` + strings.Repeat("v", 64) + `"}]`, http.StatusRequestEntityTooLarge},
+		{"not JSON", `[{"key": }]`, http.StatusBadRequest},
+		{"data after the batch", `[{"key": "a"}] [{"key": "b"}]`, http.StatusBadRequest},
+		{"empty body", ``, http.StatusBadRequest},
+		{"at the limits", `[{"key": "a"}, {"key": "b"}]`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if w := do(srv, "POST", "/v1/_bulk/put", tt.body); w.Code != tt.want {
+			t.Errorf("%s: bulk put = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	if events := log.logged(); len(events) != 2 {
+		t.Fatalf("logged %+v, want only the batch within the limits", events)
+	}
+}
+
+func TestBulkAuthorization(t *testing.T) {
+	srv, log := newTestServer(t, store.Limits{})
+	srv.Use(AuthMiddleware(auth.APIKeys{"key": "writer"}, auth.Policy{
+		{Principal: "writer", Prefix: "mine-", Permission: auth.PermissionWrite},
+		{Principal: "writer", Prefix: "shared-", Permission: auth.PermissionRead},
+	}))
+
+	bulk := func(op, body string) []int {
+		r := httptest.NewRequest("POST", "/v1/_bulk/"+op, strings.NewReader(body))
+		r.Header.Set("X-API-Key", "key")
+
+		w := serve(srv, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("bulk %s = %d %s", op, w.Code, w.Body)
+		}
+
+		return statuses(bulkResults(t, w.Body.String()))
+	}
+
+	if got := fmt.Sprint(bulk("put", `[{"key": "mine-1", "value": "v"}, {"key": "shared-1", "value": "v"}]`)); got != "[201 403]" {
+		t.Fatalf("bulk put statuses = %s, want [201 403]", got)
+	}
+	if got := fmt.Sprint(bulk("get", `[{"key": "mine-1"}, {"key": "shared-1"}, {"key": "other"}]`)); got != "[200 404 403]" {
+		t.Fatalf("bulk get statuses = %s, want [200 404 403]", got)
+	}
+
+	if events := log.logged(); len(events) != 1 || events[0].Key != "mine-1" || events[0].Principal != "writer" {
+		t.Fatalf("logged %+v, want only the allowed put, by writer", events)
+	}
+}
+
+// TestBulkLogOrder checks that concurrent batches writing the same keys are
+// logged in the order the store applied them, so that replaying the log
+// gives the same values.
+func TestBulkLogOrder(t *testing.T) {
+	srv, log := newTestServer(t, store.Limits{})
+
+	keys := []string{"a", "b", "c", "d"}
+
+	var wg sync.WaitGroup
+	for n := range 8 {
+		wg.Go(func() {
+			items := make([]string, len(keys))
+			for i, key := range keys {
+				items[i] = fmt.Sprintf(`{"key": %q, "value": "%d"}`, key, n)
+			}
+			do(srv, "POST", "/v1/_bulk/put", "["+strings.Join(items, ",")+"]")
+		})
+	}
+	wg.Wait()
+
+	last := make(map[string]string)
+	for _, batch := range log.logBatches() {
+		if len(batch) != len(keys) {
+			t.Fatalf("a batch was logged in %d events, want %d", len(batch), len(keys))
+		}
+
+		// Every key of a batch has the batch's value: no other batch was
+		// applied in between.
+		for _, e := range batch {
+			if e.Value != batch[0].Value {
+				t.Fatalf("batch %+v mixes the values of several requests", batch)
+			}
+			last[e.Key] = e.Value
+		}
+	}
+
+	for _, key := range keys {
+		if v, _ := store.Get(key); v != last[key] {
+			t.Fatalf("store has %s = %q, log replays %q", key, v, last[key])
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"cloud_native/pkg/transcationlog"
+)
+
+// Consensus commits writes through a replicated log before they reach the
+// store and serves linearizable reads, e.g. a *consensus.Node.
+type Consensus interface {
+	Propose(ctx context.Context, events []transcationlog.Event) ([]error, error)
+	ReadIndex(ctx context.Context) error
+}
+
+// UseConsensus routes writes through c instead of applying them to the store
+// and logging them, and makes reads wait for c's read index.
+func (s *Server) UseConsensus(c Consensus) {
+	s.consensus = c
+}
+
+// propose commits e and returns the error of applying it.
+func (s *Server) propose(r *http.Request, e transcationlog.Event) error {
+	errs, err := s.consensus.Propose(r.Context(), []transcationlog.Event{e})
+	if err != nil {
+		return err
+	}
+
+	return errs[0]
+}
+
+// proposeBulk commits the items that have no result yet as a single batch.
+func (s *Server) proposeBulk(r *http.Request, eventType transcationlog.EventType, status int, items []bulkItem, results []bulkResult) {
+	events := make([]transcationlog.Event, 0, len(items))
+	indexes := make([]int, 0, len(items))
+
+	for i, item := range items {
+		if results[i].Status != 0 {
+			continue
+		}
+
+		e := transcationlog.Event{EventType: eventType, Key: item.Key, Principal: principalName(r)}
+		if eventType == transcationlog.EventPut {
+			e.Value = item.Value
+		}
+
+		events = append(events, e)
+		indexes = append(indexes, i)
+	}
+
+	if len(events) == 0 {
+		return
+	}
+
+	errs, err := s.consensus.Propose(r.Context(), events)
+
+	for j, i := range indexes {
+		switch {
+		case err != nil:
+			results[i] = errorResult(items[i].Key, err)
+		case errs[j] != nil:
+			results[i] = errorResult(items[i].Key, errs[j])
+		default:
+			results[i] = bulkResult{Key: items[i].Key, Status: status}
+		}
+	}
+}
+
+// readIndex waits until reads reflect every committed write, when running
+// under consensus.
+func (s *Server) readIndex(r *http.Request) error {
+	if s.consensus == nil {
+		return nil
+	}
+
+	return s.consensus.ReadIndex(r.Context())
+}
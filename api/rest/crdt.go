@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cloud_native/pkg/cluster"
+	"cloud_native/pkg/crdt"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+	"github.com/gorilla/mux"
+)
+
+type crdtValue struct {
+	Type  crdt.Type `json:"type"`
+	Value any       `json:"value"`
+}
+
+func (s *Server) getCRDTHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+
+		var c crdt.CRDT
+		var err error
+
+		if s.replication != nil {
+			var value string
+			if value, err = s.replicatedGet(r, key); err == nil {
+				c, err = crdt.Decode(value)
+			}
+		} else if err = s.readIndex(r); err == nil {
+			c, err = crdt.Load(key)
+		}
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeCRDT(w, c)
+	}
+}
+
+// updateCRDTHandler applies the operation in the JSON body, see crdt.Op, to
+// the CRDT at the key and returns its new value.
+func (s *Server) updateCRDTHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+
+		var o crdt.Op
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			http.Error(w, "cannot decode operation: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var c crdt.CRDT
+		var err error
+
+		if s.consensus != nil {
+			c, err = s.proposeUpdate(r, key, o)
+		} else if s.replication != nil {
+			var level cluster.Consistency
+			if level, err = consistency(r); err == nil {
+				c, err = s.replication.Update(r.Context(), key, o, principalName(r), level)
+			}
+		} else {
+			c, err = s.update(r, key, o)
+		}
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeCRDT(w, c)
+	}
+}
+
+// mergeCRDTHandler merges the CRDT state in the body, as returned by
+// GET /{key} on another store, into the key's.
+func (s *Server) mergeCRDTHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+
+		if err := store.CheckKey(key); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if max := store.CurrentLimits().MaxValueSize; max > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		c, err := crdt.Decode(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if s.consensus != nil {
+			err = s.propose(r, transcationlog.Event{EventType: transcationlog.EventMerge, Key: key, Value: string(body), Principal: principalName(r)})
+		} else if s.replication != nil {
+			var level cluster.Consistency
+			if level, err = consistency(r); err == nil {
+				err = s.replication.Merge(r.Context(), key, c, principalName(r), level)
+			}
+		} else {
+			err = s.merge(r, key, c)
+		}
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// proposeUpdate applies o to the committed state and commits the result.
+// Updates are serialized, so that each starts from the state the previous
+// one committed.
+func (s *Server) proposeUpdate(r *http.Request, key string, o crdt.Op) (crdt.CRDT, error) {
+	s.crdtUpdates.Lock()
+	defer s.crdtUpdates.Unlock()
+
+	if err := s.readIndex(r); err != nil {
+		return nil, err
+	}
+
+	c, err := crdt.Load(key)
+	switch {
+	case errors.Is(err, store.ErrNoSuchKey) && o.Type != "":
+		c, err = crdt.New(o.Type)
+	case errors.Is(err, store.ErrNoSuchKey):
+		err = fmt.Errorf("%w: missing type for a new key", crdt.ErrInvalidOp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = o.Apply(c, s.ReplicaID, now()); err != nil {
+		return nil, err
+	}
+
+	value, err := crdt.Encode(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, s.propose(r, transcationlog.Event{EventType: transcationlog.EventMerge, Key: key, Value: value, Principal: principalName(r)})
+}
+
+// update and merge hold the key's lock until the write is logged, as put
+// does.
+func (s *Server) update(r *http.Request, key string, o crdt.Op) (crdt.CRDT, error) {
+	defer store.LockKeys(key)()
+
+	c, err := crdt.Update(key, o, s.ReplicaID, now())
+	if err != nil {
+		return nil, err
+	}
+
+	return c, s.logMerge(r, key, c)
+}
+
+func (s *Server) merge(r *http.Request, key string, c crdt.CRDT) error {
+	defer store.LockKeys(key)()
+
+	if _, _, err := crdt.MergeInto(store.CurrentLimits(), key, c, 0); err != nil {
+		return err
+	}
+
+	return s.logMerge(r, key, c)
+}
+
+func (s *Server) logMerge(r *http.Request, key string, c crdt.CRDT) error {
+	value, err := crdt.Encode(c)
+	if err != nil {
+		return err
+	}
+
+	s.transactionLog.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventMerge, Key: key, Value: value, Principal: principalName(r)}})
+
+	return nil
+}
+
+func writeCRDT(w http.ResponseWriter, c crdt.CRDT) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(crdtValue{Type: c.Type(), Value: c.Value()})
+}
+
+func now() uint64 {
+	return uint64(time.Now().UnixNano())
+}
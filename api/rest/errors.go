@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"cloud_native/pkg/cluster"
+	"cloud_native/pkg/consensus"
+	"cloud_native/pkg/crdt"
+	"cloud_native/pkg/store"
+)
+
+// errorStatus maps store errors onto the HTTP status codes returned to clients.
+func errorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, store.ErrNoSuchKey):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrEmptyKey), errors.Is(err, cluster.ErrInvalidConsistency):
+		return http.StatusBadRequest
+	case errors.Is(err, crdt.ErrUnknownType), errors.Is(err, crdt.ErrUnknownOp), errors.Is(err, crdt.ErrInvalidOp):
+		return http.StatusBadRequest
+	case errors.Is(err, crdt.ErrTypeMismatch), errors.Is(err, crdt.ErrNotCRDT):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrKeyTooLong):
+		return http.StatusRequestURITooLong
+	case errors.Is(err, store.ErrValueTooLarge), errors.Is(err, ErrBatchTooLarge), errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, store.ErrStoreFull):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, consensus.ErrNotLeader):
+		return http.StatusMisdirectedRequest
+	case errors.Is(err, cluster.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), errorStatus(err))
+}
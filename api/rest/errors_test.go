@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+// memLog is a TransactionLogger keeping the events in memory.
+type memLog struct {
+	m       sync.Mutex
+	batches [][]transcationlog.Event
+}
+
+func (l *memLog) WritePut(key, value, principal string) {
+	l.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventPut, Key: key, Value: value, Principal: principal}})
+}
+
+func (l *memLog) WriteDelete(key, principal string) {
+	l.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventDelete, Key: key, Principal: principal}})
+}
+
+func (l *memLog) WriteBatch(events []transcationlog.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	l.m.Lock()
+	l.batches = append(l.batches, events)
+	l.m.Unlock()
+}
+
+func (l *memLog) Err() <-chan error { return nil }
+func (l *memLog) Run()              {}
+func (l *memLog) Close() error      { return nil }
+
+func (l *memLog) ReadEvents() (<-chan transcationlog.Event, <-chan error) {
+	events, errs := make(chan transcationlog.Event), make(chan error)
+	close(events)
+	close(errs)
+
+	return events, errs
+}
+
+func (l *memLog) logged() []transcationlog.Event {
+	var events []transcationlog.Event
+	for _, batch := range l.logBatches() {
+		events = append(events, batch...)
+	}
+
+	return events
+}
+
+func (l *memLog) logBatches() [][]transcationlog.Event {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return append([][]transcationlog.Event(nil), l.batches...)
+}
+
+// newTestServer returns a server on an empty store with the given limits,
+// which are restored to the defaults when the test ends. The store is
+// global, so tests using it must not run in parallel.
+func newTestServer(t *testing.T, limits store.Limits) (*Server, *memLog) {
+	t.Helper()
+
+	store.Restore(nil)
+	store.SetLimits(limits)
+
+	t.Cleanup(func() {
+		store.Restore(nil)
+		store.SetLimits(store.Limits{MaxKeyLength: store.DefaultMaxKeyLength, MaxValueSize: store.DefaultMaxValueSize})
+	})
+
+	log := &memLog{}
+
+	return NewServer(log), log
+}
+
+func do(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	return w
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{store.ErrNoSuchKey, http.StatusNotFound},
+		{store.ErrEmptyKey, http.StatusBadRequest},
+		{store.ErrKeyTooLong, http.StatusRequestURITooLong},
+		{store.ErrValueTooLarge, http.StatusRequestEntityTooLarge},
+		{&http.MaxBytesError{Limit: 1}, http.StatusRequestEntityTooLarge},
+		{ErrBatchTooLarge, http.StatusRequestEntityTooLarge},
+		{store.ErrStoreFull, http.StatusInsufficientStorage},
+		{fmt.Errorf("wrapped: %w", store.ErrStoreFull), http.StatusInsufficientStorage},
+		{fmt.Errorf("anything else"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPutLimits(t *testing.T) {
+	srv, log := newTestServer(t, store.Limits{MaxKeyLength: 4, MaxValueSize: 4, MaxStoreSize: 12})
+
+	tests := []struct {
+		key, value string
+		want       int
+	}{
+		{"key12", "v", http.StatusRequestURITooLong},
+		{"key", "value", http.StatusRequestEntityTooLarge},
+		{"key", "1234", http.StatusCreated},
+		{"key2", "1234", http.StatusInsufficientStorage},
+	}
+
+	for _, tt := range tests {
+		if w := do(srv, "PUT", "/v1/"+tt.key, tt.value); w.Code != tt.want {
+			t.Errorf("PUT %s with %d bytes = %d, want %d", tt.key, len(tt.value), w.Code, tt.want)
+		}
+	}
+
+	if events := log.logged(); len(events) != 1 || events[0].Key != "key" {
+		t.Fatalf("logged %v, want only the accepted put", events)
+	}
+}
@@ -1,11 +1,11 @@
 package rest
 
 import (
-	"errors"
 	"io"
 	"net/http"
 
 	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
 	"github.com/gorilla/mux"
 )
 
@@ -13,6 +13,16 @@ func (s *Server) AddRoutes() {
 	// Basic Handler
 	s.HandleFunc("/", s.helloGoHandler())
 
+	// Bulk endpoints
+	s.HandleFunc("/_bulk/get", s.bulkGetHandler()).Methods("POST")
+	s.HandleFunc("/_bulk/put", s.bulkPutHandler()).Methods("POST")
+	s.HandleFunc("/_bulk/delete", s.bulkDeleteHandler()).Methods("POST")
+
+	// CRDT endpoints
+	s.HandleFunc("/{key}/crdt", s.getCRDTHandler()).Methods("GET")
+	s.HandleFunc("/{key}/crdt", s.updateCRDTHandler()).Methods("POST")
+	s.HandleFunc("/{key}/crdt/merge", s.mergeCRDTHandler()).Methods("POST")
+
 	// Key-Value store endpoints
 	s.HandleFunc("/{key}", s.putKeyIntoStoreHandler()).Methods("PUT")
 	s.HandleFunc("/{key}", s.getKeyValueHandler()).Methods("GET")
@@ -31,22 +41,36 @@ func (s *Server) putKeyIntoStoreHandler() func(w http.ResponseWriter, r *http.Re
 
 		key := vars["key"]
 
+		if err := store.CheckKey(key); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if max := store.CurrentLimits().MaxValueSize; max > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+
 		value, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
 
-		err = store.Put(key, string(value))
+		if s.consensus != nil {
+			err = s.propose(r, transcationlog.Event{EventType: transcationlog.EventPut, Key: key, Value: string(value), Principal: principalName(r)})
+		} else if s.replication != nil {
+			err = s.replicatedPut(r, key, string(value))
+		} else {
+			err = s.put(key, string(value), principalName(r))
+		}
+
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
 
-		s.transactionLog.WritePut(key, string(value))
-
 		w.WriteHeader(http.StatusCreated)
 	}
 }
@@ -57,13 +81,22 @@ func (s *Server) getKeyValueHandler() func(w http.ResponseWriter, r *http.Reques
 
 		key := vars["key"]
 
-		value, err := store.Get(key)
-		if errors.Is(err, store.ErrNoSuchKey) {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		if err := s.readIndex(r); err != nil {
+			writeError(w, err)
 			return
 		}
+
+		var value string
+		var err error
+
+		if s.replication != nil {
+			value, err = s.replicatedGet(r, key)
+		} else {
+			value, err = store.Get(key)
+		}
+
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
 
@@ -77,14 +110,47 @@ func (s *Server) deleteKeyValueHandler() func(w http.ResponseWriter, r *http.Req
 
 		key := vars["key"]
 
-		err := store.Delete(key)
+		var err error
+
+		if s.consensus != nil {
+			err = s.propose(r, transcationlog.Event{EventType: transcationlog.EventDelete, Key: key, Principal: principalName(r)})
+		} else if s.replication != nil {
+			err = s.replicatedDelete(r, key)
+		} else {
+			err = s.delete(key, principalName(r))
+		}
+
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
 
-		s.transactionLog.WriteDelete(key)
-
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// put and delete hold the key's lock until the write is logged, so the log
+// and the followers replaying it see concurrent writes in the store's order.
+func (s *Server) put(key, value, principal string) error {
+	defer store.LockKeys(key)()
+
+	if err := store.Put(key, value); err != nil {
+		return err
+	}
+
+	s.transactionLog.WritePut(key, value, principal)
+
+	return nil
+}
+
+func (s *Server) delete(key, principal string) error {
+	defer store.LockKeys(key)()
+
+	if err := store.Delete(key); err != nil {
+		return err
+	}
+
+	s.transactionLog.WriteDelete(key, principal)
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Partitioner assigns every key to the node that stores it, e.g. a
+// *cluster.Cluster. Nodes are named by the base URL of their REST API.
+type Partitioner interface {
+	Self() string
+	Owner(key string) string
+	Client() *http.Client
+	Forwarded(r *http.Request) bool
+	MarkForwarded(req *http.Request)
+}
+
+// PartitionMiddleware forwards requests for keys owned by another node to
+// that node, with the caller's credentials. Bulk requests are split by owner
+// and their results merged back in order. Requests already forwarded by a
+// node, as vouched for by the Partitioner, are always served locally.
+func PartitionMiddleware(p Partitioner, limits BulkLimits) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p.Forwarded(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if key, ok := mux.Vars(r)["key"]; ok {
+				if owner := p.Owner(key); owner != "" && owner != p.Self() {
+					forward(w, r, p, owner)
+					return
+				}
+			}
+
+			if strings.Contains(r.URL.Path, "/_bulk/") {
+				forwardBulk(w, r, p, limits, next)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forward(w http.ResponseWriter, r *http.Request, p Partitioner, owner string) {
+	target, err := url.Parse(owner)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid node %q: %v", owner, err), http.StatusInternalServerError)
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = p.Client().Transport
+
+	p.MarkForwarded(r)
+	proxy.ServeHTTP(w, r)
+}
+
+// forwardBulk sends each node the items it owns, all at once, or serves the
+// request locally when this node owns every item.
+func forwardBulk(w http.ResponseWriter, r *http.Request, p Partitioner, limits BulkLimits, next http.Handler) {
+	if limits.MaxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBytes)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	items, ndjson, err := decodeBulk(bytes.NewReader(body), limits.MaxItems)
+	if err != nil {
+		next.ServeHTTP(w, r) // let the handler report the error
+		return
+	}
+
+	groups := make(map[string][]int)
+	for i, item := range items {
+		owner := p.Owner(item.Key)
+		groups[owner] = append(groups[owner], i)
+	}
+
+	if _, local := groups[p.Self()]; len(groups) == 0 || (len(groups) == 1 && local) {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	results := make([]bulkResult, len(items))
+	wg := sync.WaitGroup{}
+
+	for owner, indexes := range groups {
+		wg.Add(1)
+
+		go func(owner string, indexes []int) {
+			defer wg.Done()
+
+			batch := make([]bulkItem, len(indexes))
+			for j, i := range indexes {
+				batch[j] = items[i]
+			}
+
+			res, err := sendBulk(r, p, owner, batch)
+			for j, i := range indexes {
+				if err != nil {
+					results[i] = bulkResult{Key: items[i].Key, Status: http.StatusBadGateway, Error: err.Error()}
+				} else {
+					results[i] = res[j]
+				}
+			}
+		}(owner, indexes)
+	}
+
+	wg.Wait()
+
+	writeBulk(w, results, ndjson)
+}
+
+func sendBulk(r *http.Request, p Partitioner, owner string, items []bulkItem) ([]bulkResult, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, owner+r.URL.Path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = r.Header.Clone()
+	p.MarkForwarded(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Del("Content-Length")
+
+	resp, err := p.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var results []bulkResult
+	if err = json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+
+	if len(results) != len(items) {
+		return nil, fmt.Errorf("%s returned %d results for %d items", owner, len(results), len(items))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,210 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud_native/pkg/cluster"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+// remoteNode stands in for the other node of a two-node cluster: it answers
+// GETs with the path it was asked for and bulk puts with a result per item,
+// and records the headers of every request.
+type remoteNode struct {
+	*httptest.Server
+
+	m       sync.Mutex
+	headers []http.Header
+}
+
+func newRemoteNode(t *testing.T) *remoteNode {
+	n := &remoteNode{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/_bulk/put", func(w http.ResponseWriter, r *http.Request) {
+		n.record(r)
+
+		var items []bulkItem
+		json.NewDecoder(r.Body).Decode(&items)
+
+		results := make([]bulkResult, len(items))
+		for i, item := range items {
+			results[i] = bulkResult{Key: item.Key, Status: http.StatusCreated, Value: "remote"}
+		}
+		json.NewEncoder(w).Encode(results)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		n.record(r)
+		fmt.Fprint(w, "remote "+r.URL.Path)
+	})
+
+	n.Server = httptest.NewServer(mux)
+	t.Cleanup(n.Close)
+
+	return n
+}
+
+func (n *remoteNode) record(r *http.Request) {
+	n.m.Lock()
+	n.headers = append(n.headers, r.Header.Clone())
+	n.m.Unlock()
+}
+
+func (n *remoteNode) requests() []http.Header {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	return append([]http.Header(nil), n.headers...)
+}
+
+// newPartitionedServer returns a server that owns part of the keyspace, the
+// rest belonging to remote. It also listens on its node's URL, since a bulk
+// request spanning several nodes reaches each of them over HTTP.
+func newPartitionedServer(t *testing.T, remote *remoteNode, key string) (*Server, *cluster.Cluster) {
+	srv, _ := newTestServer(t, store.Limits{})
+
+	node := httptest.NewServer(srv)
+	t.Cleanup(node.Close)
+
+	c := cluster.New(node.URL, []string{node.URL, remote.URL}, remote.Client(), key, discardLog{})
+	srv.Use(PartitionMiddleware(c, srv.BulkLimits))
+
+	return srv, c
+}
+
+type discardLog struct{}
+
+func (discardLog) WriteBatch([]transcationlog.Event) {}
+
+// keyOwnedBy returns the nth key owned by node.
+func keyOwnedBy(t *testing.T, c *cluster.Cluster, node string, n int) string {
+	for i := range 1000 {
+		key := fmt.Sprintf("key-%d", i)
+		if c.Owner(key) != node {
+			continue
+		}
+		if n == 0 {
+			return key
+		}
+		n--
+	}
+
+	t.Fatalf("no key owned by %s", node)
+	return ""
+}
+
+func TestPartitionForwards(t *testing.T) {
+	remote := newRemoteNode(t)
+	srv, c := newPartitionedServer(t, remote, "cluster-key")
+
+	local, other := keyOwnedBy(t, c, c.Self(), 0), keyOwnedBy(t, c, remote.URL, 0)
+
+	if w := do(srv, "PUT", "/v1/"+local, "v"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT of a local key = %d %s", w.Code, w.Body)
+	}
+	if n := len(remote.requests()); n != 0 {
+		t.Fatalf("the remote node got %d requests for a local key", n)
+	}
+
+	// A key of the other node is forwarded with the caller's credentials.
+	r := httptest.NewRequest("GET", "/v1/"+other, nil)
+	r.Header.Set("X-API-Key", "client")
+
+	w := serve(srv, r)
+	if w.Code != http.StatusOK || w.Body.String() != "remote /v1/"+other {
+		t.Fatalf("GET of a remote key = %d %q, want it served by the remote node", w.Code, w.Body)
+	}
+
+	reqs := remote.requests()
+	if len(reqs) != 1 {
+		t.Fatalf("the remote node got %d requests, want 1", len(reqs))
+	}
+	h := reqs[0]
+	if h.Get("X-API-Key") != "client" || h.Get(cluster.ForwardedHeader) != c.Self() || h.Get(cluster.PeerKeyHeader) != "cluster-key" {
+		t.Fatalf("forwarded with headers %v, want the caller's key and the cluster's", h)
+	}
+}
+
+func TestPartitionTrust(t *testing.T) {
+	remote := newRemoteNode(t)
+
+	tests := []struct {
+		name       string
+		clusterKey string
+		peerKey    string
+		forwarded  bool
+	}{
+		{"from a node", "cluster-key", "cluster-key", false},
+		{"wrong cluster key", "cluster-key", "guess", true},
+		{"no cluster key", "cluster-key", "", true},
+		{"cluster without a key", "", "", true},
+	}
+
+	for _, tt := range tests {
+		srv, c := newPartitionedServer(t, remote, tt.clusterKey)
+		before := len(remote.requests())
+
+		r := httptest.NewRequest("GET", "/v1/"+keyOwnedBy(t, c, remote.URL, 0), nil)
+		r.Header.Set(cluster.ForwardedHeader, "http://node.invalid")
+		if tt.peerKey != "" {
+			r.Header.Set(cluster.PeerKeyHeader, tt.peerKey)
+		}
+
+		w := serve(srv, r)
+
+		// A trusted request is served locally, where the key is missing.
+		if forwarded := len(remote.requests()) > before; forwarded != tt.forwarded || (!forwarded && w.Code != http.StatusNotFound) {
+			t.Errorf("%s: forwarded = %v, status %d, want forwarded = %v", tt.name, forwarded, w.Code, tt.forwarded)
+		}
+	}
+}
+
+func TestPartitionBulk(t *testing.T) {
+	remote := newRemoteNode(t)
+	srv, c := newPartitionedServer(t, remote, "cluster-key")
+
+	keys := []string{keyOwnedBy(t, c, remote.URL, 0), keyOwnedBy(t, c, c.Self(), 0), keyOwnedBy(t, c, remote.URL, 1)}
+
+	items := make([]string, len(keys))
+	for i, k := range keys {
+		items[i] = fmt.Sprintf(`{"key": %q, "value": "v"}`, k)
+	}
+	body := "[" + strings.Join(items, ",") + "]"
+
+	w := do(srv, "POST", "/v1/_bulk/put", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk put = %d %s", w.Code, w.Body)
+	}
+
+	// Results come back in the order of the items, wherever they were
+	// applied.
+	want := []bulkResult{
+		{Key: keys[0], Status: http.StatusCreated, Value: "remote"},
+		{Key: keys[1], Status: http.StatusCreated},
+		{Key: keys[2], Status: http.StatusCreated, Value: "remote"},
+	}
+	if got := bulkResults(t, w.Body.String()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("bulk put = %+v, want %+v", got, want)
+	}
+	if v, err := store.Get(keys[1]); v != "v" || err != nil {
+		t.Fatalf("Get(%s) = %q, %v, want the local item applied", keys[1], v, err)
+	}
+	if reqs := remote.requests(); len(reqs) != 1 {
+		t.Fatalf("the remote node got %d requests, want its items in one", len(reqs))
+	}
+
+	// The items of a node that cannot be reached fail alone.
+	remote.Close()
+
+	w = do(srv, "POST", "/v1/_bulk/put", body)
+	if got := fmt.Sprint(statuses(bulkResults(t, w.Body.String()))); got != "[502 201 502]" {
+		t.Fatalf("bulk put with the remote node down = %s, want [502 201 502]", got)
+	}
+}
@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud_native/patterns/reliability"
+	"github.com/gorilla/mux"
+)
+
+// RateLimit is the budget of requests of each client. With the token and
+// leaky bucket strategies, a client may make Burst requests at once and Rate
+// more every Interval, Burst more if Rate is zero. With the sliding window, a
+// client may make Burst requests in any Interval. In wait mode, requests over
+// the budget are delayed by up to MaxWait rather than rejected.
+type RateLimit struct {
+	Burst    uint
+	Rate     uint
+	Interval time.Duration
+	Strategy reliability.Strategy
+	Mode     reliability.LimitMode
+	MaxWait  time.Duration
+}
+
+func (l RateLimit) limiter() *reliability.KeyedLimiter {
+	if l.Burst == 0 {
+		return nil
+	}
+
+	return reliability.NewKeyedLimiter(reliability.LimiterOptions{
+		Strategy: l.Strategy,
+		Limit:    l.Burst,
+		Rate:     l.Rate,
+		Interval: l.Interval,
+		Mode:     l.Mode,
+		MaxWait:  l.MaxWait,
+	})
+}
+
+// RateLimitMiddleware limits every client, identified by its authenticated
+// principal or else its IP address, separately for reads and writes. A zero
+// Burst disables the limit.
+func RateLimitMiddleware(read, write RateLimit) mux.MiddlewareFunc {
+	readLimiter, writeLimiter := read.limiter(), write.limiter()
+
+	return rateLimit(clientID, func(r *http.Request) *reliability.KeyedLimiter {
+		if isRead(r) {
+			return readLimiter
+		}
+
+		return writeLimiter
+	})
+}
+
+// IPRateLimitMiddleware limits every IP address, across reads and writes.
+// Used before AuthMiddleware, it also limits the requests that fail
+// authentication, and so the guessing of credentials. A zero Burst disables
+// the limit.
+func IPRateLimitMiddleware(l RateLimit) mux.MiddlewareFunc {
+	limiter := l.limiter()
+
+	return rateLimit(clientIP, func(*http.Request) *reliability.KeyedLimiter { return limiter })
+}
+
+// rateLimit limits the requests of each client id to the budget of the
+// limiter they are given; a nil limiter lets them through.
+func rateLimit(id func(r *http.Request) string, limiterFor func(r *http.Request) *reliability.KeyedLimiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := limiterFor(r)
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			a, err := limiter.Acquire(r.Context(), id(r))
+
+			w.Header().Set("X-RateLimit-Limit", strconv.FormatUint(uint64(a.Limit), 10))
+			w.Header().Set("X-RateLimit-Remaining", strconv.FormatUint(uint64(a.Remaining), 10))
+			w.Header().Set("X-RateLimit-Reset", seconds(a.Reset))
+
+			if err != nil {
+				w.Header().Set("Retry-After", seconds(a.RetryAfter))
+				http.Error(w, reliability.ErrTooManyCalls.Error(), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isRead(r *http.Request) bool {
+	if strings.HasSuffix(r.URL.Path, "/_bulk/get") {
+		return true
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// clientID identifies the caller by its authenticated principal, falling
+// back to its IP. Unverified credentials are not used, since a client could
+// get a fresh budget with every made-up key.
+func clientID(r *http.Request) string {
+	if name := principalName(r); name != "" {
+		return "principal:" + name
+	}
+
+	return clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// seconds rounds d up to whole seconds, as expected by Retry-After.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+)
+
+// request builds a request from addr, authenticated as principal if not
+// empty.
+func request(method, target, addr, principal string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.RemoteAddr = addr
+
+	if principal != "" {
+		r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Name: principal}))
+	}
+
+	return r
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	srv, _ := newTestServer(t, store.Limits{})
+	srv.Use(RateLimitMiddleware(
+		RateLimit{Burst: 2, Interval: time.Hour},
+		RateLimit{Burst: 1, Interval: time.Hour},
+	))
+
+	const client = "192.0.2.1:1234"
+
+	for i := range 2 {
+		w := serve(srv, request("GET", "/v1/key", client, ""))
+		if w.Code == http.StatusTooManyRequests {
+			t.Fatalf("read %d within the burst = %d", i, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Fatalf("X-RateLimit-Limit = %q, want 2", got)
+		}
+	}
+
+	w := serve(srv, request("GET", "/v1/key", client, ""))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("read over the burst = %d, Retry-After %q; want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Writes have a budget of their own.
+	if w := serve(srv, request("PUT", "/v1/key", client, "")); w.Code != http.StatusCreated {
+		t.Fatalf("write after the reads ran out = %d, want 201", w.Code)
+	}
+	if w := serve(srv, request("PUT", "/v1/key", client, "")); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("write over the burst = %d, want 429", w.Code)
+	}
+
+	// So do other addresses.
+	if w := serve(srv, request("GET", "/v1/key", "192.0.2.2:1234", "")); w.Code == http.StatusTooManyRequests {
+		t.Fatal("another address was limited by the first one's reads")
+	}
+}
+
+func TestRateLimitByPrincipal(t *testing.T) {
+	srv, _ := newTestServer(t, store.Limits{})
+	srv.Use(RateLimitMiddleware(RateLimit{Burst: 1, Interval: time.Hour}, RateLimit{}))
+
+	const client = "192.0.2.1:1234"
+
+	// Principals behind the same address are limited separately, and apart
+	// from the unauthenticated requests of that address.
+	for _, principal := range []string{"alice", "bob", ""} {
+		if w := serve(srv, request("GET", "/v1/key", client, principal)); w.Code == http.StatusTooManyRequests {
+			t.Fatalf("first read of %q = 429", principal)
+		}
+		if w := serve(srv, request("GET", "/v1/key", client, principal)); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("second read of %q = %d, want 429", principal, w.Code)
+		}
+	}
+
+	// Unverified credentials do not buy a fresh budget.
+	r := request("GET", "/v1/key", client, "")
+	r.Header.Set("X-API-Key", "made-up")
+
+	if w := serve(srv, r); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("read with an unverified key = %d, want 429", w.Code)
+	}
+}
+
+func TestIPRateLimitBeforeAuth(t *testing.T) {
+	srv, _ := newTestServer(t, store.Limits{})
+	srv.Use(IPRateLimitMiddleware(RateLimit{Burst: 2, Interval: time.Hour}))
+	srv.Use(AuthMiddleware(auth.APIKeys{"secret": "alice"}, auth.Policy{{Principal: "alice", Permission: auth.PermissionAdmin}}))
+
+	const client = "192.0.2.1:1234"
+
+	for i := range 2 {
+		r := request("GET", "/v1/key", client, "")
+		r.Header.Set("X-API-Key", "guess")
+
+		if w := serve(srv, r); w.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d = %d, want 401", i, w.Code)
+		}
+	}
+
+	r := request("GET", "/v1/key", client, "")
+	r.Header.Set("X-API-Key", "guess")
+
+	if w := serve(srv, r); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("guess over the burst = %d, want 429", w.Code)
+	}
+}
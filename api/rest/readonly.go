@@ -0,0 +1,31 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+// ReadOnlyMiddleware serves reads locally and either forwards writes to the
+// leader, when proxy is set, or rejects them with 421 Misdirected Request and
+// the leader's address in X-Leader.
+func ReadOnlyMiddleware(leader *url.URL, proxy *httputil.ReverseProxy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isRead(r) || isAdmin(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if proxy != nil {
+				proxy.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-Leader", leader.String())
+			http.Error(w, "read-only follower, write to the leader", http.StatusMisdirectedRequest)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"cloud_native/pkg/cluster"
+	"cloud_native/pkg/crdt"
+)
+
+// Replicator reads and writes keys on several replicas at the consistency
+// level asked for, e.g. a *cluster.Quorum.
+type Replicator interface {
+	Get(ctx context.Context, key string, level cluster.Consistency) (string, error)
+	Put(ctx context.Context, key, value, principal string, level cluster.Consistency) error
+	Delete(ctx context.Context, key, principal string, level cluster.Consistency) error
+	Update(ctx context.Context, key string, o crdt.Op, principal string, level cluster.Consistency) (crdt.CRDT, error)
+	Merge(ctx context.Context, key string, c crdt.CRDT, principal string, level cluster.Consistency) error
+}
+
+// UseReplication serves keys through rep instead of the local store. The
+// consistency level of each request comes from the X-Consistency header.
+func (s *Server) UseReplication(rep Replicator) {
+	s.replication = rep
+}
+
+func consistency(r *http.Request) (cluster.Consistency, error) {
+	return cluster.ParseConsistency(r.Header.Get(cluster.ConsistencyHeader))
+}
+
+func (s *Server) replicatedGet(r *http.Request, key string) (string, error) {
+	level, err := consistency(r)
+	if err != nil {
+		return "", err
+	}
+
+	return s.replication.Get(r.Context(), key, level)
+}
+
+func (s *Server) replicatedPut(r *http.Request, key, value string) error {
+	level, err := consistency(r)
+	if err != nil {
+		return err
+	}
+
+	return s.replication.Put(r.Context(), key, value, principalName(r), level)
+}
+
+func (s *Server) replicatedDelete(r *http.Request, key string) error {
+	level, err := consistency(r)
+	if err != nil {
+		return err
+	}
+
+	return s.replication.Delete(r.Context(), key, principalName(r), level)
+}
+
+// replicateBulk applies the items that have no result yet one by one, each
+// at the request's consistency level.
+func (s *Server) replicateBulk(r *http.Request, status int, items []bulkItem, results []bulkResult, apply func(item bulkItem) (string, error)) {
+	for i, item := range items {
+		if results[i].Status != 0 {
+			continue
+		}
+
+		value, err := apply(item)
+		if err != nil {
+			results[i] = errorResult(item.Key, err)
+			continue
+		}
+
+		results[i] = bulkResult{Key: item.Key, Status: status, Value: value}
+	}
+}
@@ -1,13 +1,19 @@
 package rest
 
 import (
+	"sync"
+
 	"cloud_native/pkg/transcationlog"
 	"github.com/gorilla/mux"
 )
 
+// apiPrefix is the path every route of the API is served under.
+const apiPrefix = "/v1"
+
 type TransactionLogger interface {
-	WritePut(key, value string)
-	WriteDelete(key string)
+	WritePut(key, value, principal string)
+	WriteDelete(key, principal string)
+	WriteBatch(events []transcationlog.Event)
 	Err() <-chan error
 	ReadEvents() (<-chan transcationlog.Event, <-chan error)
 	Run()
@@ -17,16 +23,25 @@ type TransactionLogger interface {
 type Server struct {
 	*mux.Router
 	transactionLog TransactionLogger
+	consensus      Consensus
+	replication    Replicator
+	crdtUpdates    sync.Mutex
+
+	BulkLimits BulkLimits
+
+	// ReplicaID names this node in the state of the CRDTs it updates.
+	ReplicaID string
 }
 
 func NewServer(transactionLog TransactionLogger) *Server {
 	r := mux.NewRouter()
 
-	api := r.PathPrefix("/v1").Subrouter()
+	api := r.PathPrefix(apiPrefix).Subrouter()
 
 	srv := &Server{
 		Router:         api,
 		transactionLog: transactionLog,
+		BulkLimits:     BulkLimits{MaxItems: DefaultBulkMaxItems, MaxBytes: DefaultBulkMaxBytes},
 	}
 
 	srv.AddRoutes()
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud_native/api/rest"
+	"cloud_native/pkg/certs"
+	"cloud_native/pkg/cluster"
+)
+
+// startCluster partitions the keyspace across -cluster-nodes, forwarding
+// requests for keys this node does not own, or with -cluster-replicas above 1,
+// serving them from a quorum of the nodes holding the key.
+func startCluster(ctx context.Context, srv *rest.Server) (*cluster.Cluster, error) {
+	transport, err := peerTransport(*clusterCA)
+	if err != nil {
+		return nil, err
+	}
+
+	if *clusterAPIKey == "" {
+		log.Println("Without -cluster-api-key, requests forwarded by other nodes cannot be told from clients' and are forwarded again")
+	}
+
+	c := cluster.New(*clusterSelf, strings.Split(*clusterNodes, ","), &http.Client{Transport: transport}, *clusterAPIKey, transact)
+
+	srv.HandleFunc("/_cluster/nodes", c.NodesHandler()).Methods("GET")
+	srv.HandleFunc("/_cluster/nodes", c.SetNodesHandler()).Methods("PUT")
+	srv.HandleFunc("/_cluster/handoff", c.HandoffHandler()).Methods("POST")
+
+	if *clusterReplicas > 1 {
+		q, err := cluster.NewQuorum(c, *clusterReplicas, majority(*clusterR), majority(*clusterW))
+		if err != nil {
+			return nil, err
+		}
+
+		srv.HandleFunc("/_cluster/replica/read", c.ReplicaReadHandler()).Methods("POST")
+		srv.HandleFunc("/_cluster/replica/write", c.ReplicaWriteHandler()).Methods("POST")
+		srv.HandleFunc("/_cluster/tree", q.TreeHandler()).Methods("POST")
+		srv.HandleFunc("/_cluster/range", q.RangeHandler()).Methods("POST")
+		srv.HandleFunc("/_admin/repair", q.RepairHandler()).Methods("POST")
+		srv.UseReplication(q)
+
+		go q.Run(ctx, 5*time.Second)
+
+		if *antiEntropy > 0 {
+			go q.AntiEntropy(ctx, *antiEntropy)
+		}
+	} else {
+		srv.Use(rest.PartitionMiddleware(c, srv.BulkLimits))
+	}
+
+	go c.Run(ctx)
+
+	return c, nil
+}
+
+// majority returns n, or if it is 0, a majority of -cluster-replicas.
+func majority(n int) int {
+	if n == 0 {
+		return *clusterReplicas/2 + 1
+	}
+
+	return n
+}
+
+// peerTransport reaches other nodes over TLS, trusting the CAs in caFile, or
+// the system pool if it is empty.
+func peerTransport(caFile string) (*http.Transport, error) {
+	tlsConfig := &tls.Config{}
+
+	if caFile != "" {
+		pool, err := certs.LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"cloud_native/api/rest"
+	"cloud_native/pkg/consensus"
+	"github.com/hashicorp/raft"
+)
+
+// startConsensus joins this node to the Raft group given by the -raft-*
+// flags, applying committed writes to the store.
+func startConsensus() (*consensus.Node, error) {
+	advertise, err := net.ResolveTCPAddr("tcp", *raftAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -raft-addr: %w", err)
+	}
+
+	if advertise.IP == nil || advertise.IP.IsUnspecified() {
+		return nil, fmt.Errorf("-raft-addr %q must name the host peers reach this node on", *raftAddr)
+	}
+
+	transport, err := raft.NewTCPTransport(*raftAddr, advertise, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for raft: %w", err)
+	}
+
+	node, err := consensus.NewNode(consensus.Config{
+		ID:        *raftID,
+		Transport: transport,
+		State:     consensus.StoreState{},
+		Dir:       *raftDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	peers, err := parsePeers(*raftPeers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes missing from the initial members wait to be added through the
+	// leader's /_raft/join.
+	for _, p := range peers {
+		if p.ID == *raftID {
+			return node, node.Bootstrap(peers)
+		}
+	}
+
+	return node, nil
+}
+
+func serveConsensus(srv *rest.Server, node *consensus.Node) {
+	srv.UseConsensus(node)
+
+	srv.HandleFunc("/_raft/status", node.StatusHandler()).Methods("GET")
+	srv.HandleFunc("/_raft/join", node.JoinHandler()).Methods("POST")
+	srv.HandleFunc("/_raft/leave", node.LeaveHandler()).Methods("POST")
+	srv.HandleFunc("/_raft/snapshot", node.SnapshotHandler()).Methods("POST")
+}
+
+// parsePeers parses "id=host:port,..." into servers.
+func parsePeers(s string) ([]consensus.Server, error) {
+	servers := make([]consensus.Server, 0)
+	if s == "" {
+		return servers, nil
+	}
+
+	for _, peer := range strings.Split(s, ",") {
+		id, addr, ok := strings.Cut(strings.TrimSpace(peer), "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("invalid -raft-peers entry %q, want id=host:port", peer)
+		}
+
+		servers = append(servers, consensus.Server{ID: id, Address: addr})
+	}
+
+	return servers, nil
+}
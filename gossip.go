@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"cloud_native/api/rest"
+	"cloud_native/pkg/cluster"
+)
+
+// startGossip joins the gossip pool given by the -gossip-* flags. When c is
+// set, its ring follows the members that partition keys.
+func startGossip(ctx context.Context, srv *rest.Server, c *cluster.Cluster) error {
+	host, port, err := net.SplitHostPort(*gossipAddr)
+	if err != nil {
+		return fmt.Errorf("invalid -gossip-addr: %w", err)
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid -gossip-addr port: %w", err)
+	}
+
+	var key []byte
+	if *gossipKey != "" {
+		if key, err = base64.StdEncoding.DecodeString(*gossipKey); err != nil {
+			return fmt.Errorf("invalid -gossip-key: %w", err)
+		}
+	}
+
+	name := *nodeName
+	if name == "" {
+		hostname, _ := os.Hostname()
+		name = hostname + ":" + port
+	}
+
+	meta := cluster.Meta{Address: *clusterSelf, Role: role()}
+	if c != nil {
+		meta.Vnodes = cluster.DefaultVirtualNodes
+	}
+
+	m, err := cluster.NewMembership(cluster.MembershipConfig{
+		Name:          name,
+		BindAddr:      host,
+		BindPort:      p,
+		AdvertiseAddr: host,
+		AdvertisePort: p,
+		SecretKey:     key,
+		Meta:          meta,
+	})
+	if err != nil {
+		return err
+	}
+
+	srv.HandleFunc("/_cluster/members", m.MembersHandler()).Methods("GET")
+
+	if c != nil {
+		go c.Follow(ctx, m)
+	}
+
+	if *gossipSeeds != "" {
+		go joinSeeds(ctx, m, strings.Split(*gossipSeeds, ","))
+	}
+
+	go leaveOnSignal(m)
+
+	return nil
+}
+
+// leaveOnSignal announces the departure on SIGINT or SIGTERM, so that the
+// others drop this node at once rather than after the failure detector
+// declares it dead, then writes out the transaction log and exits.
+func leaveOnSignal(m *cluster.Membership) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	log.Printf("gossip: leaving after %v", <-sig)
+
+	if err := m.Leave(5 * time.Second); err != nil {
+		log.Printf("gossip: cannot leave: %v", err)
+	}
+
+	if transact != nil {
+		if err := transact.Close(); err != nil {
+			log.Printf("gossip: cannot close the transaction log: %v", err)
+		}
+	}
+
+	os.Exit(0)
+}
+
+// joinSeeds retries until one of the seeds answers, since they may start
+// after this node.
+func joinSeeds(ctx context.Context, m *cluster.Membership, seeds []string) {
+	backoff := time.Second
+
+	for {
+		_, err := m.Join(seeds)
+		if err == nil {
+			return
+		}
+
+		log.Printf("gossip: cannot join %v: %v; retrying in %v", seeds, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+// role is announced to the other members.
+func role() string {
+	switch {
+	case *raftID != "":
+		return "raft"
+	case *leaderURL != "":
+		return "follower"
+	case *clusterSelf != "":
+		return "partition"
+	}
+
+	return "leader"
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	kvgrpc "cloud_native/api/grpc"
+	"cloud_native/pkg/auth"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func serveGRPC(addr string, tlsConfig *tls.Config, authenticator auth.Authenticator, policy auth.Policy) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC: %w", err)
+	}
+
+	opts := []grpclib.ServerOption{grpclib.Creds(credentials.NewTLS(tlsConfig))}
+	if authenticator != nil {
+		opts = append(opts, kvgrpc.AuthInterceptors(authenticator, policy)...)
+	}
+
+	srv := kvgrpc.NewServer(transact)
+	if readOnly() {
+		srv.ReadOnly()
+	}
+
+	g := grpclib.NewServer(opts...)
+	srv.Register(g)
+
+	return g.Serve(lis)
+}
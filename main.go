@@ -1,114 +1,278 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-
+	"os"
+	"time"
+
+	"cloud_native/api/rest"
+	"cloud_native/patterns/reliability"
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/cluster"
+	"cloud_native/pkg/consensus"
+	"cloud_native/pkg/replication"
 	"cloud_native/pkg/store"
 	"cloud_native/pkg/transcationlog"
-	"github.com/gorilla/mux"
 )
 
-type TransactionLogger interface {
-	WritePut(key, value string)
-	WriteDelete(key string)
-	Err() <-chan error
-	ReadEvents() (<-chan transcationlog.Event, <-chan error)
-	Run()
-	Close() error
-}
+var transact rest.TransactionLogger
+
+var (
+	addr = flag.String("addr", ":8080", "address of the REST listener")
+
+	maxKeyLength = flag.Int("max-key-length", store.DefaultMaxKeyLength, "maximum key length in bytes, 0 for unlimited")
+	maxValueSize = flag.Int64("max-value-size", store.DefaultMaxValueSize, "maximum value size in bytes, 0 for unlimited")
+	maxStoreSize = flag.Int64("max-store-size", 0, "maximum total size of all keys and values in bytes, 0 for unlimited")
+
+	readBurst  = flag.Uint("read-burst", 0, "per-client read burst size, 0 disables read rate limiting")
+	readRate   = flag.Uint("read-rate", 0, "per-client reads refilled per second, 0 for the read burst")
+	writeBurst = flag.Uint("write-burst", 0, "per-client write burst size, 0 disables write rate limiting")
+	writeRate  = flag.Uint("write-rate", 0, "per-client writes refilled per second, 0 for the write burst")
+
+	ipBurst = flag.Uint("ip-burst", 0, "per-IP burst size of all requests, counted before authentication so that it also limits guessing credentials; 0 disables it")
+	ipRate  = flag.Uint("ip-rate", 0, "per-IP requests refilled per second, 0 for the IP burst")
+
+	rateLimitStrategy = flag.String("rate-limit-strategy", "token-bucket", "rate limiting algorithm: token-bucket, leaky-bucket or sliding-window, where the burst is the limit per second")
+	rateLimitMode     = flag.String("rate-limit-mode", "reject", "what to do with requests over the rate limit: reject or wait")
+	rateLimitMaxWait  = flag.Duration("rate-limit-max-wait", time.Second, "in wait mode, longest a request waits before it is rejected, 0 for as long as the client waits")
+
+	bulkMaxItems = flag.Int("bulk-max-items", rest.DefaultBulkMaxItems, "maximum number of items in a bulk request, 0 for unlimited")
+	bulkMaxBytes = flag.Int64("bulk-max-bytes", rest.DefaultBulkMaxBytes, "maximum body size of a bulk request in bytes, 0 for unlimited")
+
+	authConfig = flag.String("auth-config", "", "path to the JSON authentication and ACL config, empty disables authentication")
+
+	grpcAddr  = flag.String("grpc-addr", ":9090", "address of the gRPC listener, empty disables it")
+	redisAddr = flag.String("redis-addr", "", "address of the Redis protocol listener, e.g. :6379; empty disables it")
+	redisTLS  = flag.Bool("redis-tls", false, "serve the Redis protocol over TLS")
+
+	memcachedAddr      = flag.String("memcached-addr", "", "address of the memcached protocol listener, e.g. :11211; empty disables it")
+	memcachedPrincipal = flag.String("memcached-principal", "", "principal whose grants apply to memcached clients when authentication is enabled")
+
+	tlsCert       = flag.String("tls-cert", "cert.pem", "path to the PEM server certificate")
+	tlsKey        = flag.String("tls-key", "key.pem", "path to the PEM server private key")
+	tlsClientCA   = flag.String("tls-client-ca", "", "path to the PEM bundle of CAs trusted to sign client certificates")
+	tlsClientAuth = flag.String("tls-client-auth", "none", "client certificate verification: none, optional or require")
+	tlsMinVersion = flag.String("tls-min-version", "1.2", "minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	tlsReload     = flag.Duration("tls-reload-interval", 30*time.Second, "how often to check the certificate files for changes")
+	tlsDev        = flag.Bool("tls-dev", false, "serve an ephemeral self-signed certificate instead of -tls-cert/-tls-key")
+
+	leaderURL          = flag.String("leader-url", "", "REST API of the leader to follow, e.g. https://leader:8080/v1; empty runs as the leader")
+	leaderCA           = flag.String("leader-ca", "", "path to the PEM bundle of CAs trusted to sign the leader's certificate")
+	leaderAPIKey       = flag.String("leader-api-key", "", "API key a follower presents to the leader")
+	followerWrites     = flag.String("follower-writes", "reject", "what a follower does with REST writes: reject or forward")
+	replicationBacklog = flag.Int("replication-backlog", replication.DefaultBacklog, "number of recent events the leader keeps for followers")
+
+	raftID    = flag.String("raft-id", "", "ID of this node in a Raft group; empty disables clustered mode")
+	raftAddr  = flag.String("raft-addr", "127.0.0.1:7000", "host:port Raft peers reach this node on")
+	raftDir   = flag.String("raft-dir", "raft", "directory holding the Raft log and snapshots")
+	raftPeers = flag.String("raft-peers", "", "initial members of a new group as id=host:port,...; nodes not listed wait to be joined")
+
+	clusterSelf   = flag.String("cluster-self", "", "base URL of this node's REST API, e.g. https://node1:8080; setting it partitions keys across -cluster-nodes")
+	clusterNodes  = flag.String("cluster-nodes", "", "comma-separated base URLs of every node in the cluster, including -cluster-self")
+	clusterCA     = flag.String("cluster-ca", "", "path to the PEM bundle of CAs trusted to sign the other nodes' certificates")
+	clusterAPIKey = flag.String("cluster-api-key", "", "API key the nodes present to each other, also proving requests forwarded between them")
+
+	clusterReplicas = flag.Int("cluster-replicas", 1, "number of nodes holding each key; above 1, requests are served by a quorum of them")
+	clusterR        = flag.Int("cluster-r", 0, "replicas a read waits for by default; 0 is a majority of -cluster-replicas")
+	clusterW        = flag.Int("cluster-w", 0, "replicas a write waits for by default; 0 is a majority of -cluster-replicas")
+	antiEntropy     = flag.Duration("anti-entropy-interval", time.Minute, "how often replicas compare their keys and repair differences, 0 disables it")
 
-var transact TransactionLogger
+	gossipAddr  = flag.String("gossip-addr", "", "host:port of the UDP and TCP gossip listener, also announced to the other nodes; empty disables gossip")
+	gossipSeeds = flag.String("gossip-seeds", "", "comma-separated host:port of gossip members to join; with -cluster-self, the ring then follows the members")
+	gossipKey   = flag.String("gossip-key", "", "base64 AES key of 16, 24 or 32 bytes encrypting gossip")
+	nodeName    = flag.String("node-name", "", "unique name of this node among the gossip members, the hostname and gossip port if empty")
+)
 
 func main() {
+	flag.Parse()
+
 	fmt.Println("Starting the server")
-	r := mux.NewRouter()
 
-	err := initializeTransactionLog()
+	var leader *replication.Leader
+	var node *consensus.Node
+	var err error
+
+	if countSet(*raftID, *leaderURL, *clusterSelf) > 1 {
+		panic("-raft-id, -leader-url and -cluster-self are mutually exclusive")
+	}
+
+	store.SetLimits(store.Limits{
+		MaxKeyLength: *maxKeyLength,
+		MaxValueSize: *maxValueSize,
+		MaxStoreSize: *maxStoreSize,
+	})
+
+	switch {
+	case *raftID != "":
+		// The Raft log replaces the transaction log in clustered mode.
+		if node, err = startConsensus(); err != nil {
+			panic(err)
+		}
+	case *leaderURL == "":
+		leader = replication.NewLeader(*replicationBacklog)
+		if err = initializeTransactionLog(leader); err != nil {
+			panic(err)
+		}
+	}
+
+	go store.RunExpiry(context.Background(), time.Second)
+
+	srv := rest.NewServer(transact)
+	srv.BulkLimits = rest.BulkLimits{MaxItems: *bulkMaxItems, MaxBytes: *bulkMaxBytes}
+	srv.ReplicaID = replicaID()
+
+	strategy, err := reliability.ParseStrategy(*rateLimitStrategy)
+	if err != nil {
+		panic(err)
+	}
+	mode, err := reliability.ParseLimitMode(*rateLimitMode)
 	if err != nil {
 		panic(err)
 	}
 
-	api := r.PathPrefix("/v1").Subrouter()
+	srv.Use(rest.IPRateLimitMiddleware(
+		rest.RateLimit{Burst: *ipBurst, Rate: *ipRate, Interval: time.Second, Strategy: strategy, Mode: mode, MaxWait: *rateLimitMaxWait},
+	))
 
-	api.HandleFunc("/", helloGoHandler)
-	api.HandleFunc("/{key}", putKeyIntoStoreHandler).Methods("PUT")
-	api.HandleFunc("/{key}", getKeyValueHandler).Methods("GET")
-	api.HandleFunc("/{key}", deleteKeyValueHandler).Methods("DELETE")
+	var authenticator auth.Authenticator
+	var policy auth.Policy
 
-	log.Fatal(http.ListenAndServeTLS(":8080", "cert.pem", "key.pem", r))
-}
+	if *authConfig != "" {
+		if authenticator, policy, err = loadAuth(*authConfig); err != nil {
+			panic(err)
+		}
 
-func helloGoHandler(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Hello Key-Value store! \n"))
-}
+		srv.Use(rest.AuthMiddleware(authenticator, policy))
+	}
 
-func putKeyIntoStoreHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+	srv.Use(rest.RateLimitMiddleware(
+		rest.RateLimit{Burst: *readBurst, Rate: *readRate, Interval: time.Second, Strategy: strategy, Mode: mode, MaxWait: *rateLimitMaxWait},
+		rest.RateLimit{Burst: *writeBurst, Rate: *writeRate, Interval: time.Second, Strategy: strategy, Mode: mode, MaxWait: *rateLimitMaxWait},
+	))
 
-	key := vars["key"]
+	var partitions *cluster.Cluster
 
-	value, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
+	if *clusterSelf != "" {
+		if partitions, err = startCluster(context.Background(), srv); err != nil {
+			panic(err)
+		}
+	}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if *gossipAddr != "" {
+		if err = startGossip(context.Background(), srv, partitions); err != nil {
+			panic(err)
+		}
+	}
+
+	switch {
+	case node != nil:
+		serveConsensus(srv, node)
+	case leader != nil:
+		serveLeader(srv, leader)
+	default:
+		if err = startFollower(context.Background(), srv); err != nil {
+			panic(err)
+		}
 	}
 
-	err = store.Put(key, string(value))
+	tlsConfig, err := newTLSConfig(context.Background())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		panic(err)
+	}
+
+	if *clusterSelf != "" && (*grpcAddr != "" || *redisAddr != "" || *memcachedAddr != "") {
+		// Only the REST API forwards requests to the node owning the key.
+		log.Println("Cluster mode serves the REST API only, the gRPC, Redis and memcached listeners are disabled")
+		*grpcAddr, *redisAddr, *memcachedAddr = "", "", ""
 	}
 
-	transact.WritePut(key, string(value))
+	if *grpcAddr != "" {
+		go func() {
+			log.Fatal(serveGRPC(*grpcAddr, tlsConfig, authenticator, policy))
+		}()
+	}
 
-	w.WriteHeader(http.StatusCreated)
-}
+	if *redisAddr != "" {
+		var redisTLSConfig *tls.Config
+		if *redisTLS {
+			redisTLSConfig = tlsConfig
+		}
 
-func getKeyValueHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+		go func() {
+			log.Fatal(serveRESP(*redisAddr, redisTLSConfig, authenticator, policy))
+		}()
+	}
 
-	key := vars["key"]
+	if *memcachedAddr != "" {
+		go func() {
+			log.Fatal(serveMemcache(*memcachedAddr, *memcachedPrincipal, authenticator, policy))
+		}()
+	}
 
-	value, err := store.Get(key)
-	if errors.Is(err, store.ErrNoSuchKey) {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+	server := &http.Server{
+		Addr:      *addr,
+		Handler:   srv,
+		TLSConfig: tlsConfig,
 	}
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+
+	log.Fatal(server.ListenAndServeTLS("", ""))
+}
+
+func countSet(flags ...string) int {
+	n := 0
+	for _, f := range flags {
+		if f != "" {
+			n++
+		}
 	}
 
-	w.Write([]byte(value))
+	return n
 }
 
-func deleteKeyValueHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+// replicaID names this node in the CRDTs it updates; it must differ between
+// the nodes writing to the same keys.
+func replicaID() string {
+	for _, id := range []string{*raftID, *clusterSelf, *nodeName} {
+		if id != "" {
+			return id
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	return hostname + *addr
+}
 
-	key := vars["key"]
+// readOnly reports whether the gRPC, Redis and memcached listeners must
+// reject writes: on a follower, and in clustered mode, where only the REST
+// API proposes writes to the group.
+func readOnly() bool {
+	return *leaderURL != "" || *raftID != ""
+}
 
-	err := store.Delete(key)
+func loadAuth(filename string) (auth.Authenticator, auth.Policy, error) {
+	cfg, err := auth.LoadConfig(filename)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, nil, err
 	}
 
-	transact.WriteDelete(key)
+	authenticator, err := cfg.Authenticator()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to configure authentication: %w", err)
+	}
 
-	w.WriteHeader(http.StatusNoContent)
+	return authenticator, cfg.Grants, nil
 }
 
-func initializeTransactionLog() error {
-	var err error
-
-	transact, err = transcationlog.NewFileTransactionLog("transaction.log")
-	//transact, err = transcationlog.NewPostgresTransactionLog(transcationlog.PostgresDBParams{
+// initializeTransactionLog replays the log into the store and into leader's
+// backlog, then keeps leader up to date with every write.
+func initializeTransactionLog(leader *replication.Leader) error {
+	logger, err := transcationlog.NewFileTransactionLog("transaction.log")
+	//logger, err = transcationlog.NewPostgresTransactionLog(transcationlog.PostgresDBParams{
 	//	DbName:   "postgres",
 	//	Host:     "localhost",
 	//	User:     "admin",
@@ -118,23 +282,22 @@ func initializeTransactionLog() error {
 		return fmt.Errorf("failed to create event logger: %w", err)
 	}
 
-	events, errs := transact.ReadEvents()
+	events, errs := logger.ReadEvents()
 	e, ok := transcationlog.Event{}, true
 
 	for ok && err == nil {
 		select {
 		case err, ok = <-errs:
 		case e, ok = <-events:
-			switch e.EventType {
-			case transcationlog.EventDelete:
-				err = store.Delete(e.Key)
-			case transcationlog.EventPut:
-				err = store.Put(e.Key, e.Value)
+			if err = transcationlog.Apply(e); err == nil {
+				leader.Append([]transcationlog.Event{e})
 			}
 		}
 	}
 
-	transact.Run()
+	logger.Observe(leader.Append)
+	logger.Run()
+	transact = logger
 
 	return err
 }
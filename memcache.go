@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"cloud_native/api/memcache"
+	"cloud_native/pkg/auth"
+)
+
+func serveMemcache(addr, principal string, authenticator auth.Authenticator, policy auth.Policy) error {
+	// The protocol has no authentication, so every client acts as principal.
+	if authenticator != nil && principal == "" {
+		return errors.New("-memcached-principal is required when authentication is enabled")
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for memcached: %w", err)
+	}
+
+	srv := memcache.NewServer(transact)
+	if readOnly() {
+		srv.ReadOnly()
+	}
+	if authenticator != nil {
+		srv.ActAs(principal, policy)
+	}
+
+	return srv.Serve(lis)
+}
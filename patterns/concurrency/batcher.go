@@ -0,0 +1,207 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrBatcherClosed = errors.New("batcher closed")
+
+// BatchFunc processes a batch. It returns nil if every item succeeded, or
+// one error per item, in order.
+type BatchFunc[T any] func(ctx context.Context, items []T) []error
+
+// BatcherOptions bound a batch: it is flushed once it holds MaxSize items,
+// or MaxWait after its first item arrived, whichever comes first. With no
+// MaxWait, a batch holds the items already waiting when it is flushed.
+type BatcherOptions struct {
+	MaxSize int
+	MaxWait time.Duration
+}
+
+// Batcher gathers items added concurrently into batches, so that many small
+// writes share the cost of one. Batches are processed one at a time, in the
+// order their items were added.
+type Batcher[T any] struct {
+	fn    BatchFunc[T]
+	opts  BatcherOptions
+	items chan batchItem[T]
+	done  chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closing sync.RWMutex
+	closed  bool
+}
+
+type batchItem[T any] struct {
+	item   T
+	result chan error
+}
+
+func NewBatcher[T any](fn BatchFunc[T], opts BatcherOptions) *Batcher[T] {
+	opts.MaxSize = max(opts.MaxSize, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &Batcher[T]{
+		fn:     fn,
+		opts:   opts,
+		items:  make(chan batchItem[T], opts.MaxSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	go b.run()
+
+	return b
+}
+
+// Add queues item and waits for the batch holding it to be processed, then
+// returns the item's error. If ctx is done first, Add returns its error, but
+// the item may still be processed.
+func (b *Batcher[T]) Add(ctx context.Context, item T) error {
+	result := make(chan error, 1)
+
+	if err := b.enqueue(ctx, batchItem[T]{item: item, result: result}); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher[T]) enqueue(ctx context.Context, i batchItem[T]) error {
+	b.closing.RLock()
+	defer b.closing.RUnlock()
+
+	if b.closed {
+		return ErrBatcherClosed
+	}
+
+	select {
+	case b.items <- i:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close processes the items already added and stops the batcher. A batch
+// still running past ctx is cancelled.
+func (b *Batcher[T]) Close(ctx context.Context) error {
+	b.closing.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.items)
+	}
+	b.closing.Unlock()
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-b.done
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher[T]) run() {
+	defer close(b.done)
+	defer b.cancel()
+
+	batch := make([]batchItem[T], 0, b.opts.MaxSize)
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	for {
+		var wait <-chan time.Time
+		if len(batch) > 0 {
+			wait = timer.C
+		}
+
+		select {
+		case i, ok := <-b.items:
+			if !ok {
+				b.flush(batch)
+				return
+			}
+
+			if len(batch) == 0 && b.opts.MaxWait > 0 {
+				timer.Reset(b.opts.MaxWait)
+			}
+
+			batch = append(batch, i)
+			if b.opts.MaxWait == 0 {
+				batch = b.drain(batch)
+			}
+
+			if len(batch) < b.opts.MaxSize && b.opts.MaxWait > 0 {
+				continue
+			}
+
+			timer.Stop()
+		case <-wait:
+		}
+
+		b.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// drain adds the items already queued to batch, up to MaxSize.
+func (b *Batcher[T]) drain(batch []batchItem[T]) []batchItem[T] {
+	for len(batch) < b.opts.MaxSize {
+		select {
+		case i, ok := <-b.items:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, i)
+		default:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+func (b *Batcher[T]) flush(batch []batchItem[T]) {
+	if len(batch) == 0 {
+		return
+	}
+
+	items := make([]T, len(batch))
+	for i, bi := range batch {
+		items[i] = bi.item
+	}
+
+	var errs []error
+	err := protect(func() error {
+		errs = b.fn(b.ctx, items)
+		return nil
+	})
+
+	for i, bi := range batch {
+		switch {
+		case err != nil:
+			bi.result <- err
+		case errs == nil:
+			bi.result <- nil
+		case i < len(errs):
+			bi.result <- errs[i]
+		default:
+			bi.result <- errors.New("batch function returned too few errors")
+		}
+	}
+}
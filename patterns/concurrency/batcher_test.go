@@ -0,0 +1,187 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+// recorder is a BatchFunc that records the batches it was given and fails
+// the negative items.
+type recorder struct {
+	m       sync.Mutex
+	batches [][]int
+}
+
+func (r *recorder) process(_ context.Context, items []int) []error {
+	r.m.Lock()
+	r.batches = append(r.batches, slices.Clone(items))
+	r.m.Unlock()
+
+	var errs []error
+	for i, n := range items {
+		if n < 0 {
+			if errs == nil {
+				errs = make([]error, len(items))
+			}
+			errs[i] = errFuture
+		}
+	}
+
+	return errs
+}
+
+func (r *recorder) sizes() []int {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var sizes []int
+	for _, b := range r.batches {
+		sizes = append(sizes, len(b))
+	}
+
+	return sizes
+}
+
+// addAll adds the items concurrently and returns their errors, in order.
+func addAll(ctx context.Context, b *Batcher[int], items ...int) []error {
+	errs := make([]error, len(items))
+
+	var wg sync.WaitGroup
+	for i, n := range items {
+		wg.Go(func() { errs[i] = b.Add(ctx, n) })
+	}
+	wg.Wait()
+
+	return errs
+}
+
+func TestBatcherFlushOnSize(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var r recorder
+		b := NewBatcher(r.process, BatcherOptions{MaxSize: 3, MaxWait: time.Hour})
+		defer b.Close(t.Context())
+
+		start := time.Now()
+		addAll(t.Context(), b, 1, 2, 3, 4, 5, 6)
+
+		if d := time.Since(start); d != 0 {
+			t.Fatalf("full batches were flushed after %v, want at once", d)
+		}
+		if sizes := r.sizes(); !slices.Equal(sizes, []int{3, 3}) {
+			t.Fatalf("batch sizes = %v, want [3 3]", sizes)
+		}
+	})
+}
+
+func TestBatcherFlushOnTime(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var r recorder
+		b := NewBatcher(r.process, BatcherOptions{MaxSize: 10, MaxWait: time.Second})
+		defer b.Close(t.Context())
+
+		start := time.Now()
+		addAll(t.Context(), b, 1, 2)
+
+		if d := time.Since(start); d != time.Second {
+			t.Fatalf("a partial batch was flushed after %v, want MaxWait", d)
+		}
+		if sizes := r.sizes(); !slices.Equal(sizes, []int{2}) {
+			t.Fatalf("batch sizes = %v, want [2]", sizes)
+		}
+	})
+}
+
+func TestBatcherItemErrors(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var r recorder
+		b := NewBatcher(r.process, BatcherOptions{MaxSize: 3, MaxWait: time.Second})
+		defer b.Close(t.Context())
+
+		errs := addAll(t.Context(), b, 1, -2, 3)
+		for i, want := range []error{nil, errFuture, nil} {
+			if !errors.Is(errs[i], want) {
+				t.Fatalf("Add() errors = %v, want only the second to fail", errs)
+			}
+		}
+	})
+}
+
+func TestBatcherBadBatchFunc(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		tooFew := NewBatcher(func(context.Context, []int) []error { return []error{nil} }, BatcherOptions{MaxSize: 2, MaxWait: time.Second})
+		defer tooFew.Close(t.Context())
+
+		// Either item may come second in the batch, and lack an error.
+		if errs := addAll(t.Context(), tooFew, 1, 2); (errs[0] == nil) == (errs[1] == nil) {
+			t.Fatalf("Add() errors = %v, want the item without an error to fail", errs)
+		}
+
+		panics := NewBatcher(func(context.Context, []int) []error { panic("boom") }, BatcherOptions{MaxSize: 2, MaxWait: time.Second})
+		defer panics.Close(t.Context())
+
+		for _, err := range addAll(t.Context(), panics, 1, 2) {
+			var perr *PanicError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Add() = %v, want a *PanicError for every item", err)
+			}
+		}
+	})
+}
+
+func TestBatcherClose(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var r recorder
+		b := NewBatcher(r.process, BatcherOptions{MaxSize: 10, MaxWait: time.Hour})
+
+		errs := make(chan error, 3)
+		for n := range 3 {
+			go func() { errs <- b.Add(t.Context(), n) }()
+		}
+		synctest.Wait()
+
+		// Close flushes the items waiting for MaxWait at once.
+		if err := b.Close(t.Context()); err != nil {
+			t.Fatalf("Close() = %v, want nil", err)
+		}
+		for range 3 {
+			if err := <-errs; err != nil {
+				t.Fatalf("Add() of an item closed before its batch = %v, want nil", err)
+			}
+		}
+		if sizes := r.sizes(); !slices.Equal(sizes, []int{3}) {
+			t.Fatalf("batch sizes = %v, want [3]", sizes)
+		}
+
+		if err := b.Add(t.Context(), 4); !errors.Is(err, ErrBatcherClosed) {
+			t.Fatalf("Add() after Close() = %v, want ErrBatcherClosed", err)
+		}
+	})
+}
+
+func TestBatcherCloseTimeout(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := NewBatcher(func(ctx context.Context, items []int) []error {
+			<-ctx.Done()
+			return []error{ctx.Err()}
+		}, BatcherOptions{MaxSize: 1})
+
+		added := make(chan error, 1)
+		go func() { added <- b.Add(t.Context(), 1) }()
+		synctest.Wait()
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+
+		if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Close() = %v, want context.DeadlineExceeded", err)
+		}
+		if err := <-added; !errors.Is(err, context.Canceled) {
+			t.Fatalf("Add() of the batch cut short = %v, want context.Canceled", err)
+		}
+	})
+}
@@ -1,19 +1,38 @@
 package concurrency
 
-import "sync"
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
 
-func Funnel(sources ...<-chan int) <-chan int {
-	dest := make(chan int) // The shared output channel
+// Funnel merges the sources into one channel, in the order values arrive,
+// until every source is closed or ctx is done. Either way the output is then
+// closed and no goroutine is left behind; sources should watch ctx as well,
+// since they are no longer read.
+func Funnel[T any](ctx context.Context, sources ...<-chan T) <-chan T {
+	dest := make(chan T) // The shared output channel
 
 	var wg sync.WaitGroup // Used to automatically close dest when all sources are closed
 
 	wg.Add(len(sources)) // Set the size of WaitGroup
 
 	for _, ch := range sources { // Start a routine for each source
-		go func(c <-chan int) {
+		go func(c <-chan T) {
 			defer wg.Done() // Notify WaitGroup when c closes
-			for n := range c {
-				dest <- n
+
+			for {
+				select {
+				case n, ok := <-c:
+					if !ok {
+						return
+					}
+					if !send(ctx, dest, n) {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
 			}
 		}(ch)
 	}
@@ -25,3 +44,85 @@ func Funnel(sources ...<-chan int) <-chan int {
 
 	return dest
 }
+
+// FunnelOrdered merges sources that are each sorted by less into one sorted
+// channel, until every source is closed or ctx is done. It waits for a value
+// from every open source before sending the least, so a source that stalls
+// stalls the output.
+func FunnelOrdered[T any](ctx context.Context, less func(a, b T) bool, sources ...<-chan T) <-chan T {
+	dest := make(chan T)
+
+	go func() {
+		defer close(dest)
+
+		h := &mergeHeap[T]{less: less}
+
+		// Prime the heap with the head of every source.
+		for _, c := range sources {
+			if !h.pull(ctx, c) && ctx.Err() != nil {
+				return
+			}
+		}
+
+		for h.Len() > 0 {
+			head := heap.Pop(h).(mergeItem[T])
+
+			if !send(ctx, dest, head.value) {
+				return
+			}
+
+			if !h.pull(ctx, head.source) && ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+
+	return dest
+}
+
+type mergeItem[T any] struct {
+	value  T
+	source <-chan T
+}
+
+// mergeHeap holds the head of each open source, least first.
+type mergeHeap[T any] struct {
+	items []mergeItem[T]
+	less  func(a, b T) bool
+}
+
+// pull reads the next value of c into the heap, and reports whether there
+// was one.
+func (h *mergeHeap[T]) pull(ctx context.Context, c <-chan T) bool {
+	select {
+	case v, ok := <-c:
+		if ok {
+			heap.Push(h, mergeItem[T]{value: v, source: c})
+		}
+		return ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (h *mergeHeap[T]) Len() int           { return len(h.items) }
+func (h *mergeHeap[T]) Less(i, j int) bool { return h.less(h.items[i].value, h.items[j].value) }
+func (h *mergeHeap[T]) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap[T]) Push(x any)         { h.items = append(h.items, x.(mergeItem[T])) }
+
+func (h *mergeHeap[T]) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+
+	return last
+}
+
+// send sends v on c unless ctx is done first, and reports whether it did.
+func send[T any](ctx context.Context, c chan<- T, v T) bool {
+	select {
+	case c <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -1,20 +1,87 @@
 package concurrency
 
-func Split(source <-chan int, n int) []<-chan int {
-	destinations := make([]<-chan int, 0) // Create dest slice
+import (
+	"context"
+	"hash/maphash"
+)
+
+// Split distributes the values of source across n channels, each value going
+// to whichever is read first, until source is closed or ctx is done. The
+// outputs are then closed. If n is not positive, there are no outputs and
+// source is not read.
+func Split[T any](ctx context.Context, source <-chan T, n int) []<-chan T {
+	if n <= 0 {
+		return nil
+	}
+
+	destinations := make([]<-chan T, 0, n) // Create dest slice
 
 	for i := 0; i < n; i++ { // Create n destination channels
-		ch := make(chan int)
+		ch := make(chan T)
 		destinations = append(destinations, ch)
 
 		go func() { // Each channel gets a dedicated goroutine that competes for reads
 			defer close(ch)
 
-			for val := range source {
-				ch <- val
+			for {
+				select {
+				case val, ok := <-source:
+					if !ok || !send(ctx, ch, val) {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
 			}
 		}()
 	}
 
 	return destinations
 }
+
+// SplitBy distributes the values of source across n channels by the hash
+// of their key, so that values with the same key go to the same channel, in
+// the order they were read, until source is closed or ctx is done. A slow
+// output holds up the others. If n is not positive, there are no outputs
+// and source is not read.
+func SplitBy[T any, K comparable](ctx context.Context, source <-chan T, n int, key func(T) K) []<-chan T {
+	if n <= 0 {
+		return nil
+	}
+
+	channels := make([]chan T, n)
+	destinations := make([]<-chan T, n)
+
+	for i := range channels {
+		channels[i] = make(chan T)
+		destinations[i] = channels[i]
+	}
+
+	seed := maphash.MakeSeed()
+
+	go func() {
+		defer func() {
+			for _, ch := range channels {
+				close(ch)
+			}
+		}()
+
+		for {
+			select {
+			case val, ok := <-source:
+				if !ok {
+					return
+				}
+
+				i := maphash.Comparable(seed, key(val)) % uint64(n)
+				if !send(ctx, channels[i], val) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return destinations
+}
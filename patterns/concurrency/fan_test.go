@@ -0,0 +1,184 @@
+package concurrency
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"testing/synctest"
+)
+
+// generate sends values on the returned channel, then closes it.
+func generate(ctx context.Context, values ...int) <-chan int {
+	c := make(chan int)
+
+	go func() {
+		defer close(c)
+
+		for _, v := range values {
+			if !send(ctx, c, v) {
+				return
+			}
+		}
+	}()
+
+	return c
+}
+
+func collect[T any](c <-chan T) []T {
+	var values []T
+	for v := range c {
+		values = append(values, v)
+	}
+
+	return values
+}
+
+// collectAll reads every channel concurrently until all are closed.
+func collectAll[T any](channels []<-chan T) [][]T {
+	out := make([][]T, len(channels))
+
+	var wg sync.WaitGroup
+	for i, c := range channels {
+		wg.Go(func() { out[i] = collect(c) })
+	}
+	wg.Wait()
+
+	return out
+}
+
+func TestFunnel(t *testing.T) {
+	ctx := context.Background()
+
+	got := collect(Funnel(ctx, generate(ctx, 1, 2, 3), generate(ctx, 4, 5), generate(ctx)))
+	slices.Sort(got)
+
+	if want := []int{1, 2, 3, 4, 5}; !slices.Equal(got, want) {
+		t.Fatalf("Funnel() = %v, want %v", got, want)
+	}
+}
+
+func TestFunnelOrdered(t *testing.T) {
+	ctx := context.Background()
+	less := func(a, b int) bool { return a < b }
+
+	got := collect(FunnelOrdered(ctx, less,
+		generate(ctx, 1, 4, 7, 10),
+		generate(ctx, 2, 5, 8),
+		generate(ctx),
+		generate(ctx, 3, 6, 9),
+	))
+
+	if want := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !slices.Equal(got, want) {
+		t.Fatalf("FunnelOrdered() = %v, want %v", got, want)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	ctx := context.Background()
+
+	values := make([]int, 100)
+	for i := range values {
+		values[i] = i
+	}
+
+	var got []int
+	for _, out := range collectAll(Split(ctx, generate(ctx, values...), 4)) {
+		got = append(got, out...)
+	}
+	slices.Sort(got)
+
+	if !slices.Equal(got, values) {
+		t.Fatalf("Split() delivered %v, want every value once", got)
+	}
+}
+
+func TestSplitBy(t *testing.T) {
+	ctx := context.Background()
+	key := func(v int) int { return v % 7 }
+
+	values := make([]int, 200)
+	for i := range values {
+		values[i] = i
+	}
+
+	outputs := collectAll(SplitBy(ctx, generate(ctx, values...), 3, key))
+
+	output := make(map[int]int)
+	total := 0
+
+	for i, out := range outputs {
+		total += len(out)
+
+		for j, v := range out {
+			if o, ok := output[key(v)]; ok && o != i {
+				t.Fatalf("key %d went to outputs %d and %d", key(v), o, i)
+			}
+			output[key(v)] = i
+
+			if j > 0 && v < out[j-1] {
+				t.Fatalf("output %d = %v, want the values in source order", i, out)
+			}
+		}
+	}
+
+	if total != len(values) {
+		t.Fatalf("SplitBy() delivered %d values, want %d", total, len(values))
+	}
+}
+
+func TestSplitNoOutputs(t *testing.T) {
+	key := func(v int) int { return v }
+
+	for _, n := range []int{0, -1} {
+		if outputs := Split(t.Context(), make(chan int), n); outputs != nil {
+			t.Errorf("Split(%d) = %v, want no outputs", n, outputs)
+		}
+		if outputs := SplitBy(t.Context(), make(chan int), n, key); outputs != nil {
+			t.Errorf("SplitBy(%d) = %v, want no outputs", n, outputs)
+		}
+	}
+}
+
+// TestFanCancel checks that cancelling closes the outputs and stops every
+// goroutine, even with sources that never close and outputs nobody reads:
+// synctest.Test fails if goroutines are left blocked.
+func TestFanCancel(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+
+	tests := map[string]func(ctx context.Context, source <-chan int) []<-chan int{
+		"Funnel": func(ctx context.Context, source <-chan int) []<-chan int {
+			return []<-chan int{Funnel(ctx, source, make(chan int))}
+		},
+		"FunnelOrdered": func(ctx context.Context, source <-chan int) []<-chan int {
+			return []<-chan int{FunnelOrdered(ctx, less, source, make(chan int))}
+		},
+		"Split": func(ctx context.Context, source <-chan int) []<-chan int {
+			return Split(ctx, source, 3)
+		},
+		"SplitBy": func(ctx context.Context, source <-chan int) []<-chan int {
+			return SplitBy(ctx, source, 3, func(v int) int { return v })
+		},
+	}
+
+	for name, fan := range tests {
+		t.Run(name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(t.Context())
+
+				// An endless source, so only cancelling can stop it.
+				source := make(chan int)
+				go func() {
+					for i := 0; send(ctx, source, i); i++ {
+					}
+				}()
+
+				outputs := fan(ctx, source)
+				synctest.Wait()
+
+				cancel()
+				collectAll(outputs)
+			})
+		})
+	}
+}
@@ -2,51 +2,289 @@ package concurrency
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 )
 
-type Future interface {
-	Result() (string, error)
+var ErrNoFutures = errors.New("no futures given")
+
+// PanicError is the error of a future whose function panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("future panicked: %v", e.Value)
+}
+
+// Future is the result of a computation that may not have finished yet.
+type Future[T any] struct {
+	done   chan struct{}
+	once   sync.Once
+	cancel context.CancelFunc
+
+	res T
+	err error
+}
+
+// Go runs fn in a goroutine and returns its future. fn's context is
+// cancelled by Cancel, or when ctx is. A panic in fn fails the future with a
+// *PanicError.
+func Go[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) *Future[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	f := &Future[T]{done: make(chan struct{}), cancel: cancel}
+
+	go func() {
+		defer cancel()
+		defer func() {
+			if r := recover(); r != nil {
+				var zero T
+				f.settle(zero, &PanicError{Value: r, Stack: debug.Stack()})
+			}
+		}()
+
+		f.settle(fn(ctx))
+	}()
+
+	return f
+}
+
+// Resolved returns a future that has already succeeded with v.
+func Resolved[T any](v T) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	f.settle(v, nil)
+
+	return f
+}
+
+// Failed returns a future that has already failed with err.
+func Failed[T any](err error) *Future[T] {
+	var zero T
+
+	f := &Future[T]{done: make(chan struct{})}
+	f.settle(zero, err)
+
+	return f
 }
 
-type InnerFuture struct {
-	once sync.Once
-	wg   sync.WaitGroup
+// Result waits for the future and returns its result.
+func (f *Future[T]) Result() (T, error) {
+	<-f.done
+	return f.res, f.err
+}
+
+// Await waits for the future until ctx is done, then returns ctx's error.
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.res, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Done is closed once the future has a result.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
 
-	res   string
-	err   error
-	resCh <-chan string
-	errCh <-chan error
+// Cancel cancels the context of the future's function, if it has one. The
+// future settles once the function returns.
+func (f *Future[T]) Cancel() {
+	if f.cancel != nil {
+		f.cancel()
+	}
 }
 
-func (f *InnerFuture) Result() (string, error) {
+// settle records the result, only the first time.
+func (f *Future[T]) settle(res T, err error) {
 	f.once.Do(func() {
-		f.wg.Add(1)
-		defer f.wg.Done()
-		f.res = <-f.resCh
-		f.err = <-f.errCh
+		f.res, f.err = res, err
+		close(f.done)
 	})
+}
 
-	f.wg.Wait()
+// Promise is a future settled by hand, e.g. when an acknowledgement arrives.
+type Promise[T any] struct {
+	future *Future[T]
+}
 
-	return f.res, f.err
+func NewPromise[T any]() *Promise[T] {
+	return &Promise[T]{future: &Future[T]{done: make(chan struct{})}}
 }
 
-func SlowFunction(ctx context.Context) Future {
-	resCh := make(chan string)
-	errCh := make(chan error)
+func (p *Promise[T]) Future() *Future[T] { return p.future }
 
-	go func() {
-		select {
-		case <-time.After(time.Second * 2):
-			resCh <- "I slept for 2 seconds"
-			errCh <- nil
-		case <-ctx.Done():
-			resCh <- ""
-			errCh <- ctx.Err()
+// Resolve succeeds the future with v, unless it is already settled.
+func (p *Promise[T]) Resolve(v T) { p.future.settle(v, nil) }
+
+// Reject fails the future with err, unless it is already settled.
+func (p *Promise[T]) Reject(err error) {
+	var zero T
+	p.future.settle(zero, err)
+}
+
+// Then runs fn with f's result once f succeeds. If f fails, so does the
+// returned future, without running fn.
+func Then[T, U any](ctx context.Context, f *Future[T], fn func(ctx context.Context, v T) (U, error)) *Future[U] {
+	return Go(ctx, func(ctx context.Context) (U, error) {
+		v, err := f.Await(ctx)
+		if err != nil {
+			var zero U
+			return zero, err
 		}
-	}()
 
-	return &InnerFuture{resCh: resCh, errCh: errCh}
+		return fn(ctx, v)
+	})
+}
+
+// Map converts f's result with fn once f succeeds.
+func Map[T, U any](f *Future[T], fn func(v T) U) *Future[U] {
+	return Then(context.Background(), f, func(_ context.Context, v T) (U, error) {
+		return fn(v), nil
+	})
+}
+
+// All succeeds with the results of every future, in order, once they all
+// succeed. It fails as soon as one fails, cancelling the others.
+func All[T any](ctx context.Context, futures ...*Future[T]) *Future[[]T] {
+	return Go(ctx, func(ctx context.Context) ([]T, error) {
+		settled, stop := notify(futures)
+		defer stop()
+
+		for range futures {
+			select {
+			case f := <-settled:
+				if _, err := f.Result(); err != nil {
+					cancelAll(futures)
+					return nil, err
+				}
+			case <-ctx.Done():
+				cancelAll(futures)
+				return nil, ctx.Err()
+			}
+		}
+
+		results := make([]T, len(futures))
+		for i, f := range futures {
+			results[i], _ = f.Result()
+		}
+
+		return results, nil
+	})
+}
+
+// Any succeeds with the result of the first future to succeed, cancelling
+// the others. It fails with all their errors if every future fails.
+func Any[T any](ctx context.Context, futures ...*Future[T]) *Future[T] {
+	return Go(ctx, func(ctx context.Context) (T, error) {
+		var zero T
+
+		if len(futures) == 0 {
+			return zero, ErrNoFutures
+		}
+
+		settled, stop := notify(futures)
+		defer stop()
+
+		errs := make([]error, 0, len(futures))
+
+		for range futures {
+			select {
+			case f := <-settled:
+				v, err := f.Result()
+				if err == nil {
+					cancelAll(futures)
+					return v, nil
+				}
+
+				errs = append(errs, err)
+			case <-ctx.Done():
+				cancelAll(futures)
+				return zero, ctx.Err()
+			}
+		}
+
+		return zero, errors.Join(errs...)
+	})
+}
+
+// Race settles like the first future to settle, cancelling the others.
+func Race[T any](ctx context.Context, futures ...*Future[T]) *Future[T] {
+	return Go(ctx, func(ctx context.Context) (T, error) {
+		if len(futures) == 0 {
+			var zero T
+			return zero, ErrNoFutures
+		}
+
+		f, err := awaitAny(ctx, futures)
+		cancelAll(futures)
+
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+
+		return f.Result()
+	})
+}
+
+// WithTimeout settles like f, or fails with context.DeadlineExceeded and
+// cancels f if it takes longer than d.
+func WithTimeout[T any](f *Future[T], d time.Duration) *Future[T] {
+	return Go(context.Background(), func(ctx context.Context) (T, error) {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		v, err := f.Await(ctx)
+		if ctx.Err() != nil {
+			f.Cancel()
+		}
+
+		return v, err
+	})
+}
+
+// awaitAny returns the first of the futures to settle, or fails with ctx's
+// error.
+func awaitAny[T any](ctx context.Context, futures []*Future[T]) (*Future[T], error) {
+	settled, stop := notify(futures)
+	defer stop()
+
+	select {
+	case f := <-settled:
+		return f, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// notify sends each of the futures on settled once it settles, until stop
+// is called.
+func notify[T any](futures []*Future[T]) (settled <-chan *Future[T], stop func()) {
+	ch := make(chan *Future[T], len(futures))
+	done := make(chan struct{})
+
+	for _, f := range futures {
+		go func() {
+			select {
+			case <-f.done:
+				ch <- f
+			case <-done:
+			}
+		}()
+	}
+
+	return ch, func() { close(done) }
+}
+
+func cancelAll[T any](futures []*Future[T]) {
+	for _, f := range futures {
+		f.Cancel()
+	}
 }
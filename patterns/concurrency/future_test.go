@@ -0,0 +1,207 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+var errFuture = errors.New("future failed")
+
+// after returns a future that succeeds with v after d, or fails with its
+// context's error if cancelled first.
+func after[T any](ctx context.Context, d time.Duration, v T) *Future[T] {
+	return Go(ctx, func(ctx context.Context) (T, error) {
+		select {
+		case <-time.After(d):
+			return v, nil
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	})
+}
+
+func failAfter[T any](ctx context.Context, d time.Duration, err error) *Future[T] {
+	return Go(ctx, func(ctx context.Context) (T, error) {
+		var zero T
+		select {
+		case <-time.After(d):
+			return zero, err
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	})
+}
+
+func TestFuturePanic(t *testing.T) {
+	f := Go(context.Background(), func(context.Context) (int, error) { panic("boom") })
+
+	_, err := f.Result()
+
+	var perr *PanicError
+	if !errors.As(err, &perr) || perr.Value != "boom" || len(perr.Stack) == 0 {
+		t.Fatalf("Result() of a panicking future = %v, want a *PanicError with the value and stack", err)
+	}
+}
+
+func TestFutureCancel(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+
+		f := after(ctx, time.Hour, 1)
+		cancel()
+
+		if _, err := f.Result(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Result() after the parent was cancelled = %v, want context.Canceled", err)
+		}
+
+		g := after(t.Context(), time.Hour, 1)
+		g.Cancel()
+
+		if _, err := g.Result(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Result() after Cancel() = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestPromise(t *testing.T) {
+	p := NewPromise[int]()
+	p.Resolve(1)
+	p.Reject(errFuture)
+
+	if v, err := p.Future().Result(); v != 1 || err != nil {
+		t.Fatalf("Result() = %d, %v, want the first settlement 1, nil", v, err)
+	}
+}
+
+func TestThen(t *testing.T) {
+	ctx := context.Background()
+	double := func(_ context.Context, v int) (int, error) { return 2 * v, nil }
+
+	if v, err := Then(ctx, Resolved(2), double).Result(); v != 4 || err != nil {
+		t.Fatalf("Then() = %d, %v, want 4, nil", v, err)
+	}
+
+	ran := false
+	_, err := Then(ctx, Failed[int](errFuture), func(context.Context, int) (int, error) {
+		ran = true
+		return 0, nil
+	}).Result()
+	if !errors.Is(err, errFuture) || ran {
+		t.Fatalf("Then() on a failed future = %v, ran fn: %v; want its error without running fn", err, ran)
+	}
+
+	if s, err := Map(Resolved(3), func(v int) string { return string(rune('a' + v)) }).Result(); s != "d" || err != nil {
+		t.Fatalf("Map() = %q, %v, want d, nil", s, err)
+	}
+}
+
+func TestAll(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx := t.Context()
+
+		v, err := All(ctx, after(ctx, 3*time.Second, 1), after(ctx, time.Second, 2), Resolved(3)).Result()
+		if !slices.Equal(v, []int{1, 2, 3}) || err != nil {
+			t.Fatalf("All() = %v, %v, want the results in order", v, err)
+		}
+
+		slow := after(ctx, time.Hour, 1)
+		start := time.Now()
+
+		if _, err = All(ctx, slow, failAfter[int](ctx, time.Second, errFuture)).Result(); !errors.Is(err, errFuture) {
+			t.Fatalf("All() with a failure = %v, want it", err)
+		}
+		if d := time.Since(start); d != time.Second {
+			t.Fatalf("All() failed after %v, want as soon as one future failed", d)
+		}
+		if _, err = slow.Result(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("the other future = %v, want it cancelled", err)
+		}
+
+		if v, err = All[int](ctx).Result(); len(v) != 0 || err != nil {
+			t.Fatalf("All() of nothing = %v, %v, want no results", v, err)
+		}
+	})
+}
+
+func TestAllCancel(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+
+		f := after(t.Context(), time.Hour, 1)
+		all := All(ctx, f)
+		cancel()
+
+		if _, err := all.Result(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("All() after cancel = %v, want context.Canceled", err)
+		}
+		if _, err := f.Result(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("the future passed to All() = %v, want it cancelled", err)
+		}
+	})
+}
+
+func TestAny(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx := t.Context()
+
+		slow := after(ctx, time.Hour, 1)
+		v, err := Any(ctx, failAfter[int](ctx, time.Millisecond, errFuture), after(ctx, time.Second, 2), slow).Result()
+		if v != 2 || err != nil {
+			t.Fatalf("Any() = %d, %v, want the first success 2, nil", v, err)
+		}
+		if _, err = slow.Result(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("the slower future = %v, want it cancelled", err)
+		}
+
+		errOther := errors.New("other")
+		_, err = Any(ctx, Failed[int](errFuture), failAfter[int](ctx, time.Second, errOther)).Result()
+		if !errors.Is(err, errFuture) || !errors.Is(err, errOther) {
+			t.Fatalf("Any() when all fail = %v, want every error", err)
+		}
+
+		if _, err = Any[int](ctx).Result(); !errors.Is(err, ErrNoFutures) {
+			t.Fatalf("Any() of nothing = %v, want ErrNoFutures", err)
+		}
+	})
+}
+
+func TestRace(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx := t.Context()
+
+		slow := after(ctx, time.Hour, 1)
+		if _, err := Race(ctx, slow, failAfter[int](ctx, time.Second, errFuture)).Result(); !errors.Is(err, errFuture) {
+			t.Fatalf("Race() = %v, want the first to settle, a failure", err)
+		}
+		if _, err := slow.Result(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("the slower future = %v, want it cancelled", err)
+		}
+
+		if _, err := Race[int](ctx).Result(); !errors.Is(err, ErrNoFutures) {
+			t.Fatalf("Race() of nothing = %v, want ErrNoFutures", err)
+		}
+	})
+}
+
+func TestWithTimeout(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx := t.Context()
+
+		if v, err := WithTimeout(after(ctx, time.Second, 1), time.Minute).Result(); v != 1 || err != nil {
+			t.Fatalf("WithTimeout() of a fast future = %d, %v, want 1, nil", v, err)
+		}
+
+		slow := after(ctx, time.Hour, 1)
+		if _, err := WithTimeout(slow, time.Minute).Result(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("WithTimeout() of a slow future = %v, want context.DeadlineExceeded", err)
+		}
+		if _, err := slow.Result(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("the timed out future = %v, want it cancelled", err)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package concurrency
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+)
+
+// group runs goroutines that share a context, errgroup-style: the first to
+// fail cancels it, and wait returns that first error.
+type group struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+
+	once sync.Once
+	err  error
+}
+
+func newGroup(ctx context.Context) *group {
+	child, cancel := context.WithCancelCause(ctx)
+	return &group{parent: ctx, ctx: child, cancel: cancel}
+}
+
+func (g *group) goroutine(fn func() error) {
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+
+		if err := protect(fn); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel(err)
+	})
+}
+
+func (g *group) wait() error {
+	g.wg.Wait()
+
+	// Work skipped because the parent was cancelled is a failure too.
+	if g.parent.Err() != nil {
+		g.fail(context.Cause(g.parent))
+	}
+
+	g.cancel(nil)
+
+	return g.err
+}
+
+// protect runs fn, turning a panic into a *PanicError.
+func protect(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	return fn()
+}
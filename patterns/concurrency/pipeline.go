@@ -0,0 +1,149 @@
+package concurrency
+
+import "context"
+
+// Pipeline is a chain of stages connected by channels, each stage running on
+// its own workers. Stages share one context: the first to fail cancels it,
+// which stops the whole pipeline, and the sink returns that error.
+//
+//	p := concurrency.FromSlice(ctx, lines)
+//	events := concurrency.Stage(p, 4, parse)
+//	err := events.Sink(apply)
+type Pipeline[T any] struct {
+	group *group
+	out   <-chan T
+}
+
+// From starts a pipeline reading source until it is closed.
+func From[T any](ctx context.Context, source <-chan T) *Pipeline[T] {
+	g := newGroup(ctx)
+	out := make(chan T)
+
+	g.goroutine(func() error {
+		defer close(out)
+
+		for {
+			select {
+			case v, ok := <-source:
+				if !ok || !send(g.ctx, out, v) {
+					return nil
+				}
+			case <-g.ctx.Done():
+				return nil
+			}
+		}
+	})
+
+	return &Pipeline[T]{group: g, out: out}
+}
+
+// FromSlice starts a pipeline with the items.
+func FromSlice[T any](ctx context.Context, items []T) *Pipeline[T] {
+	g := newGroup(ctx)
+	out := make(chan T)
+
+	g.goroutine(func() error {
+		defer close(out)
+
+		for _, v := range items {
+			if !send(g.ctx, out, v) {
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return &Pipeline[T]{group: g, out: out}
+}
+
+// Stage adds a stage applying fn to every item on the given number of
+// workers. With more than one worker, items may leave out of order.
+func Stage[In, Out any](p *Pipeline[In], workers int, fn func(ctx context.Context, v In) (Out, error)) *Pipeline[Out] {
+	return FlatStage(p, workers, func(ctx context.Context, v In, emit func(Out) bool) error {
+		out, err := fn(ctx, v)
+		if err == nil {
+			emit(out)
+		}
+
+		return err
+	})
+}
+
+// FlatStage adds a stage calling fn for every item, which passes on any
+// number of items with emit. emit returns false once the pipeline is
+// stopping.
+func FlatStage[In, Out any](p *Pipeline[In], workers int, fn func(ctx context.Context, v In, emit func(Out) bool) error) *Pipeline[Out] {
+	g := p.group
+	out := make(chan Out)
+	done := make(chan struct{})
+
+	emit := func(v Out) bool { return send(g.ctx, out, v) }
+
+	for range max(workers, 1) {
+		g.goroutine(func() error {
+			defer func() { done <- struct{}{} }()
+
+			for v := range p.out {
+				if g.ctx.Err() != nil {
+					continue // Let the stages upstream finish.
+				}
+
+				if err := fn(g.ctx, v, emit); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	// Close out once every worker is done.
+	go func() {
+		for range max(workers, 1) {
+			<-done
+		}
+		close(out)
+	}()
+
+	return &Pipeline[Out]{group: g, out: out}
+}
+
+// Filter adds a stage passing on the items for which keep returns true.
+func Filter[T any](p *Pipeline[T], keep func(v T) bool) *Pipeline[T] {
+	return FlatStage(p, 1, func(_ context.Context, v T, emit func(T) bool) error {
+		if keep(v) {
+			emit(v)
+		}
+
+		return nil
+	})
+}
+
+// Sink runs fn on every item leaving the pipeline, then waits for every
+// stage and returns the first error.
+func (p *Pipeline[T]) Sink(fn func(ctx context.Context, v T) error) error {
+	for v := range p.out {
+		if p.group.ctx.Err() != nil {
+			continue
+		}
+
+		if err := protect(func() error { return fn(p.group.ctx, v) }); err != nil {
+			p.group.fail(err)
+		}
+	}
+
+	return p.group.wait()
+}
+
+// Collect returns the items leaving the pipeline.
+func (p *Pipeline[T]) Collect() ([]T, error) {
+	var items []T
+
+	err := p.Sink(func(_ context.Context, v T) error {
+		items = append(items, v)
+		return nil
+	})
+
+	return items, err
+}
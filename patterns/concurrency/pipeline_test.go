@@ -0,0 +1,115 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"testing/synctest"
+)
+
+func TestPipeline(t *testing.T) {
+	ctx := context.Background()
+
+	p := FromSlice(ctx, []string{"1", "2", "3", "4", "5"})
+	numbers := Stage(p, 1, func(_ context.Context, s string) (int, error) { return strconv.Atoi(s) })
+	odd := Filter(numbers, func(n int) bool { return n%2 == 1 })
+	twice := FlatStage(odd, 1, func(_ context.Context, n int, emit func(int) bool) error {
+		emit(n)
+		emit(n)
+		return nil
+	})
+
+	got, err := twice.Collect()
+	if want := []int{1, 1, 3, 3, 5, 5}; !slices.Equal(got, want) || err != nil {
+		t.Fatalf("Collect() = %v, %v, want %v, nil", got, err, want)
+	}
+}
+
+func TestPipelineWorkers(t *testing.T) {
+	ctx := context.Background()
+
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+
+	got, err := Stage(FromSlice(ctx, items), 8, func(_ context.Context, n int) (int, error) { return n, nil }).Collect()
+	slices.Sort(got)
+
+	if !slices.Equal(got, items) || err != nil {
+		t.Fatalf("Collect() = %v, %v, want every item once", got, err)
+	}
+}
+
+// TestPipelineFirstError checks that a failing stage stops the pipeline,
+// stages upstream included, and that the sink returns its error: synctest.Test
+// fails if a goroutine is left blocked.
+func TestPipelineFirstError(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		items := make([]int, 1000)
+		for i := range items {
+			items[i] = i
+		}
+
+		// The source stops with the test, once the pipeline no longer reads it.
+		p := From(t.Context(), generate(t.Context(), items...))
+		failing := Stage(p, 4, func(_ context.Context, n int) (int, error) {
+			if n == 10 {
+				return 0, errFuture
+			}
+			return n, nil
+		})
+
+		sunk := 0
+		err := failing.Sink(func(context.Context, int) error {
+			sunk++
+			return nil
+		})
+
+		if !errors.Is(err, errFuture) {
+			t.Fatalf("Sink() = %v, want the stage's error", err)
+		}
+		if sunk >= len(items) {
+			t.Fatal("every item reached the sink despite the failure")
+		}
+	})
+}
+
+func TestPipelineSinkError(t *testing.T) {
+	err := FromSlice(context.Background(), []int{1, 2, 3}).Sink(func(_ context.Context, n int) error {
+		if n == 2 {
+			return errFuture
+		}
+		return nil
+	})
+	if !errors.Is(err, errFuture) {
+		t.Fatalf("Sink() = %v, want the sink's error", err)
+	}
+}
+
+func TestPipelinePanic(t *testing.T) {
+	p := Stage(FromSlice(context.Background(), []int{1}), 1, func(context.Context, int) (int, error) { panic("boom") })
+
+	var perr *PanicError
+	if _, err := p.Collect(); !errors.As(err, &perr) || perr.Value != "boom" {
+		t.Fatalf("Collect() = %v, want a *PanicError", err)
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+
+		// A source that never closes: only cancelling stops the pipeline.
+		p := From(ctx, make(chan int))
+		stage := Stage(p, 2, func(_ context.Context, n int) (int, error) { return n, nil })
+
+		cancel()
+
+		if _, err := stage.Collect(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Collect() after cancel = %v, want context.Canceled", err)
+		}
+	})
+}
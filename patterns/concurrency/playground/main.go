@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,40 +13,170 @@ import (
 func main() {
 	//tryoutFanIn()
 	//tryoutFanOut()
+	//tryoutOrderedFanIn()
+	//tryoutKeyedFanOut()
 	//tryoutFuture()
 	//tryoutSharding()
+	//tryoutPool()
+	//tryoutPipeline()
+	//tryoutSingleflight()
+	//tryoutBatcher()
+}
+
+func tryoutSingleflight() {
+	var group concurrency.Group[string, string]
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Only one of the five calls reaches the backend.
+			v, err, shared := group.Do("alpha", func() (string, error) {
+				fmt.Println("fetching alpha")
+				time.Sleep(100 * time.Millisecond)
+				return "1", nil
+			})
+
+			fmt.Println(v, err, shared)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func tryoutBatcher() {
+	batcher := concurrency.NewBatcher(func(ctx context.Context, lines []string) []error {
+		fmt.Printf("writing %d lines at once\n", len(lines))
+		return nil
+	}, concurrency.BatcherOptions{MaxSize: 4, MaxWait: 10 * time.Millisecond})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			batcher.Add(context.Background(), fmt.Sprintf("line %d", i))
+		}()
+	}
+
+	wg.Wait()
+	batcher.Close(context.Background())
+}
+
+func tryoutPool() {
+	pool := concurrency.NewPool(context.Background(), concurrency.PoolOptions{Workers: 3, QueueSize: 5, TaskTimeout: time.Second})
+
+	for i := 0; i < 10; i++ {
+		err := pool.Submit(context.Background(), func(ctx context.Context) error {
+			if i == 7 {
+				return fmt.Errorf("task %d failed", i) // Cancels the others
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			fmt.Println("task", i, "done")
+
+			return nil
+		})
+		if err != nil {
+			fmt.Println("cannot submit:", err)
+			break
+		}
+	}
+
+	fmt.Println(pool.Wait())
+}
+
+func tryoutPipeline() {
+	ctx := context.Background()
+
+	lines := concurrency.FromSlice(ctx, []string{"1", "2", "x", "4"})
+
+	numbers := concurrency.Stage(lines, 2, func(ctx context.Context, s string) (int, error) {
+		return strconv.Atoi(s)
+	})
+
+	squares := concurrency.Stage(numbers, 2, func(ctx context.Context, n int) (int, error) {
+		return n * n, nil
+	})
+
+	err := squares.Sink(func(ctx context.Context, n int) error {
+		fmt.Println(n)
+		return nil
+	})
+
+	fmt.Println(err) // strconv.Atoi: parsing "x": invalid syntax
 }
 
 func tryoutSharding() {
-	shardedMap := concurrency.NewShardMap(5)
+	shardedMap := concurrency.NewShardMap[string, int](5, concurrency.FNV)
 	shardedMap.Set("alpha", 1)
 	shardedMap.Set("beta", 2)
 	shardedMap.Set("gamma", 3)
 	fmt.Println(shardedMap.Get("alpha"))
 	fmt.Println(shardedMap.Get("beta"))
 	fmt.Println(shardedMap.Get("gamma"))
-	keys := shardedMap.Keys()
-	for _, k := range keys {
-		fmt.Println(k)
+
+	fmt.Println(shardedMap.CompareAndSwap("alpha", 1, 10)) // true
+	fmt.Println(shardedMap.CompareAndSwap("alpha", 1, 20)) // false
+	fmt.Println(shardedMap.Delete("beta"), shardedMap.Len())
+
+	shardedMap.Resize(16)
+
+	for k, v := range shardedMap.All() {
+		fmt.Println(k, v)
 	}
 
 }
 
 func tryoutFuture() {
-	future := concurrency.SlowFunction(context.Background())
+	ctx := context.Background()
 
-	res, err := future.Result()
-	if err != nil {
-		fmt.Println("error: ", err)
-		return
-	}
+	future := slowFunction(ctx, 2*time.Second)
+
+	// Ask three replicas; the fastest answer wins and the others are cancelled.
+	fastest := concurrency.Any(ctx,
+		slowFunction(ctx, 3*time.Second),
+		slowFunction(ctx, time.Second),
+		slowFunction(ctx, 2*time.Second),
+	)
+
+	length := concurrency.Map(future, func(s string) int { return len(s) })
+
+	both := concurrency.All(ctx, future, fastest)
 
-	fmt.Println(res)
+	timedOut := concurrency.WithTimeout(slowFunction(ctx, 5*time.Second), time.Second)
+
+	panicked := concurrency.Go(ctx, func(ctx context.Context) (string, error) {
+		panic("oops")
+	})
+
+	fmt.Println(future.Result())
+	fmt.Println(fastest.Result())
+	fmt.Println(length.Result())
+	fmt.Println(both.Result())
+	fmt.Println(timedOut.Result())
+	fmt.Println(panicked.Result())
+}
+
+func slowFunction(ctx context.Context, d time.Duration) *concurrency.Future[string] {
+	return concurrency.Go(ctx, func(ctx context.Context) (string, error) {
+		select {
+		case <-time.After(d):
+			return fmt.Sprintf("I slept for %v", d), nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
 }
 
 func tryoutFanOut() {
-	source := make(chan int)              // The input channel
-	dests := concurrency.Split(source, 5) // Retrieve 5 output channels
+	source := make(chan int)                                    // The input channel
+	dests := concurrency.Split(context.Background(), source, 5) // Retrieve 5 output channels
 
 	go func() { // Send number 1..10 to source and close it when we're done
 		for i := 0; i <= 10; i++ {
@@ -89,9 +220,67 @@ func tryoutFanIn() {
 		}()
 	}
 
-	dest := concurrency.Funnel(sources...)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Stops after 3 seconds, though the sources have more to send.
+	dest := concurrency.Funnel(ctx, sources...)
 
 	for d := range dest {
 		fmt.Println(d)
 	}
 }
+
+func tryoutOrderedFanIn() {
+	sources := make([]<-chan int, 0)
+
+	for i := 0; i < 3; i++ {
+		ch := make(chan int)
+
+		sources = append(sources, ch)
+
+		go func() {
+			defer close(ch)
+
+			for j := i; j < 15; j += 3 {
+				ch <- j
+			}
+		}()
+	}
+
+	dest := concurrency.FunnelOrdered(context.Background(), func(a, b int) bool { return a < b }, sources...)
+
+	for d := range dest {
+		fmt.Println(d) // 0, 1, 2, ... 14
+	}
+}
+
+func tryoutKeyedFanOut() {
+	source := make(chan string)
+
+	go func() {
+		for _, w := range []string{"alpha", "beta", "alpha", "gamma", "beta", "alpha"} {
+			source <- w
+		}
+
+		close(source)
+	}()
+
+	// The same word always lands on the same channel.
+	dests := concurrency.SplitBy(context.Background(), source, 3, func(w string) string { return w })
+
+	var wg sync.WaitGroup
+	wg.Add(len(dests))
+
+	for i, ch := range dests {
+		go func(i int, d <-chan string) {
+			defer wg.Done()
+
+			for val := range d {
+				fmt.Printf("#%d got %s \n", i, val)
+			}
+		}(i, ch)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,144 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPoolClosed = errors.New("pool closed")
+	ErrQueueFull  = errors.New("pool queue full")
+)
+
+// Task is a unit of work run by a Pool.
+type Task func(ctx context.Context) error
+
+// PoolOptions size a Pool. TaskTimeout bounds each task's context; zero
+// leaves it unbounded.
+type PoolOptions struct {
+	Workers     int
+	QueueSize   int
+	TaskTimeout time.Duration
+}
+
+// Pool runs tasks on a fixed number of workers, queueing at most QueueSize
+// more. The first task to fail cancels the context of the others, and the
+// tasks still queued are dropped; Wait returns that first error.
+type Pool struct {
+	group   *group
+	tasks   chan Task
+	timeout time.Duration
+
+	// closing is held for reading by Submit while it sends, so Wait does not
+	// close the queue under it.
+	closing sync.RWMutex
+	closed  bool
+}
+
+// NewPool starts the workers. They stop once Wait has been called and the
+// queue is drained, or as soon as ctx is done.
+func NewPool(ctx context.Context, opts PoolOptions) *Pool {
+	p := &Pool{
+		group:   newGroup(ctx),
+		tasks:   make(chan Task, max(opts.QueueSize, 0)),
+		timeout: opts.TaskTimeout,
+	}
+
+	for range max(opts.Workers, 1) {
+		p.group.goroutine(p.work)
+	}
+
+	return p
+}
+
+// Submit queues t, waiting while the queue is full, until ctx is done.
+func (p *Pool) Submit(ctx context.Context, t Task) error {
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	// Once the pool has stopped, a free slot in the queue would take t
+	// only to drop it.
+	if err := context.Cause(p.group.ctx); err != nil {
+		return err
+	}
+
+	select {
+	case p.tasks <- t:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.group.ctx.Done():
+		return context.Cause(p.group.ctx)
+	}
+}
+
+// TrySubmit queues t unless the queue is full.
+func (p *Pool) TrySubmit(t Task) error {
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	if err := context.Cause(p.group.ctx); err != nil {
+		return err
+	}
+
+	select {
+	case p.tasks <- t:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Wait stops accepting tasks, lets the workers finish those queued, and
+// returns the first error of any of them.
+func (p *Pool) Wait() error {
+	p.closing.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.closing.Unlock()
+
+	return p.group.wait()
+}
+
+// work runs queued tasks until the queue is closed and drained, or the pool
+// fails or ctx is done, which drops the tasks still queued.
+func (p *Pool) work() error {
+	for {
+		select {
+		case t, ok := <-p.tasks:
+			if !ok || p.group.ctx.Err() != nil {
+				return nil
+			}
+
+			if err := p.run(t); err != nil {
+				return err
+			}
+		case <-p.group.ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (p *Pool) run(t Task) error {
+	ctx := p.group.ctx
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	return protect(func() error { return t(ctx) })
+}
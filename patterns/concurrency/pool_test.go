@@ -0,0 +1,187 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestPoolRunsTasks(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		p := NewPool(t.Context(), PoolOptions{Workers: 3, QueueSize: 10})
+		release := make(chan struct{})
+
+		var ran, running, peak atomic.Int32
+		for range 12 {
+			err := p.Submit(t.Context(), func(context.Context) error {
+				n := running.Add(1)
+				for m := peak.Load(); n > m && !peak.CompareAndSwap(m, n); m = peak.Load() {
+				}
+
+				<-release
+				running.Add(-1)
+				ran.Add(1)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		synctest.Wait() // every worker holds a task
+		if n := running.Load(); n != 3 {
+			t.Fatalf("%d tasks running with 3 workers, want 3", n)
+		}
+		close(release)
+
+		if err := p.Wait(); err != nil {
+			t.Fatalf("Wait() = %v, want nil", err)
+		}
+		if ran.Load() != 12 || peak.Load() != 3 {
+			t.Fatalf("ran %d tasks, at most %d at once; want 12, 3 at once", ran.Load(), peak.Load())
+		}
+
+		if err := p.Submit(t.Context(), func(context.Context) error { return nil }); !errors.Is(err, ErrPoolClosed) {
+			t.Fatalf("Submit() after Wait() = %v, want ErrPoolClosed", err)
+		}
+	})
+}
+
+func TestPoolFirstError(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		p := NewPool(t.Context(), PoolOptions{Workers: 2, QueueSize: 10})
+
+		fail := make(chan struct{})
+
+		var cancelled, ran atomic.Int32
+		p.Submit(t.Context(), func(ctx context.Context) error {
+			<-ctx.Done()
+			cancelled.Add(1)
+			return ctx.Err()
+		})
+		p.Submit(t.Context(), func(context.Context) error {
+			<-fail
+			return errFuture
+		})
+		for range 5 {
+			p.Submit(t.Context(), func(context.Context) error {
+				ran.Add(1)
+				return nil
+			})
+		}
+
+		synctest.Wait() // both workers hold a task, the others are queued
+		close(fail)
+
+		if err := p.Wait(); !errors.Is(err, errFuture) {
+			t.Fatalf("Wait() = %v, want the first error", err)
+		}
+		if cancelled.Load() != 1 {
+			t.Fatal("the running task was not cancelled")
+		}
+		if ran.Load() != 0 {
+			t.Fatalf("%d queued tasks ran after the failure, want them dropped", ran.Load())
+		}
+
+		if err := p.TrySubmit(func(context.Context) error { return nil }); err == nil {
+			t.Fatal("TrySubmit() after a failure succeeded")
+		}
+	})
+}
+
+func TestPoolPanic(t *testing.T) {
+	p := NewPool(context.Background(), PoolOptions{Workers: 1})
+	p.Submit(context.Background(), func(context.Context) error { panic("boom") })
+
+	var perr *PanicError
+	if err := p.Wait(); !errors.As(err, &perr) || perr.Value != "boom" {
+		t.Fatalf("Wait() = %v, want a *PanicError", err)
+	}
+}
+
+func TestPoolQueueFull(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		p := NewPool(t.Context(), PoolOptions{Workers: 1, QueueSize: 1})
+
+		block := make(chan struct{})
+		task := func(context.Context) error { <-block; return nil }
+
+		p.Submit(t.Context(), task)
+		synctest.Wait() // the worker holds the first task
+		p.Submit(t.Context(), task)
+
+		if err := p.TrySubmit(task); !errors.Is(err, ErrQueueFull) {
+			t.Fatalf("TrySubmit() on a full queue = %v, want ErrQueueFull", err)
+		}
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+		if err := p.Submit(ctx, task); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Submit() on a full queue = %v, want its context's error", err)
+		}
+
+		close(block)
+		if err := p.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestPoolTaskTimeout(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		p := NewPool(t.Context(), PoolOptions{Workers: 1, TaskTimeout: time.Second})
+		p.Submit(t.Context(), func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		if err := p.Wait(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Wait() = %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
+
+// TestPoolStopsWithContext checks that the workers return once ctx is done,
+// without Wait: synctest.Test fails if they are left blocked.
+func TestPoolStopsWithContext(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		p := NewPool(ctx, PoolOptions{Workers: 4, QueueSize: 4})
+		synctest.Wait()
+
+		cancel()
+		synctest.Wait()
+
+		if err := p.Submit(t.Context(), func(context.Context) error { return nil }); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Submit() after ctx is done = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestGroup(t *testing.T) {
+	g := newGroup(context.Background())
+
+	errFirst := errors.New("first")
+	g.goroutine(func() error { return errFirst })
+	g.goroutine(func() error {
+		<-g.ctx.Done()
+		return errFuture
+	})
+
+	if err := g.wait(); !errors.Is(err, errFirst) {
+		t.Fatalf("wait() = %v, want the first error", err)
+	}
+	if !errors.Is(context.Cause(g.ctx), errFirst) {
+		t.Fatalf("group context cause = %v, want the first error", context.Cause(g.ctx))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := newGroup(ctx).wait(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait() with a cancelled parent = %v, want context.Canceled", err)
+	}
+}
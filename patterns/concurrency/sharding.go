@@ -1,83 +1,332 @@
 package concurrency
 
 import (
-	"crypto/sha1"
+	"hash/fnv"
+	"hash/maphash"
+	"iter"
 	"sync"
+	"sync/atomic"
 )
 
-type Shard struct {
+// Hasher spreads keys across shards.
+type Hasher[K comparable] func(key K) uint64
+
+// MapHash hashes any comparable key with the runtime's hash function, under
+// a random seed.
+func MapHash[K comparable]() Hasher[K] {
+	seed := maphash.MakeSeed()
+
+	return func(key K) uint64 {
+		return maphash.Comparable(seed, key)
+	}
+}
+
+// FNV hashes string keys with 64-bit FNV-1a, which is the same across
+// processes.
+func FNV(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	return h.Sum64()
+}
+
+type Shard[K comparable, V any] struct {
 	sync.RWMutex
-	m map[string]interface{}
+	m map[K]V
+
+	// moved is set once Resize has copied the shard's entries to the next
+	// table.
+	moved bool
 }
 
-type ShardMap []*Shard
+// shardTable is one set of shards. Resize sets next, then moves the shards
+// into it one at a time; an operation finding its shard moved goes on to
+// the key's shard in next.
+type shardTable[K comparable, V any] struct {
+	shards []*Shard[K, V]
+	next   atomic.Pointer[shardTable[K, V]]
+}
 
-func NewShardMap(nshards int) ShardMap {
-	shards := make([]*Shard, nshards)
+func newShardTable[K comparable, V any](n int) *shardTable[K, V] {
+	t := &shardTable[K, V]{shards: make([]*Shard[K, V], max(n, 1))}
 
-	for i := 0; i < nshards; i++ {
-		shard := make(map[string]interface{})
-		shards[i] = &Shard{m: shard}
+	for i := range t.shards {
+		t.shards[i] = &Shard[K, V]{m: make(map[K]V)}
 	}
 
-	return shards
+	return t
+}
+
+func (t *shardTable[K, V]) shard(hash uint64) *Shard[K, V] {
+	return t.shards[hash%uint64(len(t.shards))]
 }
 
-func (m ShardMap) getShardIndex(key string) int {
-	checksum := sha1.Sum([]byte(key))
-	hash := int(checksum[17])
+// ShardMap is a map split into shards, each with its own lock, so that
+// goroutines using different keys rarely wait for each other. Resize changes
+// the number of shards while the map is in use.
+type ShardMap[K comparable, V any] struct {
+	table atomic.Pointer[shardTable[K, V]]
+	hash  Hasher[K]
 
-	return hash % len(m)
+	// resize is held by Resize, and by the operations reading every shard,
+	// so that they see a whole table.
+	resize sync.Mutex
 }
 
-func (m ShardMap) getShard(key string) *Shard {
-	index := m.getShardIndex(key)
-	return m[index]
+// NewShardMap returns a map with nshards shards, placing keys with hash, or
+// MapHash if it is nil.
+func NewShardMap[K comparable, V any](nshards int, hash Hasher[K]) *ShardMap[K, V] {
+	if hash == nil {
+		hash = MapHash[K]()
+	}
+
+	m := &ShardMap[K, V]{hash: hash}
+	m.table.Store(newShardTable[K, V](nshards))
+
+	return m
 }
 
-func (m ShardMap) Get(key string) interface{} {
-	shard := m.getShard(key)
-	shard.RLock()
-	defer shard.RUnlock()
+// lockShard returns key's shard, locked for writing.
+func (m *ShardMap[K, V]) lockShard(key K) (*Shard[K, V], func()) {
+	h := m.hash(key)
+
+	for t := m.table.Load(); ; t = t.next.Load() {
+		shard := t.shard(h)
+		shard.Lock()
 
-	return shard.m[key]
+		if !shard.moved {
+			return shard, shard.Unlock
+		}
+		shard.Unlock()
+	}
+}
+
+// rlockShard returns key's shard, locked for reading.
+func (m *ShardMap[K, V]) rlockShard(key K) (*Shard[K, V], func()) {
+	h := m.hash(key)
+
+	for t := m.table.Load(); ; t = t.next.Load() {
+		shard := t.shard(h)
+		shard.RLock()
+
+		if !shard.moved {
+			return shard, shard.RUnlock
+		}
+		shard.RUnlock()
+	}
 }
 
-func (m ShardMap) Set(key string, value interface{}) {
-	shard := m.getShard(key)
-	shard.Lock()
-	defer shard.Unlock()
+func (m *ShardMap[K, V]) Get(key K) (V, bool) {
+	shard, unlock := m.rlockShard(key)
+	defer unlock()
+
+	v, ok := shard.m[key]
+
+	return v, ok
+}
+
+func (m *ShardMap[K, V]) Set(key K, value V) {
+	shard, unlock := m.lockShard(key)
+	defer unlock()
 
 	shard.m[key] = value
 }
 
-func (m ShardMap) Keys() []string {
-	keys := make([]string, 0)
+// Delete removes key and reports whether it was present.
+func (m *ShardMap[K, V]) Delete(key K) bool {
+	shard, unlock := m.lockShard(key)
+	defer unlock()
+
+	_, ok := shard.m[key]
+	delete(shard.m, key)
+
+	return ok
+}
+
+// LoadOrStore returns the value of key if present; otherwise it stores
+// value. loaded reports which.
+func (m *ShardMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	shard, unlock := m.lockShard(key)
+	defer unlock()
+
+	if v, ok := shard.m[key]; ok {
+		return v, true
+	}
+
+	shard.m[key] = value
+
+	return value, false
+}
+
+// Swap stores value and returns the previous one, if any.
+func (m *ShardMap[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	shard, unlock := m.lockShard(key)
+	defer unlock()
+
+	previous, loaded = shard.m[key]
+	shard.m[key] = value
+
+	return previous, loaded
+}
+
+// CompareAndSwap stores new if key holds old. Like sync.Map, it panics if
+// V's values are not comparable.
+func (m *ShardMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	shard, unlock := m.lockShard(key)
+	defer unlock()
+
+	if v, ok := shard.m[key]; !ok || any(v) != any(old) {
+		return false
+	}
+
+	shard.m[key] = new
+
+	return true
+}
+
+// CompareAndDelete deletes key if it holds old.
+func (m *ShardMap[K, V]) CompareAndDelete(key K, old V) bool {
+	shard, unlock := m.lockShard(key)
+	defer unlock()
+
+	if v, ok := shard.m[key]; !ok || any(v) != any(old) {
+		return false
+	}
+
+	delete(shard.m, key)
+
+	return true
+}
+
+// Update atomically replaces key's value with the one fn returns given the
+// current one, or deletes it if fn returns false.
+func (m *ShardMap[K, V]) Update(key K, fn func(value V, ok bool) (V, bool)) (V, bool) {
+	shard, unlock := m.lockShard(key)
+	defer unlock()
 
-	mutex := sync.Mutex{}
+	v, ok := shard.m[key]
+	if v, ok = fn(v, ok); ok {
+		shard.m[key] = v
+	} else {
+		delete(shard.m, key)
+	}
+
+	return v, ok
+}
 
-	wg := sync.WaitGroup{}
-	wg.Add(len(m))
+func (m *ShardMap[K, V]) Len() int {
+	m.resize.Lock()
+	defer m.resize.Unlock()
 
-	for _, shard := range m {
-		go func(s *Shard) {
-			s.RLock()
+	n := 0
+	for _, shard := range m.table.Load().shards {
+		shard.RLock()
+		n += len(shard.m)
+		shard.RUnlock()
+	}
+
+	return n
+}
+
+// Snapshot returns a copy of the map as it was at one instant: every shard
+// is locked while it is taken. It waits for a Resize in progress.
+func (m *ShardMap[K, V]) Snapshot() map[K]V {
+	m.resize.Lock()
+	defer m.resize.Unlock()
+
+	shards := m.table.Load().shards
+	for _, shard := range shards {
+		shard.RLock()
+	}
+
+	n := 0
+	for _, shard := range shards {
+		n += len(shard.m)
+	}
 
-			for key := range s.m {
-				mutex.Lock()
-				keys = append(keys, key)
-				mutex.Unlock()
+	snapshot := make(map[K]V, n)
+	for _, shard := range shards {
+		for k, v := range shard.m {
+			snapshot[k] = v
+		}
+		shard.RUnlock()
+	}
+
+	return snapshot
+}
+
+// All iterates over a snapshot of the map, so the loop body may use the map.
+func (m *ShardMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for k, v := range m.Snapshot() {
+			if !yield(k, v) {
+				return
 			}
+		}
+	}
+}
 
-			s.RUnlock()
-			wg.Done()
-		}(shard)
+// Range calls fn for each entry of a snapshot until it returns false.
+func (m *ShardMap[K, V]) Range(fn func(key K, value V) bool) {
+	for k, v := range m.All() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+func (m *ShardMap[K, V]) Keys() []K {
+	keys := make([]K, 0)
+	for k := range m.All() {
+		keys = append(keys, k)
 	}
-	wg.Wait()
 
 	return keys
 }
 
+// Shards returns the number of shards.
+func (m *ShardMap[K, V]) Shards() int {
+	return len(m.table.Load().shards)
+}
+
+// Resize redistributes the entries over nshards shards while the map stays
+// in use. The shards are moved one at a time, and only operations on the
+// shard being moved wait for it; operations on a moved shard already use the
+// new ones. Snapshot, Len and other resizes wait until it is done.
+func (m *ShardMap[K, V]) Resize(nshards int) {
+	m.resize.Lock()
+	defer m.resize.Unlock()
+
+	old := m.table.Load()
+	next := newShardTable[K, V](nshards)
+	old.next.Store(next)
+
+	for _, shard := range old.shards {
+		shard.Lock()
+
+		// Group the entries by destination, to lock each one once.
+		moving := make(map[*Shard[K, V]][]K)
+		for k := range shard.m {
+			dest := next.shard(m.hash(k))
+			moving[dest] = append(moving[dest], k)
+		}
+
+		for dest, keys := range moving {
+			dest.Lock()
+			for _, k := range keys {
+				dest.m[k] = shard.m[k]
+			}
+			dest.Unlock()
+		}
+
+		shard.m = nil
+		shard.moved = true
+		shard.Unlock()
+	}
+
+	m.table.Store(next)
+}
+
 // RWMutex provides methods to establish both read and write locks, as demonstrated in the following.
 // Using this method, any number of processes can establish simultaneous read locks as long as there are no open write locks;
 // a process can establish a write lock only when there are no existing read or write locks.
@@ -0,0 +1,251 @@
+package concurrency
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardMap(t *testing.T) {
+	m := NewShardMap[string, int](4, nil)
+
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("Get() on an empty map found a")
+	}
+
+	m.Set("a", 1)
+	if v, ok := m.Get("a"); v != 1 || !ok {
+		t.Fatalf("Get(a) = %d, %v, want 1, true", v, ok)
+	}
+
+	if v, loaded := m.LoadOrStore("a", 2); v != 1 || !loaded {
+		t.Fatalf("LoadOrStore(a) = %d, %v, want the stored 1", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore("b", 2); v != 2 || loaded {
+		t.Fatalf("LoadOrStore(b) = %d, %v, want 2 stored", v, loaded)
+	}
+
+	if prev, loaded := m.Swap("b", 3); prev != 2 || !loaded {
+		t.Fatalf("Swap(b) = %d, %v, want 2, true", prev, loaded)
+	}
+
+	if m.CompareAndSwap("a", 5, 6) {
+		t.Fatal("CompareAndSwap(a) with the wrong old value succeeded")
+	}
+	if m.CompareAndSwap("c", 0, 6) {
+		t.Fatal("CompareAndSwap() of a missing key succeeded")
+	}
+	if !m.CompareAndSwap("a", 1, 6) {
+		t.Fatal("CompareAndSwap(a, 1, 6) failed")
+	}
+
+	if m.CompareAndDelete("b", 2) {
+		t.Fatal("CompareAndDelete(b) with the wrong old value succeeded")
+	}
+	if !m.CompareAndDelete("b", 3) {
+		t.Fatal("CompareAndDelete(b, 3) failed")
+	}
+
+	if v, ok := m.Update("c", func(v int, ok bool) (int, bool) { return v + 1, true }); v != 1 || !ok {
+		t.Fatalf("Update(c) = %d, %v, want it created", v, ok)
+	}
+
+	if !m.Delete("c") || m.Delete("c") {
+		t.Fatal("Delete(c) twice did not report it present once")
+	}
+
+	if got, want := m.Snapshot(), map[string]int{"a": 6}; !maps.Equal(got, want) || m.Len() != 1 {
+		t.Fatalf("Snapshot() = %v, Len() = %d, want %v", got, m.Len(), want)
+	}
+}
+
+// TestShardMapResize resizes the map over and over while writers use it,
+// each writer with keys of its own, so that it knows what they must hold.
+func TestShardMapResize(t *testing.T) {
+	const writers, keys, rounds = 8, 50, 100
+
+	m := NewShardMap[string, int](4, nil)
+
+	var done atomic.Bool
+	var resizer sync.WaitGroup
+	resizer.Go(func() {
+		for i := 0; !done.Load(); i++ {
+			m.Resize(1 + i%17)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Go(func() {
+			for k := range keys {
+				m.Set(fmt.Sprintf("%d-%d", w, k), 0)
+			}
+
+			for r := range rounds {
+				for k := range keys {
+					key := fmt.Sprintf("%d-%d", w, k)
+
+					if v, ok := m.Get(key); v != r || !ok {
+						t.Errorf("Get(%s) = %d, %v in round %d", key, v, ok, r)
+						return
+					}
+					if !m.CompareAndSwap(key, r, r+1) {
+						t.Errorf("CompareAndSwap(%s, %d) failed", key, r)
+						return
+					}
+				}
+
+				tmp := fmt.Sprintf("%d-tmp", w)
+				m.Set(tmp, r)
+				if !m.Delete(tmp) {
+					t.Errorf("Delete(%s) lost the value just set", tmp)
+					return
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+	done.Store(true)
+	resizer.Wait()
+
+	if n := m.Len(); n != writers*keys {
+		t.Fatalf("Len() = %d, want %d", n, writers*keys)
+	}
+	for k, v := range m.All() {
+		if v != rounds {
+			t.Fatalf("%s = %d, want %d", k, v, rounds)
+		}
+	}
+}
+
+// TestShardMapSnapshot checks that a snapshot is taken at one instant: a
+// writer sets the keys in order, so no snapshot may show a later key newer
+// than an earlier one.
+func TestShardMapSnapshot(t *testing.T) {
+	const keys, rounds = 16, 2000
+
+	m := NewShardMap[int, int](8, nil)
+	for k := range keys {
+		m.Set(k, 0)
+	}
+
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer done.Store(true)
+
+		for r := 1; r <= rounds; r++ {
+			for k := range keys {
+				m.Set(k, r)
+			}
+		}
+	})
+	wg.Go(func() {
+		for i := 0; !done.Load(); i++ {
+			m.Resize(1 + i%9)
+		}
+	})
+
+	for !done.Load() {
+		snapshot := m.Snapshot()
+
+		for k := 1; k < keys; k++ {
+			if first, v := snapshot[0], snapshot[k]; v > snapshot[k-1] || first > v+1 {
+				t.Fatalf("inconsistent snapshot: %v", snapshot)
+			}
+		}
+	}
+
+	wg.Wait()
+}
+
+const benchKeys = 1 << 16
+
+func benchmarkKeys() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+
+	return keys
+}
+
+func benchmarkShardMap(b *testing.B, nshards int, hash Hasher[string], writes int) {
+	keys := benchmarkKeys()
+
+	m := NewShardMap[string, int](nshards, hash)
+	for i, k := range keys {
+		m.Set(k, i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := keys[i%benchKeys]
+			if i%100 < writes {
+				m.Set(k, i)
+			} else {
+				m.Get(k)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkShardMapMapHashReads(b *testing.B)  { benchmarkShardMap(b, 32, nil, 0) }
+func BenchmarkShardMapMapHashMixed(b *testing.B)  { benchmarkShardMap(b, 32, nil, 10) }
+func BenchmarkShardMapMapHashWrites(b *testing.B) { benchmarkShardMap(b, 32, nil, 100) }
+func BenchmarkShardMapFNVMixed(b *testing.B)      { benchmarkShardMap(b, 32, FNV, 10) }
+func BenchmarkShardMapOneShardMixed(b *testing.B) { benchmarkShardMap(b, 1, nil, 10) }
+
+func BenchmarkSyncMapMixed(b *testing.B) {
+	keys := benchmarkKeys()
+
+	var m sync.Map
+	for i, k := range keys {
+		m.Store(k, i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := keys[i%benchKeys]
+			if i%100 < 10 {
+				m.Store(k, i)
+			} else {
+				m.Load(k)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkShardMapSnapshot(b *testing.B) {
+	m := NewShardMap[string, int](32, nil)
+	for i, k := range benchmarkKeys() {
+		m.Set(k, i)
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		m.Snapshot()
+	}
+}
+
+func BenchmarkShardMapResize(b *testing.B) {
+	m := NewShardMap[string, int](32, nil)
+	for i, k := range benchmarkKeys() {
+		m.Set(k, i)
+	}
+
+	b.ResetTimer()
+	for i := range b.N {
+		m.Resize(16 + i%2*16)
+	}
+}
@@ -0,0 +1,94 @@
+package concurrency
+
+import (
+	"context"
+	"sync"
+)
+
+// Group coalesces concurrent calls for the same key: while one runs, the
+// others wait for its result instead of making their own.
+type Group[K comparable, V any] struct {
+	m     sync.Mutex
+	calls map[K]*call[V]
+}
+
+type call[V any] struct {
+	done chan struct{}
+	res  V
+	err  error
+	dups int
+}
+
+// Do returns the result of fn, or of the call for key already running, and
+// whether the result was shared with other callers. A panic in fn fails
+// every caller with a *PanicError.
+func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
+	c, first := g.join(key)
+	if first {
+		g.run(key, c, fn)
+	}
+
+	<-c.done
+
+	return c.res, c.err, c.dups > 0
+}
+
+// DoContext is Do, but stops waiting when ctx is done. The call goes on for
+// the other callers; fn gets a context that is not cancelled with ctx.
+func (g *Group[K, V]) DoContext(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, err error, shared bool) {
+	c, first := g.join(key)
+	if first {
+		go g.run(key, c, func() (V, error) { return fn(context.WithoutCancel(ctx)) })
+	}
+
+	select {
+	case <-c.done:
+		return c.res, c.err, c.dups > 0
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err(), false
+	}
+}
+
+// Forget makes the next call for key run fn, even if one is running.
+func (g *Group[K, V]) Forget(key K) {
+	g.m.Lock()
+	delete(g.calls, key)
+	g.m.Unlock()
+}
+
+func (g *Group[K, V]) join(key K) (*call[V], bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		return c, false
+	}
+
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+
+	c := &call[V]{done: make(chan struct{})}
+	g.calls[key] = c
+
+	return c, true
+}
+
+func (g *Group[K, V]) run(key K, c *call[V], fn func() (V, error)) {
+	err := protect(func() error {
+		var err error
+		c.res, err = fn()
+		return err
+	})
+	c.err = err
+
+	g.m.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.m.Unlock()
+
+	close(c.done)
+}
@@ -0,0 +1,144 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+)
+
+func TestGroupDo(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var g Group[string, int]
+		var calls atomic.Int32
+		release := make(chan struct{})
+
+		fn := func() (int, error) {
+			calls.Add(1)
+			<-release
+			return 42, nil
+		}
+
+		var wg sync.WaitGroup
+		var sharedCount atomic.Int32
+		for range 5 {
+			wg.Go(func() {
+				v, err, shared := g.Do("k", fn)
+				if v != 42 || err != nil {
+					t.Errorf("Do() = %d, %v, want 42, nil", v, err)
+				}
+				if shared {
+					sharedCount.Add(1)
+				}
+			})
+		}
+		synctest.Wait() // every caller waits for the one call
+		close(release)
+		wg.Wait()
+
+		if calls.Load() != 1 || sharedCount.Load() != 5 {
+			t.Fatalf("fn ran %d times and %d callers shared it, want once and 5", calls.Load(), sharedCount.Load())
+		}
+
+		// The call is over: the next one runs fn again, unshared.
+		if _, _, shared := g.Do("k", fn); shared || calls.Load() != 2 {
+			t.Fatalf("Do() after the call ended: shared %v, %d calls; want a new unshared call", shared, calls.Load())
+		}
+	})
+}
+
+func TestGroupPanic(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var g Group[string, int]
+		release := make(chan struct{})
+
+		errs := make(chan error, 2)
+		for range 2 {
+			go func() {
+				_, err, _ := g.Do("k", func() (int, error) {
+					<-release
+					panic("boom")
+				})
+				errs <- err
+			}()
+		}
+		synctest.Wait()
+		close(release)
+
+		for range 2 {
+			var perr *PanicError
+			if err := <-errs; !errors.As(err, &perr) {
+				t.Fatalf("Do() of a panicking call = %v, want a *PanicError for every caller", err)
+			}
+		}
+	})
+}
+
+func TestGroupDoContext(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var g Group[string, int]
+		release := make(chan struct{})
+
+		fn := func(ctx context.Context) (int, error) {
+			<-release
+			return 1, ctx.Err()
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+
+		impatient := make(chan error, 1)
+		go func() {
+			_, err, _ := g.DoContext(ctx, "k", fn)
+			impatient <- err
+		}()
+		synctest.Wait()
+
+		patient := make(chan int, 1)
+		go func() {
+			v, _, _ := g.DoContext(t.Context(), "k", fn)
+			patient <- v
+		}()
+		synctest.Wait()
+
+		cancel()
+		if err := <-impatient; !errors.Is(err, context.Canceled) {
+			t.Fatalf("DoContext() after its ctx was cancelled = %v, want context.Canceled", err)
+		}
+
+		// The call goes on, with a context not cancelled with the first caller's.
+		close(release)
+		if v := <-patient; v != 1 {
+			t.Fatalf("DoContext() of the other caller = %d, want the call's result", v)
+		}
+	})
+}
+
+func TestGroupForget(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var g Group[string, int]
+		var calls atomic.Int32
+		release := make(chan struct{})
+
+		go g.Do("k", func() (int, error) {
+			calls.Add(1)
+			<-release
+			return 1, nil
+		})
+		synctest.Wait()
+
+		g.Forget("k")
+
+		if v, _, shared := g.Do("k", func() (int, error) { calls.Add(1); return 2, nil }); v != 2 || shared {
+			t.Fatalf("Do() after Forget() = %d, shared %v; want a new call", v, shared)
+		}
+
+		close(release)
+		synctest.Wait()
+
+		if calls.Load() != 2 {
+			t.Fatalf("fn ran %d times, want 2", calls.Load())
+		}
+	})
+}
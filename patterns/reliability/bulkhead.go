@@ -0,0 +1,95 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// BulkheadOptions configure a Bulkhead: at most MaxConcurrent calls run at
+// once, and at most MaxQueue more wait for a slot, each for up to MaxWait if
+// positive. Calls beyond that fail with ErrBulkheadFull.
+type BulkheadOptions struct {
+	MaxConcurrent int
+	MaxQueue      int
+	MaxWait       time.Duration
+	Clock         Clock
+}
+
+// Bulkhead caps the concurrent calls to a dependency, so that a slow one
+// cannot tie up every goroutine of its callers. Use one per dependency.
+type Bulkhead struct {
+	o      BulkheadOptions
+	slots  chan struct{}
+	queued atomic.Int64
+}
+
+func NewBulkhead(o BulkheadOptions) *Bulkhead {
+	o.MaxConcurrent = max(o.MaxConcurrent, 1)
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+
+	return &Bulkhead{o: o, slots: make(chan struct{}, o.MaxConcurrent)}
+}
+
+// Acquire takes a slot, waiting in the queue if there is room, and returns
+// the func releasing it.
+func (b *Bulkhead) Acquire(ctx context.Context) (func(), error) {
+	release := func() { <-b.slots }
+
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if b.queued.Add(1) > int64(b.o.MaxQueue) {
+		b.queued.Add(-1)
+		return nil, ErrBulkheadFull
+	}
+	defer b.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if b.o.MaxWait > 0 {
+		t := b.o.Clock.NewTimer(b.o.MaxWait)
+		defer t.Stop()
+		timeout = t.C()
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	case <-timeout:
+		return nil, ErrBulkheadFull
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Active returns the number of calls holding a slot.
+func (b *Bulkhead) Active() int {
+	return len(b.slots)
+}
+
+// Queued returns the number of calls waiting for a slot.
+func (b *Bulkhead) Queued() int {
+	return int(b.queued.Load())
+}
+
+// Isolate runs op in a slot of b.
+func Isolate[T any](op Operation[T], b *Bulkhead) Operation[T] {
+	return func(ctx context.Context) (T, error) {
+		release, err := b.Acquire(ctx)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		defer release()
+
+		return op(ctx)
+	}
+}
@@ -0,0 +1,96 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBulkheadRejectsWhenFull(t *testing.T) {
+	b := NewBulkhead(BulkheadOptions{MaxConcurrent: 1})
+
+	release, err := b.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() = %v", err)
+	}
+
+	if _, err := b.Acquire(context.Background()); !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("Acquire() on a full bulkhead = %v, want ErrBulkheadFull", err)
+	}
+
+	release()
+
+	if _, err := b.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire() after release = %v", err)
+	}
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := NewBulkhead(BulkheadOptions{MaxConcurrent: 1, MaxQueue: 1, MaxWait: time.Second, Clock: clock})
+
+	release, _ := b.Acquire(context.Background())
+
+	queued := make(chan error)
+	go func() {
+		release, err := b.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+
+	clock.BlockUntil(1)
+
+	if _, err := b.Acquire(context.Background()); !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("Acquire() with a full queue = %v, want ErrBulkheadFull", err)
+	}
+
+	release()
+
+	if err := <-queued; err != nil {
+		t.Fatalf("queued Acquire() = %v", err)
+	}
+	if b.Active() != 0 || b.Queued() != 0 {
+		t.Fatalf("Active() = %d, Queued() = %d, want 0, 0", b.Active(), b.Queued())
+	}
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := NewBulkhead(BulkheadOptions{MaxConcurrent: 1, MaxQueue: 1, MaxWait: time.Second, Clock: clock})
+
+	b.Acquire(context.Background())
+
+	queued := make(chan error)
+	go func() {
+		_, err := b.Acquire(context.Background())
+		queued <- err
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	if err := <-queued; !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("Acquire() after MaxWait = %v, want ErrBulkheadFull", err)
+	}
+}
+
+func TestIsolate(t *testing.T) {
+	b := NewBulkhead(BulkheadOptions{MaxConcurrent: 1})
+
+	e := Isolate(func(ctx context.Context) (int, error) {
+		if b.Active() != 1 {
+			t.Errorf("Active() during the call = %d, want 1", b.Active())
+		}
+		return 42, nil
+	}, b)
+
+	if res, err := e(context.Background()); res != 42 || err != nil {
+		t.Fatalf("Isolate() = %d, %v, want 42, nil", res, err)
+	}
+	if b.Active() != 0 {
+		t.Fatalf("Active() after the call = %d, want 0", b.Active())
+	}
+}
@@ -0,0 +1,63 @@
+package reliability
+
+import (
+	"context"
+	"time"
+)
+
+// Operation is the call every pattern wraps.
+type Operation[T any] func(ctx context.Context) (T, error)
+
+// Middleware wraps an operation in a pattern.
+type Middleware[T any] func(op Operation[T]) Operation[T]
+
+// Chain wraps op in middleware, the first one outermost: Chain(op,
+// WithTimeout[T](d, nil), WithRetry[T](p)) times out all the attempts
+// together, while the reverse order would time out each.
+func Chain[T any](op Operation[T], middleware ...Middleware[T]) Operation[T] {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		op = middleware[i](op)
+	}
+
+	return op
+}
+
+func WithBreaker[T any](b *CircuitBreaker[T]) Middleware[T] {
+	return func(op Operation[T]) Operation[T] {
+		return func(ctx context.Context) (T, error) {
+			return b.Execute(ctx, op)
+		}
+	}
+}
+
+func WithRetry[T any](p RetryPolicy) Middleware[T] {
+	return func(op Operation[T]) Operation[T] { return Retry(op, p) }
+}
+
+func WithThrottle[T any](l Limiter) Middleware[T] {
+	return func(op Operation[T]) Operation[T] { return Throttle(op, l) }
+}
+
+func WithTimeout[T any](d time.Duration, clock Clock) Middleware[T] {
+	return func(op Operation[T]) Operation[T] { return Timeout(op, d, clock) }
+}
+
+func WithDebounceFirst[T any](d time.Duration, clock Clock) Middleware[T] {
+	return func(op Operation[T]) Operation[T] { return DebounceFirst(op, d, clock) }
+}
+
+func WithDebounceLast[T any](d time.Duration, clock Clock) Middleware[T] {
+	return func(op Operation[T]) Operation[T] { return DebounceLast(op, d, clock) }
+}
+
+func WithBulkhead[T any](b *Bulkhead) Middleware[T] {
+	return func(op Operation[T]) Operation[T] { return Isolate(op, b) }
+}
+
+func WithHedge[T any](o HedgeOptions) Middleware[T] {
+	return func(op Operation[T]) Operation[T] { return Hedge(op, o) }
+}
+
+func WithFallback[T any](fallbacks ...Operation[T]) Middleware[T] {
+	return func(op Operation[T]) Operation[T] { return Fallback(op, fallbacks...) }
+}
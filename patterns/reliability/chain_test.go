@@ -0,0 +1,50 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+
+	trace := func(name string) Middleware[int] {
+		return func(op Operation[int]) Operation[int] {
+			return func(ctx context.Context) (int, error) {
+				order = append(order, name)
+				return op(ctx)
+			}
+		}
+	}
+
+	Chain(succeed, trace("outer"), trace("middle"), trace("inner"))(context.Background())
+
+	if want := []string{"outer", "middle", "inner"}; !slices.Equal(order, want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+}
+
+func TestChainPatterns(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := NewCircuitBreaker[int](BreakerSettings{FailureThreshold: 2, OpenTimeout: time.Minute, Clock: clock})
+	calls := 0
+
+	op := Chain(func(context.Context) (int, error) {
+		calls++
+		return 0, errFailed
+	},
+		WithFallback(func(context.Context) (int, error) { return -1, nil }),
+		WithRetry[int](RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool { return !errors.Is(err, ErrOpenState) }, Clock: clock}),
+		WithBreaker(b),
+	)
+
+	if res, err := retryInBackground(clock, op); res != -1 || err != nil {
+		t.Fatalf("chain = %d, %v, want the fallback", res, err)
+	}
+	if calls != 2 || b.State() != StateOpen {
+		t.Fatalf("%d calls, breaker %v; want the breaker to open after 2 and stop the retries", calls, b.State())
+	}
+}
@@ -3,49 +3,343 @@ package reliability
 import (
 	"context"
 	"errors"
-	"fmt"
 	"sync"
 	"time"
 )
 
-type Circuit func(ctx context.Context) (string, error)
+var (
+	ErrOpenState     = errors.New("circuit breaker is open")
+	ErrTooManyProbes = errors.New("circuit breaker is half-open and probing")
+)
+
+// Breaker wraps op in a CircuitBreaker with the given settings.
+func Breaker[T any](op Operation[T], s BreakerSettings) Operation[T] {
+	return WithBreaker(NewCircuitBreaker[T](s))(op)
+}
+
+type State byte
+
+const (
+	StateClosed   State = iota // calls go through
+	StateOpen                  // calls fail fast with ErrOpenState
+	StateHalfOpen              // a few probe calls go through to test recovery
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// BreakerSettings configure a CircuitBreaker. The breaker opens after
+// FailureThreshold consecutive failures, or once at least MinRequests calls
+// in the last Window failed at FailureRatio or more; with neither set, after
+// 5 consecutive failures. A zero Window counts calls since the breaker last
+// closed.
+type BreakerSettings struct {
+	FailureThreshold uint
+	FailureRatio     float64
+	MinRequests      uint
+	Window           time.Duration
+
+	// OpenTimeout is how long the breaker stays open before probing, 5s if
+	// zero. MaxProbes calls go through while half-open, 1 if zero; if they
+	// all succeed the breaker closes, and the first failure reopens it.
+	OpenTimeout time.Duration
+	MaxProbes   uint
+
+	// IsFailure classifies the errors that count against the circuit. By
+	// default every error does. Calls cancelled by the caller count neither
+	// way, and free their probe slot.
+	IsFailure func(err error) bool
+
+	// OnStateChange is called after every change of state.
+	OnStateChange func(from, to State)
+
+	Clock Clock
+}
+
+// Counts are the calls seen since the breaker last changed state, or for a
+// closed breaker with a Window, within it.
+type Counts struct {
+	Requests             uint
+	Successes            uint
+	Failures             uint
+	ConsecutiveSuccesses uint
+	ConsecutiveFailures  uint
+}
+
+// CircuitBreaker stops calling a failing dependency for a while, so that it
+// is not overloaded while it recovers and callers fail fast meanwhile.
+type CircuitBreaker[T any] struct {
+	s BreakerSettings
+
+	m          sync.Mutex
+	state      State
+	generation uint64 // increases with every change of state
+	openedAt   time.Time
+	probes     uint
+	counts     Counts
+	window     window
+}
+
+func NewCircuitBreaker[T any](s BreakerSettings) *CircuitBreaker[T] {
+	if s.FailureThreshold == 0 && s.FailureRatio == 0 {
+		s.FailureThreshold = 5
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = 5 * time.Second
+	}
+	if s.MaxProbes == 0 {
+		s.MaxProbes = 1
+	}
+	if s.Clock == nil {
+		s.Clock = SystemClock
+	}
+	if s.IsFailure == nil {
+		s.IsFailure = func(err error) bool { return err != nil }
+	}
+
+	return &CircuitBreaker[T]{s: s, window: newWindow(s.Window)}
+}
+
+// Execute calls op unless the breaker is open, and counts its outcome. A
+// panic in op counts as a failure and is passed on.
+func (b *CircuitBreaker[T]) Execute(ctx context.Context, op Operation[T]) (T, error) {
+	var zero T
+
+	generation, err := b.before()
+	if err != nil {
+		return zero, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			b.after(generation, true)
+			panic(r)
+		}
+	}()
+
+	res, err := op(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		b.cancel(generation)
+	} else {
+		b.after(generation, b.s.IsFailure(err))
+	}
+
+	return res, err
+}
+
+func (b *CircuitBreaker[T]) State() State {
+	b.m.Lock()
+	state, changes := b.current(b.s.Clock.Now())
+	b.m.Unlock()
+
+	b.notify(changes)
+
+	return state
+}
+
+func (b *CircuitBreaker[T]) Counts() Counts {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	c := b.counts
+	if b.state == StateClosed {
+		c.Requests, c.Failures = b.window.totals(b.s.Clock.Now())
+		c.Successes = c.Requests - c.Failures
+	}
+
+	return c
+}
+
+type stateChange struct{ from, to State }
+
+func (b *CircuitBreaker[T]) before() (uint64, error) {
+	b.m.Lock()
+	state, changes := b.current(b.s.Clock.Now())
+
+	var err error
+
+	switch {
+	case state == StateOpen:
+		err = ErrOpenState
+	case state == StateHalfOpen && b.probes >= b.s.MaxProbes:
+		err = ErrTooManyProbes
+	case state == StateHalfOpen:
+		b.probes++
+	}
 
-func Breaker(circuit Circuit, failureThreshold uint) Circuit {
-	var consecutiveFailure = 0
-	var lastAttempt = time.Now()
-	var m sync.RWMutex
+	if err == nil {
+		b.counts.Requests++
+	}
+
+	generation := b.generation
+	b.m.Unlock()
+
+	b.notify(changes)
+
+	return generation, err
+}
+
+func (b *CircuitBreaker[T]) after(generation uint64, failed bool) {
+	now := b.s.Clock.Now()
+
+	b.m.Lock()
+	state, changes := b.current(now)
 
-	return func(ctx context.Context) (string, error) {
-		m.RLock()
+	// The breaker changed state while the call ran: its outcome is stale.
+	if generation != b.generation {
+		b.m.Unlock()
+		b.notify(changes)
+		return
+	}
+
+	if failed {
+		b.counts.Failures++
+		b.counts.ConsecutiveFailures++
+		b.counts.ConsecutiveSuccesses = 0
+	} else {
+		b.counts.Successes++
+		b.counts.ConsecutiveSuccesses++
+		b.counts.ConsecutiveFailures = 0
+	}
+
+	switch state {
+	case StateClosed:
+		b.window.add(now, failed)
+		if failed && b.shouldTrip(now) {
+			changes = append(changes, b.setState(StateOpen, now))
+		}
+	case StateHalfOpen:
+		if failed {
+			changes = append(changes, b.setState(StateOpen, now))
+		} else if b.counts.ConsecutiveSuccesses >= b.s.MaxProbes {
+			changes = append(changes, b.setState(StateClosed, now))
+		}
+	}
 
-		d := consecutiveFailure - int(failureThreshold)
+	b.m.Unlock()
 
-		fmt.Println(consecutiveFailure)
-		fmt.Println(lastAttempt)
+	b.notify(changes)
+}
 
-		if d >= 0 {
-			shouldRetryAt := lastAttempt.Add(time.Second * 2 << d)
-			if !time.Now().After(shouldRetryAt) {
-				m.RUnlock()
-				return "", errors.New("service unreachable")
-			}
+// cancel forgets a call that before let through, as if it never started.
+func (b *CircuitBreaker[T]) cancel(generation uint64) {
+	b.m.Lock()
+	if generation == b.generation {
+		b.counts.Requests--
+		if b.state == StateHalfOpen {
+			b.probes--
 		}
+	}
+	b.m.Unlock()
+}
+
+func (b *CircuitBreaker[T]) shouldTrip(now time.Time) bool {
+	if b.s.FailureThreshold > 0 && b.counts.ConsecutiveFailures >= b.s.FailureThreshold {
+		return true
+	}
+
+	if b.s.FailureRatio > 0 {
+		requests, failures := b.window.totals(now)
+		return requests >= max(b.s.MinRequests, 1) && float64(failures)/float64(requests) >= b.s.FailureRatio
+	}
+
+	return false
+}
+
+// current moves an open breaker to half-open once its timeout has passed,
+// and returns the state. It must be called with b.m held.
+func (b *CircuitBreaker[T]) current(now time.Time) (State, []stateChange) {
+	if b.state == StateOpen && !now.Before(b.openedAt.Add(b.s.OpenTimeout)) {
+		return StateHalfOpen, []stateChange{b.setState(StateHalfOpen, now)}
+	}
+
+	return b.state, nil
+}
+
+func (b *CircuitBreaker[T]) setState(to State, now time.Time) stateChange {
+	change := stateChange{from: b.state, to: to}
+
+	b.state = to
+	b.generation++
+	b.probes = 0
+	b.counts = Counts{}
+	b.window.reset()
+
+	if to == StateOpen {
+		b.openedAt = now
+	}
+
+	return change
+}
+
+func (b *CircuitBreaker[T]) notify(changes []stateChange) {
+	if b.s.OnStateChange == nil {
+		return
+	}
+
+	for _, c := range changes {
+		b.s.OnStateChange(c.from, c.to)
+	}
+}
+
+const windowBuckets = 10
 
-		m.RUnlock()
+// window counts calls over a sliding window, in buckets of a tenth of it.
+type window struct {
+	bucket  time.Duration // zero: a single bucket that never expires
+	buckets [windowBuckets]windowBucket
+}
+
+type windowBucket struct {
+	start              time.Time
+	requests, failures uint
+}
 
-		response, err := circuit(ctx)
-		m.Lock()
-		defer m.Unlock()
+func newWindow(size time.Duration) window {
+	return window{bucket: size / windowBuckets}
+}
 
-		lastAttempt = time.Now()
+func (w *window) add(now time.Time, failed bool) {
+	b := &w.buckets[0]
 
-		if err != nil {
-			consecutiveFailure++
-			return "", err
+	if w.bucket > 0 {
+		start := now.Truncate(w.bucket)
+		b = &w.buckets[(start.UnixNano()/int64(w.bucket))%windowBuckets]
+
+		if !b.start.Equal(start) {
+			*b = windowBucket{start: start}
 		}
+	}
 
-		consecutiveFailure = 0
+	b.requests++
+	if failed {
+		b.failures++
+	}
+}
+
+func (w *window) totals(now time.Time) (requests, failures uint) {
+	horizon := now.Add(-w.bucket * windowBuckets)
 
-		return response, nil
+	for _, b := range w.buckets {
+		if w.bucket == 0 || b.start.After(horizon) {
+			requests += b.requests
+			failures += b.failures
+		}
 	}
+
+	return requests, failures
+}
+
+func (w *window) reset() {
+	w.buckets = [windowBuckets]windowBucket{}
 }
@@ -0,0 +1,165 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var errFailed = errors.New("failed")
+
+func fail(context.Context) (int, error)    { return 0, errFailed }
+func succeed(context.Context) (int, error) { return 1, nil }
+
+func TestBreakerStates(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var changes []string
+
+	b := NewCircuitBreaker[int](BreakerSettings{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Second,
+		Clock:            clock,
+		OnStateChange:    func(from, to State) { changes = append(changes, from.String()+">"+to.String()) },
+	})
+
+	b.Execute(context.Background(), fail)
+	if b.State() != StateClosed {
+		t.Fatalf("State() after 1 failure = %v, want closed", b.State())
+	}
+
+	b.Execute(context.Background(), fail)
+	if _, err := b.Execute(context.Background(), succeed); !errors.Is(err, ErrOpenState) {
+		t.Fatalf("Execute() when open = %v, want ErrOpenState", err)
+	}
+
+	clock.Advance(time.Second)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("State() after OpenTimeout = %v, want half-open", b.State())
+	}
+
+	b.Execute(context.Background(), fail)
+	if b.State() != StateOpen {
+		t.Fatalf("State() after a failed probe = %v, want open", b.State())
+	}
+
+	clock.Advance(time.Second)
+	if res, err := b.Execute(context.Background(), succeed); res != 1 || err != nil {
+		t.Fatalf("probe Execute() = %d, %v, want 1, nil", res, err)
+	}
+
+	want := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if !slices.Equal(changes, want) {
+		t.Fatalf("state changes = %v, want %v", changes, want)
+	}
+}
+
+func TestBreakerFailureRatio(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := NewCircuitBreaker[int](BreakerSettings{FailureRatio: 0.5, MinRequests: 4, Window: 10 * time.Second, Clock: clock})
+
+	b.Execute(context.Background(), fail)
+	b.Execute(context.Background(), succeed)
+	b.Execute(context.Background(), fail)
+	if b.State() != StateClosed {
+		t.Fatalf("State() below MinRequests = %v, want closed", b.State())
+	}
+
+	// The first failure slides out of the window.
+	clock.Advance(10 * time.Second)
+	b.Execute(context.Background(), succeed)
+	b.Execute(context.Background(), succeed)
+	b.Execute(context.Background(), fail)
+	if c := b.Counts(); b.State() != StateClosed || c.Requests != 3 || c.Failures != 1 {
+		t.Fatalf("State() = %v, Counts() = %+v; want closed with 3 requests and 1 failure", b.State(), c)
+	}
+
+	b.Execute(context.Background(), fail)
+	b.Execute(context.Background(), fail)
+	if b.State() != StateOpen {
+		t.Fatalf("State() at 3 failures of 5 = %v, want open", b.State())
+	}
+}
+
+func TestBreakerMaxProbes(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := NewCircuitBreaker[int](BreakerSettings{FailureThreshold: 1, MaxProbes: 2, OpenTimeout: time.Second, Clock: clock})
+
+	b.Execute(context.Background(), fail)
+	clock.Advance(time.Second)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	for range 2 {
+		go func() {
+			b.Execute(context.Background(), func(context.Context) (int, error) {
+				started <- struct{}{}
+				<-release
+				return 1, nil
+			})
+			done <- struct{}{}
+		}()
+	}
+	<-started
+	<-started
+
+	if _, err := b.Execute(context.Background(), succeed); !errors.Is(err, ErrTooManyProbes) {
+		t.Fatalf("third probe = %v, want ErrTooManyProbes", err)
+	}
+
+	close(release)
+	<-done
+	<-done
+
+	if b.State() != StateClosed {
+		t.Fatalf("State() after the probes succeeded = %v, want closed", b.State())
+	}
+}
+
+func TestBreakerIsFailure(t *testing.T) {
+	b := NewCircuitBreaker[int](BreakerSettings{
+		FailureThreshold: 1,
+		IsFailure:        func(err error) bool { return err != nil && !errors.Is(err, errFailed) },
+	})
+
+	b.Execute(context.Background(), fail)
+	b.Execute(context.Background(), func(context.Context) (int, error) { return 0, context.Canceled })
+
+	if b.State() != StateOpen {
+		t.Fatalf("State() = %v, want open after the error classified as a failure", b.State())
+	}
+	if c := b.Counts(); c.Successes != 0 || c.Failures != 0 {
+		t.Fatalf("Counts() after opening = %+v, want them reset", c)
+	}
+}
+
+func TestBreakerIgnoresCancelledCalls(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := NewCircuitBreaker[int](BreakerSettings{FailureThreshold: 2, OpenTimeout: time.Second, Clock: clock})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled := func(ctx context.Context) (int, error) { return 0, ctx.Err() }
+
+	b.Execute(context.Background(), fail)
+	b.Execute(ctx, cancelled)
+	if c := b.Counts(); c.Requests != 1 || c.ConsecutiveFailures != 1 {
+		t.Fatalf("Counts() after a cancelled call = %+v, want only the failure", c)
+	}
+
+	b.Execute(context.Background(), fail)
+	clock.Advance(time.Second)
+
+	// A cancelled probe neither closes the breaker nor holds its slot.
+	b.Execute(ctx, cancelled)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("State() after a cancelled probe = %v, want half-open", b.State())
+	}
+	if res, err := b.Execute(context.Background(), succeed); res != 1 || err != nil {
+		t.Fatalf("probe Execute() after a cancelled one = %d, %v, want 1, nil", res, err)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("State() after the probe succeeded = %v, want closed", b.State())
+	}
+}
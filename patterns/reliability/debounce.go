@@ -6,72 +6,88 @@ import (
 	"time"
 )
 
-func DebounceFirst(circuit Circuit, d time.Duration) Circuit {
+// DebounceFirst calls op at most once per d: calls within d of the previous
+// one, including those answered from the cache, return its result.
+func DebounceFirst[T any](op Operation[T], d time.Duration, clock Clock) Operation[T] {
+	if clock == nil {
+		clock = SystemClock
+	}
+
 	var threshold time.Time
-	var result string
+	var result T
 	var err error
 	var m sync.Mutex
 
-	return func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (T, error) {
 		m.Lock()
 		defer func() {
-			threshold = time.Now().Add(d)
+			threshold = clock.Now().Add(d)
 			m.Unlock()
 		}()
 
-		if time.Now().Before(threshold) {
+		if clock.Now().Before(threshold) {
 			return result, err
 		}
 
-		result, err = circuit(ctx)
+		result, err = op(ctx)
 
 		return result, err
 	}
 }
 
-func DebounceLast(circuit Circuit, d time.Duration) Circuit {
-	var threshold time.Time = time.Now()
-	var ticker *time.Ticker
-	var result string
+// DebounceLast calls op once no call came for d. op runs on behalf of every
+// caller, so with a context none of them can cancel, and never twice at
+// once: calls made while it runs lead to another run once they stop for d.
+// Calls return the result of the previous run.
+func DebounceLast[T any](op Operation[T], d time.Duration, clock Clock) Operation[T] {
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	var threshold time.Time
+	var running, pending bool
+	var result T
 	var err error
-	var once sync.Once
 	var m sync.Mutex
 
-	return func(ctx context.Context) (string, error) {
+	run := func() {
+		for {
+			m.Lock()
+			if wait := threshold.Sub(clock.Now()); wait > 0 {
+				m.Unlock()
+				<-clock.NewTimer(wait).C()
+				continue
+			}
+			// This run answers every call so far.
+			pending = false
+			m.Unlock()
+
+			res, e := op(context.Background())
+
+			m.Lock()
+			result, err = res, e
+			if !pending {
+				running = false
+				m.Unlock()
+				return
+			}
+			m.Unlock()
+		}
+	}
+
+	return func(context.Context) (T, error) {
 		m.Lock()
 		defer m.Unlock()
 
-		threshold = time.Now().Add(d)
-
-		once.Do(func() {
-			ticker = time.NewTicker(time.Millisecond * 100)
-
-			go func() {
-				defer func() {
-					m.Lock()
-					ticker.Stop()
-					once = sync.Once{}
-					m.Unlock()
-				}()
-				for {
-					select {
-					case <-ticker.C:
-						m.Lock()
-						if time.Now().After(threshold) {
-							result, err = circuit(ctx)
-							m.Unlock()
-							return
-						}
-						m.Unlock()
-					case <-ctx.Done():
-						m.Lock()
-						result, err = "", ctx.Err()
-						m.Unlock()
-						return
-					}
-				}
-			}()
-		})
+		threshold = clock.Now().Add(d)
+
+		if running {
+			pending = true
+		} else {
+			running = true
+			go run()
+		}
+
 		return result, err
 	}
 }
@@ -0,0 +1,138 @@
+package reliability
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDebounceFirst(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	calls := 0
+
+	op := DebounceFirst(func(context.Context) (int, error) {
+		calls++
+		return calls, nil
+	}, time.Second, clock)
+
+	for range 3 {
+		if res, _ := op(context.Background()); res != 1 {
+			t.Fatalf("debounced call = %d, want the first result", res)
+		}
+		clock.Advance(500 * time.Millisecond)
+	}
+
+	clock.Advance(time.Second)
+	if res, _ := op(context.Background()); res != 2 {
+		t.Fatalf("call after a quiet second = %d, want 2", res)
+	}
+}
+
+func TestDebounceLast(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	called := make(chan struct{}, 2)
+
+	op := DebounceLast(func(context.Context) (int, error) {
+		called <- struct{}{}
+		return 1, nil
+	}, time.Second, clock)
+
+	op(context.Background())
+	clock.BlockUntil(1)
+	clock.Advance(500 * time.Millisecond)
+
+	// Pushes the call back by another second.
+	op(context.Background())
+	clock.Advance(500 * time.Millisecond)
+
+	clock.BlockUntil(1)
+	select {
+	case <-called:
+		t.Fatal("called before a quiet second")
+	default:
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	<-called
+
+	if len(called) != 0 {
+		t.Fatal("called more than once")
+	}
+}
+
+// TestDebounceLastNoOverlap checks that calls made while op runs wait for it
+// to return before running it again.
+func TestDebounceLastNoOverlap(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	started := make(chan int, 2)
+	release := make(chan struct{})
+
+	var running, calls atomic.Int32
+	op := DebounceLast(func(context.Context) (int, error) {
+		if running.Add(1) > 1 {
+			t.Error("op ran twice at once")
+		}
+		defer running.Add(-1)
+
+		n := int(calls.Add(1))
+		started <- n
+		<-release
+		return n, nil
+	}, time.Second, clock)
+
+	op(context.Background())
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-started
+
+	// op is running: this call is answered by a later run.
+	op(context.Background())
+	clock.Advance(time.Second)
+
+	select {
+	case <-started:
+		t.Fatal("op started again before the running one returned")
+	default:
+	}
+
+	release <- struct{}{}
+	if n := <-started; n != 2 {
+		t.Fatalf("run %d started, want the second", n)
+	}
+
+	// A call as the second run returns leads to a third, a quiet second
+	// later.
+	op(context.Background())
+	release <- struct{}{}
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if n := <-started; n != 3 {
+		t.Fatalf("run %d started, want the third", n)
+	}
+	close(release)
+}
+
+// TestDebounceLastDetached checks that a caller cancelling its context does
+// not cancel the run it started.
+func TestDebounceLastDetached(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	done := make(chan error, 1)
+
+	op := DebounceLast(func(ctx context.Context) (int, error) {
+		done <- ctx.Err()
+		return 1, ctx.Err()
+	}, time.Second, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op(ctx)
+	cancel()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	if err := <-done; err != nil {
+		t.Fatalf("op ran with ctx.Err() = %v after its first caller cancelled, want nil", err)
+	}
+}
@@ -0,0 +1,35 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+)
+
+// Fallback calls op, then each fallback in turn while they fail, and
+// returns the first success. If all fail, the error joins all of theirs.
+func Fallback[T any](op Operation[T], fallbacks ...Operation[T]) Operation[T] {
+	return func(ctx context.Context) (T, error) {
+		var errs []error
+
+		for _, e := range append([]Operation[T]{op}, fallbacks...) {
+			res, err := e(ctx)
+			if err == nil {
+				return res, nil
+			}
+
+			errs = append(errs, err)
+
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		var zero T
+		return zero, errors.Join(errs...)
+	}
+}
+
+// FallbackValue returns value whenever op fails.
+func FallbackValue[T any](op Operation[T], value T) Operation[T] {
+	return Fallback(op, func(context.Context) (T, error) { return value, nil })
+}
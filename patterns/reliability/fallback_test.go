@@ -0,0 +1,64 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func failing(err error) Operation[string] {
+	return func(context.Context) (string, error) { return "", err }
+}
+
+func succeeding(res string) Operation[string] {
+	return func(context.Context) (string, error) { return res, nil }
+}
+
+func TestFallback(t *testing.T) {
+	primary, secondary := errors.New("primary"), errors.New("secondary")
+
+	tests := []struct {
+		name    string
+		e       Operation[string]
+		want    string
+		wantErr []error
+	}{
+		{"primary succeeds", Fallback(succeeding("a"), succeeding("b")), "a", nil},
+		{"first fallback", Fallback(failing(primary), succeeding("b"), succeeding("c")), "b", nil},
+		{"second fallback", Fallback(failing(primary), failing(secondary), succeeding("c")), "c", nil},
+		{"all fail", Fallback(failing(primary), failing(secondary)), "", []error{primary, secondary}},
+		{"value", FallbackValue(failing(primary), "default"), "default", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.e(context.Background())
+			if res != tt.want {
+				t.Errorf("result = %q, want %q", res, tt.want)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("error = %v, want nil", err)
+			}
+			for _, want := range tt.wantErr {
+				if !errors.Is(err, want) {
+					t.Errorf("error = %v, want it to wrap %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFallbackStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	e := Fallback(failing(context.Canceled), func(context.Context) (string, error) {
+		called = true
+		return "", nil
+	})
+
+	if _, err := e(ctx); !errors.Is(err, context.Canceled) || called {
+		t.Fatalf("Fallback() = %v, fallback called %v; want context.Canceled without calling it", err, called)
+	}
+}
@@ -0,0 +1,151 @@
+package reliability
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// HedgeOptions configure Hedge. A duplicate call is sent once the calls in
+// flight took longer than the Percentile, e.g. 0.95, of the latencies of the
+// last Samples successful calls, or Delay until MinSamples were seen.
+type HedgeOptions struct {
+	Delay      time.Duration
+	Percentile float64
+	Samples    int // 100 if zero
+	MinSamples int // 10 if zero
+	MaxHedges  int // duplicate calls on top of the first, 1 if zero
+	Clock      Clock
+}
+
+// Hedge calls op again when it is slower than usual, and returns the
+// first success, cancelling the other calls. A call failing while none
+// other is in flight starts the next duplicate right away. If all calls
+// fail, the error is the last one's.
+func Hedge[T any](op Operation[T], o HedgeOptions) Operation[T] {
+	if o.Samples <= 0 {
+		o.Samples = 100
+	}
+	if o.MinSamples <= 0 {
+		o.MinSamples = 10
+	}
+	if o.MaxHedges <= 0 {
+		o.MaxHedges = 1
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+
+	latencies := &latencies{samples: make([]time.Duration, 0, o.Samples)}
+
+	return func(ctx context.Context) (T, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type result struct {
+			res     T
+			err     error
+			latency time.Duration
+		}
+
+		// Buffered so that the losing calls do not block once we returned.
+		results := make(chan result, o.MaxHedges+1)
+		call := func() {
+			start := o.Clock.Now()
+			res, err := op(ctx)
+			results <- result{res, err, o.Clock.Now().Sub(start)}
+		}
+
+		delay := latencies.percentile(o.Percentile, o.MinSamples, o.Delay)
+		started, inFlight := 0, 0
+
+		var timer Timer
+		var hedge <-chan time.Time
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+
+		// launch starts a call, and the timer for the next one if any.
+		launch := func() {
+			go call()
+			started++
+			inFlight++
+
+			if timer != nil {
+				timer.Stop()
+			}
+			timer, hedge = nil, nil
+
+			if started <= o.MaxHedges {
+				timer = o.Clock.NewTimer(delay)
+				hedge = timer.C()
+			}
+		}
+
+		launch()
+
+		for {
+			select {
+			case r := <-results:
+				inFlight--
+				if r.err == nil {
+					latencies.add(r.latency)
+					return r.res, nil
+				}
+				if inFlight > 0 {
+					continue
+				}
+				if started > o.MaxHedges {
+					return r.res, r.err
+				}
+				launch()
+			case <-hedge:
+				launch()
+			case <-ctx.Done():
+				var zero T
+				return zero, ctx.Err()
+			}
+		}
+	}
+}
+
+// latencies keeps the most recent samples in a ring.
+type latencies struct {
+	m       sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if len(l.samples) < cap(l.samples) {
+		l.samples = append(l.samples, d)
+		return
+	}
+
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % len(l.samples)
+}
+
+// percentile returns the p-th percentile of the samples, or fallback while
+// there are fewer than minSamples of them.
+func (l *latencies) percentile(p float64, minSamples int, fallback time.Duration) time.Duration {
+	l.m.Lock()
+	sorted := slices.Clone(l.samples)
+	l.m.Unlock()
+
+	if len(sorted) < minSamples || p <= 0 {
+		return fallback
+	}
+
+	slices.Sort(sorted)
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
@@ -0,0 +1,127 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeTakesFirstSuccess(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var calls atomic.Int32
+	cancelled := make(chan struct{})
+
+	e := Hedge(func(ctx context.Context) (string, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			close(cancelled)
+			return "", ctx.Err()
+		}
+		return "hedged", nil
+	}, HedgeOptions{Delay: 10 * time.Millisecond, Clock: clock})
+
+	done := make(chan string)
+	go func() {
+		res, _ := e(context.Background())
+		done <- res
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Millisecond)
+
+	if res := <-done; res != "hedged" {
+		t.Fatalf("Hedge() = %q, want %q", res, "hedged")
+	}
+	<-cancelled
+}
+
+func TestHedgeFastCall(t *testing.T) {
+	var calls atomic.Int32
+
+	e := Hedge(func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		return 1, nil
+	}, HedgeOptions{Delay: time.Hour, Clock: NewFakeClock(time.Unix(0, 0))})
+
+	if res, err := e(context.Background()); res != 1 || err != nil {
+		t.Fatalf("Hedge() = %d, %v, want 1, nil", res, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("calls = %d, want 1", n)
+	}
+}
+
+func TestHedgeAfterPercentile(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var calls atomic.Int32
+	var latency atomic.Int64
+	started, slow := make(chan struct{}), make(chan struct{})
+
+	e := Hedge(func(ctx context.Context) (int, error) {
+		n := calls.Add(1)
+		if d := latency.Load(); d > 0 {
+			clock.Advance(time.Duration(d))
+			return int(n), nil
+		}
+		if n == 1 {
+			close(started)
+			<-ctx.Done()
+			close(slow)
+			return 0, ctx.Err()
+		}
+		return int(n), nil
+	}, HedgeOptions{Delay: time.Hour, Percentile: 0.9, MinSamples: 10, Clock: clock})
+
+	for i := 1; i <= 10; i++ {
+		latency.Store(int64(i) * int64(time.Millisecond))
+		e(context.Background())
+	}
+	latency.Store(0)
+	calls.Store(0)
+
+	done := make(chan int)
+	go func() {
+		res, _ := e(context.Background())
+		done <- res
+	}()
+
+	// The 90th percentile of 1ms to 10ms is 9ms.
+	<-started
+	clock.BlockUntil(1)
+	clock.Advance(8 * time.Millisecond)
+	if n := pendingTimers(clock); n != 1 {
+		t.Fatalf("pending timers before the percentile = %d, want the hedge's", n)
+	}
+
+	clock.Advance(time.Millisecond)
+	if res := <-done; res != 2 {
+		t.Fatalf("Hedge() = %d, want the hedged call 2", res)
+	}
+	<-slow
+}
+
+func TestHedgeAllFail(t *testing.T) {
+	var calls atomic.Int32
+	fail := errors.New("down")
+
+	e := Hedge(func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		return 0, fail
+	}, HedgeOptions{Delay: time.Hour, MaxHedges: 2, Clock: NewFakeClock(time.Unix(0, 0))})
+
+	if _, err := e(context.Background()); !errors.Is(err, fail) {
+		t.Fatalf("Hedge() = %v, want %v", err, fail)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("calls = %d, want 3", n)
+	}
+}
+
+func pendingTimers(c *FakeClock) int {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return len(c.timers)
+}
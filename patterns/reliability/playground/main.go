@@ -4,22 +4,52 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"cloud_native/patterns/reliability"
 )
 
 func main() {
 	tryOutCircuitBreaker()
+	tryOutChain()
 }
 
 func tryOutCircuitBreaker() {
-	x := reliability.Circuit(func(ctx context.Context) (string, error) {
+	x := reliability.Operation[string](func(ctx context.Context) (string, error) {
 		return "", errors.New("intentional error")
 	})
 
-	brokenCircuit := reliability.Breaker(x, 2)
+	brokenCircuit := reliability.Breaker(x, reliability.BreakerSettings{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Second,
+		OnStateChange: func(from, to reliability.State) {
+			fmt.Printf("circuit %s -> %s\n", from, to)
+		},
+	})
 
 	fmt.Println(brokenCircuit(context.Background()))
 	fmt.Println(brokenCircuit(context.Background()))
 	fmt.Println(brokenCircuit(context.Background()))
+
+	time.Sleep(time.Second)
+	fmt.Println(brokenCircuit(context.Background()))
+}
+
+func tryOutChain() {
+	attempts := 0
+	flaky := reliability.Operation[string](func(ctx context.Context) (string, error) {
+		if attempts++; attempts < 3 {
+			return "", errors.New("flaky")
+		}
+		return fmt.Sprintf("ok after %d attempts", attempts), nil
+	})
+
+	op := reliability.Chain(flaky,
+		reliability.WithFallback(func(context.Context) (string, error) { return "fallback", nil }),
+		reliability.WithTimeout[string](time.Second, nil),
+		reliability.WithRetry[string](reliability.RetryPolicy{MaxAttempts: 5, InitialDelay: 10 * time.Millisecond}),
+		reliability.WithBreaker(reliability.NewCircuitBreaker[string](reliability.BreakerSettings{})),
+	)
+
+	fmt.Println(op(context.Background()))
 }
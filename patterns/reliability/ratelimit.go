@@ -0,0 +1,368 @@
+package reliability
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter decides whether a call may go through now. Implementations are
+// safe for concurrent use.
+type Limiter interface {
+	Take() Allowance
+}
+
+type Strategy byte
+
+const (
+	// StrategyTokenBucket allows bursts of up to Limit calls, refilled by
+	// Rate calls every Interval.
+	StrategyTokenBucket Strategy = iota
+	// StrategyLeakyBucket spaces calls evenly at Rate per Interval, letting
+	// through bursts of up to Limit.
+	StrategyLeakyBucket
+	// StrategySlidingWindow allows Limit calls in any window of Interval.
+	StrategySlidingWindow
+)
+
+// ParseStrategy parses token-bucket, leaky-bucket or sliding-window.
+func ParseStrategy(s string) (Strategy, error) {
+	switch s {
+	case "token-bucket":
+		return StrategyTokenBucket, nil
+	case "leaky-bucket":
+		return StrategyLeakyBucket, nil
+	case "sliding-window":
+		return StrategySlidingWindow, nil
+	}
+
+	return 0, fmt.Errorf("unknown rate limit strategy %q, want token-bucket, leaky-bucket or sliding-window", s)
+}
+
+// LimitMode is what a KeyedLimiter does with a call over the limit.
+type LimitMode byte
+
+const (
+	ModeReject LimitMode = iota // fail it with ErrTooManyCalls
+	ModeWait                    // delay it until it is allowed
+)
+
+// ParseLimitMode parses reject or wait.
+func ParseLimitMode(s string) (LimitMode, error) {
+	switch s {
+	case "reject":
+		return ModeReject, nil
+	case "wait":
+		return ModeWait, nil
+	}
+
+	return 0, fmt.Errorf("unknown rate limit mode %q, want reject or wait", s)
+}
+
+type LimiterOptions struct {
+	Strategy Strategy
+	Limit    uint
+	Rate     uint // per Interval, Limit if zero; unused by the sliding window
+	Interval time.Duration
+
+	Mode    LimitMode
+	MaxWait time.Duration // in ModeWait, reject calls that would wait longer; zero waits as long as ctx allows
+
+	// IdleTimeout is how long a KeyedLimiter keeps the limiter of a key
+	// that is not used, 10 Intervals if zero. A key evicted before its
+	// limiter recovered gets a fresh one.
+	IdleTimeout time.Duration
+
+	Clock Clock
+}
+
+func NewLimiter(o LimiterOptions) Limiter {
+	clock := o.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	// A bucket that never refills would block a client for good.
+	rate := cmp.Or(o.Rate, o.Limit)
+
+	switch o.Strategy {
+	case StrategyLeakyBucket:
+		return newLeakyBucket(o.Limit, rate, o.Interval, clock)
+	case StrategySlidingWindow:
+		return newSlidingWindow(o.Limit, o.Interval, clock)
+	}
+
+	return newTokenBucket(o.Limit, rate, o.Interval, clock)
+}
+
+// Wait blocks until l allows a call, ctx is done, or, if maxWait is
+// positive, the call would have to wait longer than maxWait.
+func Wait(ctx context.Context, l Limiter, maxWait time.Duration) (Allowance, error) {
+	return wait(ctx, l, maxWait, SystemClock)
+}
+
+func wait(ctx context.Context, l Limiter, maxWait time.Duration, clock Clock) (Allowance, error) {
+	var waited time.Duration
+
+	for {
+		a := l.Take()
+		if a.Allowed {
+			return a, nil
+		}
+
+		d := max(a.RetryAfter, time.Millisecond)
+		if maxWait > 0 && waited+d > maxWait {
+			return a, ErrTooManyCalls
+		}
+
+		t := clock.NewTimer(d)
+		select {
+		case <-t.C():
+			waited += d
+		case <-ctx.Done():
+			t.Stop()
+			return a, ctx.Err()
+		}
+	}
+}
+
+// LeakyBucket lets calls through at a steady rate, like water leaking from a
+// bucket of the given size at refill per d. It is implemented as the generic cell
+// rate algorithm: only the time the bucket will be empty is kept.
+type LeakyBucket struct {
+	clock Clock
+	m     sync.Mutex
+	max   uint
+	every time.Duration // between two calls at the steady rate
+	empty time.Time
+}
+
+func NewLeakyBucket(size, refill uint, d time.Duration) *LeakyBucket {
+	return newLeakyBucket(size, refill, d, SystemClock)
+}
+
+func newLeakyBucket(size, refill uint, d time.Duration, clock Clock) *LeakyBucket {
+	return &LeakyBucket{clock: clock, max: size, every: d / time.Duration(max(refill, 1))}
+}
+
+func (b *LeakyBucket) Take() Allowance {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	now := b.clock.Now()
+	empty := b.empty
+	if empty.Before(now) {
+		empty = now
+	}
+
+	a := Allowance{Limit: b.max}
+
+	// A call fits if the bucket, after leaking until now, has room for it.
+	capacity := time.Duration(b.max) * b.every
+	if next := empty.Add(b.every); b.max > 0 && next.Sub(now) <= capacity {
+		b.empty = next
+		empty = next
+		a.Allowed = true
+	} else {
+		a.RetryAfter = next.Add(-capacity).Sub(now)
+	}
+
+	if b.every > 0 {
+		a.Remaining = b.max - min(uint((empty.Sub(now)+b.every-1)/b.every), b.max)
+	}
+	a.Reset = empty.Sub(now)
+
+	return a
+}
+
+// SlidingWindow allows limit calls in any window of d. It approximates the
+// calls in the window by weighing the previous fixed window's count by how
+// much of it the sliding window still covers.
+type SlidingWindow struct {
+	clock Clock
+	m     sync.Mutex
+	max   uint
+	d     time.Duration
+	start time.Time // of the current fixed window
+	prev  uint
+	cur   uint
+}
+
+func NewSlidingWindow(limit uint, d time.Duration) *SlidingWindow {
+	return newSlidingWindow(limit, d, SystemClock)
+}
+
+func newSlidingWindow(limit uint, d time.Duration, clock Clock) *SlidingWindow {
+	return &SlidingWindow{clock: clock, max: limit, d: d, start: clock.Now()}
+}
+
+func (w *SlidingWindow) Take() Allowance {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	now := w.clock.Now()
+	w.advance(now)
+
+	a := Allowance{Limit: w.max}
+
+	if w.count(now)+1 <= float64(w.max) {
+		w.cur++
+		a.Allowed = true
+	} else {
+		a.RetryAfter = w.retryAfter(now)
+	}
+
+	if n := math.Ceil(w.count(now)); n < float64(w.max) {
+		a.Remaining = w.max - uint(n)
+	}
+
+	switch {
+	case w.cur > 0:
+		a.Reset = w.start.Add(2 * w.d).Sub(now)
+	case w.prev > 0:
+		a.Reset = w.start.Add(w.d).Sub(now)
+	}
+
+	return a
+}
+
+func (w *SlidingWindow) advance(now time.Time) {
+	if w.d <= 0 {
+		return
+	}
+
+	switch n := now.Sub(w.start) / w.d; {
+	case n == 1:
+		w.prev, w.cur = w.cur, 0
+		w.start = w.start.Add(w.d)
+	case n > 1:
+		w.prev, w.cur = 0, 0
+		w.start = w.start.Add(n * w.d)
+	}
+}
+
+func (w *SlidingWindow) count(now time.Time) float64 {
+	if w.d <= 0 {
+		return float64(w.cur)
+	}
+
+	covered := 1 - float64(now.Sub(w.start))/float64(w.d)
+
+	return float64(w.prev)*covered + float64(w.cur)
+}
+
+// retryAfter is when the weighted count leaves room for a call again,
+// assuming no other calls until then.
+func (w *SlidingWindow) retryAfter(now time.Time) time.Duration {
+	if w.max == 0 {
+		return w.d
+	}
+
+	start, prev, cur := w.start, w.prev, w.cur
+
+	// Only the next fixed window has room, where this one weighs in as the
+	// previous.
+	if cur >= w.max {
+		start, prev, cur = start.Add(w.d), cur, 0
+	}
+
+	if prev == 0 {
+		return start.Sub(now)
+	}
+
+	covered := float64(w.max-1-cur) / float64(prev)
+
+	return start.Add(time.Duration(math.Ceil((1 - covered) * float64(w.d)))).Sub(now)
+}
+
+// KeyedLimiter keeps a separate limiter for every key, e.g. per client, and
+// evicts those of keys unused for the idle timeout.
+type KeyedLimiter struct {
+	o LimiterOptions
+
+	m         sync.Mutex
+	limiters  map[string]*keyedEntry
+	lastSweep time.Time
+}
+
+type keyedEntry struct {
+	limiter Limiter
+	used    time.Time
+}
+
+func NewKeyedLimiter(o LimiterOptions) *KeyedLimiter {
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = 10 * o.Interval
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+
+	return &KeyedLimiter{o: o, limiters: make(map[string]*keyedEntry), lastSweep: o.Clock.Now()}
+}
+
+// Take takes from key's limiter, rejecting the call if it is over the limit.
+func (k *KeyedLimiter) Take(key string) Allowance {
+	return k.limiter(key).Take()
+}
+
+// Acquire takes from key's limiter according to the mode: in ModeReject it
+// fails with ErrTooManyCalls if the call is over the limit, in ModeWait it
+// waits until the call is allowed.
+func (k *KeyedLimiter) Acquire(ctx context.Context, key string) (Allowance, error) {
+	l := k.limiter(key)
+
+	if k.o.Mode == ModeWait {
+		return wait(ctx, l, k.o.MaxWait, k.o.Clock)
+	}
+
+	a := l.Take()
+	if !a.Allowed {
+		return a, ErrTooManyCalls
+	}
+
+	return a, nil
+}
+
+// Len returns the number of keys with a limiter.
+func (k *KeyedLimiter) Len() int {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	return len(k.limiters)
+}
+
+func (k *KeyedLimiter) limiter(key string) Limiter {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	now := k.o.Clock.Now()
+	k.sweep(now)
+
+	e, ok := k.limiters[key]
+	if !ok {
+		e = &keyedEntry{limiter: NewLimiter(k.o)}
+		k.limiters[key] = e
+	}
+	e.used = now
+
+	return e.limiter
+}
+
+// sweep evicts idle keys, at most once per idle timeout, so that no
+// background goroutine is needed.
+func (k *KeyedLimiter) sweep(now time.Time) {
+	if now.Sub(k.lastSweep) < k.o.IdleTimeout {
+		return
+	}
+	k.lastSweep = now
+
+	for key, e := range k.limiters {
+		if now.Sub(e.used) >= k.o.IdleTimeout {
+			delete(k.limiters, key)
+		}
+	}
+}
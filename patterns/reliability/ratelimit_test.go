@@ -0,0 +1,136 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// allowed takes n times from l and returns how many were allowed.
+func allowed(l Limiter, n int) int {
+	ok := 0
+	for range n {
+		if l.Take().Allowed {
+			ok++
+		}
+	}
+
+	return ok
+}
+
+func TestLimiterStrategies(t *testing.T) {
+	tests := []struct {
+		strategy Strategy
+		burst    int // allowed at once
+		after    time.Duration
+		refilled int // allowed after that
+	}{
+		{StrategyTokenBucket, 4, time.Second, 2},
+		{StrategyLeakyBucket, 4, 500 * time.Millisecond, 1},
+		{StrategySlidingWindow, 4, 1500 * time.Millisecond, 2},
+	}
+
+	for _, tt := range tests {
+		clock := NewFakeClock(time.Unix(0, 0))
+		l := NewLimiter(LimiterOptions{Strategy: tt.strategy, Limit: 4, Rate: 2, Interval: time.Second, Clock: clock})
+
+		if n := allowed(l, 10); n != tt.burst {
+			t.Errorf("strategy %d: %d allowed at once, want %d", tt.strategy, n, tt.burst)
+		}
+
+		clock.Advance(tt.after)
+		if n := allowed(l, 10); n != tt.refilled {
+			t.Errorf("strategy %d: %d allowed after %v, want %d", tt.strategy, n, tt.after, tt.refilled)
+		}
+	}
+}
+
+func TestLimiterRetryAfter(t *testing.T) {
+	for _, strategy := range []Strategy{StrategyTokenBucket, StrategyLeakyBucket, StrategySlidingWindow} {
+		clock := NewFakeClock(time.Unix(0, 0))
+		l := NewLimiter(LimiterOptions{Strategy: strategy, Limit: 2, Rate: 1, Interval: time.Second, Clock: clock})
+
+		allowed(l, 2)
+		a := l.Take()
+		if a.Allowed || a.RetryAfter <= 0 {
+			t.Fatalf("strategy %d: Take() over the limit = %+v, want a positive RetryAfter", strategy, a)
+		}
+
+		clock.Advance(a.RetryAfter)
+		if !l.Take().Allowed {
+			t.Errorf("strategy %d: Take() after RetryAfter %v not allowed", strategy, a.RetryAfter)
+		}
+	}
+}
+
+func TestKeyedLimiterWait(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	k := NewKeyedLimiter(LimiterOptions{Limit: 1, Rate: 1, Interval: time.Second, Mode: ModeWait, MaxWait: 2 * time.Second, Clock: clock})
+
+	if _, err := k.Acquire(context.Background(), "a"); err != nil {
+		t.Fatalf("Acquire() = %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := k.Acquire(context.Background(), "a")
+		done <- err
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	if err := <-done; err != nil {
+		t.Fatalf("waiting Acquire() = %v", err)
+	}
+
+	k = NewKeyedLimiter(LimiterOptions{Limit: 1, Interval: time.Second, Mode: ModeReject, Clock: clock})
+	k.Acquire(context.Background(), "a")
+	if _, err := k.Acquire(context.Background(), "a"); !errors.Is(err, ErrTooManyCalls) {
+		t.Fatalf("Acquire() over the limit in reject mode = %v, want ErrTooManyCalls", err)
+	}
+	if _, err := k.Acquire(context.Background(), "b"); err != nil {
+		t.Fatalf("Acquire() of another key = %v", err)
+	}
+}
+
+func TestKeyedLimiterEviction(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	k := NewKeyedLimiter(LimiterOptions{Limit: 1, Interval: time.Second, IdleTimeout: time.Minute, Clock: clock})
+
+	k.Take("a")
+	k.Take("b")
+	clock.Advance(30 * time.Second)
+	k.Take("b")
+	clock.Advance(30 * time.Second)
+	k.Take("c")
+
+	if n := k.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2 after a was evicted", n)
+	}
+}
+
+func TestLimiterDefaultRate(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	l := NewLimiter(LimiterOptions{Limit: 2, Interval: time.Second, Clock: clock})
+
+	allowed(l, 2)
+	clock.Advance(time.Second)
+
+	if n := allowed(l, 10); n != 2 {
+		t.Fatalf("%d allowed a second later with no Rate, want the bucket refilled to 2", n)
+	}
+}
+
+func TestTokenBucketWithoutRefill(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := newTokenBucket(1, 0, time.Second, clock)
+
+	b.Take()
+	clock.Advance(5 * time.Second)
+
+	if a := b.Take(); a.Allowed || a.RetryAfter < 0 {
+		t.Fatalf("Take() = %+v, want a rejection with a RetryAfter of at least 0", a)
+	}
+}
@@ -2,27 +2,193 @@ package reliability
 
 import (
 	"context"
-	"log"
+	"errors"
+	"math/rand/v2"
 	"time"
 )
 
-type Effector func(ctx context.Context) (string, error)
+type Jitter byte
 
-func Retry(effector Effector, retries int, delay time.Duration) Effector {
-	return func(ctx context.Context) (string, error) {
-		for r := 0; ; r++ {
-			response, err := effector(ctx)
-			if err == nil || r >= retries {
-				return response, err
+const (
+	NoJitter Jitter = iota
+	// FullJitter waits a random time up to the exponential delay.
+	FullJitter
+	// DecorrelatedJitter waits a random time between InitialDelay and three
+	// times the previous wait, which spreads out retries without keeping
+	// them in lockstep with the attempt count.
+	DecorrelatedJitter
+)
+
+// RetryPolicy configures Retry. Delays start at InitialDelay, 100ms if
+// zero, and grow by Multiplier, 2 if zero, up to MaxDelay, 30s if zero.
+type RetryPolicy struct {
+	// MaxAttempts counts the first call too; zero allows 3 unless
+	// MaxElapsed is set, which then bounds the retries alone.
+	MaxAttempts int
+	MaxElapsed  time.Duration
+
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       Jitter
+
+	// Retryable reports whether a failed call may succeed if retried. By
+	// default every error is, except Permanent ones and those of ctx.
+	Retryable func(err error) bool
+
+	// OnRetry is called before waiting to retry, OnDone once the operation
+	// succeeded or Retry gave up.
+	OnRetry func(attempt int, err error, wait time.Duration)
+	OnDone  func(attempts int, err error)
+
+	Clock Clock
+}
+
+// Retry calls op until it succeeds or policy gives up, and returns the
+// last result. A RetryAfter hint in the error overrides the computed delay.
+func Retry[T any](op Operation[T], policy RetryPolicy) Operation[T] {
+	p := policy.withDefaults()
+
+	return func(ctx context.Context) (T, error) {
+		start := p.Clock.Now()
+		var wait time.Duration
+
+		for attempt := 1; ; attempt++ {
+			res, err := op(ctx)
+			if err == nil || !p.retryable(ctx, err) || (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) {
+				return retryDone(p, attempt, res, err)
+			}
+
+			wait = p.next(attempt, wait)
+			if hint, ok := retryAfter(err); ok {
+				wait = hint
 			}
 
-			log.Printf("Attempt %d failed; retrying in %v", r+1, delay)
+			if p.MaxElapsed > 0 && p.Clock.Now().Sub(start)+wait > p.MaxElapsed {
+				return retryDone(p, attempt, res, err)
+			}
+
+			if p.OnRetry != nil {
+				p.OnRetry(attempt, err, wait)
+			}
 
+			t := p.Clock.NewTimer(wait)
 			select {
-			case <-time.After(delay):
+			case <-t.C():
 			case <-ctx.Done():
-				return "", ctx.Err()
+				t.Stop()
+				return retryDone(p, attempt, res, err)
 			}
 		}
 	}
 }
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 && p.MaxElapsed == 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = 100 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 30 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Clock == nil {
+		p.Clock = SystemClock
+	}
+
+	return p
+}
+
+func (p RetryPolicy) retryable(ctx context.Context, err error) bool {
+	var perm *permanentError
+	if errors.As(err, &perm) || ctx.Err() != nil {
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// next returns the wait before retrying after attempt, given the previous
+// wait.
+func (p RetryPolicy) next(attempt int, prev time.Duration) time.Duration {
+	d := float64(p.InitialDelay)
+	for range attempt - 1 {
+		if d *= p.Multiplier; d >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	exp := min(time.Duration(d), p.MaxDelay)
+
+	switch p.Jitter {
+	case FullJitter:
+		return rand.N(exp + 1)
+	case DecorrelatedJitter:
+		upper := max(prev*3, p.InitialDelay)
+		return min(p.InitialDelay+rand.N(upper-p.InitialDelay+1), p.MaxDelay)
+	}
+
+	return exp
+}
+
+func retryDone[T any](p RetryPolicy, attempts int, res T, err error) (T, error) {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		err = perm.err
+	}
+
+	if p.OnDone != nil {
+		p.OnDone(attempts, err)
+	}
+
+	return res, err
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. an authentication
+// failure. Retry returns the error it wraps.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// RetryAfter attaches a hint of how long to wait before retrying to err, such
+// as a Retry-After header of a 429 or 503 response.
+func RetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+
+	return &retryAfterError{err: err, after: d}
+}
+
+func retryAfter(err error) (time.Duration, bool) {
+	var hint *retryAfterError
+	if errors.As(err, &hint) {
+		return max(hint.after, 0), true
+	}
+
+	return 0, false
+}
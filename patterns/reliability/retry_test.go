@@ -0,0 +1,152 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+// retryInBackground runs op and, while it waits to retry, advances clock by
+// the wait, so the retries run without sleeping.
+func retryInBackground(clock *FakeClock, op Operation[int]) (int, error) {
+	type result struct {
+		res int
+		err error
+	}
+
+	done := make(chan result)
+	go func() {
+		res, err := op(context.Background())
+		done <- result{res, err}
+	}()
+
+	for {
+		select {
+		case r := <-done:
+			return r.res, r.err
+		default:
+		}
+
+		clock.m.Lock()
+		pending := slices.Clone(clock.timers)
+		clock.m.Unlock()
+
+		if len(pending) > 0 {
+			clock.Advance(pending[0].at.Sub(clock.Now()))
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var waits []time.Duration
+	calls := 0
+
+	op := Retry(func(context.Context) (int, error) {
+		if calls++; calls < 4 {
+			return 0, errFailed
+		}
+		return calls, nil
+	}, RetryPolicy{
+		MaxAttempts:  5,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     300 * time.Millisecond,
+		OnRetry:      func(_ int, _ error, wait time.Duration) { waits = append(waits, wait) },
+		Clock:        clock,
+	})
+
+	if res, err := retryInBackground(clock, op); res != 4 || err != nil {
+		t.Fatalf("Retry() = %d, %v, want 4, nil", res, err)
+	}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	if !slices.Equal(waits, want) {
+		t.Fatalf("waits = %v, want %v", waits, want)
+	}
+}
+
+func TestRetryMaxElapsed(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	calls := 0
+	var gaveUp int
+
+	op := Retry(func(context.Context) (int, error) {
+		calls++
+		return 0, errFailed
+	}, RetryPolicy{
+		MaxElapsed:   250 * time.Millisecond,
+		InitialDelay: 100 * time.Millisecond,
+		OnDone:       func(attempts int, _ error) { gaveUp = attempts },
+		Clock:        clock,
+	})
+
+	// The third attempt would start at 300ms.
+	if _, err := retryInBackground(clock, op); !errors.Is(err, errFailed) || calls != 2 || gaveUp != 2 {
+		t.Fatalf("Retry() = %v after %d calls, OnDone saw %d; want %v after 2", err, calls, gaveUp, errFailed)
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	calls := 0
+
+	op := Retry(func(context.Context) (int, error) {
+		calls++
+		return 0, Permanent(errFailed)
+	}, RetryPolicy{MaxAttempts: 5})
+
+	if _, err := op(context.Background()); err != errFailed || calls != 1 {
+		t.Fatalf("Retry() = %v after %d calls, want the unwrapped error after 1", err, calls)
+	}
+
+	calls = 0
+	op = Retry(func(context.Context) (int, error) {
+		calls++
+		return 0, fmt.Errorf("insert: %w", Permanent(errFailed))
+	}, RetryPolicy{MaxAttempts: 5})
+
+	if _, err := op(context.Background()); err != errFailed || calls != 1 {
+		t.Fatalf("Retry() of a wrapped Permanent error = %v after %d calls, want the unwrapped error after 1", err, calls)
+	}
+}
+
+func TestRetryAfterHint(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var waits []time.Duration
+	calls := 0
+
+	op := Retry(func(context.Context) (int, error) {
+		if calls++; calls == 1 {
+			return 0, RetryAfter(errFailed, 5*time.Second)
+		}
+		return calls, nil
+	}, RetryPolicy{
+		OnRetry: func(_ int, _ error, wait time.Duration) { waits = append(waits, wait) },
+		Clock:   clock,
+	})
+
+	if _, err := retryInBackground(clock, op); err != nil || !slices.Equal(waits, []time.Duration{5 * time.Second}) {
+		t.Fatalf("Retry() = %v with waits %v, want nil after 5s", err, waits)
+	}
+}
+
+func TestRetryJitterBounds(t *testing.T) {
+	p := RetryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}.withDefaults()
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		p.Jitter = FullJitter
+		if d := p.next(attempt, 0); d < 0 || d > time.Second {
+			t.Fatalf("full jitter wait %v out of [0, 1s]", d)
+		}
+
+		p.Jitter = DecorrelatedJitter
+		prev := time.Duration(attempt) * 100 * time.Millisecond
+		if d := p.next(attempt, prev); d < p.InitialDelay || d > min(3*prev, time.Second) {
+			t.Fatalf("decorrelated jitter wait %v out of [100ms, %v]", d, min(3*prev, time.Second))
+		}
+	}
+}
@@ -7,45 +7,103 @@ import (
 	"time"
 )
 
-// Uses token bucket with error strategy
+var ErrTooManyCalls = errors.New("too many calls")
 
-func Throttle(e Effector, max, refill uint, d time.Duration) Effector {
-	var tokens = max
-	var once sync.Once
+// Throttle fails calls to op over the limit of l with ErrTooManyCalls.
+func Throttle[T any](op Operation[T], l Limiter) Operation[T] {
+	return func(ctx context.Context) (T, error) {
+		var zero T
 
-	return func(ctx context.Context) (string, error) {
 		if ctx.Err() != nil {
-			return "", ctx.Err()
+			return zero, ctx.Err()
 		}
 
-		once.Do(func() {
-			ticker := time.NewTicker(d)
-
-			go func() {
-				defer ticker.Stop()
-
-				for {
-					select {
-					case <-ctx.Done():
-						return
-
-					case <-ticker.C:
-						t := tokens + refill
-						if t > max {
-							t = max
-						}
-						tokens = t
-					}
-				}
-			}()
-		})
-
-		if tokens <= 0 {
-			return "", errors.New("too many calls")
+		if !l.Take().Allowed {
+			return zero, ErrTooManyCalls
 		}
 
-		tokens--
+		return op(ctx)
+	}
+}
+
+// Allowance describes the outcome of taking a token from a bucket.
+type Allowance struct {
+	Allowed    bool
+	Limit      uint
+	Remaining  uint
+	RetryAfter time.Duration // until the next token is available, zero if Allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// TokenBucket is a thread-safe token bucket. Tokens are refilled lazily on
+// every Take, so no background goroutine is needed.
+type TokenBucket struct {
+	clock  Clock
+	m      sync.Mutex
+	max    uint
+	refill uint
+	d      time.Duration
+	tokens uint
+	last   time.Time
+}
+
+func NewTokenBucket(max, refill uint, d time.Duration) *TokenBucket {
+	return newTokenBucket(max, refill, d, SystemClock)
+}
+
+func newTokenBucket(max, refill uint, d time.Duration, clock Clock) *TokenBucket {
+	return &TokenBucket{clock: clock, max: max, refill: refill, d: d, tokens: max, last: clock.Now()}
+}
+
+func (b *TokenBucket) Take() Allowance {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	now := b.clock.Now()
+	b.fill(now)
+
+	a := Allowance{Limit: b.max}
+
+	if b.tokens > 0 {
+		b.tokens--
+		a.Allowed = true
+	} else {
+		// Never negative, even for a bucket that does not refill.
+		a.RetryAfter = max(b.last.Add(b.d).Sub(now), 0)
+	}
+
+	a.Remaining = b.tokens
+	a.Reset = b.untilFull(now)
+
+	return a
+}
+
+func (b *TokenBucket) fill(now time.Time) {
+	if b.refill == 0 || b.d <= 0 {
+		return
+	}
+
+	n := now.Sub(b.last) / b.d
+	if n <= 0 {
+		return
+	}
+
+	b.last = b.last.Add(n * b.d)
 
-		return e(ctx)
+	t := uint64(b.tokens) + uint64(n)*uint64(b.refill)
+	if t > uint64(b.max) {
+		t = uint64(b.max)
 	}
+	b.tokens = uint(t)
+}
+
+func (b *TokenBucket) untilFull(now time.Time) time.Duration {
+	missing := b.max - b.tokens
+	if missing == 0 || b.refill == 0 {
+		return 0
+	}
+
+	intervals := (missing + b.refill - 1) / b.refill
+
+	return b.last.Add(time.Duration(intervals) * b.d).Sub(now)
 }
@@ -1,27 +1,46 @@
 package reliability
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
-type SlowFunction func(string) (string, error)
+// Timeout fails calls to op that take longer than d with
+// context.DeadlineExceeded, even if op does not watch its context, which is
+// cancelled then.
+func Timeout[T any](op Operation[T], d time.Duration, clock Clock) Operation[T] {
+	if clock == nil {
+		clock = SystemClock
+	}
 
-type WithContext func(context.Context, string) (string, error)
+	return func(ctx context.Context) (T, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
 
-func Timeout(f SlowFunction) WithContext {
-	return func(ctx context.Context, arg string) (string, error) {
-		chRes := make(chan string)
-		chErr := make(chan error)
+		type result struct {
+			res T
+			err error
+		}
 
+		// Buffered so that op can finish after we gave up on it.
+		done := make(chan result, 1)
 		go func() {
-			res, err := f(arg)
-			chRes <- res
-			chErr <- err
+			res, err := op(ctx)
+			done <- result{res, err}
 		}()
 
+		t := clock.NewTimer(d)
+		defer t.Stop()
+
+		var zero T
+
 		select {
-		case res := <-chRes:
-			return res, <-chErr
+		case r := <-done:
+			return r.res, r.err
+		case <-t.C():
+			return zero, context.DeadlineExceeded
 		case <-ctx.Done():
-			return "", ctx.Err()
+			return zero, ctx.Err()
 		}
 	}
 }
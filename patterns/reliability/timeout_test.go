@@ -0,0 +1,41 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	cancelled := make(chan struct{})
+
+	op := Timeout(func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return 0, ctx.Err()
+	}, time.Second, clock)
+
+	done := make(chan error)
+	go func() {
+		_, err := op(context.Background())
+		done <- err
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Timeout() = %v, want context.DeadlineExceeded", err)
+	}
+	<-cancelled
+}
+
+func TestTimeoutFastCall(t *testing.T) {
+	op := Timeout(succeed, time.Second, NewFakeClock(time.Unix(0, 0)))
+
+	if res, err := op(context.Background()); res != 1 || err != nil {
+		t.Fatalf("Timeout() = %d, %v, want 1, nil", res, err)
+	}
+}
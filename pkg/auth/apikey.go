@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// APIKeys authenticates requests carrying a static key, either in the
+// X-API-Key header or as an "ApiKey" authorization scheme.
+type APIKeys map[string]string // key -> principal name
+
+func (k APIKeys) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey ")
+	}
+	if key == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	for known, name := range k {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(key)) == 1 {
+			return Principal{Name: name, Method: "apikey"}, nil
+		}
+	}
+
+	return Principal{}, ErrInvalidCredentials
+}
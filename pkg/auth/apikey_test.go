@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	keys := APIKeys{"s3cr3t": "batch-job"}
+
+	for _, header := range []string{"X-API-Key", "Authorization"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if header == "Authorization" {
+			r.Header.Set(header, "ApiKey s3cr3t")
+		} else {
+			r.Header.Set(header, "s3cr3t")
+		}
+
+		if p, err := keys.Authenticate(r); err != nil || p.Name != "batch-job" || p.Method != "apikey" {
+			t.Fatalf("Authenticate() with the key in %s = %+v, %v, want batch-job by apikey", header, p, err)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, err := keys.Authenticate(r); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("Authenticate() without a key = %v, want ErrNoCredentials", err)
+	}
+
+	r.Header.Set("X-API-Key", "s3cr3")
+	if _, err := keys.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate() with an unknown key = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	chain := Chain{JWT{Keys: map[string][]byte{"k": []byte("secret")}}, APIKeys{"s3cr3t": "batch-job"}}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-API-Key", "s3cr3t")
+
+	// The JWT authenticator finds no bearer token and passes the request on.
+	if p, err := chain.Authenticate(r); err != nil || p.Name != "batch-job" {
+		t.Fatalf("Authenticate() = %+v, %v, want batch-job from the API keys", p, err)
+	}
+
+	// An invalid token stops the chain: it is not retried as something else.
+	r.Header.Set("Authorization", "Bearer forged.token.here")
+	if _, err := chain.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate() with a bad token and a good key = %v, want ErrInvalidCredentials", err)
+	}
+
+	if _, err := chain.Authenticate(httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("Authenticate() without credentials = %v, want ErrNoCredentials", err)
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+// Principal is the authenticated identity behind a request.
+type Principal struct {
+	Name   string
+	Method string // "apikey", "jwt" or "mtls"
+}
+
+// Authenticator resolves the principal of a request. It returns
+// ErrNoCredentials when the request carries no credentials it understands, so
+// that the next authenticator can be tried.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Chain tries each authenticator in turn until one recognises the request.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+
+		return p, err
+	}
+
+	return Principal{}, ErrNoCredentials
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+type policyKey struct{}
+
+func WithPolicy(ctx context.Context, p Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// Allowed reports whether the principal in ctx holds want on key. When ctx
+// carries no policy, authorization is disabled and everything is allowed.
+func Allowed(ctx context.Context, key string, want Permission) bool {
+	policy, ok := ctx.Value(policyKey{}).(Policy)
+	if !ok {
+		return true
+	}
+
+	p, _ := PrincipalFrom(ctx)
+
+	return policy.Allowed(p.Name, key, want)
+}
@@ -0,0 +1,26 @@
+package auth
+
+import "net/http"
+
+// ClientCert authenticates requests by the verified TLS client certificate.
+// The identity is the first URI SAN (e.g. a SPIFFE ID) or, failing that, the
+// subject common name.
+type ClientCert struct{}
+
+func (ClientCert) Authenticate(r *http.Request) (Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Principal{}, ErrNoCredentials
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+
+	name := cert.Subject.CommonName
+	if len(cert.URIs) > 0 {
+		name = cert.URIs[0].String()
+	}
+	if name == "" {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	return Principal{Name: name, Method: "mtls"}, nil
+}
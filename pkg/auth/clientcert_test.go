@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientCert(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/batch-job")
+
+	tests := []struct {
+		cert *x509.Certificate
+		want string
+	}{
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "batch-job"}}, "batch-job"},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "ignored"}, URIs: []*url.URL{spiffe}}, spiffe.String()},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+
+		if p, err := (ClientCert{}).Authenticate(r); err != nil || p.Name != tt.want || p.Method != "mtls" {
+			t.Fatalf("Authenticate() = %+v, %v, want %s by mtls", p, err, tt.want)
+		}
+	}
+
+	// A certificate that was presented but not verified is no credential.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "batch-job"}}}}
+
+	if _, err := (ClientCert{}).Authenticate(r); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("Authenticate() of an unverified certificate = %v, want ErrNoCredentials", err)
+	}
+
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	if _, err := (ClientCert{}).Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate() of a certificate without a name = %v, want ErrInvalidCredentials", err)
+	}
+
+	if _, err := (ClientCert{}).Authenticate(httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("Authenticate() without TLS = %v, want ErrNoCredentials", err)
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config is the on-disk description of the authenticators and the policy.
+//
+//	{
+//	  "api_keys": {"s3cr3t": "batch-job"},
+//	  "jwt_keys": {"2024-01": "<base64 secret>"},
+//	  "client_certs": true,
+//	  "grants": [{"principal": "batch-job", "prefix": "jobs/", "permission": "write"}]
+//	}
+type Config struct {
+	APIKeys     map[string]string `json:"api_keys"`
+	JWTKeys     map[string]string `json:"jwt_keys"`
+	ClientCerts bool              `json:"client_certs"`
+	Grants      Policy            `json:"grants"`
+}
+
+func LoadConfig(filename string) (Config, error) {
+	var c Config
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return c, fmt.Errorf("cannot read auth config: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("cannot parse auth config: %w", err)
+	}
+
+	return c, nil
+}
+
+// Authenticator builds the chain of authenticators enabled by the config.
+// Client certificates are tried first, then JWTs, then static API keys.
+func (c Config) Authenticator() (Chain, error) {
+	var chain Chain
+
+	if c.ClientCerts {
+		chain = append(chain, ClientCert{})
+	}
+
+	if len(c.JWTKeys) > 0 {
+		keys := make(map[string][]byte, len(c.JWTKeys))
+
+		for kid, secret := range c.JWTKeys {
+			b, err := base64.StdEncoding.DecodeString(secret)
+			if err != nil {
+				return nil, fmt.Errorf("jwt key %q is not valid base64: %w", kid, err)
+			}
+			keys[kid] = b
+		}
+
+		chain = append(chain, JWT{Keys: keys})
+	}
+
+	if len(c.APIKeys) > 0 {
+		chain = append(chain, APIKeys(c.APIKeys))
+	}
+
+	return chain, nil
+}
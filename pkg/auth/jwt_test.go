@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sign returns an HS256 token over claims, with kid in its header if set.
+func sign(t *testing.T, kid string, claims map[string]any, secret []byte) string {
+	t.Helper()
+
+	segment := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	header := map[string]string{"alg": "HS256", "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	signed := segment(header) + "." + segment(claims)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func authenticate(a Authenticator, authorization string) (Principal, error) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+
+	return a.Authenticate(r)
+}
+
+func TestJWT(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	j := JWT{
+		Keys: map[string][]byte{"k1": []byte("secret-1"), "k2": []byte("secret-2")},
+		Now:  func() time.Time { return now },
+	}
+
+	valid := map[string]any{"sub": "alice", "exp": now.Add(time.Hour).Unix()}
+
+	for _, kid := range []string{"k2", ""} {
+		p, err := authenticate(j, "Bearer "+sign(t, kid, valid, []byte("secret-2")))
+		if err != nil || p.Name != "alice" || p.Method != "jwt" {
+			t.Fatalf("Authenticate() with kid %q = %+v, %v, want alice by jwt", kid, p, err)
+		}
+	}
+
+	if _, err := authenticate(j, ""); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("Authenticate() without a token = %v, want ErrNoCredentials", err)
+	}
+
+	rejected := map[string]string{
+		"expired":        sign(t, "k1", map[string]any{"sub": "alice", "exp": now.Unix()}, []byte("secret-1")),
+		"not yet valid":  sign(t, "k1", map[string]any{"sub": "alice", "nbf": now.Add(time.Minute).Unix()}, []byte("secret-1")),
+		"no subject":     sign(t, "k1", map[string]any{"exp": now.Add(time.Hour).Unix()}, []byte("secret-1")),
+		"forged":         sign(t, "k1", valid, []byte("guessed")),
+		"forged no kid":  sign(t, "", valid, []byte("guessed")),
+		"wrong kid":      sign(t, "k1", valid, []byte("secret-2")),
+		"unknown kid":    sign(t, "k3", valid, []byte("secret-1")),
+		"malformed":      "not-a-token",
+		"no signature":   strings.Join(strings.Split(sign(t, "k1", valid, []byte("secret-1")), ".")[:2], ".") + ".",
+		"alg none":       unsigned(t, "none", valid),
+		"alg asymmetric": unsigned(t, "RS256", valid),
+	}
+
+	for name, token := range rejected {
+		if _, err := authenticate(j, "Bearer "+token); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate() of a token %s = %v, want ErrInvalidCredentials", name, err)
+		}
+	}
+}
+
+// TestJWTTamperedClaims checks that the signature covers the claims.
+func TestJWTTamperedClaims(t *testing.T) {
+	j := JWT{Keys: map[string][]byte{"k1": []byte("secret-1")}}
+
+	parts := strings.Split(sign(t, "k1", map[string]any{"sub": "alice"}, []byte("secret-1")), ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`))
+
+	if _, err := authenticate(j, "Bearer "+strings.Join(parts, ".")); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate() of tampered claims = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+// unsigned returns a token with the given alg and an empty signature.
+func unsigned(t *testing.T, alg string, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg})
+	body, _ := json.Marshal(claims)
+
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body) + "."
+}
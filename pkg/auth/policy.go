@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Permission int
+
+const (
+	PermissionNone Permission = iota
+	PermissionRead
+	PermissionWrite
+	PermissionAdmin
+)
+
+func (p Permission) String() string {
+	switch p {
+	case PermissionRead:
+		return "read"
+	case PermissionWrite:
+		return "write"
+	case PermissionAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+func (p *Permission) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	switch s {
+	case "read":
+		*p = PermissionRead
+	case "write":
+		*p = PermissionWrite
+	case "admin":
+		*p = PermissionAdmin
+	default:
+		return fmt.Errorf("unknown permission %q", s)
+	}
+
+	return nil
+}
+
+// Grant gives a principal a permission on every key starting with Prefix.
+// Higher permissions include the lower ones: admin > write > read.
+// A Principal of "*" matches every authenticated principal.
+type Grant struct {
+	Principal  string     `json:"principal"`
+	Prefix     string     `json:"prefix"`
+	Permission Permission `json:"permission"`
+}
+
+type Policy []Grant
+
+// Permission returns the highest permission principal holds on key.
+func (p Policy) Permission(principal, key string) Permission {
+	best := PermissionNone
+
+	for _, g := range p {
+		if g.Principal != "*" && g.Principal != principal {
+			continue
+		}
+		if !strings.HasPrefix(key, g.Prefix) {
+			continue
+		}
+		if g.Permission > best {
+			best = g.Permission
+		}
+	}
+
+	return best
+}
+
+func (p Policy) Allowed(principal, key string, want Permission) bool {
+	return p.Permission(principal, key) >= want
+}
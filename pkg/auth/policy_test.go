@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	var policy Policy
+	err := json.Unmarshal([]byte(`[
+		{"principal": "batch-job", "prefix": "jobs/", "permission": "write"},
+		{"principal": "batch-job", "prefix": "jobs/archive/", "permission": "read"},
+		{"principal": "*", "prefix": "public/", "permission": "read"},
+		{"principal": "ops", "prefix": "", "permission": "admin"}
+	]`), &policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		principal, key string
+		want           Permission
+	}{
+		{"batch-job", "jobs/1", PermissionWrite},
+		// The highest grant matching the key wins, even a shorter prefix.
+		{"batch-job", "jobs/archive/1", PermissionWrite},
+		{"batch-job", "job", PermissionNone},
+		{"batch-job", "public/x", PermissionRead},
+		{"someone", "public/x", PermissionRead},
+		{"someone", "jobs/1", PermissionNone},
+		{"ops", "anything", PermissionAdmin},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Permission(tt.principal, tt.key); got != tt.want {
+			t.Errorf("Permission(%q, %q) = %v, want %v", tt.principal, tt.key, got, tt.want)
+		}
+	}
+
+	// Higher permissions include the lower ones.
+	if !policy.Allowed("ops", "jobs/1", PermissionRead) || policy.Allowed("batch-job", "jobs/1", PermissionAdmin) {
+		t.Fatal("Allowed() does not order admin > write > read")
+	}
+
+	var p Permission
+	if err := json.Unmarshal([]byte(`"owner"`), &p); err == nil {
+		t.Fatal("unmarshalling an unknown permission succeeded")
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	ctx := context.Background()
+
+	if !Allowed(ctx, "key", PermissionAdmin) {
+		t.Fatal("Allowed() without a policy = false, want authorization disabled")
+	}
+
+	ctx = WithPolicy(WithPrincipal(ctx, Principal{Name: "reader"}), Policy{{Principal: "reader", Permission: PermissionRead}})
+
+	if !Allowed(ctx, "key", PermissionRead) || Allowed(ctx, "key", PermissionWrite) {
+		t.Fatal("Allowed() does not apply the policy to the principal in the context")
+	}
+}
@@ -0,0 +1,48 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// Config describes where the server's TLS material lives and how clients are
+// verified.
+type Config struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+	MinVersion   uint16
+}
+
+// ParseMinVersion converts "1.0" .. "1.3" into a tls.VersionTLS* constant.
+func ParseMinVersion(v string) (uint16, error) {
+	switch v {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version %q", v)
+	}
+}
+
+// ParseClientAuth converts "none", "optional" or "require" into the
+// corresponding verification mode. Presented certificates are always
+// verified against the client CA bundle.
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unknown client auth mode %q", mode)
+	}
+}
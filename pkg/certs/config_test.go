@@ -0,0 +1,26 @@
+package certs
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	if v, err := ParseMinVersion("1.3"); v != tls.VersionTLS13 || err != nil {
+		t.Fatalf("ParseMinVersion(1.3) = %d, %v", v, err)
+	}
+	if _, err := ParseMinVersion("1.4"); err == nil {
+		t.Fatal("ParseMinVersion(1.4) succeeded")
+	}
+
+	if mode, err := ParseClientAuth("require"); mode != tls.RequireAndVerifyClientCert || err != nil {
+		t.Fatalf("ParseClientAuth(require) = %v, %v", mode, err)
+	}
+	// Optional certificates are still verified when presented.
+	if mode, err := ParseClientAuth("optional"); mode != tls.VerifyClientCertIfGiven || err != nil {
+		t.Fatalf("ParseClientAuth(optional) = %v, %v", mode, err)
+	}
+	if _, err := ParseClientAuth("request"); err == nil {
+		t.Fatal("ParseClientAuth(request) succeeded")
+	}
+}
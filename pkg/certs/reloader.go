@@ -0,0 +1,186 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Reloader serves the certificate and client CA pool read from disk, and
+// swaps them for fresh copies when the files change or on SIGHUP, so that
+// certificates can be rotated without a restart.
+type Reloader struct {
+	cfg Config
+
+	m        sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func NewReloader(cfg Config) (*Reloader, error) {
+	r := &Reloader{cfg: cfg}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CA bundle from disk. On error
+// the previously loaded material stays in use.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		if pool, err = LoadCertPool(r.cfg.ClientCAFile); err != nil {
+			return err
+		}
+	}
+
+	modTimes, err := r.statFiles()
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	r.cert = &cert
+	r.clientCA = pool
+	r.modTimes = modTimes
+	r.m.Unlock()
+
+	return nil
+}
+
+// TLSConfig returns a server config that always hands out the most recently
+// loaded certificate and client CA pool.
+func (r *Reloader) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		// Both HTTP and gRPC are served with this config.
+		NextProtos:     []string{"h2", "http/1.1"},
+		MinVersion:     r.cfg.MinVersion,
+		ClientAuth:     r.cfg.ClientAuth,
+		GetCertificate: r.certificate,
+	}
+
+	base := cfg.Clone()
+
+	// The config returned for a client replaces cfg for the handshake, so
+	// it is a copy that differs only in the client CA pool.
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+
+		r.m.RLock()
+		c.ClientCAs = r.clientCA
+		r.m.RUnlock()
+
+		return c, nil
+	}
+
+	return cfg
+}
+
+func (r *Reloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.cert, nil
+}
+
+// Watch reloads the files whenever their modification time changes, checking
+// every interval, and whenever the process receives SIGHUP. It returns when
+// ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reloadAndLog("SIGHUP")
+		case <-ticker.C:
+			if r.changed() {
+				r.reloadAndLog("file change")
+			}
+		}
+	}
+}
+
+func (r *Reloader) reloadAndLog(reason string) {
+	if err := r.Reload(); err != nil {
+		log.Printf("TLS reload after %s failed: %v", reason, err)
+		return
+	}
+
+	log.Printf("TLS certificates reloaded after %s", reason)
+}
+
+func (r *Reloader) changed() bool {
+	modTimes, err := r.statFiles()
+	if err != nil {
+		return false // a rotation may be in progress; try again later
+	}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	for name, t := range modTimes {
+		if !t.Equal(r.modTimes[name]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Reloader) statFiles() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+
+		modTimes[name] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates.
+func LoadCertPool(filename string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", filename)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,182 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes a fresh self-signed certificate and its key to the
+// files, and returns the certificate.
+func writePair(t *testing.T, certFile, keyFile string) []byte {
+	t.Helper()
+
+	cert, err := SelfSigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEM(t, certFile, "CERTIFICATE", cert.Certificate[0])
+	writePEM(t, keyFile, "EC PRIVATE KEY", key)
+
+	return cert.Certificate[0]
+}
+
+// writePEM writes the file with a modification time later than any it had,
+// as the reloader compares them.
+func writePEM(t *testing.T, name, blockType string, der []byte) {
+	t.Helper()
+
+	mtime := time.Now()
+	if info, err := os.Stat(name); err == nil {
+		mtime = info.ModTime().Add(time.Second)
+	}
+
+	if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// served returns the certificate a client is handed by a server using cfg.
+func served(t *testing.T, cfg *tls.Config) []byte {
+	t.Helper()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go tls.Server(server, cfg).Handshake()
+
+	conn := tls.Client(client, &tls.Config{InsecureSkipVerify: true})
+	if err := conn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+
+	return conn.ConnectionState().PeerCertificates[0].Raw
+}
+
+func newTestReloader(t *testing.T) (*Reloader, Config, []byte) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := Config{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem"), MinVersion: tls.VersionTLS12}
+
+	cert := writePair(t, cfg.CertFile, cfg.KeyFile)
+
+	r, err := NewReloader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r, cfg, cert
+}
+
+func TestReloadOnFileChange(t *testing.T) {
+	r, cfg, first := newTestReloader(t)
+	tlsConfig := r.TLSConfig()
+
+	if got := served(t, tlsConfig); !bytes.Equal(got, first) {
+		t.Fatal("the server does not hand out the certificate on disk")
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	second := writePair(t, cfg.CertFile, cfg.KeyFile)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Equal(served(t, tlsConfig), second) {
+		if time.Now().After(deadline) {
+			t.Fatal("the rotated certificate was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloadKeepsCertificateOnError(t *testing.T) {
+	r, cfg, first := newTestReloader(t)
+	tlsConfig := r.TLSConfig()
+
+	// A certificate that does not match the key, as seen halfway through a
+	// rotation.
+	other := filepath.Join(t.TempDir(), "other.pem")
+	writePair(t, cfg.CertFile, other)
+
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload() of a mismatched key pair succeeded")
+	}
+	if got := served(t, tlsConfig); !bytes.Equal(got, first) {
+		t.Fatal("a failed reload replaced the certificate")
+	}
+
+	if err := os.WriteFile(cfg.KeyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload() of a corrupt key succeeded")
+	}
+	if got := served(t, tlsConfig); !bytes.Equal(got, first) {
+		t.Fatal("a failed reload replaced the certificate")
+	}
+}
+
+func TestReloadClientCA(t *testing.T) {
+	r, cfg, _ := newTestReloader(t)
+
+	// Without a client CA bundle, no pool is handed to clients.
+	c, err := r.TLSConfig().GetConfigForClient(nil)
+	if err != nil || c.ClientCAs != nil {
+		t.Fatalf("GetConfigForClient() = %v, %v, want no client CAs", c, err)
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	cfg.ClientCAFile = ca
+	caCert := writePair(t, ca, filepath.Join(t.TempDir(), "ca-key.pem"))
+
+	r, err = NewReloader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig := r.TLSConfig()
+	c, err = tlsConfig.GetConfigForClient(nil)
+	if err != nil || c.ClientCAs == nil || c.MinVersion != tls.VersionTLS12 || len(c.NextProtos) == 0 {
+		t.Fatalf("GetConfigForClient() = %+v, %v, want the base config with the client CAs", c, err)
+	}
+
+	parsed, err := x509.ParseCertificate(caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parsed.Verify(x509.VerifyOptions{Roots: c.ClientCAs}); err != nil {
+		t.Fatalf("the client CA pool does not hold the bundle: %v", err)
+	}
+
+	// A bundle without certificates is refused and the pool kept.
+	if err := os.WriteFile(ca, []byte("empty"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload() of an empty CA bundle succeeded")
+	}
+	if c, _ = tlsConfig.GetConfigForClient(nil); c.ClientCAs == nil {
+		t.Fatal("a failed reload dropped the client CAs")
+	}
+}
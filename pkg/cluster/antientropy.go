@@ -0,0 +1,343 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud_native/pkg/store"
+)
+
+// PeerRepair is the outcome of comparing this node's keys with one peer.
+type PeerRepair struct {
+	Node     string `json:"node"`
+	Repaired int    `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RepairReport is the outcome of an anti-entropy round.
+type RepairReport struct {
+	Repaired int          `json:"repaired"`
+	Peers    []PeerRepair `json:"peers"`
+}
+
+type treeRequest struct {
+	Peer    string `json:"peer"`
+	Level   int    `json:"level"`
+	Indexes []int  `json:"indexes"`
+}
+
+type treeResponse struct {
+	Hashes [][]byte `json:"hashes"`
+}
+
+type rangeRequest struct {
+	Peer   string `json:"peer"`
+	Leaves []int  `json:"leaves"`
+}
+
+// AntiEntropy compares this node's keys with every peer each interval until
+// ctx is done, repairing whichever side holds the older value.
+func (q *Quorum) AntiEntropy(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report := q.Repair(ctx)
+			for _, p := range report.Peers {
+				if p.Error != "" {
+					log.Printf("Anti-entropy with %s failed: %s", p.Node, p.Error)
+				}
+			}
+			if report.Repaired > 0 {
+				log.Printf("Anti-entropy repaired %d keys", report.Repaired)
+			}
+		}
+	}
+}
+
+// Repair runs one anti-entropy round. For each peer, both build a Merkle
+// tree over the keys they both replicate and compare it from the root down,
+// so that only the keys in differing leaves are exchanged.
+func (q *Quorum) Repair(ctx context.Context) RepairReport {
+	report := RepairReport{Peers: make([]PeerRepair, 0)}
+
+	for _, peer := range q.cluster.Nodes() {
+		if peer == q.cluster.self {
+			continue
+		}
+
+		n, err := q.repairWith(ctx, peer)
+
+		p := PeerRepair{Node: peer, Repaired: n}
+		if err != nil {
+			p.Error = err.Error()
+		}
+
+		report.Peers = append(report.Peers, p)
+		report.Repaired += n
+	}
+
+	return report
+}
+
+func (q *Quorum) repairWith(ctx context.Context, peer string) (int, error) {
+	tree := newMerkleTree(q.shared(peer))
+
+	indexes := []int{0}
+	for level := 0; ; level += treeStep {
+		theirs, err := q.cluster.remoteHashes(ctx, peer, treeRequest{Peer: q.cluster.self, Level: level, Indexes: indexes})
+		if err != nil {
+			return 0, err
+		}
+
+		ours := tree.hashes(level, indexes)
+		differ := make([]int, 0)
+
+		for i, idx := range indexes {
+			if i >= len(theirs) || !bytes.Equal(ours[i], theirs[i]) {
+				differ = append(differ, idx)
+			}
+		}
+
+		if len(differ) == 0 {
+			return 0, nil
+		}
+
+		if level+treeStep > treeDepth {
+			indexes = differ
+			break
+		}
+
+		indexes = children(differ)
+	}
+
+	theirs, err := q.cluster.remoteRange(ctx, peer, rangeRequest{Peer: q.cluster.self, Leaves: indexes})
+	if err != nil {
+		return 0, err
+	}
+
+	return q.reconcile(ctx, peer, tree.values(indexes), theirs)
+}
+
+// reconcile writes the newer of each key's two values to the side holding
+// the older, or for two differing CRDT states, each to the other side, and
+// returns how many keys it repaired.
+func (q *Quorum) reconcile(ctx context.Context, peer string, ours, theirs []replicaValue) (int, error) {
+	mine := make(map[string]replicaValue, len(ours))
+	for _, v := range ours {
+		mine[v.Key] = v
+	}
+
+	repaired := 0
+
+	for _, t := range theirs {
+		o := mine[t.Key]
+		delete(mine, t.Key)
+
+		switch {
+		case t.CRDT && o.CRDT:
+			if t.Value == o.Value {
+				continue
+			}
+			if err := q.cluster.writeReplica(t); err != nil {
+				return repaired, fmt.Errorf("cannot repair %q: %w", t.Key, err)
+			}
+			if err := q.cluster.remoteWrite(ctx, peer, o); err != nil {
+				return repaired, err
+			}
+			repaired++
+		case t.Stamp > o.Stamp:
+			if err := q.cluster.writeReplica(t); err != nil {
+				return repaired, fmt.Errorf("cannot repair %q: %w", t.Key, err)
+			}
+			repaired++
+		case o.Stamp > t.Stamp:
+			if err := q.cluster.remoteWrite(ctx, peer, o); err != nil {
+				return repaired, err
+			}
+			repaired++
+		}
+	}
+
+	for _, o := range mine {
+		if err := q.cluster.remoteWrite(ctx, peer, o); err != nil {
+			return repaired, err
+		}
+		repaired++
+	}
+
+	return repaired, nil
+}
+
+// shared returns the local values of the keys replicated on both this node
+// and peer.
+func (q *Quorum) shared(peer string) []replicaValue {
+	var values []replicaValue
+
+	held := func(key string) bool {
+		owners := q.cluster.ring.Owners(key, q.n)
+		return contains(owners, q.cluster.self) && contains(owners, peer)
+	}
+
+	for _, e := range store.Snapshot() {
+		if e.Stamp != 0 && held(e.Key) {
+			values = append(values, replicaValue{Key: e.Key, Value: e.Value, Stamp: e.Stamp, ExpiresAt: e.ExpiresAt, Flags: e.Flags, CRDT: e.CRDT})
+		}
+	}
+
+	for key, stamp := range store.Tombstones() {
+		if held(key) {
+			values = append(values, replicaValue{Key: key, Stamp: stamp, Deleted: true})
+		}
+	}
+
+	return values
+}
+
+// TreeHandler returns the hashes of the Merkle tree nodes asked for in the
+// JSON body, over the keys shared with the peer making the request.
+func (q *Quorum) TreeHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req treeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Peer == "" {
+			http.Error(w, "body must be {\"peer\": ..., \"level\": ..., \"indexes\": [...]}", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(treeResponse{Hashes: q.peerTree(req.Peer).hashes(req.Level, req.Indexes)})
+	}
+}
+
+// RangeHandler returns the values in the Merkle tree leaves asked for in the
+// JSON body, over the keys shared with the peer making the request.
+func (q *Quorum) RangeHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req rangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Peer == "" {
+			http.Error(w, "body must be {\"peer\": ..., \"leaves\": [...]}", http.StatusBadRequest)
+			return
+		}
+
+		values := q.peerTree(req.Peer).values(req.Leaves)
+		if values == nil {
+			values = make([]replicaValue, 0)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(values)
+	}
+}
+
+// treeTTL is how long a tree built for a peer answers its requests. A round
+// asks for several levels and then the leaves; they must all come from the
+// same tree, and rebuilding it for each would hash every shared key again.
+// Writes in the meantime are found by the next round.
+const treeTTL = 10 * time.Second
+
+// treeCache holds the last tree built for each peer.
+type treeCache struct {
+	m     sync.Mutex
+	trees map[string]cachedTree
+}
+
+type cachedTree struct {
+	tree  *merkleTree
+	built time.Time
+}
+
+// peerTree returns the tree over the keys shared with peer, built at most
+// treeTTL ago.
+func (q *Quorum) peerTree(peer string) *merkleTree {
+	c := &q.trees
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	now := time.Now()
+	if t, ok := c.trees[peer]; ok && now.Sub(t.built) < treeTTL {
+		return t.tree
+	}
+
+	for p, t := range c.trees {
+		if now.Sub(t.built) >= treeTTL {
+			delete(c.trees, p)
+		}
+	}
+
+	if c.trees == nil {
+		c.trees = make(map[string]cachedTree)
+	}
+
+	tree := newMerkleTree(q.shared(peer))
+	c.trees[peer] = cachedTree{tree: tree, built: now}
+
+	return tree
+}
+
+// RepairHandler runs an anti-entropy round and reports how many keys it
+// repaired. It responds 502 if some peers could not be compared.
+func (q *Quorum) RepairHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := q.Repair(r.Context())
+
+		status := http.StatusOK
+		for _, p := range report.Peers {
+			if p.Error != "" {
+				status = http.StatusBadGateway
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func (c *Cluster) remoteHashes(ctx context.Context, node string, req treeRequest) ([][]byte, error) {
+	resp, err := c.post(ctx, node+"/v1/_cluster/tree", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(node, resp)
+	}
+
+	var body treeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	return body.Hashes, nil
+}
+
+func (c *Cluster) remoteRange(ctx context.Context, node string, req rangeRequest) ([]replicaValue, error) {
+	resp, err := c.post(ctx, node+"/v1/_cluster/range", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(node, resp)
+	}
+
+	var values []replicaValue
+	if err := json.NewDecoder(resp.Body).Decode(&values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
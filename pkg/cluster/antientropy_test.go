@@ -0,0 +1,133 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMerkleTreeDiff(t *testing.T) {
+	values := []replicaValue{
+		{Key: "a", Value: "1", Stamp: 1},
+		{Key: "b", Value: "2", Stamp: 2},
+		{Key: "c", Stamp: 3, Deleted: true},
+	}
+
+	reversed := slices.Clone(values)
+	slices.Reverse(reversed)
+
+	ours, theirs := newMerkleTree(values), newMerkleTree(reversed)
+	if !bytes.Equal(ours.hashes(0, []int{0})[0], theirs.hashes(0, []int{0})[0]) {
+		t.Fatal("trees over the same values have different roots")
+	}
+
+	changed := slices.Clone(values)
+	changed[1].Stamp = 4
+	theirs = newMerkleTree(changed)
+
+	// Only the leaf holding b, and the nodes above it, differ.
+	leaf := leafOf("b")
+	for level := treeDepth; level >= 0; level-- {
+		idx := leaf >> (treeDepth - level)
+		if bytes.Equal(ours.hashes(level, []int{idx})[0], theirs.hashes(level, []int{idx})[0]) {
+			t.Fatalf("node %d at level %d above the changed leaf has the same hash", idx, level)
+		}
+	}
+
+	var differ []int
+	for i := range 1 << treeDepth {
+		if !bytes.Equal(ours.hashes(treeDepth, []int{i})[0], theirs.hashes(treeDepth, []int{i})[0]) {
+			differ = append(differ, i)
+		}
+	}
+	if !slices.Equal(differ, []int{leaf}) {
+		t.Fatalf("differing leaves = %v, want [%d]", differ, leaf)
+	}
+}
+
+func TestRepairRound(t *testing.T) {
+	peer := newFakeReplica(t)
+
+	self := "http://self"
+	q, err := NewQuorum(New(self, []string{self, peer.URL}, http.DefaultClient, "", discardLog{}), 2, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The store is shared with the other tests and outlives a test run.
+	s := uint64(time.Now().UnixNano())
+	local := []replicaValue{
+		{Key: "ae-same", Value: "v", Stamp: s + 1},
+		{Key: "ae-newer-here", Value: "new", Stamp: s + 5},
+		{Key: "ae-deleted-here", Deleted: true, Stamp: s + 10},
+		{Key: "ae-only-here", Value: "v", Stamp: s + 2},
+		{Key: "ae-deleted-there", Value: "v", Stamp: s + 6},
+	}
+	remote := []replicaValue{
+		{Key: "ae-same", Value: "v", Stamp: s + 1},
+		{Key: "ae-newer-here", Value: "old", Stamp: s + 2},
+		{Key: "ae-deleted-here", Value: "v", Stamp: s + 3},
+		{Key: "ae-only-there", Value: "v", Stamp: s + 4},
+		{Key: "ae-deleted-there", Deleted: true, Stamp: s + 9},
+	}
+
+	for _, v := range local {
+		if err := q.cluster.writeReplica(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range remote {
+		peer.set(v)
+	}
+
+	report := q.Repair(context.Background())
+	if len(report.Peers) != 1 || report.Peers[0].Error != "" {
+		t.Fatalf("Repair() = %+v, want one peer without error", report)
+	}
+	if report.Repaired < 5 {
+		t.Fatalf("Repair() repaired %d keys, want at least 5", report.Repaired)
+	}
+
+	root := func(tree *merkleTree) []byte { return tree.hashes(0, []int{0})[0] }
+	if !bytes.Equal(root(newMerkleTree(q.shared(peer.URL))), root(peer.tree())) {
+		t.Fatal("the replicas still differ after a round")
+	}
+
+	if v := readReplica("ae-deleted-there"); !v.Deleted || v.Stamp != s+9 {
+		t.Fatalf("local ae-deleted-there = %+v, want the peer's tombstone", v)
+	}
+	if v := readReplica("ae-only-there"); v.Value != "v" || v.Stamp != s+4 {
+		t.Fatalf("local ae-only-there = %+v, want the peer's value", v)
+	}
+	if v, _ := peer.get("ae-newer-here"); v.Value != "new" {
+		t.Fatalf("peer ae-newer-here = %+v, want the local value", v)
+	}
+	if v, _ := peer.get("ae-deleted-here"); !v.Deleted {
+		t.Fatalf("peer ae-deleted-here = %+v, want the local tombstone", v)
+	}
+
+	if report = q.Repair(context.Background()); report.Repaired != 0 {
+		t.Fatalf("second Repair() repaired %d keys, want 0", report.Repaired)
+	}
+}
+
+func TestPeerTreeCached(t *testing.T) {
+	self, peer := "http://self", "http://peer"
+	q, err := NewQuorum(New(self, []string{self, peer}, http.DefaultClient, "", discardLog{}), 2, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.peerTree(peer) != q.peerTree(peer) {
+		t.Fatal("peerTree() rebuilt the tree within treeTTL")
+	}
+
+	old := q.peerTree(peer)
+	q.trees.trees[peer] = cachedTree{tree: old, built: time.Now().Add(-treeTTL)}
+	if q.peerTree(peer) == old {
+		t.Fatal("peerTree() kept a tree older than treeTTL")
+	}
+}
@@ -0,0 +1,261 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+// ForwardedHeader marks requests sent by another node of the cluster. They are
+// served locally, never forwarded again, so nodes whose rings briefly
+// disagree cannot bounce a request between them. It is only trusted along
+// with the cluster key in PeerKeyHeader, see Forwarded.
+const (
+	ForwardedHeader = "X-Cluster-Forwarded"
+	PeerKeyHeader   = "X-Cluster-Key"
+)
+
+const (
+	handoffBatch  = 500
+	retryInterval = 5 * time.Second
+)
+
+type TransactionLogger interface {
+	WriteBatch(events []transcationlog.Event)
+}
+
+// Cluster partitions the keyspace across nodes, each named by the base URL of
+// its REST API, e.g. "https://node1:8080". When the nodes change, keys this
+// node no longer owns are handed off to their new owner in the background.
+type Cluster struct {
+	self   string
+	ring   *Ring
+	client *http.Client
+	key    string
+	log    TransactionLogger
+
+	// replicas is how many nodes hold each key, see NewQuorum.
+	replicas  int
+	rebalance chan struct{}
+}
+
+// New creates the cluster as seen from self. key is the API key the nodes
+// present to each other, which also proves a request came from a node.
+func New(self string, nodes []string, client *http.Client, key string, log TransactionLogger) *Cluster {
+	return &Cluster{
+		self:      strings.TrimSuffix(self, "/"),
+		ring:      NewRing(DefaultVirtualNodes, trim(nodes)...),
+		client:    client,
+		key:       key,
+		log:       log,
+		replicas:  1,
+		rebalance: make(chan struct{}, 1),
+	}
+}
+
+func (c *Cluster) Self() string {
+	return c.self
+}
+
+func (c *Cluster) Owner(key string) string {
+	return c.ring.Owner(key)
+}
+
+func (c *Cluster) Nodes() []string {
+	return c.ring.Nodes()
+}
+
+func (c *Cluster) Ring() *Ring {
+	return c.ring
+}
+
+// Client returns the client used to reach other nodes.
+func (c *Cluster) Client() *http.Client {
+	return c.client
+}
+
+// SetNodes replaces the members of the cluster and starts rebalancing.
+func (c *Cluster) SetNodes(nodes []string) {
+	c.ring.Set(trim(nodes))
+	c.Rebalance()
+}
+
+// SetMembers replaces the members of the cluster with nodes at the given ring
+// tokens, and starts rebalancing.
+func (c *Cluster) SetMembers(tokens map[string][]uint64) {
+	c.ring.SetTokens(tokens)
+	c.Rebalance()
+}
+
+// Rebalance schedules a pass that hands off the keys owned by other nodes.
+func (c *Cluster) Rebalance() {
+	select {
+	case c.rebalance <- struct{}{}:
+	default:
+	}
+}
+
+// Run rebalances whenever the nodes change, until ctx is done. Keys that
+// could not be handed off are retried.
+func (c *Cluster) Run(ctx context.Context) {
+	c.Rebalance() // keys restored from the log may belong elsewhere
+
+	var retry <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.rebalance:
+		case <-retry:
+		}
+
+		retry = nil
+		if err := c.handOff(ctx); err != nil {
+			log.Printf("cluster: rebalancing: %v; retrying in %v", err, retryInterval)
+			retry = time.After(retryInterval)
+		}
+	}
+}
+
+// handOff sends every local entry this node no longer holds a replica of to
+// the nodes that do, and deletes it locally once they all have it.
+func (c *Cluster) handOff(ctx context.Context) error {
+	moving := make(map[string][]store.Entry)
+	for _, e := range store.Snapshot() {
+		if owners := c.ring.Owners(e.Key, c.replicas); len(owners) > 0 && !contains(owners, c.self) {
+			group := strings.Join(owners, ",")
+			moving[group] = append(moving[group], e)
+		}
+	}
+
+	var failed []string
+
+	for group, entries := range moving {
+		owners := strings.Split(group, ",")
+
+		for len(entries) > 0 {
+			n := min(handoffBatch, len(entries))
+
+			if err := c.sendAll(ctx, owners, entries[:n]); err != nil {
+				failed = append(failed, err.Error())
+				break
+			}
+
+			c.drop(entries[:n])
+			entries = entries[n:]
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("cannot hand off to %s", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+func (c *Cluster) sendAll(ctx context.Context, owners []string, entries []store.Entry) error {
+	for _, owner := range owners {
+		if err := c.send(ctx, owner, entries); err != nil {
+			return fmt.Errorf("%s: %w", owner, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) send(ctx context.Context, owner string, entries []store.Entry) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+
+	for _, e := range entries {
+		enc.Encode(handoffEntry{Key: e.Key, Value: e.Value, ExpiresAt: e.ExpiresAt, Flags: e.Flags, Stamp: e.Stamp, CRDT: e.CRDT})
+	}
+
+	resp, err := c.Do(ctx, http.MethodPost, owner+"/v1/_cluster/handoff", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// drop deletes the handed-off entries that were not written to since.
+func (c *Cluster) drop(entries []store.Entry) {
+	events := make([]transcationlog.Event, 0, len(entries))
+
+	for _, e := range entries {
+		res, err := store.Txn(
+			[]store.Compare{{Key: e.Key, Target: store.CompareVersion, Version: e.Version}},
+			[]store.Op{{Type: store.OpDelete, Key: e.Key}},
+			nil,
+		)
+		if err == nil && res.Succeeded {
+			events = append(events, transcationlog.Event{EventType: transcationlog.EventDelete, Key: e.Key})
+		}
+	}
+
+	c.log.WriteBatch(events)
+}
+
+// Do sends a request to another node, marked as forwarded.
+func (c *Cluster) Do(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.key != "" {
+		req.Header.Set("X-API-Key", c.key)
+	}
+	c.MarkForwarded(req)
+
+	return c.client.Do(req)
+}
+
+// MarkForwarded marks req as sent by this node.
+func (c *Cluster) MarkForwarded(req *http.Request) {
+	req.Header.Set(ForwardedHeader, c.self)
+
+	if c.key != "" {
+		req.Header.Set(PeerKeyHeader, c.key)
+	}
+}
+
+// Forwarded reports whether r was sent by another node: it must carry the
+// cluster key, so clients cannot have a node serve a key it does not own.
+// Without a cluster key, no request is trusted as forwarded.
+func (c *Cluster) Forwarded(r *http.Request) bool {
+	if r.Header.Get(ForwardedHeader) == "" || c.key == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(PeerKeyHeader)), []byte(c.key)) == 1
+}
+
+func trim(nodes []string) []string {
+	trimmed := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if n = strings.TrimSuffix(strings.TrimSpace(n), "/"); n != "" && !contains(trimmed, n) {
+			trimmed = append(trimmed, n)
+		}
+	}
+
+	return trimmed
+}
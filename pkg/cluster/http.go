@@ -0,0 +1,142 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud_native/pkg/auth"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+type handoffEntry struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Flags     uint32    `json:"flags,omitempty"`
+	Stamp     uint64    `json:"stamp,omitempty"`
+	CRDT      bool      `json:"crdt,omitempty"`
+}
+
+type nodes struct {
+	Self  string   `json:"self,omitempty"`
+	Nodes []string `json:"nodes"`
+}
+
+func (c *Cluster) NodesHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nodes{Self: c.self, Nodes: c.Nodes()})
+	}
+}
+
+// SetNodesHandler replaces the members with the JSON body, e.g.
+// {"nodes": ["https://node1:8080", "https://node2:8080"]}, and passes the
+// change on to the old and new members. It responds 502 if some of them
+// could not be told.
+func (c *Cluster) SetNodesHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body nodes
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Nodes) == 0 {
+			http.Error(w, "body must be {\"nodes\": [...]}", http.StatusBadRequest)
+			return
+		}
+
+		old := c.Nodes()
+		c.SetNodes(body.Nodes)
+
+		if c.Forwarded(r) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		data, _ := json.Marshal(nodes{Nodes: c.Nodes()})
+		var failed []string
+
+		for _, n := range trim(append(old, c.Nodes()...)) {
+			if n == c.self {
+				continue
+			}
+
+			resp, err := c.Do(r.Context(), http.MethodPut, n+"/v1/_cluster/nodes", bytes.NewReader(data))
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusNoContent {
+					err = fmt.Errorf("%s", resp.Status)
+				}
+			}
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", n, err))
+			}
+		}
+
+		if len(failed) > 0 {
+			http.Error(w, "cannot update "+strings.Join(failed, "; "), http.StatusBadGateway)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandoffHandler accepts entries, one JSON object per line, from a node that
+// no longer owns them. An entry is only stored if the key is absent, since
+// any value already here was written after the ownership changed, or for
+// replicated entries, if it is newer than the value here. CRDT states are
+// merged into the one here.
+func (c *Cluster) HandoffHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		dec := json.NewDecoder(bufio.NewReader(r.Body))
+		events := make([]transcationlog.Event, 0)
+
+		var principal string
+		if p, ok := auth.PrincipalFrom(r.Context()); ok {
+			principal = p.Name
+		}
+
+		for dec.More() {
+			var e handoffEntry
+			if err := dec.Decode(&e); err != nil {
+				http.Error(w, fmt.Sprintf("cannot decode entry: %v", err), http.StatusBadRequest)
+				c.log.WriteBatch(events)
+				return
+			}
+
+			if e.Stamp != 0 || e.CRDT {
+				v := replicaValue{Key: e.Key, Value: e.Value, Stamp: e.Stamp, ExpiresAt: e.ExpiresAt, Flags: e.Flags, CRDT: e.CRDT, Principal: principal}
+				if err := c.writeReplica(v); err != nil {
+					http.Error(w, fmt.Sprintf("cannot store %q: %v", e.Key, err), replicaStatus(err))
+					c.log.WriteBatch(events)
+					return
+				}
+				continue
+			}
+
+			res, err := store.Txn(
+				[]store.Compare{{Key: e.Key, Target: store.CompareVersion, Version: 0}},
+				[]store.Op{{Type: store.OpPut, Key: e.Key, Value: e.Value, ExpiresAt: e.ExpiresAt, Flags: e.Flags}},
+				nil,
+			)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("cannot store %q: %v", e.Key, err), http.StatusInsufficientStorage)
+				c.log.WriteBatch(events)
+				return
+			}
+
+			if res.Succeeded {
+				events = append(events, transcationlog.PutEvents(e.Key, e.Value, e.ExpiresAt, e.Flags, principal)...)
+			}
+		}
+
+		c.log.WriteBatch(events)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,260 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// Meta is what a node announces about itself to the others.
+type Meta struct {
+	Address string `json:"address,omitempty"` // base URL of the REST API
+	Role    string `json:"role,omitempty"`
+
+	// Vnodes is the number of points the node takes on the ring. The points
+	// derive from Address, see Tokens, so they need not be gossiped.
+	Vnodes int `json:"vnodes,omitempty"`
+}
+
+// Tokens returns the ring points the node announced.
+func (m Meta) Tokens() []uint64 {
+	return Tokens(m.Address, m.Vnodes)
+}
+
+// Member is a node as seen by the failure detector.
+type Member struct {
+	Name  string `json:"name"`
+	Addr  string `json:"addr"`
+	State string `json:"state"`
+	Meta  Meta   `json:"meta"`
+}
+
+type MemberEventType byte
+
+const (
+	MemberJoin MemberEventType = iota
+	MemberLeave
+	MemberUpdate
+)
+
+type MemberEvent struct {
+	Type   MemberEventType
+	Member Member
+}
+
+// MembershipConfig configures the gossip listener, on both UDP and TCP.
+type MembershipConfig struct {
+	Name          string
+	BindAddr      string
+	BindPort      int
+	AdvertiseAddr string
+	AdvertisePort int
+
+	// SecretKey encrypts gossip with AES; it must be 16, 24 or 32 bytes.
+	SecretKey []byte
+
+	Meta Meta
+}
+
+// Membership discovers the other nodes and detects their failure with
+// SWIM: nodes probe each other, suspect those that do not answer, and declare
+// them dead unless they refute the suspicion in time.
+type Membership struct {
+	list *memberlist.Memberlist
+	meta []byte
+
+	m    sync.Mutex
+	subs map[chan MemberEvent]struct{}
+}
+
+func NewMembership(cfg MembershipConfig) (*Membership, error) {
+	meta, err := json.Marshal(cfg.Meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(meta) > memberlist.MetaMaxSize {
+		return nil, fmt.Errorf("member metadata is %d bytes, more than %d", len(meta), memberlist.MetaMaxSize)
+	}
+
+	m := &Membership{meta: meta, subs: make(map[chan MemberEvent]struct{})}
+
+	c := memberlist.DefaultLANConfig()
+	c.Name = cfg.Name
+	c.BindAddr = cfg.BindAddr
+	c.BindPort = cfg.BindPort
+	c.AdvertiseAddr = cfg.AdvertiseAddr
+	c.AdvertisePort = cfg.AdvertisePort
+	c.SecretKey = cfg.SecretKey
+	c.Delegate = m
+	c.Events = m
+	c.Logger = log.New(quietWriter{os.Stderr}, "", log.LstdFlags)
+
+	if m.list, err = memberlist.Create(c); err != nil {
+		return nil, fmt.Errorf("cannot start gossip: %w", err)
+	}
+
+	return m, nil
+}
+
+// Join contacts the seeds, as host:port, and returns how many answered.
+func (m *Membership) Join(seeds []string) (int, error) {
+	return m.list.Join(seeds)
+}
+
+// Leave tells the others this node is leaving, so they do not wait to
+// declare it dead.
+func (m *Membership) Leave(timeout time.Duration) error {
+	if err := m.list.Leave(timeout); err != nil {
+		return err
+	}
+
+	return m.list.Shutdown()
+}
+
+// Members returns the nodes that are alive or suspected, sorted by name.
+func (m *Membership) Members() []Member {
+	nodes := m.list.Members()
+
+	members := make([]Member, 0, len(nodes))
+	for _, n := range nodes {
+		members = append(members, member(n))
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+
+	return members
+}
+
+// Subscribe returns a channel of member changes until ctx is done. A
+// subscriber that falls behind has its channel closed and must subscribe
+// again, then call Members to catch up.
+func (m *Membership) Subscribe(ctx context.Context) <-chan MemberEvent {
+	ch := make(chan MemberEvent, 64)
+
+	m.m.Lock()
+	m.subs[ch] = struct{}{}
+	m.m.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.unsubscribe(ch)
+	}()
+
+	return ch
+}
+
+func (m *Membership) MembersHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Members())
+	}
+}
+
+func (m *Membership) unsubscribe(ch chan MemberEvent) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if _, ok := m.subs[ch]; ok {
+		delete(m.subs, ch)
+		close(ch)
+	}
+}
+
+func (m *Membership) publish(t MemberEventType, n *memberlist.Node) {
+	e := MemberEvent{Type: t, Member: member(n)}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	for ch := range m.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(m.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// memberlist.EventDelegate
+func (m *Membership) NotifyJoin(n *memberlist.Node)   { m.publish(MemberJoin, n) }
+func (m *Membership) NotifyLeave(n *memberlist.Node)  { m.publish(MemberLeave, n) }
+func (m *Membership) NotifyUpdate(n *memberlist.Node) { m.publish(MemberUpdate, n) }
+
+// memberlist.Delegate
+func (m *Membership) NodeMeta(limit int) []byte                  { return m.meta }
+func (m *Membership) NotifyMsg([]byte)                           {}
+func (m *Membership) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (m *Membership) LocalState(join bool) []byte                { return nil }
+func (m *Membership) MergeRemoteState(buf []byte, join bool)     {}
+
+func member(n *memberlist.Node) Member {
+	mem := Member{Name: n.Name, Addr: n.Address(), State: stateName(n.State)}
+	json.Unmarshal(n.Meta, &mem.Meta)
+
+	return mem
+}
+
+func stateName(s memberlist.NodeStateType) string {
+	switch s {
+	case memberlist.StateAlive:
+		return "alive"
+	case memberlist.StateSuspect:
+		return "suspect"
+	case memberlist.StateDead:
+		return "dead"
+	case memberlist.StateLeft:
+		return "left"
+	}
+
+	return "unknown"
+}
+
+// quietWriter drops memberlist's debug lines.
+type quietWriter struct {
+	w io.Writer
+}
+
+func (q quietWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("[DEBUG]")) {
+		return len(p), nil
+	}
+
+	return q.w.Write(p)
+}
+
+// Follow keeps the ring in step with the members announcing an address and
+// ring tokens, until ctx is done. Suspected members keep their keys until
+// they are declared dead, so that a slow node does not cause a rebalance.
+func (c *Cluster) Follow(ctx context.Context, m *Membership) {
+	for ctx.Err() == nil {
+		events := m.Subscribe(ctx)
+		c.SetMembers(ringTokens(m.Members()))
+
+		for range events {
+			c.SetMembers(ringTokens(m.Members()))
+		}
+	}
+}
+
+func ringTokens(members []Member) map[string][]uint64 {
+	tokens := make(map[string][]uint64, len(members))
+	for _, mem := range members {
+		if mem.Meta.Address != "" && mem.Meta.Vnodes > 0 {
+			tokens[mem.Meta.Address] = mem.Meta.Tokens()
+		}
+	}
+
+	return tokens
+}
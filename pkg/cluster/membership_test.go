@@ -0,0 +1,152 @@
+package cluster
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestMembership(t *testing.T, name string, meta Meta) *Membership {
+	t.Helper()
+
+	m, err := NewMembership(MembershipConfig{Name: name, BindAddr: "127.0.0.1", AdvertiseAddr: "127.0.0.1", Meta: meta})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.list.Shutdown() })
+
+	return m
+}
+
+func (m *Membership) addr() string {
+	return m.list.LocalNode().Address()
+}
+
+func memberNames(m *Membership) []string {
+	var names []string
+	for _, mem := range m.Members() {
+		names = append(names, mem.Name)
+	}
+
+	return names
+}
+
+// nextEvent returns the next event of type want, skipping the others.
+func nextEvent(t *testing.T, events <-chan MemberEvent, want MemberEventType, timeout time.Duration) MemberEvent {
+	t.Helper()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatal("subscription closed")
+			}
+			if e.Type == want {
+				return e
+			}
+		case <-deadline:
+			t.Fatalf("no event of type %d within %v", want, timeout)
+		}
+	}
+}
+
+func TestMembershipJoin(t *testing.T) {
+	a := newTestMembership(t, "a", Meta{Address: "https://a", Role: "partition", Vnodes: 4})
+	b := newTestMembership(t, "b", Meta{Address: "https://b", Role: "partition", Vnodes: 4})
+
+	events := a.Subscribe(t.Context())
+
+	if n, err := b.Join([]string{a.addr()}); err != nil || n != 1 {
+		t.Fatalf("Join() = %d, %v, want 1, nil", n, err)
+	}
+
+	e := nextEvent(t, events, MemberJoin, 5*time.Second)
+	if e.Member.Name != "b" || e.Member.Meta.Address != "https://b" || e.Member.Meta.Vnodes != 4 {
+		t.Fatalf("join event = %+v, want b with its metadata", e)
+	}
+
+	want := []string{"a", "b"}
+	for _, m := range []*Membership{a, b} {
+		if names := memberNames(m); !slices.Equal(names, want) {
+			t.Fatalf("Members() = %v, want %v", names, want)
+		}
+	}
+
+	if tokens := ringTokens(a.Members()); len(tokens["https://b"]) != 4 {
+		t.Fatalf("ringTokens() = %v, want 4 tokens for b", tokens)
+	}
+}
+
+func TestMembershipLeave(t *testing.T) {
+	a := newTestMembership(t, "a", Meta{})
+	b := newTestMembership(t, "b", Meta{})
+
+	if _, err := b.Join([]string{a.addr()}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := a.Subscribe(t.Context())
+
+	if err := b.Leave(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := nextEvent(t, events, MemberLeave, 5*time.Second); e.Member.Name != "b" {
+		t.Fatalf("leave event = %+v, want b", e)
+	}
+	if names := memberNames(a); !slices.Equal(names, []string{"a"}) {
+		t.Fatalf("Members() after b left = %v, want [a]", names)
+	}
+}
+
+func TestMembershipFailureDetection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the failure detector")
+	}
+
+	a := newTestMembership(t, "a", Meta{})
+	b := newTestMembership(t, "b", Meta{})
+
+	if _, err := b.Join([]string{a.addr()}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := a.Subscribe(t.Context())
+
+	// Stop b without telling anyone, as a crash would.
+	b.list.Shutdown()
+
+	if e := nextEvent(t, events, MemberLeave, 30*time.Second); e.Member.Name != "b" {
+		t.Fatalf("leave event after b stopped = %+v, want b", e)
+	}
+	if names := memberNames(a); !slices.Equal(names, []string{"a"}) {
+		t.Fatalf("Members() after b failed = %v, want [a]", names)
+	}
+}
+
+func TestMembershipSlowSubscriber(t *testing.T) {
+	a := newTestMembership(t, "a", Meta{})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	events := a.Subscribe(ctx)
+
+	// The buffer holds 64 events; the next one drops the subscriber.
+	n := a.list.LocalNode()
+	for range 65 {
+		a.NotifyUpdate(n)
+	}
+
+	count := 0
+	for range events {
+		count++
+	}
+	if count != 64 {
+		t.Fatalf("received %d events before the channel closed, want 64", count)
+	}
+
+	// Unsubscribing a dropped subscriber must not close its channel twice.
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+}
@@ -0,0 +1,135 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+)
+
+const (
+	// treeDepth gives the Merkle trees 2^treeDepth leaves.
+	treeDepth = 10
+
+	// treeStep is how many levels a comparison descends at once, trading
+	// round trips for hashes sent.
+	treeStep = 5
+)
+
+// merkleTree hashes a set of replica values. Each value falls in the leaf
+// given by the top bits of its key's hash, and each inner node hashes its
+// two children, so two trees over the same values have the same root, and
+// where they differ, the differing leaves are found by descending from it.
+type merkleTree struct {
+	levels [][][]byte // levels[0] is the root, levels[treeDepth] the leaves
+	leaves [][]replicaValue
+}
+
+func newMerkleTree(values []replicaValue) *merkleTree {
+	t := &merkleTree{
+		levels: make([][][]byte, treeDepth+1),
+		leaves: make([][]replicaValue, 1<<treeDepth),
+	}
+
+	for _, v := range values {
+		i := leafOf(v.Key)
+		t.leaves[i] = append(t.leaves[i], v)
+	}
+
+	leaves := make([][]byte, len(t.leaves))
+	for i, vs := range t.leaves {
+		sort.Slice(vs, func(a, b int) bool { return vs[a].Key < vs[b].Key })
+		leaves[i] = hashLeaf(vs)
+	}
+	t.levels[treeDepth] = leaves
+
+	for level := treeDepth - 1; level >= 0; level-- {
+		below := t.levels[level+1]
+		nodes := make([][]byte, len(below)/2)
+
+		for i := range nodes {
+			h := sha256.New()
+			h.Write(below[2*i])
+			h.Write(below[2*i+1])
+			nodes[i] = h.Sum(nil)
+		}
+
+		t.levels[level] = nodes
+	}
+
+	return t
+}
+
+// hashes returns the hashes of the nodes at level, in the order of indexes;
+// out-of-range indexes have no hash.
+func (t *merkleTree) hashes(level int, indexes []int) [][]byte {
+	if level < 0 || level > treeDepth {
+		return nil
+	}
+
+	nodes := t.levels[level]
+	hashes := make([][]byte, len(indexes))
+
+	for i, idx := range indexes {
+		if idx >= 0 && idx < len(nodes) {
+			hashes[i] = nodes[idx]
+		}
+	}
+
+	return hashes
+}
+
+// values returns the values in the given leaves.
+func (t *merkleTree) values(leaves []int) []replicaValue {
+	var values []replicaValue
+	for _, i := range leaves {
+		if i >= 0 && i < len(t.leaves) {
+			values = append(values, t.leaves[i]...)
+		}
+	}
+
+	return values
+}
+
+// children returns the indexes, treeStep levels down, of the nodes below
+// those at indexes.
+func children(indexes []int) []int {
+	below := make([]int, 0, len(indexes)<<treeStep)
+	for _, i := range indexes {
+		for j := range 1 << treeStep {
+			below = append(below, i<<treeStep+j)
+		}
+	}
+
+	return below
+}
+
+func leafOf(key string) int {
+	return int(hash(key) >> (64 - treeDepth))
+}
+
+func hashLeaf(values []replicaValue) []byte {
+	h := sha256.New()
+	var n [8]byte
+
+	write := func(s string) {
+		binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+		h.Write(n[:])
+		h.Write([]byte(s))
+	}
+
+	for _, v := range values {
+		write(v.Key)
+
+		binary.BigEndian.PutUint64(n[:], v.Stamp)
+		h.Write(n[:])
+
+		if v.Deleted {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+			write(v.Value)
+		}
+	}
+
+	return h.Sum(nil)
+}
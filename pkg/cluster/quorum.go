@@ -0,0 +1,527 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_native/pkg/crdt"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+const (
+	ConsistencyHeader = "X-Consistency"
+	replicaTimeout    = 5 * time.Second
+
+	// oldestStamp is the stamp given to a value written without one when it
+	// is repaired: older than any write the clock stamps.
+	oldestStamp = 1
+)
+
+var (
+	ErrUnavailable        = errors.New("not enough replicas available")
+	ErrInvalidConsistency = errors.New("invalid consistency level")
+)
+
+// Consistency is how many replicas must answer a request.
+type Consistency byte
+
+const (
+	ConsistencyDefault Consistency = iota // R for reads, W for writes
+	ConsistencyOne
+	ConsistencyQuorum
+	ConsistencyAll
+)
+
+// ParseConsistency parses ONE, QUORUM or ALL, case-insensitively; empty is
+// the default.
+func ParseConsistency(s string) (Consistency, error) {
+	switch strings.ToUpper(s) {
+	case "":
+		return ConsistencyDefault, nil
+	case "ONE":
+		return ConsistencyOne, nil
+	case "QUORUM":
+		return ConsistencyQuorum, nil
+	case "ALL":
+		return ConsistencyAll, nil
+	}
+
+	return 0, fmt.Errorf("%w %q, want ONE, QUORUM or ALL", ErrInvalidConsistency, s)
+}
+
+// Quorum replicates every key to the first N nodes clockwise from it on the
+// ring. Writes wait for W replicas and reads for R; with R + W > N a read
+// sees the latest acknowledged write. Replicas that disagree are repaired by
+// reads, and writes missed by an unavailable replica are kept as hints and
+// delivered when it is back. Conflicting writes resolve to the newest stamp.
+type Quorum struct {
+	cluster *Cluster
+	n, r, w int
+	clock   clock
+	hints   *hints
+	trees   treeCache // built for peers comparing with this node
+
+	// updates serializes the CRDT updates this node coordinates, so that each
+	// reads the state the previous one wrote.
+	updates sync.Mutex
+}
+
+// NewQuorum replicates c's keys n times, with r and w as default read and
+// write consistency.
+func NewQuorum(c *Cluster, n, r, w int) (*Quorum, error) {
+	if n < 1 || r < 1 || w < 1 || r > n || w > n {
+		return nil, fmt.Errorf("need 1 <= R, W <= N, got N=%d R=%d W=%d", n, r, w)
+	}
+
+	c.replicas = n
+
+	return &Quorum{cluster: c, n: n, r: r, w: w, hints: newHints()}, nil
+}
+
+func (q *Quorum) Get(ctx context.Context, key string, level Consistency) (string, error) {
+	v, err := q.read(ctx, key, level)
+	if err != nil {
+		return "", err
+	}
+
+	if v.Deleted {
+		return "", store.ErrNoSuchKey
+	}
+
+	return v.Value, nil
+}
+
+func (q *Quorum) Put(ctx context.Context, key, value, principal string, level Consistency) error {
+	return q.write(ctx, replicaValue{Key: key, Value: value, Principal: principal, Stamp: q.clock.now()}, level)
+}
+
+func (q *Quorum) Delete(ctx context.Context, key, principal string, level Consistency) error {
+	return q.write(ctx, replicaValue{Key: key, Deleted: true, Principal: principal, Stamp: q.clock.now()}, level)
+}
+
+// Update applies o to the CRDT at key as this node, and writes the new state
+// to the replicas, which merge it into theirs.
+func (q *Quorum) Update(ctx context.Context, key string, o crdt.Op, principal string, level Consistency) (crdt.CRDT, error) {
+	q.updates.Lock()
+	defer q.updates.Unlock()
+
+	v, err := q.read(ctx, key, level)
+	if err != nil {
+		return nil, err
+	}
+
+	var c crdt.CRDT
+
+	switch {
+	case v.CRDT:
+		c, err = crdt.Decode(v.Value)
+	case !v.Deleted:
+		err = crdt.ErrNotCRDT
+	case o.Type == "":
+		err = fmt.Errorf("%w: missing type for a new key", crdt.ErrInvalidOp)
+	default:
+		c, err = crdt.New(o.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stamp := q.clock.now()
+	if err := o.Apply(c, q.cluster.self, stamp); err != nil {
+		return nil, err
+	}
+
+	return c, q.Merge(ctx, key, c, principal, level)
+}
+
+// Merge writes c to the replicas of key, which merge it into theirs.
+func (q *Quorum) Merge(ctx context.Context, key string, c crdt.CRDT, principal string, level Consistency) error {
+	value, err := crdt.Encode(c)
+	if err != nil {
+		return err
+	}
+
+	return q.write(ctx, replicaValue{Key: key, Value: value, CRDT: true, Principal: principal, Stamp: q.clock.now()}, level)
+}
+
+// Run delivers hints every interval until ctx is done.
+func (q *Quorum) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.deliverHints(ctx)
+		}
+	}
+}
+
+func (q *Quorum) write(ctx context.Context, v replicaValue, level Consistency) error {
+	replicas := q.cluster.ring.Owners(v.Key, q.n)
+	need := q.needed(level, q.w, len(replicas))
+
+	if err := checkValue(v); err != nil {
+		return err
+	}
+
+	acks := make(chan error, len(replicas))
+	for _, node := range replicas {
+		go func(node string) {
+			err := q.send(node, v)
+			if err != nil && !isPermanent(err) {
+				q.hints.add(node, v)
+			}
+			acks <- err
+		}(node)
+	}
+
+	acked, failed := 0, make([]string, 0)
+	for range replicas {
+		select {
+		case err := <-acks:
+			if err != nil {
+				if isPermanent(err) {
+					return err
+				}
+				failed = append(failed, err.Error())
+				continue
+			}
+
+			if acked++; acked >= need {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return fmt.Errorf("%w: %d of %d replicas acknowledged, %d needed: %s",
+		ErrUnavailable, acked, len(replicas), need, strings.Join(failed, "; "))
+}
+
+type reply struct {
+	node string
+	v    replicaValue
+	err  error
+}
+
+// read returns the newest value among the first replicas to answer, then
+// waits for the others in the background and repairs those that are stale.
+func (q *Quorum) read(ctx context.Context, key string, level Consistency) (replicaValue, error) {
+	replicas := q.cluster.ring.Owners(key, q.n)
+	need := q.needed(level, q.r, len(replicas))
+
+	replies := make(chan reply, len(replicas))
+	for _, node := range replicas {
+		go func(node string) {
+			v, err := q.fetch(node, key)
+			replies <- reply{node, v, err}
+		}(node)
+	}
+
+	got := make([]reply, 0, len(replicas))
+	answered := 0
+
+	for answered < need && len(got) < len(replicas) {
+		select {
+		case r := <-replies:
+			got = append(got, r)
+			if r.err == nil {
+				answered++
+			}
+		case <-ctx.Done():
+			return replicaValue{}, ctx.Err()
+		}
+	}
+
+	if answered < need {
+		return replicaValue{}, fmt.Errorf("%w: %d of %d replicas answered, %d needed", ErrUnavailable, answered, len(replicas), need)
+	}
+
+	newest := resolve(got)
+
+	go func() {
+		for len(got) < len(replicas) {
+			got = append(got, <-replies)
+		}
+		q.repair(resolve(got), got)
+	}()
+
+	return newest, nil
+}
+
+// repair writes newest to every replica that answered with an older value,
+// or for a CRDT, with a state that lacks some of the others'. An unstamped
+// value, written before quorum mode, is repaired as the oldest version there
+// can be, so that any stamped write still wins over it.
+func (q *Quorum) repair(newest replicaValue, replies []reply) {
+	if newest.Stamp == 0 {
+		if newest.Deleted {
+			return
+		}
+		newest.Stamp = oldestStamp
+	}
+
+	for _, r := range replies {
+		if r.err == nil && (r.v.Stamp < newest.Stamp || newest.CRDT && r.v.Value != newest.Value) {
+			if err := q.send(r.node, newest); err != nil && !isPermanent(err) {
+				q.hints.add(r.node, newest)
+			}
+		}
+	}
+}
+
+func (q *Quorum) deliverHints(ctx context.Context) {
+	for node, values := range q.hints.take() {
+		for i, v := range values {
+			if ctx.Err() != nil {
+				q.hints.add(node, values[i:]...)
+				return
+			}
+
+			if err := q.send(node, v); err != nil && !isPermanent(err) {
+				// Still unavailable: keep the rest for the next round.
+				q.hints.add(node, values[i:]...)
+				break
+			}
+		}
+	}
+}
+
+func (q *Quorum) send(node string, v replicaValue) error {
+	q.clock.observe(v.Stamp)
+
+	if node == q.cluster.self {
+		return q.cluster.writeReplica(v)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	defer cancel()
+
+	return q.cluster.remoteWrite(ctx, node, v)
+}
+
+func (q *Quorum) fetch(node, key string) (replicaValue, error) {
+	var v replicaValue
+	var err error
+
+	if node == q.cluster.self {
+		v = readReplica(key)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+		defer cancel()
+
+		v, err = q.cluster.remoteRead(ctx, node, key)
+	}
+
+	q.clock.observe(v.Stamp)
+
+	return v, err
+}
+
+func (q *Quorum) needed(level Consistency, def, replicas int) int {
+	n := def
+
+	switch level {
+	case ConsistencyOne:
+		n = 1
+	case ConsistencyQuorum:
+		n = q.n/2 + 1
+	case ConsistencyAll:
+		n = q.n
+	}
+
+	// With fewer nodes than replicas, each node holds one copy.
+	return min(n, replicas)
+}
+
+// resolve returns the newest value among the replies. An unstamped value is
+// older than any stamped one, but wins over a replica missing the key. If the
+// newest value is a CRDT, it is merged with the other CRDT states.
+func resolve(replies []reply) replicaValue {
+	newest := replicaValue{Deleted: true}
+	for _, r := range replies {
+		if r.err == nil && (r.v.Stamp > newest.Stamp || r.v.Stamp == newest.Stamp && newest.Deleted && !r.v.Deleted) {
+			newest = r.v
+		}
+	}
+
+	if !newest.CRDT {
+		return newest
+	}
+
+	for _, r := range replies {
+		if r.err != nil || !r.v.CRDT || r.v.Value == newest.Value {
+			continue
+		}
+
+		if merged, err := crdt.MergeEncoded(newest.Value, r.v.Value); err == nil {
+			newest.Value = merged
+		}
+	}
+
+	return newest
+}
+
+// checkValue rejects writes that no replica would accept, so they are not
+// kept as hints.
+func checkValue(v replicaValue) error {
+	if err := store.CheckKey(v.Key); err != nil {
+		return err
+	}
+
+	if max := store.CurrentLimits().MaxValueSize; max > 0 && int64(len(v.Value)) > max {
+		return store.ErrValueTooLarge
+	}
+
+	return nil
+}
+
+// writeReplica applies a replicated write to the local store and logs it,
+// unless the store already holds a newer one.
+func (c *Cluster) writeReplica(v replicaValue) error {
+	if v.CRDT {
+		return c.mergeReplica(v)
+	}
+
+	var applied bool
+	var err error
+
+	if v.Deleted {
+		applied = store.DeleteStamped(v.Key, v.Stamp)
+	} else {
+		applied, err = store.PutStamped(store.Entry{Key: v.Key, Value: v.Value, Stamp: v.Stamp, ExpiresAt: v.ExpiresAt, Flags: v.Flags})
+	}
+
+	if err != nil || !applied {
+		return err
+	}
+
+	if v.Deleted {
+		c.log.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventDelete, Key: v.Key, Principal: v.Principal, Stamp: v.Stamp}})
+		return nil
+	}
+
+	events := transcationlog.PutEvents(v.Key, v.Value, v.ExpiresAt, v.Flags, v.Principal)
+	for i := range events {
+		events[i].Stamp = v.Stamp
+	}
+	c.log.WriteBatch(events)
+
+	return nil
+}
+
+// mergeReplica merges a replicated CRDT state into the local one and logs
+// the merge.
+func (c *Cluster) mergeReplica(v replicaValue) error {
+	state, err := crdt.Decode(v.Value)
+	if err != nil {
+		return err
+	}
+
+	_, changed, err := crdt.MergeInto(store.CurrentLimits(), v.Key, state, v.Stamp)
+	if err != nil || !changed {
+		return err
+	}
+
+	c.log.WriteBatch([]transcationlog.Event{{EventType: transcationlog.EventMerge, Key: v.Key, Value: v.Value, Principal: v.Principal, Stamp: v.Stamp}})
+
+	return nil
+}
+
+func readReplica(key string) replicaValue {
+	if e, err := store.GetEntry(key); err == nil {
+		return replicaValue{Key: key, Value: e.Value, Stamp: e.Stamp, ExpiresAt: e.ExpiresAt, Flags: e.Flags, CRDT: e.CRDT}
+	}
+
+	stamp, _ := store.Stamp(key)
+
+	return replicaValue{Key: key, Stamp: stamp, Deleted: true}
+}
+
+// clock is a hybrid logical clock: it follows wall time, but never goes
+// backwards and always runs ahead of the stamps it has seen, so a write
+// coordinated after another is stamped newer even if clocks are skewed.
+type clock struct {
+	m    sync.Mutex
+	last uint64
+}
+
+func (c *clock) now() uint64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.last = max(c.last+1, uint64(time.Now().UnixNano()))
+
+	return c.last
+}
+
+func (c *clock) observe(stamp uint64) {
+	c.m.Lock()
+	c.last = max(c.last, stamp)
+	c.m.Unlock()
+}
+
+const maxHints = 10000
+
+// hints holds the writes each unavailable replica missed, only the newest
+// per key, until they can be delivered.
+type hints struct {
+	m     sync.Mutex
+	nodes map[string]map[string]replicaValue
+	count int
+}
+
+func newHints() *hints {
+	return &hints{nodes: make(map[string]map[string]replicaValue)}
+}
+
+func (h *hints) add(node string, values ...replicaValue) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for _, v := range values {
+		keys, ok := h.nodes[node]
+		if !ok {
+			keys = make(map[string]replicaValue)
+			h.nodes[node] = keys
+		}
+
+		old, ok := keys[v.Key]
+		switch {
+		case ok && old.Stamp >= v.Stamp:
+		case ok:
+			keys[v.Key] = v
+		case h.count < maxHints:
+			keys[v.Key] = v
+			h.count++
+		default:
+			// Anti-entropy repairs what no hint is kept for.
+		}
+	}
+}
+
+func (h *hints) take() map[string][]replicaValue {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	taken := make(map[string][]replicaValue, len(h.nodes))
+	for node, keys := range h.nodes {
+		for _, v := range keys {
+			taken[node] = append(taken[node], v)
+		}
+	}
+
+	h.nodes = make(map[string]map[string]replicaValue)
+	h.count = 0
+
+	return taken
+}
@@ -0,0 +1,344 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+type discardLog struct{}
+
+func (discardLog) WriteBatch([]transcationlog.Event) {}
+
+// fakeReplica serves the replica endpoints of a node from its own map, and
+// fails every request while down.
+type fakeReplica struct {
+	*httptest.Server
+
+	m      sync.Mutex
+	down   bool
+	values map[string]replicaValue
+}
+
+func newFakeReplica(t *testing.T) *fakeReplica {
+	f := &fakeReplica{values: make(map[string]replicaValue)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/_cluster/replica/read", func(w http.ResponseWriter, r *http.Request) {
+		var req replicaValue
+		json.NewDecoder(r.Body).Decode(&req)
+
+		v, ok := f.get(req.Key)
+		if !ok {
+			v = replicaValue{Key: req.Key, Deleted: true}
+		}
+		json.NewEncoder(w).Encode(v)
+	})
+	mux.HandleFunc("POST /v1/_cluster/replica/write", func(w http.ResponseWriter, r *http.Request) {
+		var v replicaValue
+		json.NewDecoder(r.Body).Decode(&v)
+
+		f.m.Lock()
+		if v.Stamp > f.values[v.Key].Stamp {
+			f.values[v.Key] = v
+		}
+		f.m.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /v1/_cluster/tree", func(w http.ResponseWriter, r *http.Request) {
+		var req treeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(treeResponse{Hashes: f.tree().hashes(req.Level, req.Indexes)})
+	})
+	mux.HandleFunc("POST /v1/_cluster/range", func(w http.ResponseWriter, r *http.Request) {
+		var req rangeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(f.tree().values(req.Leaves))
+	})
+
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.m.Lock()
+		down := f.down
+		f.m.Unlock()
+
+		if down {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeReplica) get(key string) (replicaValue, bool) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	v, ok := f.values[key]
+	return v, ok
+}
+
+// tree is the Merkle tree over all the replica's values, as if it shared
+// every key with the peer asking.
+func (f *fakeReplica) tree() *merkleTree {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	values := make([]replicaValue, 0, len(f.values))
+	for _, v := range f.values {
+		values = append(values, v)
+	}
+
+	return newMerkleTree(values)
+}
+
+func (f *fakeReplica) set(v replicaValue) {
+	f.m.Lock()
+	f.values[v.Key] = v
+	f.m.Unlock()
+}
+
+func (f *fakeReplica) setDown(down bool) {
+	f.m.Lock()
+	f.down = down
+	f.m.Unlock()
+}
+
+// newTestQuorum coordinates from a node outside the ring, so every replica
+// is one of the fakes.
+func newTestQuorum(t *testing.T, n, r, w int) (*Quorum, []*fakeReplica) {
+	t.Helper()
+
+	replicas := make([]*fakeReplica, n)
+	urls := make([]string, n)
+	for i := range replicas {
+		replicas[i] = newFakeReplica(t)
+		urls[i] = replicas[i].URL
+	}
+
+	q, err := NewQuorum(New("http://coordinator", urls, http.DefaultClient, "", discardLog{}), n, r, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q, replicas
+}
+
+func TestQuorumWrite(t *testing.T) {
+	q, replicas := newTestQuorum(t, 3, 2, 2)
+	ctx := context.Background()
+
+	replicas[0].setDown(true)
+	if err := q.Put(ctx, "quorum-write", "v1", "", ConsistencyDefault); err != nil {
+		t.Fatalf("Put() with 2 of 3 replicas up = %v, want nil", err)
+	}
+	if err := q.Put(ctx, "quorum-write", "v2", "", ConsistencyAll); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Put(ALL) with a replica down = %v, want ErrUnavailable", err)
+	}
+
+	replicas[1].setDown(true)
+	if err := q.Put(ctx, "quorum-write", "v3", "", ConsistencyDefault); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Put() with 1 of 3 replicas up = %v, want ErrUnavailable", err)
+	}
+	if err := q.Put(ctx, "quorum-write", "v4", "", ConsistencyOne); err != nil {
+		t.Fatalf("Put(ONE) with 1 of 3 replicas up = %v, want nil", err)
+	}
+}
+
+func TestQuorumRead(t *testing.T) {
+	q, replicas := newTestQuorum(t, 3, 2, 2)
+	ctx := context.Background()
+
+	if err := q.Put(ctx, "quorum-read", "v", "", ConsistencyAll); err != nil {
+		t.Fatal(err)
+	}
+
+	replicas[0].setDown(true)
+	if v, err := q.Get(ctx, "quorum-read", ConsistencyDefault); v != "v" || err != nil {
+		t.Fatalf("Get() with 2 of 3 replicas up = %q, %v, want v, nil", v, err)
+	}
+
+	replicas[1].setDown(true)
+	if _, err := q.Get(ctx, "quorum-read", ConsistencyDefault); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Get() with 1 of 3 replicas up = %v, want ErrUnavailable", err)
+	}
+	if v, err := q.Get(ctx, "quorum-read", ConsistencyOne); v != "v" || err != nil {
+		t.Fatalf("Get(ONE) with 1 of 3 replicas up = %q, %v, want v, nil", v, err)
+	}
+}
+
+func TestQuorumHintedHandoff(t *testing.T) {
+	q, replicas := newTestQuorum(t, 3, 2, 2)
+	ctx := context.Background()
+
+	replicas[2].setDown(true)
+	if err := q.Put(ctx, "quorum-hint", "v", "", ConsistencyDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	// The write returns after 2 acks; wait for the third attempt to fail.
+	waitFor(t, func() bool { return q.hints.pending(replicas[2].URL) == 1 }, "a hint for the replica that was down")
+
+	// Still down: the hint is kept for the next round.
+	q.deliverHints(ctx)
+	if n := q.hints.pending(replicas[2].URL); n != 1 {
+		t.Fatalf("%d hints after a failed delivery, want 1", n)
+	}
+
+	replicas[2].setDown(false)
+	q.deliverHints(ctx)
+
+	if v, ok := replicas[2].get("quorum-hint"); !ok || v.Value != "v" {
+		t.Fatalf("recovered replica holds %+v, want the hinted write", v)
+	}
+	if n := q.hints.pending(replicas[2].URL); n != 0 {
+		t.Fatalf("%d hints left after delivery, want none", n)
+	}
+}
+
+func TestQuorumReadRepair(t *testing.T) {
+	q, replicas := newTestQuorum(t, 3, 3, 3)
+	ctx := context.Background()
+
+	replicas[0].set(replicaValue{Key: "quorum-repair", Value: "old", Stamp: 1})
+	replicas[1].set(replicaValue{Key: "quorum-repair", Value: "new", Stamp: 2})
+	replicas[2].set(replicaValue{Key: "quorum-repair", Value: "new", Stamp: 2})
+
+	if v, err := q.Get(ctx, "quorum-repair", ConsistencyDefault); v != "new" || err != nil {
+		t.Fatalf("Get() = %q, %v, want the newest value", v, err)
+	}
+
+	waitFor(t, func() bool {
+		v, _ := replicas[0].get("quorum-repair")
+		return v.Value == "new"
+	}, "the stale replica to be repaired")
+}
+
+func TestQuorumTombstoneWins(t *testing.T) {
+	q, replicas := newTestQuorum(t, 3, 3, 3)
+	ctx := context.Background()
+
+	if err := q.Put(ctx, "quorum-tomb", "v", "", ConsistencyAll); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Delete(ctx, "quorum-tomb", "", ConsistencyAll); err != nil {
+		t.Fatal(err)
+	}
+
+	// A put stamped before the delete reaches one replica late.
+	tomb := mustGet(t, replicas[0], "quorum-tomb")
+	replicas[0].set(replicaValue{Key: "quorum-tomb", Value: "late", Stamp: tomb.Stamp - 1})
+
+	if _, err := q.Get(ctx, "quorum-tomb", ConsistencyDefault); !errors.Is(err, store.ErrNoSuchKey) {
+		t.Fatalf("Get() after the delete = %v, want ErrNoSuchKey", err)
+	}
+}
+
+// TestQuorumUnstamped reads a value written before quorum mode, which
+// carries no stamp.
+func TestQuorumUnstamped(t *testing.T) {
+	q, replicas := newTestQuorum(t, 3, 3, 3)
+	ctx := context.Background()
+
+	replicas[0].set(replicaValue{Key: "quorum-unstamped", Value: "old"})
+
+	if v, err := q.Get(ctx, "quorum-unstamped", ConsistencyDefault); v != "old" || err != nil {
+		t.Fatalf("Get() of an unstamped value = %q, %v, want it", v, err)
+	}
+
+	// The replicas missing it are repaired with the oldest stamp.
+	waitFor(t, func() bool {
+		for _, r := range replicas {
+			if v, _ := r.get("quorum-unstamped"); v.Value != "old" || v.Stamp != oldestStamp {
+				return false
+			}
+		}
+		return true
+	}, "the replicas to be repaired")
+
+	if err := q.Put(ctx, "quorum-unstamped", "new", "", ConsistencyOne); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := q.Get(ctx, "quorum-unstamped", ConsistencyDefault); v != "new" || err != nil {
+		t.Fatalf("Get() after a stamped put = %q, %v, want it", v, err)
+	}
+
+	if err := q.Delete(ctx, "quorum-unstamped", "", ConsistencyAll); err != nil {
+		t.Fatal(err)
+	}
+	replicas[1].set(replicaValue{Key: "quorum-unstamped", Value: "old"})
+
+	if _, err := q.Get(ctx, "quorum-unstamped", ConsistencyDefault); !errors.Is(err, store.ErrNoSuchKey) {
+		t.Fatalf("Get() after the delete = %v, want ErrNoSuchKey", err)
+	}
+}
+
+func TestWriteReplicaStampOrder(t *testing.T) {
+	c := New("http://self", nil, http.DefaultClient, "", discardLog{})
+	key := "replica-stamp-order"
+	// The store is shared with the other tests and outlives a test run.
+	base := uint64(time.Now().UnixNano())
+
+	for _, v := range []replicaValue{
+		{Key: key, Value: "v", Stamp: base + 10},
+		{Key: key, Deleted: true, Stamp: base + 20},
+		{Key: key, Value: "late", Stamp: base + 15},
+	} {
+		if err := c.writeReplica(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v := readReplica(key); !v.Deleted || v.Stamp != base+20 {
+		t.Fatalf("readReplica() = %+v, want the tombstone of the delete", v)
+	}
+
+	if err := c.writeReplica(replicaValue{Key: key, Value: "newer", Stamp: base + 30}); err != nil {
+		t.Fatal(err)
+	}
+	if v := readReplica(key); v.Deleted || v.Value != "newer" {
+		t.Fatalf("readReplica() after a newer put = %+v, want it", v)
+	}
+}
+
+func (h *hints) pending(node string) int {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return len(h.nodes[node])
+}
+
+func mustGet(t *testing.T, f *fakeReplica, key string) replicaValue {
+	t.Helper()
+
+	v, ok := f.get(key)
+	if !ok {
+		t.Fatalf("replica holds no %q", key)
+	}
+
+	return v
+}
+
+func waitFor(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
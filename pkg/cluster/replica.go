@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cloud_native/pkg/store"
+)
+
+// replicaValue is a key as held by one replica. A deleted key keeps the
+// stamp of its deletion. A CRDT value merges with the others instead of the
+// newest replacing them.
+type replicaValue struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value,omitempty"`
+	Stamp     uint64    `json:"stamp"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	CRDT      bool      `json:"crdt,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Flags     uint32    `json:"flags,omitempty"`
+	Principal string    `json:"principal,omitempty"`
+}
+
+// ReplicaReadHandler returns the local value of the key in the JSON body,
+// e.g. {"key": "a"}, with its stamp.
+func (c *Cluster) ReplicaReadHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req replicaValue
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key == "" {
+			http.Error(w, "body must be {\"key\": ...}", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(readReplica(req.Key))
+	}
+}
+
+// ReplicaWriteHandler applies the replicated write in the JSON body unless
+// the local value is newer.
+func (c *Cluster) ReplicaWriteHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var v replicaValue
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil || v.Stamp == 0 {
+			http.Error(w, "body must be a stamped replica value", http.StatusBadRequest)
+			return
+		}
+
+		if err := c.writeReplica(v); err != nil {
+			http.Error(w, err.Error(), replicaStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (c *Cluster) remoteRead(ctx context.Context, node, key string) (replicaValue, error) {
+	var v replicaValue
+
+	resp, err := c.post(ctx, node+"/v1/_cluster/replica/read", replicaValue{Key: key})
+	if err != nil {
+		return v, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return v, responseError(node, resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&v)
+
+	return v, err
+}
+
+func (c *Cluster) remoteWrite(ctx context.Context, node string, v replicaValue) error {
+	resp, err := c.post(ctx, node+"/v1/_cluster/replica/write", v)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return responseError(node, resp)
+	}
+
+	return nil
+}
+
+func (c *Cluster) post(ctx context.Context, url string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(ctx, http.MethodPost, url, bytes.NewReader(data))
+}
+
+// permanentErrors are returned by a replica that will never accept a write,
+// so retrying it is pointless.
+var permanentErrors = map[int]error{
+	http.StatusRequestEntityTooLarge: store.ErrValueTooLarge,
+	http.StatusRequestURITooLong:     store.ErrKeyTooLong,
+	http.StatusInsufficientStorage:   store.ErrStoreFull,
+}
+
+func replicaStatus(err error) int {
+	for status, e := range permanentErrors {
+		if errors.Is(err, e) {
+			return status
+		}
+	}
+
+	return http.StatusInternalServerError
+}
+
+func responseError(node string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if err, ok := permanentErrors[resp.StatusCode]; ok {
+		return fmt.Errorf("%s: %w", node, err)
+	}
+
+	return fmt.Errorf("%s: %s: %s", node, resp.Status, bytes.TrimSpace(msg))
+}
+
+func isPermanent(err error) bool {
+	for _, e := range permanentErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	return errors.Is(err, store.ErrEmptyKey)
+}
@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const DefaultVirtualNodes = 128
+
+// Ring assigns keys to nodes by consistent hashing. Every node is placed on
+// the ring at several points, its virtual nodes, so that keys spread evenly
+// and adding or removing a node only moves the keys next to its points.
+type Ring struct {
+	sync.RWMutex
+	vnodes int
+	points []uint64
+	owners map[uint64]string
+	nodes  []string
+}
+
+func NewRing(vnodes int, nodes ...string) *Ring {
+	r := &Ring{vnodes: vnodes}
+	r.Set(nodes)
+
+	return r
+}
+
+// Set replaces the nodes on the ring, each at the tokens Tokens derives
+// from its name.
+func (r *Ring) Set(nodes []string) {
+	tokens := make(map[string][]uint64, len(nodes))
+	for _, n := range nodes {
+		tokens[n] = Tokens(n, r.vnodes)
+	}
+
+	r.SetTokens(tokens)
+}
+
+// SetTokens replaces the nodes on the ring, each at the given points, e.g.
+// as announced by the node itself.
+func (r *Ring) SetTokens(tokens map[string][]uint64) {
+	points := make([]uint64, 0, len(tokens)*r.vnodes)
+	owners := make(map[uint64]string, len(tokens)*r.vnodes)
+	sorted := make([]string, 0, len(tokens))
+
+	for n := range tokens {
+		sorted = append(sorted, n)
+	}
+
+	// Visit nodes in order so that every node resolves clashing tokens alike.
+	sort.Strings(sorted)
+
+	for _, n := range sorted {
+		for _, p := range tokens[n] {
+			if _, taken := owners[p]; taken {
+				continue
+			}
+
+			points = append(points, p)
+			owners[p] = n
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+
+	r.Lock()
+	r.points, r.owners, r.nodes = points, owners, sorted
+	r.Unlock()
+}
+
+// Nodes returns the nodes on the ring, sorted.
+func (r *Ring) Nodes() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	return append([]string(nil), r.nodes...)
+}
+
+// Owner returns the node responsible for key, or "" if the ring is empty.
+func (r *Ring) Owner(key string) string {
+	owners := r.Owners(key, 1)
+	if len(owners) == 0 {
+		return ""
+	}
+
+	return owners[0]
+}
+
+// Owners returns up to n distinct nodes for key, walking the ring clockwise
+// from the key's hash: the owner first, then the nodes that should hold its
+// replicas.
+func (r *Ring) Owners(key string, n int) []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+
+	owners := make([]string, 0, n)
+	if n == 0 || len(r.points) == 0 {
+		return owners
+	}
+
+	h := hash(key)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+
+	// Nodes without tokens are never reached, so stop after a full turn.
+	for i := 0; len(owners) < n && i < len(r.points); i++ {
+		node := r.owners[r.points[(start+i)%len(r.points)]]
+		if !contains(owners, node) {
+			owners = append(owners, node)
+		}
+	}
+
+	return owners
+}
+
+// Tokens returns the points of the vnodes virtual nodes of node.
+func Tokens(node string, vnodes int) []uint64 {
+	tokens := make([]uint64, vnodes)
+	for i := range tokens {
+		tokens[i] = hash(node + "#" + strconv.Itoa(i))
+	}
+
+	return tokens
+}
+
+// hash places a key on the ring: the first 64 bits of its SHA-1, which every
+// node computes the same.
+func hash(key string) uint64 {
+	checksum := sha1.Sum([]byte(key))
+	return binary.BigEndian.Uint64(checksum[:8])
+}
+
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,107 @@
+package cluster
+
+import (
+	"fmt"
+	"testing"
+)
+
+const ringKeys = 10000
+
+// owners maps every test key to its owner on r.
+func owners(r *Ring) map[string]string {
+	m := make(map[string]string, ringKeys)
+	for i := range ringKeys {
+		key := fmt.Sprintf("key-%d", i)
+		m[key] = r.Owner(key)
+	}
+
+	return m
+}
+
+func TestRingOwners(t *testing.T) {
+	r := NewRing(DefaultVirtualNodes, "a", "b", "c")
+
+	// The order nodes are given in does not matter.
+	other := NewRing(DefaultVirtualNodes, "c", "a", "b")
+
+	for i := range 100 {
+		key := fmt.Sprintf("key-%d", i)
+
+		got := r.Owners(key, 3)
+		if len(got) != 3 || got[0] == got[1] || got[1] == got[2] || got[0] == got[2] {
+			t.Fatalf("Owners(%q, 3) = %v, want 3 distinct nodes", key, got)
+		}
+		if r.Owner(key) != got[0] {
+			t.Fatalf("Owner(%q) = %q, want the first of %v", key, r.Owner(key), got)
+		}
+		if fmt.Sprint(other.Owners(key, 3)) != fmt.Sprint(got) {
+			t.Fatalf("Owners(%q, 3) = %v on a ring built in another order, want %v", key, other.Owners(key, 3), got)
+		}
+
+		if n := len(r.Owners(key, 5)); n != 3 {
+			t.Fatalf("Owners(%q, 5) returned %d nodes, want the 3 there are", key, n)
+		}
+	}
+}
+
+func TestRingBalance(t *testing.T) {
+	r := NewRing(DefaultVirtualNodes, "a", "b", "c", "d")
+
+	counts := make(map[string]int)
+	for _, owner := range owners(r) {
+		counts[owner]++
+	}
+
+	// Each node should own about a quarter of the keys.
+	for _, n := range r.Nodes() {
+		if share := float64(counts[n]) / ringKeys; share < 0.15 || share > 0.35 {
+			t.Errorf("%s owns %.0f%% of the keys, want about 25%%", n, 100*share)
+		}
+	}
+}
+
+func TestRingMovement(t *testing.T) {
+	r := NewRing(DefaultVirtualNodes, "a", "b", "c", "d")
+	before := owners(r)
+
+	// A node joining only takes keys, about its share of them.
+	r.Set([]string{"a", "b", "c", "d", "e"})
+	moved := 0
+	for key, owner := range owners(r) {
+		if owner == before[key] {
+			continue
+		}
+		if owner != "e" {
+			t.Fatalf("%q moved from %s to %s when e joined", key, before[key], owner)
+		}
+		moved++
+	}
+	if share := float64(moved) / ringKeys; share < 0.1 || share > 0.3 {
+		t.Fatalf("%.0f%% of the keys moved when a fifth node joined, want about 20%%", 100*share)
+	}
+
+	// A node leaving only gives away its own keys.
+	r.Set([]string{"a", "c", "d"})
+	for key, owner := range owners(r) {
+		if owner != before[key] && before[key] != "b" {
+			t.Fatalf("%q moved from %s to %s when b left", key, before[key], owner)
+		}
+	}
+}
+
+func TestRingEmpty(t *testing.T) {
+	if owner := NewRing(0, "a").Owner("key"); owner != "" {
+		t.Fatalf("Owner() on a ring without points = %q, want none", owner)
+	}
+	if got := NewRing(DefaultVirtualNodes).Owners("key", 2); len(got) != 0 {
+		t.Fatalf("Owners() on an empty ring = %v, want none", got)
+	}
+
+	// A node without tokens is never an owner, and does not stall the walk.
+	r := NewRing(DefaultVirtualNodes)
+	r.SetTokens(map[string][]uint64{"a": nil, "b": Tokens("b", 4)})
+
+	if got := r.Owners("key", 2); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("Owners(key, 2) = %v, want only b", got)
+	}
+}
@@ -0,0 +1,81 @@
+package consensus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+	"github.com/hashicorp/raft"
+)
+
+// fsm applies committed batches of events to a State. Each log entry holds
+// one JSON-encoded batch, and its response is the error of every event.
+type fsm struct {
+	state State
+}
+
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var events []transcationlog.Event
+	if err := json.Unmarshal(l.Data, &events); err != nil {
+		return fmt.Errorf("cannot decode log entry %d: %w", l.Index, err)
+	}
+
+	errs := make([]error, len(events))
+	for i, e := range events {
+		e.Sequence = l.Index
+		errs[i] = f.state.Apply(e)
+	}
+
+	return errs
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return snapshot(f.state.Snapshot()), nil
+}
+
+// Restore replaces the state with a snapshot written by snapshot.Persist:
+// one JSON entry per line.
+func (f *fsm) Restore(r io.ReadCloser) error {
+	defer r.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	entries := make([]store.Entry, 0)
+
+	for dec.More() {
+		var e store.Entry
+		if err := dec.Decode(&e); err != nil {
+			return fmt.Errorf("cannot decode snapshot: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	f.state.Restore(entries)
+
+	return nil
+}
+
+type snapshot []store.Entry
+
+func (s snapshot) Persist(sink raft.SnapshotSink) error {
+	w := bufio.NewWriter(sink)
+	enc := json.NewEncoder(w)
+
+	for _, e := range s {
+		if err := enc.Encode(e); err != nil {
+			sink.Cancel()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s snapshot) Release() {}
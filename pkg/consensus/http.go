@@ -0,0 +1,92 @@
+package consensus
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Status describes a node's view of its group.
+type Status struct {
+	ID           string   `json:"id"`
+	State        string   `json:"state"`
+	Leader       string   `json:"leader,omitempty"`
+	Servers      []Server `json:"servers"`
+	CommitIndex  uint64   `json:"commit_index"`
+	AppliedIndex uint64   `json:"applied_index"`
+}
+
+func (n *Node) Status() (Status, error) {
+	servers, err := n.Servers()
+	if err != nil {
+		return Status{}, err
+	}
+
+	leader, _ := n.Leader()
+
+	return Status{
+		ID:           n.id,
+		State:        n.raft.State().String(),
+		Leader:       leader.ID,
+		Servers:      servers,
+		CommitIndex:  n.raft.CommitIndex(),
+		AppliedIndex: n.raft.AppliedIndex(),
+	}, nil
+}
+
+func (n *Node) StatusHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := n.Status()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// JoinHandler adds the server in the JSON body, e.g.
+// {"id": "node2", "address": "10.0.0.2:7000"}, as a voter.
+func (n *Node) JoinHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var s Server
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.ID == "" || s.Address == "" {
+			http.Error(w, "body must be {\"id\": ..., \"address\": ...}", http.StatusBadRequest)
+			return
+		}
+
+		writeResult(w, n.Join(s))
+	}
+}
+
+// LeaveHandler removes the server whose ID is in the JSON body.
+func (n *Node) LeaveHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var s Server
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.ID == "" {
+			http.Error(w, "body must be {\"id\": ...}", http.StatusBadRequest)
+			return
+		}
+
+		writeResult(w, n.Leave(s.ID))
+	}
+}
+
+func (n *Node) SnapshotHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, n.Snapshot())
+	}
+}
+
+func writeResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrNotLeader):
+		http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
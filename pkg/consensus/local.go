@@ -0,0 +1,131 @@
+package consensus
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// LocalCluster runs a group in one process over in-memory transports, each
+// node with its own MemoryState, e.g. to exercise elections, failover and
+// membership changes in tests.
+type LocalCluster struct {
+	Nodes      []*Node
+	States     []*MemoryState
+	transports []*raft.InmemTransport
+}
+
+func NewLocalCluster(size int) (*LocalCluster, error) {
+	c := &LocalCluster{}
+	servers := make([]Server, 0, size)
+
+	for i := 0; i < size; i++ {
+		if _, err := c.start(); err != nil {
+			c.Shutdown()
+			return nil, err
+		}
+		servers = append(servers, Server{ID: c.id(i), Address: string(c.transports[i].LocalAddr())})
+	}
+
+	if err := c.Nodes[0].Bootstrap(servers); err != nil {
+		c.Shutdown()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Add starts a new node and joins it to the group through the leader.
+func (c *LocalCluster) Add() (*Node, error) {
+	leader, err := c.Leader(5 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := c.start()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Nodes[i], leader.Join(Server{ID: c.id(i), Address: string(c.transports[i].LocalAddr())})
+}
+
+// Leader waits up to timeout for a node to become leader.
+func (c *LocalCluster) Leader(timeout time.Duration) (*Node, error) {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		for i, n := range c.Nodes {
+			if n.IsLeader() && c.connected(i) && n.ready.Load() {
+				return n, nil
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil, fmt.Errorf("no leader elected within %v", timeout)
+}
+
+// Isolate cuts node i off from every other node, as a network partition.
+func (c *LocalCluster) Isolate(i int) {
+	c.transports[i].DisconnectAll()
+	for j, t := range c.transports {
+		if j != i {
+			t.Disconnect(c.transports[i].LocalAddr())
+		}
+	}
+}
+
+// Heal reconnects node i to every other node.
+func (c *LocalCluster) Heal(i int) {
+	for j, t := range c.transports {
+		if j != i {
+			t.Connect(c.transports[i].LocalAddr(), c.transports[i])
+			c.transports[i].Connect(t.LocalAddr(), t)
+		}
+	}
+}
+
+func (c *LocalCluster) Shutdown() {
+	for _, n := range c.Nodes {
+		n.Shutdown()
+	}
+}
+
+func (c *LocalCluster) start() (int, error) {
+	i := len(c.Nodes)
+
+	_, transport := raft.NewInmemTransport("")
+	state := NewMemoryState()
+
+	cfg := raft.DefaultConfig()
+	cfg.HeartbeatTimeout = 50 * time.Millisecond
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+	cfg.CommitTimeout = 5 * time.Millisecond
+	cfg.TrailingLogs = 2 // so that nodes joining after a snapshot install it
+	cfg.LogLevel = "WARN"
+
+	n, err := NewNode(Config{ID: c.id(i), Transport: transport, State: state, Raft: cfg})
+	if err != nil {
+		return 0, err
+	}
+
+	c.Nodes = append(c.Nodes, n)
+	c.States = append(c.States, state)
+	c.transports = append(c.transports, transport)
+	c.Heal(i)
+
+	return i, nil
+}
+
+// connected reports whether node i can reach any other node; an isolated
+// leader keeps believing it leads until its lease runs out.
+func (c *LocalCluster) connected(i int) bool {
+	return len(c.Nodes) == 1 || c.Nodes[i].raft.VerifyLeader().Error() == nil
+}
+
+func (c *LocalCluster) id(i int) string {
+	return fmt.Sprintf("node%d", i)
+}
@@ -0,0 +1,187 @@
+package consensus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud_native/pkg/transcationlog"
+)
+
+const testTimeout = 5 * time.Second
+
+func newTestCluster(t *testing.T, size int) *LocalCluster {
+	t.Helper()
+
+	c, err := NewLocalCluster(size)
+	if err != nil {
+		t.Fatalf("NewLocalCluster(%d) = %v", size, err)
+	}
+	t.Cleanup(c.Shutdown)
+
+	return c
+}
+
+func leader(t *testing.T, c *LocalCluster) (*Node, int) {
+	t.Helper()
+
+	n, err := c.Leader(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, m := range c.Nodes {
+		if m == n {
+			return n, i
+		}
+	}
+
+	panic("leader is not a member")
+}
+
+func put(t *testing.T, n *Node, key, value string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	errs, err := n.Propose(ctx, []transcationlog.Event{{EventType: transcationlog.EventPut, Key: key, Value: value}})
+	if err == nil {
+		err = errors.Join(errs...)
+	}
+	if err != nil {
+		t.Fatalf("Propose(%s=%s) = %v", key, value, err)
+	}
+}
+
+// eventually waits for every state in states to hold key = value.
+func eventually(t *testing.T, states []*MemoryState, key, value string) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+
+	for i, s := range states {
+		for {
+			if e, err := s.Get(key); err == nil && e.Value == value {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("node %d does not have %s=%s", i, key, value)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestElectionAndReplication(t *testing.T) {
+	c := newTestCluster(t, 3)
+	n, _ := leader(t, c)
+
+	put(t, n, "a", "1")
+	eventually(t, c.States, "a", "1")
+}
+
+func TestFailover(t *testing.T) {
+	c := newTestCluster(t, 5)
+	old, i := leader(t, c)
+
+	put(t, old, "a", "1")
+	c.Isolate(i)
+
+	// The isolated leader may still believe it leads for a moment.
+	n, j := leader(t, c)
+	for deadline := time.Now().Add(testTimeout); j == i; n, j = leader(t, c) {
+		if time.Now().After(deadline) {
+			t.Fatal("the isolated node is still the leader")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	put(t, n, "a", "2")
+
+	// The isolated node cannot commit, nor serve reads.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := old.Propose(ctx, []transcationlog.Event{{EventType: transcationlog.EventPut, Key: "a", Value: "lost"}}); err == nil {
+		t.Fatal("Propose() on the isolated node succeeded")
+	}
+	if err := old.ReadIndex(ctx); err == nil {
+		t.Fatal("ReadIndex() on the isolated node succeeded")
+	}
+
+	c.Heal(i)
+	eventually(t, c.States, "a", "2")
+}
+
+func TestJoinLeave(t *testing.T) {
+	c := newTestCluster(t, 3)
+	n, _ := leader(t, c)
+	put(t, n, "a", "1")
+
+	added, err := c.Add()
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	eventually(t, c.States, "a", "1")
+
+	servers, _ := n.Servers()
+	if len(servers) != 4 {
+		t.Fatalf("Servers() after Add = %v, want 4", servers)
+	}
+
+	n, _ = leader(t, c)
+	if err = n.Leave(added.id); err != nil {
+		t.Fatalf("Leave(%s) = %v", added.id, err)
+	}
+
+	servers, _ = n.Servers()
+	if len(servers) != 3 {
+		t.Fatalf("Servers() after Leave = %v, want 3", servers)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	c := newTestCluster(t, 3)
+	n, _ := leader(t, c)
+
+	for i := range 10 {
+		put(t, n, fmt.Sprintf("k%d", i), fmt.Sprint(i))
+	}
+	if err := n.Snapshot(); err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+
+	// The log was compacted, so the new node installs the snapshot.
+	if _, err := c.Add(); err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+
+	for i := range 10 {
+		eventually(t, c.States[3:], fmt.Sprintf("k%d", i), fmt.Sprint(i))
+	}
+}
+
+func TestReadIndex(t *testing.T) {
+	c := newTestCluster(t, 3)
+	n, i := leader(t, c)
+
+	put(t, n, "a", "1")
+
+	e, err := n.Get(context.Background(), "a")
+	if err != nil || e.Value != "1" {
+		t.Fatalf("Get() on the leader = %q, %v, want 1", e.Value, err)
+	}
+
+	follower := c.Nodes[(i+1)%len(c.Nodes)]
+	if _, err = follower.Get(context.Background(), "a"); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("Get() on a follower = %v, want ErrNotLeader", err)
+	}
+}
+
+func TestShutdownTwice(t *testing.T) {
+	c := newTestCluster(t, 1)
+
+	c.Nodes[0].Shutdown()
+	c.Nodes[0].Shutdown()
+}
@@ -0,0 +1,310 @@
+package consensus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	retainSnapshots   = 2
+	readIndexInterval = time.Millisecond
+)
+
+var ErrNotLeader = errors.New("not the raft leader")
+
+// Config describes one member of a Raft group.
+type Config struct {
+	ID        string
+	Transport raft.Transport
+	State     State
+
+	// Dir holds the log and snapshots. Empty keeps them in memory, which
+	// loses everything when the node stops.
+	Dir string
+
+	// Raft overrides the default timeouts and snapshot thresholds; its
+	// LocalID is always set from ID.
+	Raft *raft.Config
+}
+
+// Server is a voting member of the group.
+type Server struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+// Node proposes writes to the group and applies them to its State once they
+// are committed.
+type Node struct {
+	id    string
+	raft  *raft.Raft
+	state State
+
+	// ready is set once the node, as leader, has committed an entry in its
+	// term; only then is its commit index safe to serve reads from.
+	ready atomic.Bool
+	done  chan struct{}
+	stop  sync.Once
+}
+
+func NewNode(cfg Config) (*Node, error) {
+	c := cfg.Raft
+	if c == nil {
+		c = raft.DefaultConfig()
+		c.LogLevel = "INFO"
+	}
+	c.LocalID = raft.ServerID(cfg.ID)
+
+	var logs raft.LogStore
+	var stable raft.StableStore
+	var snaps raft.SnapshotStore
+
+	if cfg.Dir == "" {
+		mem := raft.NewInmemStore()
+		logs, stable, snaps = mem, mem, raft.NewInmemSnapshotStore()
+	} else {
+		if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+			return nil, fmt.Errorf("cannot create raft directory: %w", err)
+		}
+
+		bolt, err := raftboltdb.NewBoltStore(filepath.Join(cfg.Dir, "raft.db"))
+		if err != nil {
+			return nil, fmt.Errorf("cannot open raft log: %w", err)
+		}
+		logs, stable = bolt, bolt
+
+		if snaps, err = raft.NewFileSnapshotStore(cfg.Dir, retainSnapshots, os.Stderr); err != nil {
+			return nil, fmt.Errorf("cannot open raft snapshots: %w", err)
+		}
+	}
+
+	r, err := raft.NewRaft(c, &fsm{state: cfg.State}, logs, stable, snaps, cfg.Transport)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start raft: %w", err)
+	}
+
+	n := &Node{id: cfg.ID, raft: r, state: cfg.State, done: make(chan struct{})}
+	go n.watchLeadership()
+
+	return n, nil
+}
+
+// Bootstrap forms a new group out of servers, which must include this node.
+// Every initial member may call it with the same servers; it is a no-op on a
+// node that already has state.
+func (n *Node) Bootstrap(servers []Server) error {
+	cfg := raft.Configuration{}
+	for _, s := range servers {
+		cfg.Servers = append(cfg.Servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(s.ID),
+			Address:  raft.ServerAddress(s.Address),
+		})
+	}
+
+	err := n.raft.BootstrapCluster(cfg).Error()
+	if errors.Is(err, raft.ErrCantBootstrap) {
+		return nil
+	}
+
+	return err
+}
+
+// Propose commits events and applies them. The first error reports whether
+// the batch was committed at all; the slice holds the error applying each
+// event, which is deterministic on every node. Events the state's limits
+// refuse are not proposed, and get the error checking them.
+func (n *Node) Propose(ctx context.Context, events []transcationlog.Event) ([]error, error) {
+	errs := n.state.Check(events)
+
+	accepted := make([]transcationlog.Event, 0, len(events))
+	for i, e := range events {
+		if errs[i] == nil {
+			accepted = append(accepted, e)
+		}
+	}
+
+	if len(accepted) == 0 {
+		return errs, nil
+	}
+
+	data, err := json.Marshal(accepted)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := timeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f := n.raft.Apply(data, d)
+	if err = f.Error(); err != nil {
+		return nil, leaderError(err)
+	}
+
+	switch resp := f.Response().(type) {
+	case []error:
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i], resp = resp[0], resp[1:]
+			}
+		}
+		return errs, nil
+	case error:
+		return nil, resp
+	}
+
+	return nil, fmt.Errorf("unexpected raft response %T", f.Response())
+}
+
+// ReadIndex blocks until the state reflects every write committed before it
+// was called, so that a read which follows is linearizable. Only the leader
+// can serve such reads.
+func (n *Node) ReadIndex(ctx context.Context) error {
+	if !n.ready.Load() {
+		return n.notLeader()
+	}
+
+	index := n.raft.CommitIndex()
+
+	// Confirm with a quorum that no newer leader has committed anything.
+	if err := n.raft.VerifyLeader().Error(); err != nil {
+		return leaderError(err)
+	}
+
+	ticker := time.NewTicker(readIndexInterval)
+	defer ticker.Stop()
+
+	for n.raft.AppliedIndex() < index {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// Get performs a linearizable read of key.
+func (n *Node) Get(ctx context.Context, key string) (store.Entry, error) {
+	if err := n.ReadIndex(ctx); err != nil {
+		return store.Entry{}, err
+	}
+
+	return n.state.Get(key)
+}
+
+// Join adds a voter, or updates its address. It must be called on the leader.
+func (n *Node) Join(s Server) error {
+	f := n.raft.AddVoter(raft.ServerID(s.ID), raft.ServerAddress(s.Address), 0, defaultTimeout)
+	return leaderError(f.Error())
+}
+
+// Leave removes a member. It must be called on the leader.
+func (n *Node) Leave(id string) error {
+	return leaderError(n.raft.RemoveServer(raft.ServerID(id), 0, defaultTimeout).Error())
+}
+
+// Snapshot compacts the log up to the last applied entry.
+func (n *Node) Snapshot() error {
+	return n.raft.Snapshot().Error()
+}
+
+// Servers returns the current members of the group.
+func (n *Node) Servers() ([]Server, error) {
+	f := n.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+
+	servers := make([]Server, 0)
+	for _, s := range f.Configuration().Servers {
+		servers = append(servers, Server{ID: string(s.ID), Address: string(s.Address)})
+	}
+
+	return servers, nil
+}
+
+// Leader returns the member that is currently leading, if known.
+func (n *Node) Leader() (Server, bool) {
+	addr, id := n.raft.LeaderWithID()
+	return Server{ID: string(id), Address: string(addr)}, id != ""
+}
+
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Shutdown stops the node; calling it again is a no-op.
+func (n *Node) Shutdown() error {
+	n.stop.Do(func() { close(n.done) })
+	return n.raft.Shutdown().Error()
+}
+
+// watchLeadership tracks whether the node may serve reads. A new leader
+// only knows its commit index is current once an entry of its own term is
+// committed, which the barrier waits for.
+func (n *Node) watchLeadership() {
+	for {
+		select {
+		case <-n.done:
+			return
+		case leader := <-n.raft.LeaderCh():
+			n.ready.Store(false)
+
+			if leader && n.raft.Barrier(defaultTimeout).Error() == nil {
+				n.ready.Store(n.IsLeader())
+			}
+		}
+	}
+}
+
+func (n *Node) notLeader() error {
+	if leader, ok := n.Leader(); ok {
+		return fmt.Errorf("%w, the leader is %s", ErrNotLeader, leader.ID)
+	}
+
+	return ErrNotLeader
+}
+
+// leaderError marks errors that mean the request must go to the leader. Losing
+// leadership mid-write is not one of them: the write may still be committed.
+func leaderError(err error) error {
+	if errors.Is(err, raft.ErrNotLeader) {
+		return fmt.Errorf("%w: %v", ErrNotLeader, err)
+	}
+
+	return err
+}
+
+// timeout returns how long ctx leaves to commit an entry, or its error if
+// its deadline has already passed.
+func timeout(ctx context.Context) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultTimeout, nil
+	}
+
+	d := time.Until(deadline)
+	if d <= 0 {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+
+	return d, nil
+}
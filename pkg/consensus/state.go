@@ -0,0 +1,127 @@
+package consensus
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"cloud_native/pkg/crdt"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+// State is what committed events are applied to. A server applies them to
+// pkg/store; nodes sharing a process each need their own, e.g. MemoryState.
+//
+// The leader checks events against its limits before proposing them; once
+// committed, they are applied without any, so that every node ends up with
+// the same state whatever its limits or the order its entries expire in.
+type State interface {
+	Check(events []transcationlog.Event) []error
+	Apply(e transcationlog.Event) error
+	Get(key string) (store.Entry, error)
+	Snapshot() []store.Entry
+	Restore(entries []store.Entry)
+}
+
+// StoreState applies events to the process-wide pkg/store.
+type StoreState struct{}
+
+func (StoreState) Check(events []transcationlog.Event) []error { return transcationlog.Check(events) }
+func (StoreState) Apply(e transcationlog.Event) error          { return transcationlog.Apply(e) }
+func (StoreState) Get(key string) (store.Entry, error)         { return store.GetEntry(key) }
+func (StoreState) Snapshot() []store.Entry                     { return store.Snapshot() }
+func (StoreState) Restore(entries []store.Entry)               { store.Restore(entries) }
+
+// MemoryState is a State private to one node, for running several nodes in
+// one process. It ignores the store's size limits.
+type MemoryState struct {
+	m       sync.RWMutex
+	entries map[string]store.Entry
+}
+
+func NewMemoryState() *MemoryState {
+	return &MemoryState{entries: make(map[string]store.Entry)}
+}
+
+func (s *MemoryState) Check(events []transcationlog.Event) []error {
+	return make([]error, len(events))
+}
+
+func (s *MemoryState) Apply(e transcationlog.Event) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	entry, ok := s.entries[e.Key]
+
+	switch e.EventType {
+	case transcationlog.EventPut:
+		s.entries[e.Key] = store.Entry{Key: e.Key, Value: e.Value, Version: e.Sequence}
+	case transcationlog.EventDelete:
+		delete(s.entries, e.Key)
+	case transcationlog.EventExpire:
+		at, err := e.ExpiresAt()
+		if err != nil || !ok {
+			return err
+		}
+		entry.ExpiresAt = at
+		s.entries[e.Key] = entry
+	case transcationlog.EventFlags:
+		flags, err := e.Flags()
+		if err != nil || !ok {
+			return err
+		}
+		entry.Flags = flags
+		s.entries[e.Key] = entry
+	case transcationlog.EventMerge:
+		if ok && !entry.CRDT {
+			return crdt.ErrNotCRDT
+		}
+
+		value := e.Value
+		if ok {
+			var err error
+			if value, err = crdt.MergeEncoded(entry.Value, e.Value); err != nil {
+				return err
+			}
+		}
+		s.entries[e.Key] = store.Entry{Key: e.Key, Value: value, Version: e.Sequence, CRDT: true}
+	}
+
+	return nil
+}
+
+func (s *MemoryState) Get(key string) (store.Entry, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	e, ok := s.entries[key]
+	if !ok || (!e.ExpiresAt.IsZero() && !time.Now().Before(e.ExpiresAt)) {
+		return store.Entry{}, store.ErrNoSuchKey
+	}
+
+	return e, nil
+}
+
+func (s *MemoryState) Snapshot() []store.Entry {
+	s.m.RLock()
+	entries := make([]store.Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	s.m.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	return entries
+}
+
+func (s *MemoryState) Restore(entries []store.Entry) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.entries = make(map[string]store.Entry, len(entries))
+	for _, e := range entries {
+		s.entries[e.Key] = e
+	}
+}
@@ -0,0 +1,174 @@
+package consensus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud_native/pkg/crdt"
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+	"github.com/hashicorp/raft"
+)
+
+// resetStore empties the store and sets l until the test ends. The store is
+// global, so tests using it must not run in parallel.
+func resetStore(t *testing.T, l store.Limits) {
+	t.Helper()
+
+	store.Restore(nil)
+	store.SetLimits(l)
+
+	t.Cleanup(func() {
+		store.Restore(nil)
+		store.SetLimits(store.Limits{MaxKeyLength: store.DefaultMaxKeyLength, MaxValueSize: store.DefaultMaxValueSize})
+	})
+}
+
+// TestStoreStateIgnoresLimits applies the same committed entries to two
+// StoreStates with different limits and checks they end up alike.
+func TestStoreStateIgnoresLimits(t *testing.T) {
+	counter, err := crdt.New(crdt.TypeGCounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (crdt.Op{Op: "increment", Amount: 3}).Apply(counter, "r1", 1); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := crdt.Encode(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := transcationlog.ExpireEvent("a", time.Now().Add(-time.Second), "")
+
+	batches := [][]transcationlog.Event{
+		{{EventType: transcationlog.EventPut, Key: "a", Value: "1"}, past},
+		{{EventType: transcationlog.EventPut, Key: "long key", Value: "a long value"}},
+		{{EventType: transcationlog.EventPut, Key: "b", Value: "22"}, {EventType: transcationlog.EventMerge, Key: "c", Value: merge}},
+		{{EventType: transcationlog.EventPut, Key: "d", Value: "4444", Stamp: 7}},
+	}
+
+	apply := func(l store.Limits) string {
+		resetStore(t, l)
+
+		f := &fsm{state: StoreState{}}
+		for i, batch := range batches {
+			data, err := json.Marshal(batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp := f.Apply(&raft.Log{Index: uint64(i + 1), Data: data})
+			if err := errors.Join(resp.([]error)...); err != nil {
+				t.Fatalf("applying entry %d under %+v = %v", i+1, l, err)
+			}
+		}
+
+		// Versions are store revisions, which a restore does not reset.
+		entries := f.state.Snapshot()
+		for i := range entries {
+			entries[i].Version = 0
+		}
+
+		return fmt.Sprintf("%+v", entries)
+	}
+
+	unlimited := apply(store.Limits{})
+	limited := apply(store.Limits{MaxKeyLength: 2, MaxValueSize: 2, MaxStoreSize: 8})
+
+	if unlimited != limited {
+		t.Fatalf("the limits changed the state:\n%s\n%s", unlimited, limited)
+	}
+}
+
+func TestStoreStateCheck(t *testing.T) {
+	resetStore(t, store.Limits{MaxKeyLength: 4, MaxValueSize: 4, MaxStoreSize: 8})
+
+	if err := store.Put("a", "123"); err != nil {
+		t.Fatal(err)
+	}
+
+	events := []transcationlog.Event{
+		{EventType: transcationlog.EventPut, Key: "long key", Value: "v"},
+		{EventType: transcationlog.EventPut, Key: "b", Value: "large"},
+		{EventType: transcationlog.EventPut, Key: "b", Value: "1"},
+		{EventType: transcationlog.EventExpire, Key: "b"},
+		// The store holds 6 of its 8 bytes once b is written.
+		{EventType: transcationlog.EventMerge, Key: "c", Value: "12"},
+		{EventType: transcationlog.EventDelete, Key: "a"},
+		{EventType: transcationlog.EventPut, Key: "c", Value: "12"},
+	}
+	want := []error{store.ErrKeyTooLong, store.ErrValueTooLarge, nil, nil, store.ErrStoreFull, nil, nil}
+
+	errs := StoreState{}.Check(events)
+	for i := range events {
+		if !errors.Is(errs[i], want[i]) || (want[i] == nil && errs[i] != nil) {
+			t.Fatalf("Check() = %v, want %v", errs, want)
+		}
+	}
+
+	// Checking writes nothing.
+	if _, err := store.Get("b"); !errors.Is(err, store.ErrNoSuchKey) {
+		t.Fatalf("Get(b) after Check() = %v, want ErrNoSuchKey", err)
+	}
+}
+
+// TestProposeChecksFirst checks that the leader refuses writes over its
+// limits without committing them.
+func TestProposeChecksFirst(t *testing.T) {
+	resetStore(t, store.Limits{MaxValueSize: 2})
+
+	_, transport := raft.NewInmemTransport("")
+
+	cfg := raft.DefaultConfig()
+	cfg.HeartbeatTimeout = 50 * time.Millisecond
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+	cfg.LogLevel = "WARN"
+
+	n, err := NewNode(Config{ID: "node0", Transport: transport, State: StoreState{}, Raft: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Shutdown() })
+
+	if err = n.Bootstrap([]Server{{ID: "node0", Address: string(transport.LocalAddr())}}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(testTimeout)
+	for !n.ready.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("the node did not become leader")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	errs, err := n.Propose(ctx, []transcationlog.Event{
+		{EventType: transcationlog.EventPut, Key: "a", Value: "too large"},
+		{EventType: transcationlog.EventPut, Key: "b", Value: "ok"},
+	})
+	if err != nil || len(errs) != 2 || !errors.Is(errs[0], store.ErrValueTooLarge) || errs[1] != nil {
+		t.Fatalf("Propose() = %v, %v, want the first put refused", errs, err)
+	}
+	if v, err := store.Get("b"); v != "ok" || err != nil {
+		t.Fatalf("Get(b) = %q, %v, want the accepted put committed", v, err)
+	}
+	if _, err := store.Get("a"); !errors.Is(err, store.ErrNoSuchKey) {
+		t.Fatalf("Get(a) = %v, want the refused put not committed", err)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	if _, err = n.Propose(expired, []transcationlog.Event{{EventType: transcationlog.EventPut, Key: "c", Value: "ok"}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Propose() past its deadline = %v, want DeadlineExceeded", err)
+	}
+}
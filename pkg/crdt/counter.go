@@ -0,0 +1,66 @@
+package crdt
+
+// GCounter is a grow-only counter. Each replica counts its own increments;
+// merging keeps the highest count seen from each.
+type GCounter struct {
+	Counts map[string]uint64 `json:"counts"`
+}
+
+func (g *GCounter) Type() Type { return TypeGCounter }
+func (g *GCounter) Value() any { return g.Sum() }
+
+func (g *GCounter) Sum() uint64 {
+	var sum uint64
+	for _, n := range g.Counts {
+		sum += n
+	}
+
+	return sum
+}
+
+func (g *GCounter) Increment(replica string, n uint64) {
+	if g.Counts == nil {
+		g.Counts = make(map[string]uint64)
+	}
+
+	g.Counts[replica] += n
+}
+
+func (g *GCounter) merge(other CRDT) {
+	for replica, n := range other.(*GCounter).Counts {
+		if g.Counts == nil {
+			g.Counts = make(map[string]uint64)
+		}
+
+		g.Counts[replica] = max(g.Counts[replica], n)
+	}
+}
+
+// PNCounter is a counter that also decrements, as the difference of two
+// grow-only counters.
+type PNCounter struct {
+	P GCounter `json:"p"`
+	N GCounter `json:"n"`
+}
+
+func (c *PNCounter) Type() Type { return TypePNCounter }
+func (c *PNCounter) Value() any { return c.Sum() }
+
+func (c *PNCounter) Sum() int64 {
+	return int64(c.P.Sum() - c.N.Sum())
+}
+
+func (c *PNCounter) Add(replica string, delta int64) {
+	if delta >= 0 {
+		c.P.Increment(replica, uint64(delta))
+	} else {
+		c.N.Increment(replica, uint64(-delta))
+	}
+}
+
+func (c *PNCounter) merge(other CRDT) {
+	o := other.(*PNCounter)
+
+	c.P.merge(&o.P)
+	c.N.merge(&o.N)
+}
@@ -0,0 +1,125 @@
+// Package crdt implements conflict-free replicated data types: values that
+// replicas update independently and that converge once every replica has
+// merged the others' states, whatever the order.
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type Type string
+
+const (
+	TypeGCounter    Type = "g-counter"
+	TypePNCounter   Type = "pn-counter"
+	TypeLWWRegister Type = "lww-register"
+	TypeORSet       Type = "or-set"
+	TypeLWWMap      Type = "lww-map"
+)
+
+var (
+	ErrUnknownType  = errors.New("unknown CRDT type")
+	ErrTypeMismatch = errors.New("CRDT type mismatch")
+	ErrUnknownOp    = errors.New("unknown CRDT operation")
+	ErrInvalidOp    = errors.New("invalid CRDT operation")
+	ErrNotCRDT      = errors.New("value is not a CRDT")
+)
+
+// CRDT is the state of a replicated value. Merging is commutative,
+// associative and idempotent.
+type CRDT interface {
+	Type() Type
+
+	// Value returns what the state reads as, e.g. the sum of a counter.
+	Value() any
+
+	// merge folds other, of the same type, into the state.
+	merge(other CRDT)
+}
+
+// New returns the empty state of a CRDT of type t.
+func New(t Type) (CRDT, error) {
+	switch t {
+	case TypeGCounter:
+		return &GCounter{}, nil
+	case TypePNCounter:
+		return &PNCounter{}, nil
+	case TypeLWWRegister:
+		return &LWWRegister{}, nil
+	case TypeORSet:
+		return &ORSet{}, nil
+	case TypeLWWMap:
+		return &LWWMap{}, nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownType, t)
+}
+
+// Merge folds other into c.
+func Merge(c, other CRDT) error {
+	if c.Type() != other.Type() {
+		return fmt.Errorf("%w: cannot merge %s into %s", ErrTypeMismatch, other.Type(), c.Type())
+	}
+
+	c.merge(other)
+
+	return nil
+}
+
+type envelope struct {
+	Type  Type            `json:"type"`
+	State json.RawMessage `json:"state"`
+}
+
+// Encode returns the state of c as stored under a key. The encoding is
+// deterministic, so equal states encode the same.
+func Encode(c CRDT) (string, error) {
+	state, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(envelope{Type: c.Type(), State: state})
+
+	return string(data), err
+}
+
+// Decode parses a state returned by Encode.
+func Decode(s string) (CRDT, error) {
+	var env envelope
+	if err := json.Unmarshal([]byte(s), &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotCRDT, err)
+	}
+
+	c, err := New(env.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(env.State, c); err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", env.Type, err)
+	}
+
+	return c, nil
+}
+
+// MergeEncoded merges two encoded states into one.
+func MergeEncoded(a, b string) (string, error) {
+	c, err := Decode(a)
+	if err != nil {
+		return "", err
+	}
+
+	other, err := Decode(b)
+	if err != nil {
+		return "", err
+	}
+
+	if err := Merge(c, other); err != nil {
+		return "", err
+	}
+
+	return Encode(c)
+}
@@ -0,0 +1,235 @@
+package crdt
+
+import (
+	"fmt"
+	"testing"
+)
+
+// update is an op applied by a replica at a time.
+type update struct {
+	op      Op
+	replica string
+	now     uint64
+}
+
+// apply returns a copy of c with the updates applied.
+func apply(t *testing.T, c CRDT, updates ...update) CRDT {
+	t.Helper()
+
+	c = clone(t, c)
+	for _, u := range updates {
+		if err := u.op.Apply(c, u.replica, u.now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return c
+}
+
+func clone(t *testing.T, c CRDT) CRDT {
+	t.Helper()
+
+	c, err := Decode(encode(t, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func encode(t *testing.T, c CRDT) string {
+	t.Helper()
+
+	s, err := Encode(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// mergeAll returns a copy of the first state with the others merged into it,
+// in order.
+func mergeAll(t *testing.T, states ...CRDT) CRDT {
+	t.Helper()
+
+	c := clone(t, states[0])
+	for _, s := range states[1:] {
+		if err := Merge(c, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return c
+}
+
+func newCRDT(t *testing.T, typ Type) CRDT {
+	t.Helper()
+
+	c, err := New(typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// TestMergeConverges updates three replicas of each type concurrently and
+// checks that they converge to the same state whatever order and grouping
+// they merge in, and however often.
+func TestMergeConverges(t *testing.T) {
+	tests := []struct {
+		typ      Type
+		base     []update
+		replicas [3][]update
+		want     string
+	}{
+		{
+			typ: TypeGCounter,
+			replicas: [3][]update{
+				{{Op{Op: "increment", Amount: 3}, "r1", 1}},
+				{{Op{Op: "increment", Amount: 5}, "r2", 1}},
+				{{Op{Op: "increment"}, "r1", 1}, {Op{Op: "increment", Amount: 2}, "r3", 1}},
+			},
+			want: "10",
+		},
+		{
+			typ: TypePNCounter,
+			replicas: [3][]update{
+				{{Op{Op: "increment", Amount: 3}, "r1", 1}},
+				{{Op{Op: "decrement", Amount: 5}, "r2", 1}},
+				{{Op{Op: "increment"}, "r1", 1}, {Op{Op: "decrement", Amount: 2}, "r2", 1}},
+			},
+			want: "-2",
+		},
+		{
+			typ: TypeLWWRegister,
+			replicas: [3][]update{
+				{{Op{Op: "set", Value: "a"}, "r1", 1}},
+				{{Op{Op: "set", Value: "b"}, "r2", 2}},
+				{{Op{Op: "set", Value: "c"}, "r3", 2}},
+			},
+			want: "c",
+		},
+		{
+			typ:  TypeORSet,
+			base: []update{{Op{Op: "add", Element: "x"}, "r1", 1}},
+			replicas: [3][]update{
+				{{Op{Op: "remove", Element: "x"}, "r1", 2}},
+				{{Op{Op: "add", Element: "x"}, "r2", 2}},
+				{{Op{Op: "add", Element: "y"}, "r3", 2}, {Op{Op: "add", Element: "z"}, "r3", 3}, {Op{Op: "remove", Element: "z"}, "r3", 4}},
+			},
+			want: "[x y]",
+		},
+		{
+			typ: TypeLWWMap,
+			replicas: [3][]update{
+				{{Op{Op: "set", Field: "f", Value: "1"}, "r1", 1}},
+				{{Op{Op: "set", Field: "f", Value: "2"}, "r2", 2}, {Op{Op: "delete", Field: "g"}, "r2", 3}},
+				{{Op{Op: "set", Field: "g", Value: "3"}, "r3", 2}, {Op{Op: "delete", Field: "f"}, "r1", 2}},
+			},
+			want: "map[f:2]",
+		},
+	}
+
+	for _, tt := range tests {
+		base := apply(t, newCRDT(t, tt.typ), tt.base...)
+		a, b, c := apply(t, base, tt.replicas[0]...), apply(t, base, tt.replicas[1]...), apply(t, base, tt.replicas[2]...)
+
+		if ab, ba := encode(t, mergeAll(t, a, b)), encode(t, mergeAll(t, b, a)); ab != ba {
+			t.Errorf("%s: merge is not commutative:\n%s\n%s", tt.typ, ab, ba)
+		}
+
+		left := encode(t, mergeAll(t, mergeAll(t, a, b), c))
+		right := encode(t, mergeAll(t, a, mergeAll(t, b, c)))
+		if left != right {
+			t.Errorf("%s: merge is not associative:\n%s\n%s", tt.typ, left, right)
+		}
+
+		for _, s := range []CRDT{a, b, c, mergeAll(t, a, b, c)} {
+			if once, twice := encode(t, s), encode(t, mergeAll(t, s, s)); once != twice {
+				t.Errorf("%s: merge is not idempotent:\n%s\n%s", tt.typ, once, twice)
+			}
+		}
+
+		// Every order of the three replicas ends in the same state.
+		orders := [][3]CRDT{{a, b, c}, {a, c, b}, {b, a, c}, {b, c, a}, {c, a, b}, {c, b, a}}
+		for _, o := range orders {
+			if got := encode(t, mergeAll(t, o[0], o[1], o[2])); got != left {
+				t.Errorf("%s: merging in another order gives\n%s\nnot\n%s", tt.typ, got, left)
+			}
+		}
+
+		if got := fmt.Sprint(mergeAll(t, a, b, c).Value()); got != tt.want {
+			t.Errorf("%s: merged value = %s, want %s", tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestMergeTypeMismatch(t *testing.T) {
+	if err := Merge(newCRDT(t, TypeGCounter), newCRDT(t, TypePNCounter)); err == nil {
+		t.Fatal("Merge() of a pn-counter into a g-counter succeeded")
+	}
+}
+
+func TestORSetAddWins(t *testing.T) {
+	base := apply(t, newCRDT(t, TypeORSet), update{Op{Op: "add", Element: "x"}, "r1", 1})
+
+	removed := apply(t, base, update{Op{Op: "remove", Element: "x"}, "r1", 2})
+	readded := apply(t, base, update{Op{Op: "add", Element: "x"}, "r2", 2})
+
+	// The remove did not see the concurrent add, so the element stays.
+	for _, s := range []CRDT{mergeAll(t, removed, readded), mergeAll(t, readded, removed)} {
+		if !s.(*ORSet).Contains("x") {
+			t.Fatalf("x was removed by a remove concurrent with its add: %s", encode(t, s))
+		}
+	}
+
+	// A remove that saw every add removes the element, even merged with the
+	// older states.
+	removedAll := apply(t, mergeAll(t, removed, readded), update{Op{Op: "remove", Element: "x"}, "r1", 3})
+	for _, s := range []CRDT{mergeAll(t, removedAll, base, readded), mergeAll(t, base, readded, removedAll)} {
+		if s.(*ORSet).Contains("x") {
+			t.Fatalf("x is back after a remove that saw every add: %s", encode(t, s))
+		}
+	}
+
+	// A tag once removed cannot be added again.
+	if s := apply(t, removedAll, update{Op{Op: "add", Element: "x"}, "r2", 2}); s.(*ORSet).Contains("x") {
+		t.Fatal("re-adding a removed tag brought x back")
+	}
+}
+
+func TestLWWTieBreak(t *testing.T) {
+	// Equal stamps are ordered by replica, then by value.
+	tests := []struct {
+		a, b update
+		want string
+	}{
+		{update{Op{Op: "set", Value: "a"}, "r1", 5}, update{Op{Op: "set", Value: "b"}, "r2", 5}, "b"},
+		{update{Op{Op: "set", Value: "b"}, "r1", 5}, update{Op{Op: "set", Value: "a"}, "r2", 5}, "a"},
+		{update{Op{Op: "set", Value: "a"}, "r1", 5}, update{Op{Op: "set", Value: "b"}, "r1", 5}, "b"},
+		{update{Op{Op: "set", Value: "b"}, "r2", 6}, update{Op{Op: "set", Value: "a"}, "r1", 5}, "b"},
+	}
+
+	for _, tt := range tests {
+		a := apply(t, newCRDT(t, TypeLWWRegister), tt.a)
+		b := apply(t, newCRDT(t, TypeLWWRegister), tt.b)
+
+		for _, s := range []CRDT{mergeAll(t, a, b), mergeAll(t, b, a)} {
+			if got := s.Value(); got != tt.want {
+				t.Errorf("merging %+v and %+v = %v, want %s", tt.a, tt.b, got, tt.want)
+			}
+		}
+	}
+
+	// In a map, a delete wins over a write with the same stamp and replica.
+	set := apply(t, newCRDT(t, TypeLWWMap), update{Op{Op: "set", Field: "f"}, "r1", 5})
+	deleted := apply(t, newCRDT(t, TypeLWWMap), update{Op{Op: "delete", Field: "f"}, "r1", 5})
+
+	for _, s := range []CRDT{mergeAll(t, set, deleted), mergeAll(t, deleted, set)} {
+		if got := fmt.Sprint(s.Value()); got != "map[]" {
+			t.Errorf("merging a set and a delete with the same stamp = %s, want the delete", got)
+		}
+	}
+}
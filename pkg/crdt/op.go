@@ -0,0 +1,87 @@
+package crdt
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Op is an update to a CRDT, as sent by clients:
+//
+//	g-counter:    {"op": "increment", "amount": 2}
+//	pn-counter:   {"op": "increment" | "decrement", "amount": 2}
+//	lww-register: {"op": "set", "value": "v"}
+//	or-set:       {"op": "add" | "remove", "element": "e"}
+//	lww-map:      {"op": "set", "field": "f", "value": "v"} or {"op": "delete", "field": "f"}
+//
+// Type creates the CRDT if the key does not hold one yet. Amount defaults
+// to 1.
+type Op struct {
+	Type    Type   `json:"type,omitempty"`
+	Op      string `json:"op"`
+	Amount  int64  `json:"amount,omitempty"`
+	Element string `json:"element,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Value   string `json:"value,omitempty"`
+}
+
+// Apply performs o on c as replica, at time now, which orders the writes of
+// last-writer-wins types and must increase with every call on a replica.
+func (o Op) Apply(c CRDT, replica string, now uint64) error {
+	if o.Type != "" && o.Type != c.Type() {
+		return fmt.Errorf("%w: key holds a %s CRDT, not %s", ErrTypeMismatch, c.Type(), o.Type)
+	}
+
+	amount := o.Amount
+	if amount == 0 {
+		amount = 1
+	}
+
+	switch c := c.(type) {
+	case *GCounter:
+		if o.Op == "increment" {
+			if amount < 0 {
+				return fmt.Errorf("%w: a g-counter only grows", ErrInvalidOp)
+			}
+			c.Increment(replica, uint64(amount))
+			return nil
+		}
+	case *PNCounter:
+		switch o.Op {
+		case "increment":
+			c.Add(replica, amount)
+			return nil
+		case "decrement":
+			c.Add(replica, -amount)
+			return nil
+		}
+	case *LWWRegister:
+		if o.Op == "set" {
+			c.Set(o.Value, replica, now)
+			return nil
+		}
+	case *ORSet:
+		switch o.Op {
+		case "add":
+			c.Add(o.Element, replica+"/"+strconv.FormatUint(now, 10))
+			return nil
+		case "remove":
+			c.Remove(o.Element)
+			return nil
+		}
+	case *LWWMap:
+		if o.Field == "" {
+			return fmt.Errorf("%w: missing field", ErrInvalidOp)
+		}
+
+		switch o.Op {
+		case "set":
+			c.Set(o.Field, o.Value, replica, now)
+			return nil
+		case "delete":
+			c.Delete(o.Field, replica, now)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w %q on a %s", ErrUnknownOp, o.Op, c.Type())
+}
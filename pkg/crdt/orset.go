@@ -0,0 +1,87 @@
+package crdt
+
+import "sort"
+
+// ORSet is an observed-remove set. Every add tags the element with a unique
+// tag, and a remove only removes the tags it has seen, so an add concurrent
+// with a remove wins. Removed tags are kept to cancel them out in merges.
+type ORSet struct {
+	Adds    map[string]map[string]bool `json:"adds"`
+	Removed map[string]bool            `json:"removed"`
+}
+
+func (s *ORSet) Type() Type { return TypeORSet }
+
+func (s *ORSet) Value() any {
+	elements := make([]string, 0, len(s.Adds))
+	for e := range s.Adds {
+		elements = append(elements, e)
+	}
+
+	sort.Strings(elements)
+
+	return elements
+}
+
+func (s *ORSet) Contains(element string) bool {
+	return len(s.Adds[element]) > 0
+}
+
+// Add adds element with tag, which must be unique across replicas.
+func (s *ORSet) Add(element, tag string) {
+	if s.Removed[tag] {
+		return
+	}
+
+	if s.Adds == nil {
+		s.Adds = make(map[string]map[string]bool)
+	}
+
+	if s.Adds[element] == nil {
+		s.Adds[element] = make(map[string]bool)
+	}
+
+	s.Adds[element][tag] = true
+}
+
+func (s *ORSet) Remove(element string) {
+	for tag := range s.Adds[element] {
+		s.remove(tag)
+	}
+
+	delete(s.Adds, element)
+}
+
+func (s *ORSet) remove(tag string) {
+	if s.Removed == nil {
+		s.Removed = make(map[string]bool)
+	}
+
+	s.Removed[tag] = true
+}
+
+func (s *ORSet) merge(other CRDT) {
+	o := other.(*ORSet)
+
+	for tag := range o.Removed {
+		s.remove(tag)
+	}
+
+	for element, tags := range o.Adds {
+		for tag := range tags {
+			s.Add(element, tag)
+		}
+	}
+
+	for element, tags := range s.Adds {
+		for tag := range tags {
+			if s.Removed[tag] {
+				delete(tags, tag)
+			}
+		}
+
+		if len(tags) == 0 {
+			delete(s.Adds, element)
+		}
+	}
+}
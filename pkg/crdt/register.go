@@ -0,0 +1,100 @@
+package crdt
+
+import (
+	"cmp"
+	"strings"
+)
+
+// LWWRegister holds the value of the last write, ordered by stamp, then by
+// replica to break ties.
+type LWWRegister struct {
+	Data    string `json:"value"`
+	Stamp   uint64 `json:"stamp"`
+	Replica string `json:"replica"`
+}
+
+func (r *LWWRegister) Type() Type { return TypeLWWRegister }
+func (r *LWWRegister) Value() any { return r.Data }
+
+func (r *LWWRegister) Set(value, replica string, stamp uint64) {
+	r.merge(&LWWRegister{Data: value, Stamp: stamp, Replica: replica})
+}
+
+func (r *LWWRegister) merge(other CRDT) {
+	if o := other.(*LWWRegister); r.compare(*o) < 0 {
+		*r = *o
+	}
+}
+
+func (r LWWRegister) compare(o LWWRegister) int {
+	return cmp.Or(
+		cmp.Compare(r.Stamp, o.Stamp),
+		strings.Compare(r.Replica, o.Replica),
+		strings.Compare(r.Data, o.Data),
+	)
+}
+
+// LWWMap is a map whose fields are last-writer-wins registers. A deleted
+// field keeps its stamp, so that older writes to it lose.
+type LWWMap struct {
+	Fields map[string]mapField `json:"fields"`
+}
+
+type mapField struct {
+	LWWRegister
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+func (m *LWWMap) Type() Type { return TypeLWWMap }
+
+func (m *LWWMap) Value() any {
+	fields := make(map[string]string, len(m.Fields))
+	for name, f := range m.Fields {
+		if !f.Deleted {
+			fields[name] = f.Data
+		}
+	}
+
+	return fields
+}
+
+func (m *LWWMap) Set(field, value, replica string, stamp uint64) {
+	m.set(field, mapField{LWWRegister: LWWRegister{Data: value, Stamp: stamp, Replica: replica}})
+}
+
+func (m *LWWMap) Delete(field, replica string, stamp uint64) {
+	m.set(field, mapField{LWWRegister: LWWRegister{Stamp: stamp, Replica: replica}, Deleted: true})
+}
+
+func (m *LWWMap) set(name string, f mapField) {
+	if m.Fields == nil {
+		m.Fields = make(map[string]mapField)
+	}
+
+	old, ok := m.Fields[name]
+	if !ok || old.compare(f) < 0 {
+		m.Fields[name] = f
+	}
+}
+
+func (m *LWWMap) merge(other CRDT) {
+	for name, f := range other.(*LWWMap).Fields {
+		m.set(name, f)
+	}
+}
+
+func (f mapField) compare(o mapField) int {
+	if c := f.LWWRegister.compare(o.LWWRegister); c != 0 {
+		return c
+	}
+
+	// A deletion and a write with the same stamp: the deletion wins.
+	switch {
+	case f.Deleted == o.Deleted:
+		return 0
+	case f.Deleted:
+		return 1
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,103 @@
+package crdt
+
+import (
+	"fmt"
+
+	"cloud_native/pkg/store"
+)
+
+// Load returns the CRDT stored at key.
+func Load(key string) (CRDT, error) {
+	e, err := store.GetEntry(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.CRDT {
+		return nil, ErrNotCRDT
+	}
+
+	return Decode(e.Value)
+}
+
+// Update atomically applies o to the CRDT at key, creating it from o.Type if
+// the key is absent, and returns the new state.
+func Update(key string, o Op, replica string, now uint64) (CRDT, error) {
+	var c CRDT
+
+	_, _, err := store.Update(key, func(e store.Entry, ok bool) (store.Entry, bool, error) {
+		var err error
+
+		switch {
+		case ok && !e.CRDT:
+			return e, false, ErrNotCRDT
+		case ok:
+			c, err = Decode(e.Value)
+		case o.Type == "":
+			return e, false, fmt.Errorf("%w: missing type for a new key", ErrInvalidOp)
+		default:
+			c, err = New(o.Type)
+		}
+		if err != nil {
+			return e, false, err
+		}
+
+		if err = o.Apply(c, replica, now); err != nil {
+			return e, false, err
+		}
+
+		e.Value, err = Encode(c)
+		e.CRDT = true
+
+		return e, err == nil, err
+	})
+
+	return c, err
+}
+
+// MergeInto atomically merges c into the CRDT at key and returns the merged
+// state and whether it changed. Stamp orders the merge against plain writes
+// and deletions of the key, when replicated by quorum: it is ignored if the
+// key was last written or deleted with a newer stamp, and it replaces a plain
+// value with an older one. Without a stamp, a plain value is not replaced
+// but fails with ErrNotCRDT, as with Update. The merged state must fit in l.
+func MergeInto(l store.Limits, key string, c CRDT, stamp uint64) (CRDT, bool, error) {
+	merged := c
+
+	_, changed, err := l.Update(key, func(e store.Entry, ok bool) (store.Entry, bool, error) {
+		if ok && !e.CRDT && stamp == 0 {
+			return e, false, ErrNotCRDT
+		}
+
+		if !ok || !e.CRDT {
+			if stamp != 0 && e.Stamp >= stamp {
+				return e, false, nil
+			}
+
+			value, err := Encode(c)
+			return store.Entry{Value: value, CRDT: true, Stamp: stamp}, true, err
+		}
+
+		local, err := Decode(e.Value)
+		if err != nil {
+			return e, false, err
+		}
+
+		if err = Merge(local, c); err != nil {
+			return e, false, err
+		}
+		merged = local
+
+		value, err := Encode(local)
+		if err != nil || value == e.Value {
+			return e, false, err
+		}
+
+		e.Value = value
+		e.Stamp = max(e.Stamp, stamp)
+
+		return e, true, nil
+	})
+
+	return merged, changed, err
+}
@@ -0,0 +1,262 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+var errCompacted = errors.New("leader compacted past the follower's sequence")
+
+// Status describes how far a follower is behind its leader.
+type Status struct {
+	Role           string        `json:"role"`
+	Leader         string        `json:"leader"`
+	Connected      bool          `json:"connected"`
+	LastApplied    uint64        `json:"last_applied"`
+	LeaderSequence uint64        `json:"leader_sequence"`
+	LagEvents      uint64        `json:"lag_events"`
+	Lag            time.Duration `json:"lag_ns"`
+	LastContact    time.Time     `json:"last_contact"`
+}
+
+// Follower streams the leader's transaction log into the local store. It
+// resumes from its last applied sequence after a disconnect, and installs a
+// snapshot when the leader no longer has the events it needs.
+//
+// A follower keeps nothing on disk: its store is in memory, so its last
+// applied sequence is too. A restarted follower starts empty from sequence
+// 0, and re-bootstraps unless the leader's backlog still reaches back there.
+type Follower struct {
+	leaderURL string
+	client    *http.Client
+	header    http.Header
+
+	m           sync.Mutex
+	connected   bool
+	lastApplied uint64
+	leaderSeq   uint64
+	behindSince time.Time
+	lastContact time.Time
+}
+
+// NewFollower follows the leader whose REST API is at leaderURL, e.g.
+// "https://leader:8080/v1". header is sent with every request, e.g. to carry
+// an API key.
+func NewFollower(leaderURL string, client *http.Client, header http.Header) *Follower {
+	return &Follower{leaderURL: strings.TrimSuffix(leaderURL, "/"), client: client, header: header}
+}
+
+// Run follows the leader until ctx is done, reconnecting with exponential
+// backoff.
+func (f *Follower) Run(ctx context.Context) {
+	backoff := minBackoff
+
+	for ctx.Err() == nil {
+		err := f.stream(ctx)
+
+		if errors.Is(err, errCompacted) {
+			if err = f.bootstrap(ctx); err == nil {
+				backoff = minBackoff
+				continue
+			}
+		}
+
+		f.setConnected(false)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("replication: %v; retrying in %v", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (f *Follower) Status() Status {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	s := Status{
+		Role:           "follower",
+		Leader:         f.leaderURL,
+		Connected:      f.connected,
+		LastApplied:    f.lastApplied,
+		LeaderSequence: f.leaderSeq,
+		LastContact:    f.lastContact,
+	}
+
+	if f.leaderSeq > f.lastApplied {
+		s.LagEvents = f.leaderSeq - f.lastApplied
+		s.Lag = time.Since(f.behindSince)
+	}
+
+	return s
+}
+
+func (f *Follower) StatusHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(f.Status())
+	}
+}
+
+func (f *Follower) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.leaderURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, vs := range f.header {
+		req.Header[k] = vs
+	}
+
+	return f.client.Do(req)
+}
+
+func (f *Follower) stream(ctx context.Context) error {
+	resp, err := f.get(ctx, "/_replication/stream?from="+strconv.FormatUint(f.applied(), 10))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		return errCompacted
+	default:
+		return fmt.Errorf("leader responded %s", resp.Status)
+	}
+
+	f.setConnected(true)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 64<<20)
+
+	for scanner.Scan() {
+		var msg message
+		if err = json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return fmt.Errorf("bad replication message: %w", err)
+		}
+
+		if msg.Event == nil {
+			f.observe(msg.Heartbeat)
+			continue
+		}
+
+		if err = transcationlog.Apply(*msg.Event); err != nil {
+			return fmt.Errorf("cannot apply event %d: %w", msg.Event.Sequence, err)
+		}
+
+		f.advance(msg.Event.Sequence)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	return errors.New("leader closed the stream")
+}
+
+func (f *Follower) bootstrap(ctx context.Context) error {
+	log.Printf("replication: bootstrapping from a snapshot")
+
+	resp, err := f.get(ctx, "/_replication/snapshot")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("leader responded %s to snapshot request", resp.Status)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+
+	var header snapshotHeader
+	if err = dec.Decode(&header); err != nil {
+		return fmt.Errorf("bad snapshot header: %w", err)
+	}
+
+	entries := make([]store.Entry, 0)
+	for dec.More() {
+		var e snapshotEntry
+		if err = dec.Decode(&e); err != nil {
+			return fmt.Errorf("bad snapshot entry: %w", err)
+		}
+
+		entries = append(entries, store.Entry{Key: e.Key, Value: e.Value, Version: e.Version, ExpiresAt: e.ExpiresAt, Flags: e.Flags, Stamp: e.Stamp, CRDT: e.CRDT})
+	}
+
+	store.Restore(entries)
+
+	f.m.Lock()
+	f.lastApplied = header.Sequence
+	f.m.Unlock()
+
+	f.observe(header.Sequence)
+
+	return nil
+}
+
+func (f *Follower) applied() uint64 {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.lastApplied
+}
+
+func (f *Follower) setConnected(connected bool) {
+	f.m.Lock()
+	f.connected = connected
+	f.m.Unlock()
+}
+
+// observe records the leader's latest sequence.
+func (f *Follower) observe(leaderSeq uint64) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.lastContact = time.Now()
+
+	if leaderSeq > f.leaderSeq {
+		if f.leaderSeq <= f.lastApplied {
+			f.behindSince = time.Now()
+		}
+		f.leaderSeq = leaderSeq
+	}
+}
+
+func (f *Follower) advance(seq uint64) {
+	f.observe(seq)
+
+	f.m.Lock()
+	f.lastApplied = seq
+	f.m.Unlock()
+}
@@ -0,0 +1,244 @@
+package replication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+// testLeader serves a Leader's endpoints under /v1, recording the sequence
+// every stream request starts from.
+type testLeader struct {
+	*Leader
+	*httptest.Server
+
+	m        sync.Mutex
+	from     []string
+	snapshot []byte // served instead of the store, if set
+}
+
+func newTestLeader(t *testing.T, backlog int) *testLeader {
+	t.Helper()
+
+	l := &testLeader{Leader: NewLeader(backlog)}
+
+	stream, snapshot := l.StreamHandler(), l.SnapshotHandler()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/_replication/stream", func(w http.ResponseWriter, r *http.Request) {
+		l.m.Lock()
+		l.from = append(l.from, r.URL.Query().Get("from"))
+		l.m.Unlock()
+
+		stream(w, r)
+	})
+	mux.HandleFunc("/v1/_replication/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		l.m.Lock()
+		defer l.m.Unlock()
+
+		if l.snapshot == nil {
+			snapshot(w, r)
+			return
+		}
+		w.Write(l.snapshot)
+	})
+
+	l.Server = httptest.NewServer(mux)
+	t.Cleanup(l.Server.Close)
+
+	return l
+}
+
+// saveSnapshot makes the leader serve a snapshot of the store as it is now.
+func (l *testLeader) saveSnapshot() {
+	w := httptest.NewRecorder()
+	l.SnapshotHandler()(w, httptest.NewRequest("GET", "/", nil))
+
+	l.m.Lock()
+	l.snapshot = w.Body.Bytes()
+	l.m.Unlock()
+}
+
+func (l *testLeader) streamedFrom() []string {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return append([]string(nil), l.from...)
+}
+
+// follow runs a follower of l until the test ends.
+func follow(t *testing.T, l *testLeader) *Follower {
+	t.Helper()
+
+	f := NewFollower(l.URL+"/v1/", l.Client(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return f
+}
+
+func waitApplied(t *testing.T, f *Follower, seq uint64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Status().LastApplied < seq {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower applied up to %d, want %d", f.Status().LastApplied, seq)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// resetStore empties the store, which is global, so tests using it must not
+// run in parallel.
+func resetStore(t *testing.T) {
+	store.Restore(nil)
+	t.Cleanup(func() { store.Restore(nil) })
+}
+
+// contents returns the store's keys and values, ignoring versions, which
+// differ between replicas.
+func contents() map[string]string {
+	m := make(map[string]string)
+	for _, e := range store.Snapshot() {
+		m[e.Key] = e.Value
+	}
+
+	return m
+}
+
+func expectContents(t *testing.T, want map[string]string) {
+	t.Helper()
+
+	got := contents()
+	if len(got) != len(want) {
+		t.Fatalf("store holds %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("store holds %v, want %v", got, want)
+		}
+	}
+}
+
+var history = []transcationlog.Event{
+	{Sequence: 1, EventType: transcationlog.EventPut, Key: "a", Value: "1"},
+	{Sequence: 2, EventType: transcationlog.EventPut, Key: "b", Value: "2"},
+	{Sequence: 3, EventType: transcationlog.EventDelete, Key: "a"},
+	{Sequence: 4, EventType: transcationlog.EventPut, Key: "b", Value: "3"},
+}
+
+func TestFollowerStreams(t *testing.T) {
+	resetStore(t)
+
+	l := newTestLeader(t, DefaultBacklog)
+	l.Append(history[:3])
+
+	f := follow(t, l)
+	waitApplied(t, f, 3)
+	expectContents(t, map[string]string{"b": "2"})
+
+	// Events written later are pushed down the open stream.
+	l.Append(history[3:])
+	waitApplied(t, f, 4)
+	expectContents(t, map[string]string{"b": "3"})
+
+	if from := l.streamedFrom(); len(from) != 1 || from[0] != "0" {
+		t.Fatalf("streams started from %v, want a single one from 0", from)
+	}
+
+	if s := f.Status(); !s.Connected || s.LeaderSequence != 4 || s.LagEvents != 0 {
+		t.Fatalf("status %+v, want connected and caught up at 4", s)
+	}
+}
+
+func TestFollowerBootstrap(t *testing.T) {
+	resetStore(t)
+
+	// The leader applied the history, then trimmed its backlog past its
+	// start, so a new follower must install a snapshot.
+	l := newTestLeader(t, 1)
+	for _, e := range history[:3] {
+		if err := transcationlog.Apply(e); err != nil {
+			t.Fatal(err)
+		}
+		l.Append([]transcationlog.Event{e})
+	}
+	l.saveSnapshot()
+
+	store.Restore([]store.Entry{{Key: "stale", Value: "x", Version: 1}})
+
+	f := follow(t, l)
+	waitApplied(t, f, 3)
+	expectContents(t, map[string]string{"b": "2"})
+
+	// It then streams from the snapshot's sequence.
+	l.Append(history[3:])
+	waitApplied(t, f, 4)
+	expectContents(t, map[string]string{"b": "3"})
+
+	if from := l.streamedFrom(); len(from) != 2 || from[0] != "0" || from[1] != "3" {
+		t.Fatalf("streams started from %v, want 0 then 3", from)
+	}
+}
+
+// TestFollowerReplay checks that replaying events the store already holds,
+// as a restarted follower does, changes nothing.
+func TestFollowerReplay(t *testing.T) {
+	resetStore(t)
+
+	for _, e := range history {
+		if err := transcationlog.Apply(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := newTestLeader(t, DefaultBacklog)
+	l.Append(history)
+
+	f := follow(t, l)
+	waitApplied(t, f, 4)
+	expectContents(t, map[string]string{"b": "3"})
+}
+
+func TestFollowerReconnects(t *testing.T) {
+	resetStore(t)
+
+	l := newTestLeader(t, DefaultBacklog)
+	l.Append(history[:2])
+
+	f := follow(t, l)
+	waitApplied(t, f, 2)
+
+	// It resumes after the last event it applied.
+	l.CloseClientConnections()
+	l.Append(history[2:])
+	waitApplied(t, f, 4)
+	expectContents(t, map[string]string{"b": "3"})
+
+	from := l.streamedFrom()
+	if len(from) < 2 || from[0] != "0" {
+		t.Fatalf("streams started from %v, want 0 then 2 or later", from)
+	}
+	for _, seq := range from[1:] {
+		if seq == "0" || seq == "1" {
+			t.Fatalf("streams started from %v, want no replay before 2", from)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package replication
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud_native/pkg/store"
+	"cloud_native/pkg/transcationlog"
+)
+
+const (
+	DefaultBacklog    = 100000
+	heartbeatInterval = time.Second
+)
+
+// message is one line of the replication stream: either an event or a
+// heartbeat carrying the leader's latest sequence.
+type message struct {
+	Event     *transcationlog.Event `json:"event,omitempty"`
+	Heartbeat uint64                `json:"heartbeat,omitempty"`
+}
+
+// snapshotHeader is the first line of a snapshot, followed by one entry per
+// line.
+type snapshotHeader struct {
+	Sequence uint64 `json:"sequence"`
+}
+
+type snapshotEntry struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	Version   uint64    `json:"version"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Flags     uint32    `json:"flags,omitempty"`
+	Stamp     uint64    `json:"stamp,omitempty"`
+	CRDT      bool      `json:"crdt,omitempty"`
+}
+
+// Leader keeps a backlog of the most recent transaction-log events and
+// streams it to followers. Followers that fall behind the backlog must
+// re-bootstrap from a snapshot.
+type Leader struct {
+	m       sync.Mutex
+	backlog int
+	events  []transcationlog.Event
+	floor   uint64 // sequence of the newest event dropped from the backlog
+	last    uint64
+	changed chan struct{}
+}
+
+func NewLeader(backlog int) *Leader {
+	return &Leader{backlog: backlog, changed: make(chan struct{})}
+}
+
+// Append records events written to the transaction log. It is meant to be
+// registered as the log's Observer, and also fed the events replayed at
+// startup, or else followers must bootstrap from a snapshot.
+func (l *Leader) Append(events []transcationlog.Event) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for _, e := range events {
+		if e.Sequence <= l.last {
+			continue
+		}
+
+		l.events = append(l.events, e)
+		l.last = e.Sequence
+	}
+
+	// Trim in bulk so that appends stay amortised O(1).
+	if len(l.events) > 2*l.backlog {
+		drop := len(l.events) - l.backlog
+		l.floor = l.events[drop-1].Sequence
+		l.events = append([]transcationlog.Event(nil), l.events[drop:]...)
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// since returns the events after seq. ok is false if the backlog no longer
+// reaches back to seq, or seq is ahead of the leader.
+func (l *Leader) since(seq uint64) (events []transcationlog.Event, last uint64, changed <-chan struct{}, ok bool) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if seq > l.last {
+		return nil, l.last, l.changed, false
+	}
+
+	if seq == l.last {
+		return nil, l.last, l.changed, true
+	}
+
+	if seq < l.floor {
+		return nil, l.last, l.changed, false
+	}
+
+	// Sequences can have gaps, e.g. in Postgres, so search rather than index.
+	i := sort.Search(len(l.events), func(i int) bool { return l.events[i].Sequence > seq })
+
+	return append([]transcationlog.Event(nil), l.events[i:]...), l.last, l.changed, true
+}
+
+func (l *Leader) Last() uint64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.last
+}
+
+// StreamHandler streams events after the "from" query parameter as NDJSON,
+// followed by new events as they are written. It responds 410 Gone when the
+// backlog no longer reaches back to "from".
+func (l *Leader) StreamHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, err := strconv.ParseUint(r.URL.Query().Get("from"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid from sequence", http.StatusBadRequest)
+			return
+		}
+
+		events, last, changed, ok := l.since(from)
+		if !ok {
+			http.Error(w, "sequence compacted, bootstrap from a snapshot", http.StatusGone)
+			return
+		}
+
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			for i := range events {
+				if err = enc.Encode(message{Event: &events[i]}); err != nil {
+					return
+				}
+				from = events[i].Sequence
+			}
+
+			if len(events) == 0 {
+				if err = enc.Encode(message{Heartbeat: last}); err != nil {
+					return
+				}
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-changed:
+			case <-ticker.C:
+			}
+
+			if events, last, changed, ok = l.since(from); !ok {
+				return // the follower reconnects and is told to bootstrap
+			}
+		}
+	}
+}
+
+// SnapshotHandler writes the sequence the snapshot is consistent with,
+// followed by every entry in the store. Every event up to that sequence has
+// been applied to the store before being logged, so replaying the events after
+// it on top of the snapshot converges on the leader's state.
+func (l *Leader) SnapshotHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seq := l.Last()
+		entries := store.Snapshot()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+
+		enc.Encode(snapshotHeader{Sequence: seq})
+		for _, e := range entries {
+			enc.Encode(snapshotEntry{Key: e.Key, Value: e.Value, Version: e.Version, ExpiresAt: e.ExpiresAt, Flags: e.Flags, Stamp: e.Stamp, CRDT: e.CRDT})
+		}
+	}
+}
+
+func (l *Leader) StatusHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Status{Role: "leader", LastApplied: l.Last(), LeaderSequence: l.Last()})
+	}
+}
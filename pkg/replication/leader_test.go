@@ -0,0 +1,99 @@
+package replication
+
+import (
+	"testing"
+
+	"cloud_native/pkg/transcationlog"
+)
+
+// puts returns put events with the sequences from first to last.
+func puts(first, last uint64) []transcationlog.Event {
+	var events []transcationlog.Event
+	for seq := first; seq <= last; seq++ {
+		events = append(events, transcationlog.Event{Sequence: seq, EventType: transcationlog.EventPut, Key: "k", Value: string(rune('a' + seq))})
+	}
+
+	return events
+}
+
+func sequences(events []transcationlog.Event) []uint64 {
+	seqs := make([]uint64, len(events))
+	for i, e := range events {
+		seqs[i] = e.Sequence
+	}
+
+	return seqs
+}
+
+func TestLeaderBacklog(t *testing.T) {
+	l := NewLeader(2)
+
+	// The backlog is trimmed once it holds twice its size, down to its size.
+	for _, e := range puts(1, 4) {
+		l.Append([]transcationlog.Event{e})
+	}
+	if events, _, _, ok := l.since(0); !ok || len(events) != 4 {
+		t.Fatalf("since(0) = %v, %v before trimming, want the 4 events", sequences(events), ok)
+	}
+
+	l.Append(puts(5, 5))
+
+	tests := []struct {
+		seq  uint64
+		want []uint64
+		ok   bool
+	}{
+		{0, nil, false},
+		{2, nil, false},
+		{3, []uint64{4, 5}, true},
+		{4, []uint64{5}, true},
+		{5, nil, true},
+		{6, nil, false},
+	}
+
+	for _, tt := range tests {
+		events, last, _, ok := l.since(tt.seq)
+		if ok != tt.ok || len(events) != len(tt.want) || last != 5 {
+			t.Fatalf("since(%d) = %v, %d, %v, want %v, 5, %v", tt.seq, sequences(events), last, ok, tt.want, tt.ok)
+		}
+		for i, seq := range sequences(events) {
+			if seq != tt.want[i] {
+				t.Fatalf("since(%d) = %v, want %v", tt.seq, sequences(events), tt.want)
+			}
+		}
+	}
+
+	// Events already appended, e.g. replayed at startup, are ignored.
+	l.Append(puts(4, 6))
+	if events, last, _, _ := l.since(3); len(events) != 3 || last != 6 {
+		t.Fatalf("since(3) = %v, %d after appending 4 to 6 again, want 4 5 6", sequences(events), last)
+	}
+}
+
+func TestLeaderSequenceGaps(t *testing.T) {
+	l := NewLeader(10)
+	l.Append(append(puts(2, 2), puts(5, 7)...))
+
+	if events, _, _, ok := l.since(3); !ok || len(events) != 3 || events[0].Sequence != 5 {
+		t.Fatalf("since(3) = %v, %v, want 5 6 7", sequences(events), ok)
+	}
+}
+
+func TestLeaderWakesStreams(t *testing.T) {
+	l := NewLeader(10)
+
+	_, _, changed, _ := l.since(0)
+	select {
+	case <-changed:
+		t.Fatal("changed before any append")
+	default:
+	}
+
+	l.Append(puts(1, 1))
+
+	select {
+	case <-changed:
+	default:
+		t.Fatal("an append did not signal the waiting streams")
+	}
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrNotInteger = errors.New("value is not an integer")
+	ErrOverflow   = errors.New("increment would overflow")
+)
+
+// Incr atomically adds delta to the integer stored at key, treating a missing
+// key as 0, and returns the updated entry. The key's expiry is preserved.
+func Incr(key string, delta int64) (Entry, error) {
+	l := CurrentLimits()
+	if err := l.CheckKey(key); err != nil {
+		return Entry{}, err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	e, ok := lookup(key)
+
+	var n int64
+	if ok {
+		var err error
+		if n, err = strconv.ParseInt(e.Value, 10, 64); err != nil {
+			return Entry{}, ErrNotInteger
+		}
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return Entry{}, ErrOverflow
+	}
+
+	n += delta
+	value := strconv.FormatInt(n, 10)
+
+	if err := l.checkSize(func() int64 { return sizeDelta(key, value) }); err != nil {
+		return Entry{}, err
+	}
+
+	return put(Entry{Key: key, Value: value, ExpiresAt: e.ExpiresAt, Flags: e.Flags}), nil
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Expire sets the time at which key is removed. A zero at removes any expiry.
+func Expire(key string, at time.Time) error {
+	store.Lock()
+	defer store.Unlock()
+
+	e, ok := lookup(key)
+	if !ok {
+		return ErrNoSuchKey
+	}
+
+	e.ExpiresAt = at
+	store.m[key] = e
+
+	return nil
+}
+
+// RunExpiry removes expired entries every interval until ctx is done.
+// Expired entries are invisible to readers as soon as they expire; the sweep
+// only reclaims their space and notifies watchers.
+func RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep()
+		}
+	}
+}
+
+func sweep() {
+	store.Lock()
+	defer store.Unlock()
+
+	now := time.Now()
+	removeExpired(now)
+	pruneTombstones(now)
+}
+
+// removeExpired must be called with the store locked.
+func removeExpired(now time.Time) {
+	for k, e := range store.m {
+		if e.expired(now) {
+			del(k)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync"
+)
+
+const keyLockStripes = 256
+
+var keyLocks struct {
+	seed    maphash.Seed
+	stripes [keyLockStripes]sync.Mutex
+}
+
+func init() {
+	keyLocks.seed = maphash.MakeSeed()
+}
+
+// LockKeys serializes writers of the same keys until the returned function
+// is called. Front ends hold it across a write and the logging of its
+// events, so that the log records the writes of a key in the order the
+// store applied them.
+func LockKeys(keys ...string) (unlock func()) {
+	stripes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		stripes = append(stripes, int(maphash.String(keyLocks.seed, key)%keyLockStripes))
+	}
+
+	// Locking in a fixed order keeps writers of overlapping keys from
+	// deadlocking.
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, i := range stripes {
+		keyLocks.stripes[i].Lock()
+	}
+
+	return func() {
+		for _, i := range stripes {
+			keyLocks.stripes[i].Unlock()
+		}
+	}
+}
+
+// OpKeys returns the keys that ops write, to lock them with LockKeys.
+func OpKeys(ops []Op) []string {
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = op.Key
+	}
+
+	return keys
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxKeyLength = 1 << 10 // 1 KiB
+	DefaultMaxValueSize = 1 << 20 // 1 MiB
+)
+
+// Limits bounds the size of the data accepted by the store. A zero value for
+// any field disables that limit. The package-level writes check the current
+// limits; the methods of the same names check l instead, so that a zero Limits
+// applies writes that were accepted elsewhere, e.g. replayed from a log.
+type Limits struct {
+	MaxKeyLength int
+	MaxValueSize int64
+	MaxStoreSize int64
+}
+
+var limits = struct {
+	sync.RWMutex
+	l Limits
+}{l: Limits{MaxKeyLength: DefaultMaxKeyLength, MaxValueSize: DefaultMaxValueSize}}
+
+func SetLimits(l Limits) {
+	limits.Lock()
+	limits.l = l
+	limits.Unlock()
+}
+
+func CurrentLimits() Limits {
+	limits.RLock()
+	defer limits.RUnlock()
+
+	return limits.l
+}
+
+// CheckKey reports whether key is acceptable under the current limits.
+func CheckKey(key string) error {
+	return CurrentLimits().CheckKey(key)
+}
+
+func (l Limits) CheckKey(key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+
+	if l.MaxKeyLength > 0 && len(key) > l.MaxKeyLength {
+		return ErrKeyTooLong
+	}
+
+	return nil
+}
+
+func (l Limits) checkEntry(key, value string) error {
+	if err := l.CheckKey(key); err != nil {
+		return err
+	}
+
+	if l.MaxValueSize > 0 && int64(len(value)) > l.MaxValueSize {
+		return ErrValueTooLarge
+	}
+
+	return nil
+}
+
+// checkSize reports whether the store has room to grow by delta(). Expired
+// entries take up room until they are swept, so they are removed before a
+// write is refused; delta is a function since it depends on them. It must be
+// called with the store locked.
+func (l Limits) checkSize(delta func() int64) error {
+	max := l.MaxStoreSize
+	if max <= 0 || store.size+delta() <= max {
+		return nil
+	}
+
+	removeExpired(time.Now())
+
+	if store.size+delta() > max {
+		return ErrStoreFull
+	}
+
+	return nil
+}
+
+// Check reports whether each of ops would be accepted under l if applied in
+// order to the store as it is now, counting only the ops accepted before it.
+// It lets a write be checked once, e.g. by a Raft leader before proposing it,
+// and then applied on every replica without limits, see Limits.Put.
+func (l Limits) Check(ops []Op) []error {
+	errs := make([]error, len(ops))
+
+	store.Lock()
+	defer store.Unlock()
+
+	accepted := make([]Op, 0, len(ops))
+	for i, op := range ops {
+		if errs[i] = l.checkOp(op); errs[i] != nil {
+			continue
+		}
+
+		if errs[i] = l.checkSize(func() int64 { return opsSizeDelta(append(accepted, op)) }); errs[i] != nil {
+			continue
+		}
+
+		accepted = append(accepted, op)
+	}
+
+	return errs
+}
+
+func entrySize(key, value string) int64 {
+	return int64(len(key) + len(value))
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reset empties the store and sets l until the test ends. The store is
+// global, so tests using it must not run in parallel.
+func reset(t *testing.T, l Limits) {
+	t.Helper()
+
+	Restore(nil)
+	SetLimits(l)
+
+	t.Cleanup(func() {
+		Restore(nil)
+		SetLimits(Limits{MaxKeyLength: DefaultMaxKeyLength, MaxValueSize: DefaultMaxValueSize})
+	})
+}
+
+func TestLimits(t *testing.T) {
+	reset(t, Limits{MaxKeyLength: 4, MaxValueSize: 4, MaxStoreSize: 16})
+
+	if err := Put("", "v"); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("Put() of an empty key = %v, want ErrEmptyKey", err)
+	}
+	if err := Put("key12", "v"); !errors.Is(err, ErrKeyTooLong) {
+		t.Fatalf("Put() of a long key = %v, want ErrKeyTooLong", err)
+	}
+	if err := Put("key", "value"); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Put() of a large value = %v, want ErrValueTooLarge", err)
+	}
+
+	// Each entry takes 8 bytes of the 16.
+	for _, key := range []string{"key1", "key2"} {
+		if err := Put(key, "1234"); err != nil {
+			t.Fatalf("Put(%q) = %v, want nil", key, err)
+		}
+	}
+	if err := Put("key3", "1"); !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("Put() into a full store = %v, want ErrStoreFull", err)
+	}
+	if _, err := Incr("key3", 1); !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("Incr() into a full store = %v, want ErrStoreFull", err)
+	}
+
+	// Replacing a value only counts the difference.
+	if err := Put("key1", "abcd"); err != nil {
+		t.Fatalf("Put() replacing a value of the same size = %v, want nil", err)
+	}
+
+	// A transaction that would not fit applies none of its ops.
+	_, err := Txn(nil, []Op{{Type: OpDelete, Key: "key1"}, {Type: OpPut, Key: "key3", Value: "1234"}, {Type: OpPut, Key: "key4", Value: "1"}}, nil)
+	if !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("Txn() over the limit = %v, want ErrStoreFull", err)
+	}
+	if v, err := Get("key1"); v != "abcd" || err != nil {
+		t.Fatalf("Get() after a refused Txn() = %q, %v, want the value unchanged", v, err)
+	}
+
+	if err := Delete("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Put("key3", "1234"); err != nil {
+		t.Fatalf("Put() after a deletion made room = %v, want nil", err)
+	}
+	if got := Size(); got != 16 {
+		t.Fatalf("Size() = %d, want 16", got)
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	reset(t, Limits{MaxKeyLength: 3})
+
+	if err := CheckKey(strings.Repeat("k", 3)); err != nil {
+		t.Fatalf("CheckKey() at the limit = %v, want nil", err)
+	}
+	if err := CheckKey(strings.Repeat("k", 4)); !errors.Is(err, ErrKeyTooLong) {
+		t.Fatalf("CheckKey() over the limit = %v, want ErrKeyTooLong", err)
+	}
+
+	SetLimits(Limits{})
+
+	if err := CheckKey(strings.Repeat("k", 1<<16)); err != nil {
+		t.Fatalf("CheckKey() without limits = %v, want nil", err)
+	}
+}
+
+// TestStoreFullReclaimsExpired checks that entries which expired but were
+// not swept yet do not keep a write out.
+func TestStoreFullReclaimsExpired(t *testing.T) {
+	reset(t, Limits{MaxStoreSize: 16})
+
+	Restore([]Entry{
+		{Key: "gone", Value: "1234", ExpiresAt: time.Now().Add(-time.Second)},
+		{Key: "live", Value: "1234"},
+	})
+
+	if err := Put("key", "12345"); err != nil {
+		t.Fatalf("Put() while an expired entry takes the room = %v, want nil", err)
+	}
+	if got := Size(); got != 16 {
+		t.Fatalf("Size() = %d, want the expired entry reclaimed", got)
+	}
+
+	if err := Put("more", "1"); !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("Put() into a store full of live entries = %v, want ErrStoreFull", err)
+	}
+}
@@ -0,0 +1,29 @@
+package store
+
+// Snapshot returns every live entry, sorted by key.
+func Snapshot() []Entry {
+	return List("")
+}
+
+// Restore replaces the whole content of the store with entries, e.g. when a
+// replica installs a snapshot. Watchers are closed, since the changes between
+// the old and new content are not reported, and must watch again.
+func Restore(entries []Entry) {
+	store.Lock()
+	defer store.Unlock()
+
+	store.m = make(map[string]Entry, len(entries))
+	store.tombs = make(map[string]uint64)
+	store.size = 0
+
+	for _, e := range entries {
+		store.m[e.Key] = e
+		store.size += entrySize(e.Key, e.Value)
+
+		if e.Version > store.revision {
+			store.revision = e.Version
+		}
+	}
+
+	closeWatchers()
+}
@@ -0,0 +1,107 @@
+package store
+
+import "time"
+
+// Stamped writes let replicas that receive the same writes in different
+// orders converge: a write only applies if its stamp is newer than that of
+// the key's last write. A deletion leaves a tombstone with its stamp, so that
+// an older write arriving late cannot bring the key back.
+//
+// Stamps are hybrid clock readings in Unix nanoseconds; tombstones are pruned
+// once their stamp is older than TombstoneTTL, by which time every replica is
+// expected to have seen the writes they guard against.
+const TombstoneTTL = 24 * time.Hour
+
+// PutStamped stores e unless the key was last written with a stamp at least
+// as new as e.Stamp, and reports whether it did.
+func PutStamped(e Entry) (bool, error) {
+	return CurrentLimits().PutStamped(e)
+}
+
+func (l Limits) PutStamped(e Entry) (bool, error) {
+	if err := l.checkEntry(e.Key, e.Value); err != nil {
+		return false, err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	if e.Stamp <= stampOf(e.Key) {
+		return false, nil
+	}
+
+	if err := l.checkSize(func() int64 { return sizeDelta(e.Key, e.Value) }); err != nil {
+		return false, err
+	}
+
+	delete(store.tombs, e.Key)
+	put(e)
+
+	return true, nil
+}
+
+// DeleteStamped deletes key unless it was last written with a stamp at least
+// as new as stamp, and reports whether it did.
+func DeleteStamped(key string, stamp uint64) bool {
+	store.Lock()
+	defer store.Unlock()
+
+	if stamp <= stampOf(key) {
+		return false
+	}
+
+	del(key)
+	store.tombs[key] = stamp
+
+	return true
+}
+
+// Stamp returns the stamp of the last write to key and whether that write
+// deleted it. An unknown key has stamp 0.
+func Stamp(key string) (uint64, bool) {
+	store.RLock()
+	defer store.RUnlock()
+
+	if e, ok := lookup(key); ok {
+		return e.Stamp, false
+	}
+
+	return store.tombs[key], true
+}
+
+// stampOf must be called with the store locked.
+func stampOf(key string) uint64 {
+	if e, ok := store.m[key]; ok {
+		return e.Stamp
+	}
+
+	return store.tombs[key]
+}
+
+func pruneTombstones(now time.Time) {
+	horizon := uint64(now.Add(-TombstoneTTL).UnixNano())
+
+	for k, stamp := range store.tombs {
+		if stamp < horizon {
+			delete(store.tombs, k)
+		}
+	}
+}
+
+// Tombstones returns the stamps of the deleted keys whose tombstones are not
+// yet due to be pruned.
+func Tombstones() map[string]uint64 {
+	horizon := uint64(time.Now().Add(-TombstoneTTL).UnixNano())
+
+	store.RLock()
+	defer store.RUnlock()
+
+	tombs := make(map[string]uint64, len(store.tombs))
+	for k, stamp := range store.tombs {
+		if stamp >= horizon {
+			tombs[k] = stamp
+		}
+	}
+
+	return tombs
+}
@@ -2,40 +2,189 @@ package store
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// Entry is a key with its value and the store revision that last wrote it.
+// A zero ExpiresAt means the entry never expires. Flags are opaque to the
+// store; memcached clients use them to tag how a value is serialized. Stamp
+// is set by stamped writes only, see PutStamped. CRDT marks values holding
+// the encoded state of a CRDT, which writes merge into rather than replace.
+type Entry struct {
+	Key       string
+	Value     string
+	Version   uint64
+	ExpiresAt time.Time
+	Flags     uint32
+	Stamp     uint64
+	CRDT      bool
+}
+
 var store = struct {
 	sync.RWMutex
-	m map[string]string
-}{m: make(map[string]string)}
+	m        map[string]Entry
+	tombs    map[string]uint64
+	size     int64
+	revision uint64
+}{m: make(map[string]Entry), tombs: make(map[string]uint64)}
 
-var ErrNoSuchKey = errors.New("no such key")
+var (
+	ErrNoSuchKey     = errors.New("no such key")
+	ErrKeyTooLong    = errors.New("key too long")
+	ErrValueTooLarge = errors.New("value too large")
+	ErrStoreFull     = errors.New("store size limit exceeded")
+	ErrEmptyKey      = errors.New("empty key")
+)
 
 func Put(key, value string) error {
+	return CurrentLimits().Put(key, value)
+}
+
+func (l Limits) Put(key, value string) error {
+	if err := l.checkEntry(key, value); err != nil {
+		return err
+	}
+
 	store.Lock()
-	store.m[key] = value
-	store.Unlock()
+	defer store.Unlock()
+
+	if err := l.checkSize(func() int64 { return sizeDelta(key, value) }); err != nil {
+		return err
+	}
+
+	put(Entry{Key: key, Value: value})
 
 	return nil
 }
 
 func Get(key string) (string, error) {
+	e, err := GetEntry(key)
+	return e.Value, err
+}
+
+// GetEntry returns the value of key together with its version.
+func GetEntry(key string) (Entry, error) {
 	store.RLock()
-	value, ok := store.m[key]
+	e, ok := lookup(key)
 	store.RUnlock()
 
 	if !ok {
-		return "", ErrNoSuchKey
+		return Entry{}, ErrNoSuchKey
 	}
 
-	return value, nil
+	return e, nil
 }
 
 func Delete(key string) error {
 	store.Lock()
-	delete(store.m, key)
+	del(key)
 	store.Unlock()
 
 	return nil
 }
+
+// SetFlags replaces the flags of key without changing its value.
+func SetFlags(key string, flags uint32) error {
+	store.Lock()
+	defer store.Unlock()
+
+	e, ok := lookup(key)
+	if !ok {
+		return ErrNoSuchKey
+	}
+
+	e.Flags = flags
+	store.m[key] = e
+
+	return nil
+}
+
+// List returns the entries whose key starts with prefix, sorted by key.
+func List(prefix string) []Entry {
+	store.RLock()
+	entries := make([]Entry, 0)
+	now := time.Now()
+	for k, e := range store.m {
+		if strings.HasPrefix(k, prefix) && !e.expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	store.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	return entries
+}
+
+// Size returns the number of bytes currently held by keys and values.
+func Size() int64 {
+	store.RLock()
+	defer store.RUnlock()
+
+	return store.size
+}
+
+// Revision returns the version assigned to the most recent write.
+func Revision() uint64 {
+	store.RLock()
+	defer store.RUnlock()
+
+	return store.revision
+}
+
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// lookup, put and del must be called with the store locked.
+
+// lookup returns the live entry for key, treating expired entries as absent.
+func lookup(key string) (Entry, bool) {
+	e, ok := store.m[key]
+	if !ok || e.expired(time.Now()) {
+		return Entry{}, false
+	}
+
+	return e, true
+}
+
+// put stores e under a new revision, which it returns in e.Version.
+func put(e Entry) Entry {
+	store.size += sizeDelta(e.Key, e.Value)
+	store.revision++
+
+	e.Version = store.revision
+	store.m[e.Key] = e
+
+	notify(Change{Type: ChangePut, Entry: e})
+
+	return e
+}
+
+func del(key string) bool {
+	old, ok := store.m[key]
+	if !ok {
+		return false
+	}
+
+	store.size -= entrySize(key, old.Value)
+	store.revision++
+	delete(store.m, key)
+
+	notify(Change{Type: ChangeDelete, Entry: Entry{Key: key, Version: store.revision}})
+
+	return true
+}
+
+// sizeDelta is how much the store grows if key is set to value.
+func sizeDelta(key, value string) int64 {
+	delta := entrySize(key, value)
+	if old, ok := store.m[key]; ok {
+		delta -= entrySize(key, old.Value)
+	}
+
+	return delta
+}
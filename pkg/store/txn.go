@@ -0,0 +1,156 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidTxn = errors.New("invalid transaction")
+
+type CompareTarget byte
+
+const (
+	CompareVersion CompareTarget = iota // Version 0 means the key must not exist
+	CompareValue
+	CompareExists
+)
+
+// Compare is a condition on the current state of a key.
+type Compare struct {
+	Key     string
+	Target  CompareTarget
+	Version uint64
+	Value   string
+}
+
+type OpType byte
+
+const (
+	_               = iota
+	OpDelete OpType = iota
+	OpPut
+)
+
+// Op is a write applied by a transaction. A put replaces the whole entry,
+// including its expiry and flags.
+type Op struct {
+	Type      OpType
+	Key       string
+	Value     string
+	ExpiresAt time.Time
+	Flags     uint32
+}
+
+// TxnResult reports which branch of a transaction ran, and the writes it made
+// so that callers can record them in the transaction log.
+type TxnResult struct {
+	Succeeded bool
+	Applied   []Op
+	Revision  uint64
+}
+
+// Txn atomically applies success if every compare holds, and failure
+// otherwise. Either all ops of the chosen branch are applied or none are.
+func Txn(compares []Compare, success, failure []Op) (TxnResult, error) {
+	l := CurrentLimits()
+
+	for _, ops := range [][]Op{success, failure} {
+		for _, op := range ops {
+			if err := l.checkOp(op); err != nil {
+				return TxnResult{}, err
+			}
+		}
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	res := TxnResult{Succeeded: true}
+	for _, c := range compares {
+		if !holds(c) {
+			res.Succeeded = false
+			break
+		}
+	}
+
+	ops := success
+	if !res.Succeeded {
+		ops = failure
+	}
+
+	if err := l.checkSize(func() int64 { return opsSizeDelta(ops) }); err != nil {
+		return TxnResult{}, err
+	}
+
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			put(Entry{Key: op.Key, Value: op.Value, ExpiresAt: op.ExpiresAt, Flags: op.Flags})
+		case OpDelete:
+			if !del(op.Key) {
+				continue
+			}
+		}
+
+		res.Applied = append(res.Applied, op)
+	}
+
+	res.Revision = store.revision
+
+	return res, nil
+}
+
+func (l Limits) checkOp(op Op) error {
+	switch op.Type {
+	case OpPut:
+		return l.checkEntry(op.Key, op.Value)
+	case OpDelete:
+		return l.CheckKey(op.Key)
+	default:
+		return ErrInvalidTxn
+	}
+}
+
+func holds(c Compare) bool {
+	e, ok := lookup(c.Key)
+
+	switch c.Target {
+	case CompareVersion:
+		return e.Version == c.Version
+	case CompareValue:
+		return ok && e.Value == c.Value
+	case CompareExists:
+		return ok
+	default:
+		return false
+	}
+}
+
+// opsSizeDelta is how much the store grows once ops are applied in order.
+func opsSizeDelta(ops []Op) int64 {
+	sizes := make(map[string]int64)
+	var delta int64
+
+	current := func(key string) int64 {
+		if s, ok := sizes[key]; ok {
+			return s
+		}
+		if e, ok := store.m[key]; ok {
+			return entrySize(key, e.Value)
+		}
+		return 0
+	}
+
+	for _, op := range ops {
+		before := current(op.Key)
+		after := int64(0)
+		if op.Type == OpPut {
+			after = entrySize(op.Key, op.Value)
+		}
+
+		delta += after - before
+		sizes[op.Key] = after
+	}
+
+	return delta
+}
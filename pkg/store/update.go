@@ -0,0 +1,42 @@
+package store
+
+// Update atomically replaces the entry at key with the one fn derives from
+// it, and returns the entry stored. ok reports whether the key exists; if it
+// does not, e carries the stamp of its tombstone, if any. fn returns false to
+// leave the key as it is.
+func Update(key string, fn func(e Entry, ok bool) (Entry, bool, error)) (Entry, bool, error) {
+	return CurrentLimits().Update(key, fn)
+}
+
+func (l Limits) Update(key string, fn func(e Entry, ok bool) (Entry, bool, error)) (Entry, bool, error) {
+	if err := l.CheckKey(key); err != nil {
+		return Entry{}, false, err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	old, ok := lookup(key)
+	if !ok {
+		old = Entry{Key: key, Stamp: store.tombs[key]}
+	}
+
+	e, write, err := fn(old, ok)
+	if err != nil || !write {
+		return old, false, err
+	}
+
+	e.Key = key
+
+	if err := l.checkEntry(key, e.Value); err != nil {
+		return old, false, err
+	}
+
+	if err := l.checkSize(func() int64 { return sizeDelta(key, e.Value) }); err != nil {
+		return old, false, err
+	}
+
+	delete(store.tombs, key)
+
+	return put(e), true, nil
+}
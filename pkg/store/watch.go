@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+type ChangeType byte
+
+const (
+	_                       = iota
+	ChangeDelete ChangeType = iota
+	ChangePut
+)
+
+// Change is a single write observed by a watcher. For deletes, Entry.Value
+// is empty and Entry.Version is the revision of the delete.
+type Change struct {
+	Type  ChangeType
+	Entry Entry
+}
+
+// watchBuffer is how many changes a watcher may fall behind before it is
+// dropped.
+const watchBuffer = 256
+
+type watcher struct {
+	prefix string
+	ch     chan Change
+}
+
+var watchers = struct {
+	sync.Mutex
+	w map[*watcher]struct{}
+}{w: make(map[*watcher]struct{})}
+
+// Watch streams every change to keys starting with prefix until ctx is done.
+// A watcher that falls too far behind has its channel closed and must watch
+// again, re-reading the keys it cares about.
+func Watch(ctx context.Context, prefix string) <-chan Change {
+	w := &watcher{prefix: prefix, ch: make(chan Change, watchBuffer)}
+
+	watchers.Lock()
+	watchers.w[w] = struct{}{}
+	watchers.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		unwatch(w)
+	}()
+
+	return w.ch
+}
+
+func unwatch(w *watcher) {
+	watchers.Lock()
+	defer watchers.Unlock()
+
+	if _, ok := watchers.w[w]; ok {
+		delete(watchers.w, w)
+		close(w.ch)
+	}
+}
+
+// notify is called with the store locked, so watchers see changes in order.
+func notify(c Change) {
+	watchers.Lock()
+	defer watchers.Unlock()
+
+	for w := range watchers.w {
+		if !strings.HasPrefix(c.Entry.Key, w.prefix) {
+			continue
+		}
+
+		select {
+		case w.ch <- c:
+		default:
+			delete(watchers.w, w)
+			close(w.ch)
+		}
+	}
+}
+
+func closeWatchers() {
+	watchers.Lock()
+	defer watchers.Unlock()
+
+	for w := range watchers.w {
+		delete(watchers.w, w)
+		close(w.ch)
+	}
+}
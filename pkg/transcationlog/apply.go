@@ -0,0 +1,108 @@
+package transcationlog
+
+import (
+	"errors"
+
+	"cloud_native/pkg/crdt"
+	"cloud_native/pkg/store"
+)
+
+// unlimited applies logged writes: they were checked against the limits
+// when they were accepted, and replaying them must give the same store
+// whatever the limits are now, or on another replica.
+var unlimited store.Limits
+
+// Apply replays a logged event against the store, as done when restoring
+// from the log at startup, when following a leader or when applying a
+// committed Raft entry.
+func Apply(e Event) error {
+	switch e.EventType {
+	case EventDelete:
+		if e.Stamp != 0 {
+			store.DeleteStamped(e.Key, e.Stamp)
+			return nil
+		}
+		return store.Delete(e.Key)
+	case EventPut:
+		if e.Stamp != 0 {
+			_, err := unlimited.PutStamped(store.Entry{Key: e.Key, Value: e.Value, Stamp: e.Stamp})
+			return err
+		}
+		return unlimited.Put(e.Key, e.Value)
+	case EventExpire:
+		return applyExpire(e)
+	case EventFlags:
+		return applyFlags(e)
+	case EventMerge:
+		return applyMerge(e)
+	}
+
+	return nil
+}
+
+func applyExpire(e Event) error {
+	at, err := e.ExpiresAt()
+	if err != nil {
+		return err
+	}
+
+	// The key may have been deleted or already expired since.
+	if err = store.Expire(e.Key, at); errors.Is(err, store.ErrNoSuchKey) {
+		return nil
+	}
+
+	return err
+}
+
+func applyFlags(e Event) error {
+	flags, err := e.Flags()
+	if err != nil {
+		return err
+	}
+
+	if err = store.SetFlags(e.Key, flags); errors.Is(err, store.ErrNoSuchKey) {
+		return nil
+	}
+
+	return err
+}
+
+// applyMerge merges the logged state rather than replacing the key's, so the
+// result does not depend on the order merges are replayed in.
+func applyMerge(e Event) error {
+	c, err := crdt.Decode(e.Value)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = crdt.MergeInto(unlimited, e.Key, c, e.Stamp)
+
+	return err
+}
+
+// Check reports whether each of events would be accepted under the current
+// limits, as a write checks them before it is logged. A merge is checked as
+// a put of the state it carries.
+func Check(events []Event) []error {
+	ops := make([]store.Op, 0, len(events))
+	indexes := make([]int, 0, len(events))
+
+	for i, e := range events {
+		switch e.EventType {
+		case EventPut, EventMerge:
+			ops = append(ops, store.Op{Type: store.OpPut, Key: e.Key, Value: e.Value})
+		case EventDelete:
+			ops = append(ops, store.Op{Type: store.OpDelete, Key: e.Key})
+		default:
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+
+	errs := make([]error, len(events))
+	for j, err := range store.CurrentLimits().Check(ops) {
+		errs[indexes[j]] = err
+	}
+
+	return errs
+}
@@ -1,16 +1,84 @@
 package transcationlog
 
+import (
+	"strconv"
+	"time"
+)
+
 type EventType byte
 
 const (
 	_                     = iota
 	EventDelete EventType = iota
 	EventPut
+	EventExpire // Value holds the expiry as Unix nanoseconds, empty to persist
+	EventFlags  // Value holds the entry's flags in decimal
+	EventMerge  // Value holds a CRDT state to merge into the key's
 )
 
 type Event struct {
-	Sequence  uint64
-	EventType EventType
-	Key       string
-	Value     string
+	Sequence  uint64    `json:"sequence"`
+	EventType EventType `json:"event_type"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value,omitempty"`
+	Principal string    `json:"principal,omitempty"`
+
+	// Stamp orders writes to a key made on different replicas; the newest
+	// wins. Zero for writes that are not replicated by quorum.
+	Stamp uint64 `json:"stamp,omitempty"`
+}
+
+// Observer is called with every batch of events once it has been written,
+// with sequence numbers assigned.
+type Observer func(events []Event)
+
+// PutEvents records a put of key together with the expiry and flags it was
+// written with, if any.
+func PutEvents(key, value string, expiresAt time.Time, flags uint32, principal string) []Event {
+	events := []Event{{EventType: EventPut, Key: key, Value: value, Principal: principal}}
+
+	if !expiresAt.IsZero() {
+		events = append(events, ExpireEvent(key, expiresAt, principal))
+	}
+	if flags != 0 {
+		events = append(events, FlagsEvent(key, flags, principal))
+	}
+
+	return events
+}
+
+// ExpireEvent records that key expires at the given time. A zero time
+// removes the expiry.
+func ExpireEvent(key string, at time.Time, principal string) Event {
+	e := Event{EventType: EventExpire, Key: key, Principal: principal}
+	if !at.IsZero() {
+		e.Value = strconv.FormatInt(at.UnixNano(), 10)
+	}
+
+	return e
+}
+
+// ExpiresAt decodes the expiry carried by an EventExpire.
+func (e Event) ExpiresAt() (time.Time, error) {
+	if e.Value == "" {
+		return time.Time{}, nil
+	}
+
+	ns, err := strconv.ParseInt(e.Value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, ns), nil
+}
+
+// FlagsEvent records the opaque flags of key.
+func FlagsEvent(key string, flags uint32, principal string) Event {
+	return Event{EventType: EventFlags, Key: key, Value: strconv.FormatUint(uint64(flags), 10), Principal: principal}
+}
+
+// Flags decodes the flags carried by an EventFlags.
+func (e Event) Flags() (uint32, error) {
+	n, err := strconv.ParseUint(e.Value, 10, 32)
+	return uint32(n), err
 }
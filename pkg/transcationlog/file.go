@@ -4,15 +4,25 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 )
 
-const FORMAT = "%d\t%d\t%s\t%s\n"
+// FORMAT is sequence, event type, the quoted key, value and principal, then
+// the stamp. Lines written before stamps were recorded end at the principal;
+// those written before principals were recorded have no principal column and
+// unquoted key and value.
+const FORMAT = "%d\t%d\t%q\t%q\t%q\t%d\n"
+
+// maxLineSize bounds a single log line; quoting can expand a value up to 4x.
+const maxLineSize = 64 << 20
 
 type FileTransactionLog struct {
-	events       chan<- Event
+	queue        queue
 	errors       <-chan error
 	lastSequence uint64
 	file         *os.File
+	observer     Observer
 }
 
 func NewFileTransactionLog(filename string) (*FileTransactionLog, error) {
@@ -26,12 +36,23 @@ func NewFileTransactionLog(filename string) (*FileTransactionLog, error) {
 	}, nil
 }
 
-func (l *FileTransactionLog) WritePut(key, value string) {
-	l.events <- Event{EventType: EventPut, Key: key, Value: value}
+func (l *FileTransactionLog) WritePut(key, value, principal string) {
+	l.queue.put([]Event{{EventType: EventPut, Key: key, Value: value, Principal: principal}})
+}
+
+func (l *FileTransactionLog) WriteDelete(key, principal string) {
+	l.queue.put([]Event{{EventType: EventDelete, Key: key, Principal: principal}})
 }
 
-func (l *FileTransactionLog) WriteDelete(key string) {
-	l.events <- Event{EventType: EventDelete, Key: key}
+// WriteBatch logs several events with a single write to the file.
+func (l *FileTransactionLog) WriteBatch(events []Event) {
+	l.queue.put(events)
+}
+
+// Observe registers o to be called after each write. It must be called
+// before Run.
+func (l *FileTransactionLog) Observe(o Observer) {
+	l.observer = o
 }
 
 func (l *FileTransactionLog) Err() <-chan error {
@@ -39,60 +60,112 @@ func (l *FileTransactionLog) Err() <-chan error {
 }
 
 func (l *FileTransactionLog) Run() {
-	events := make(chan Event, 16)
-	l.events = events
 	errors := make(chan error, 1)
 	l.errors = errors
 
-	go func() {
-		for e := range events {
+	w := bufio.NewWriter(l.file)
+
+	l.queue.run(func(batch []Event) bool {
+		written := make([]Event, len(batch))
+
+		for i, e := range batch {
 			l.lastSequence++
+			e.Sequence = l.lastSequence
+			written[i] = e
 
-			_, err := fmt.Fprintf(l.file, FORMAT, l.lastSequence, e.EventType, e.Key, e.Value)
-			if err != nil {
-				errors <- err
-				return
-			}
+			fmt.Fprintf(w, FORMAT, e.Sequence, e.EventType, e.Key, e.Value, e.Principal, e.Stamp)
+		}
+
+		if err := w.Flush(); err != nil {
+			errors <- err
+			return false
 		}
-	}()
-}
 
+		if l.observer != nil {
+			l.observer(written)
+		}
+
+		return true
+	})
+}
 func (l *FileTransactionLog) ReadEvents() (<-chan Event, <-chan error) {
 	scanner := bufio.NewScanner(l.file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
 	outEvent := make(chan Event)
-	outError := make(chan error)
+	outError := make(chan error, 1)
 
 	go func() {
-		var e Event
 		defer close(outEvent)
 		defer close(outError)
 
 		for scanner.Scan() {
-			line := scanner.Text()
-
-			if _, err := fmt.Sscanf(line, FORMAT,
-				&e.Sequence, &e.EventType, &e.Key, &e.Value); err != nil {
+			e, err := parseLine(scanner.Text())
+			if err != nil {
 				outError <- fmt.Errorf("input parse error: %w", err)
 				return
 			}
-		}
 
-		isStartingSequence := (l.lastSequence == 0) && (e.Sequence == 0)
+			if l.lastSequence >= e.Sequence {
+				outError <- fmt.Errorf("transaction numbers out of sequence")
+				return
+			}
 
-		if l.lastSequence >= e.Sequence && !isStartingSequence {
-			outError <- fmt.Errorf("transaction numbers out of sequence")
-			return
-		}
+			l.lastSequence = e.Sequence
 
-		l.lastSequence = e.Sequence
+			outEvent <- e
+		}
 
-		outEvent <- e
+		if err := scanner.Err(); err != nil {
+			outError <- fmt.Errorf("transaction log read failure: %w", err)
+		}
 	}()
 
 	return outEvent, outError
 }
 
+func parseLine(line string) (Event, error) {
+	var e Event
+
+	fields := strings.Split(line, "\t")
+	if len(fields) < 4 || len(fields) > 6 {
+		return e, fmt.Errorf("expected 4 to 6 fields, got %d", len(fields))
+	}
+
+	seq, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return e, err
+	}
+
+	typ, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return e, err
+	}
+
+	e.Sequence = seq
+	e.EventType = EventType(typ)
+
+	if len(fields) == 4 {
+		e.Key, e.Value = fields[2], fields[3]
+		return e, nil
+	}
+
+	for i, dst := range []*string{&e.Key, &e.Value, &e.Principal} {
+		if *dst, err = strconv.Unquote(fields[i+2]); err != nil {
+			return e, err
+		}
+	}
+
+	if len(fields) == 6 {
+		e.Stamp, err = strconv.ParseUint(fields[5], 10, 64)
+	}
+
+	return e, err
+}
+
+// Close writes the events already queued and closes the file; events
+// written after it are dropped.
 func (l *FileTransactionLog) Close() error {
+	l.queue.close()
 	return l.file.Close()
 }
 
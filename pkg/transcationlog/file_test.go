@@ -0,0 +1,137 @@
+package transcationlog
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// readAll reads every event back from the log at filename.
+func readAll(t *testing.T, filename string) []Event {
+	t.Helper()
+
+	l, err := NewFileTransactionLog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var read []Event
+
+	events, errs := l.ReadEvents()
+	for e := range events {
+		read = append(read, e)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	return read
+}
+
+// TestWriteBatch checks that the events of a batch are written together,
+// with consecutive sequence numbers, however many batches are written at
+// once.
+func TestWriteBatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+
+	l, err := NewFileTransactionLog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const batches, size = 20, 5
+
+	var written sync.WaitGroup
+	written.Add(batches)
+	l.Observe(func([]Event) { written.Done() })
+	l.Run()
+
+	var wg sync.WaitGroup
+	for b := range batches {
+		wg.Go(func() {
+			events := make([]Event, size)
+			for i := range events {
+				events[i] = Event{EventType: EventPut, Key: fmt.Sprintf("k%d", i), Value: fmt.Sprint(b)}
+			}
+			l.WriteBatch(events)
+		})
+	}
+	wg.Wait()
+	written.Wait()
+	l.Close()
+
+	read := readAll(t, filename)
+	if len(read) != batches*size {
+		t.Fatalf("read %d events, want %d", len(read), batches*size)
+	}
+
+	for i := 0; i < len(read); i += size {
+		for j, e := range read[i : i+size] {
+			if e.Value != read[i].Value || e.Key != fmt.Sprintf("k%d", j) {
+				t.Fatalf("events %d to %d are not one batch: %+v", i, i+size, read[i:i+size])
+			}
+			if e.Sequence != uint64(i+j+1) {
+				t.Fatalf("event %d has sequence %d", i+j, e.Sequence)
+			}
+		}
+	}
+}
+
+// TestCloseWritesQueued checks that Close writes the batches still queued
+// rather than dropping them.
+func TestCloseWritesQueued(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+
+	l, err := NewFileTransactionLog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Run()
+
+	for i := range 100 {
+		l.WriteBatch([]Event{{EventType: EventPut, Key: fmt.Sprint(i), Value: "v"}})
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes after Close are dropped.
+	l.WriteBatch([]Event{{EventType: EventPut, Key: "late", Value: "v"}})
+
+	if read := readAll(t, filename); len(read) != 100 {
+		t.Fatalf("read %d events after Close, want 100", len(read))
+	}
+}
+
+func TestFileLogQuoting(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+
+	l, err := NewFileTransactionLog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []Event{
+		{EventType: EventPut, Key: "tab\tkey", Value: "two\nlines", Principal: "alice"},
+		{EventType: EventPut, Key: "quoted \"key\"", Value: "", Stamp: 42},
+		{EventType: EventDelete, Key: "tab\tkey", Principal: "bob"},
+	}
+
+	var written sync.WaitGroup
+	written.Add(1)
+	l.Observe(func([]Event) { written.Done() })
+	l.Run()
+	l.WriteBatch(events)
+	written.Wait()
+	l.Close()
+
+	read := readAll(t, filename)
+	for i := range events {
+		events[i].Sequence = uint64(i + 1)
+	}
+	if fmt.Sprint(read) != fmt.Sprint(events) {
+		t.Fatalf("read %+v, want %+v", read, events)
+	}
+}
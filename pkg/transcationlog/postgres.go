@@ -1,16 +1,36 @@
 package transcationlog
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
-	_ "github.com/lib/pq"
+	"cloud_native/patterns/reliability"
+	"github.com/lib/pq"
 )
 
+// PostgresTransactionLog inserts events into a Postgres table. A failed
+// insert is retried a few times with backoff, and the retries go through a
+// circuit breaker: once the database keeps failing, batches fail fast with
+// reliability.ErrOpenState, and are dropped like any batch that could not be
+// inserted, until a probe insert succeeds.
 type PostgresTransactionLog struct {
-	events chan<- Event
-	error  <-chan error
-	db     *sql.DB
+	queue    queue
+	error    <-chan error
+	db       *sql.DB
+	observer Observer
+	breaker  *reliability.CircuitBreaker[[]Event]
+}
+
+var insertRetry = reliability.RetryPolicy{
+	MaxAttempts:  3,
+	InitialDelay: 100 * time.Millisecond,
+	MaxDelay:     time.Second,
+	Jitter:       reliability.FullJitter,
+	Retryable:    func(err error) bool { return !refused(err) },
 }
 
 type PostgresDBParams struct {
@@ -34,7 +54,12 @@ func NewPostgresTransactionLog(params PostgresDBParams) (*PostgresTransactionLog
 		return nil, fmt.Errorf("failed to open db connection: %w", err)
 	}
 
-	logger := &PostgresTransactionLog{db: db}
+	logger := &PostgresTransactionLog{db: db, breaker: reliability.NewCircuitBreaker[[]Event](reliability.BreakerSettings{
+		IsFailure: func(err error) bool { return err != nil && !refused(err) },
+		OnStateChange: func(from, to reliability.State) {
+			log.Printf("transaction log: postgres circuit breaker %s -> %s", from, to)
+		},
+	})}
 
 	exists, err := logger.verifyTableExists()
 
@@ -47,15 +72,30 @@ func NewPostgresTransactionLog(params PostgresDBParams) (*PostgresTransactionLog
 		}
 	}
 
+	if err = logger.migrateTable(); err != nil {
+		return nil, fmt.Errorf("failed to migrate table: %w", err)
+	}
+
 	return logger, nil
 }
 
-func (l *PostgresTransactionLog) WritePut(key, value string) {
-	l.events <- Event{EventType: EventPut, Key: key, Value: value}
+func (l *PostgresTransactionLog) WritePut(key, value, principal string) {
+	l.queue.put([]Event{{EventType: EventPut, Key: key, Value: value, Principal: principal}})
 }
 
-func (l *PostgresTransactionLog) WriteDelete(key string) {
-	l.events <- Event{EventType: EventDelete, Key: key}
+func (l *PostgresTransactionLog) WriteDelete(key, principal string) {
+	l.queue.put([]Event{{EventType: EventDelete, Key: key, Principal: principal}})
+}
+
+// WriteBatch inserts several events in a single database transaction.
+func (l *PostgresTransactionLog) WriteBatch(events []Event) {
+	l.queue.put(events)
+}
+
+// Observe registers o to be called after each write. It must be called
+// before Run.
+func (l *PostgresTransactionLog) Observe(o Observer) {
+	l.observer = o
 }
 
 func (l *PostgresTransactionLog) Err() <-chan error {
@@ -63,23 +103,79 @@ func (l *PostgresTransactionLog) Err() <-chan error {
 }
 
 func (l *PostgresTransactionLog) Run() {
-	events := make(chan Event, 16)
-	l.events = events
 	errs := make(chan error, 1)
 	l.error = errs
 
-	go func() {
-		query := `INSERT INTO transactions
-				(event_type, key, value)
-				VALUES ($1, $2, $3);
-				`
-		for e := range events {
-			_, err := l.db.Exec(query, e.EventType, e.Key, e.Value)
-			if err != nil {
-				errs <- err
+	l.queue.run(func(batch []Event) bool {
+		insert := reliability.Chain(
+			func(ctx context.Context) ([]Event, error) { return l.insert(ctx, batch) },
+			reliability.WithBreaker(l.breaker),
+			reliability.WithRetry[[]Event](insertRetry),
+		)
+
+		written, err := insert(context.Background())
+		if err != nil {
+			// Keep the first unread error rather than block the writer
+			// on a reader that may never come.
+			select {
+			case errs <- err:
+			default:
 			}
+			return true
 		}
-	}()
+
+		if l.observer != nil {
+			l.observer(written)
+		}
+
+		return true
+	})
+}
+
+// insert writes batch in a single database transaction and returns the
+// events with the sequence numbers assigned by the database.
+func (l *PostgresTransactionLog) insert(ctx context.Context, batch []Event) ([]Event, error) {
+	query := `INSERT INTO transactions
+			(event_type, key, value, principal, stamp)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING sequence;
+			`
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	written := make([]Event, len(batch))
+
+	for i, e := range batch {
+		if err = stmt.QueryRowContext(ctx, e.EventType, e.Key, e.Value, e.Principal, int64(e.Stamp)).Scan(&e.Sequence); err != nil {
+			return nil, err
+		}
+		written[i] = e
+	}
+
+	// Whether a failed commit went through is unknown: retrying it could
+	// insert the events twice.
+	if err = tx.Commit(); err != nil {
+		return nil, reliability.Permanent(err)
+	}
+
+	return written, nil
+}
+
+// refused reports whether the database rejected the data itself, e.g. an
+// invalid byte sequence, which says nothing about its health.
+func refused(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23")
 }
 
 func (l *PostgresTransactionLog) verifyTableExists() (bool, error) {
@@ -107,7 +203,9 @@ func (l *PostgresTransactionLog) createTable() error {
 		sequence      BIGSERIAL PRIMARY KEY,
 		event_type    SMALLINT,
 		key 		  TEXT,
-		value         TEXT
+		value         TEXT,
+		principal     TEXT NOT NULL DEFAULT '',
+		stamp         BIGINT NOT NULL DEFAULT 0
 	  );`
 
 	_, err = l.db.Exec(createQuery)
@@ -118,6 +216,15 @@ func (l *PostgresTransactionLog) createTable() error {
 	return nil
 }
 
+// migrateTable adds the columns introduced after the table was first created.
+func (l *PostgresTransactionLog) migrateTable() error {
+	_, err := l.db.Exec(`ALTER TABLE transactions
+		ADD COLUMN IF NOT EXISTS principal TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS stamp BIGINT NOT NULL DEFAULT 0`)
+
+	return err
+}
+
 func (l *PostgresTransactionLog) ReadEvents() (<-chan Event, <-chan error) {
 	outEvent := make(chan Event)
 	outError := make(chan error, 1)
@@ -126,7 +233,7 @@ func (l *PostgresTransactionLog) ReadEvents() (<-chan Event, <-chan error) {
 		defer close(outEvent)
 		defer close(outError)
 
-		query := `SELECT sequence, event_type, key, value FROM transactions
+		query := `SELECT sequence, event_type, key, value, principal, stamp FROM transactions
 					ORDER BY sequence`
 
 		rows, err := l.db.Query(query)
@@ -137,6 +244,7 @@ func (l *PostgresTransactionLog) ReadEvents() (<-chan Event, <-chan error) {
 		defer rows.Close()
 
 		e := Event{}
+		var stamp int64
 
 		for rows.Next() {
 			err = rows.Scan(
@@ -144,7 +252,10 @@ func (l *PostgresTransactionLog) ReadEvents() (<-chan Event, <-chan error) {
 				&e.EventType,
 				&e.Key,
 				&e.Value,
+				&e.Principal,
+				&stamp,
 			)
+			e.Stamp = uint64(stamp)
 
 			if err != nil {
 				outError <- fmt.Errorf("error reading row: %w", err)
@@ -163,6 +274,9 @@ func (l *PostgresTransactionLog) ReadEvents() (<-chan Event, <-chan error) {
 	return outEvent, outError
 }
 
+// Close inserts the events already queued and closes the database; events
+// written after it are dropped.
 func (l *PostgresTransactionLog) Close() error {
+	l.queue.close()
 	return l.db.Close()
 }
@@ -0,0 +1,28 @@
+package transcationlog
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestRefused(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pq.Error{Code: "22021"}, true}, // invalid byte sequence
+		{fmt.Errorf("insert: %w", &pq.Error{Code: "23505"}), true},
+		{&pq.Error{Code: "57P01"}, false}, // admin shutdown
+		{&pq.Error{Code: "08006"}, false}, // connection failure
+		{driver.ErrBadConn, false},
+	}
+
+	for _, tt := range tests {
+		if got := refused(tt.err); got != tt.want {
+			t.Errorf("refused(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package transcationlog
+
+import "sync"
+
+// queue hands batches of events to the goroutine writing them. Closing it
+// waits for the batches already queued to be written, so that none are lost
+// on shutdown.
+type queue struct {
+	m      sync.RWMutex
+	events chan []Event
+	closed bool
+	done   chan struct{}
+}
+
+// run starts a goroutine calling write with each batch, until the queue is
+// closed or write returns false.
+func (q *queue) run(write func(batch []Event) bool) {
+	q.events = make(chan []Event, 16)
+	q.done = make(chan struct{})
+
+	go func() {
+		defer close(q.done)
+
+		for batch := range q.events {
+			if !write(batch) {
+				return
+			}
+		}
+	}()
+}
+
+// put queues events, unless the queue is closed or its writer stopped.
+func (q *queue) put(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	q.m.RLock()
+	defer q.m.RUnlock()
+
+	if q.closed {
+		return
+	}
+
+	select {
+	case q.events <- events:
+	case <-q.done:
+	}
+}
+
+// close stops accepting events and waits until the queued ones are written.
+func (q *queue) close() {
+	q.m.Lock()
+	if q.closed || q.events == nil {
+		q.closed = true
+		q.m.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.events)
+	q.m.Unlock()
+
+	<-q.done
+}
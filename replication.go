@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"cloud_native/api/rest"
+	"cloud_native/pkg/replication"
+)
+
+// startFollower replicates the leader at -leader-url into the local store and
+// makes srv read-only.
+func startFollower(ctx context.Context, srv *rest.Server) error {
+	leader, err := url.Parse(*leaderURL)
+	if err != nil {
+		return fmt.Errorf("invalid -leader-url: %w", err)
+	}
+
+	transport, err := peerTransport(*leaderCA)
+	if err != nil {
+		return err
+	}
+
+	header := make(http.Header)
+	if *leaderAPIKey != "" {
+		header.Set("X-API-Key", *leaderAPIKey)
+	}
+
+	var proxy *httputil.ReverseProxy
+
+	switch *followerWrites {
+	case "reject":
+	case "forward":
+		proxy = httputil.NewSingleHostReverseProxy(&url.URL{Scheme: leader.Scheme, Host: leader.Host})
+		proxy.Transport = transport
+	default:
+		return fmt.Errorf("invalid -follower-writes %q, want reject or forward", *followerWrites)
+	}
+
+	follower := replication.NewFollower(*leaderURL, &http.Client{Transport: transport}, header)
+
+	srv.HandleFunc("/_replication/status", follower.StatusHandler()).Methods("GET")
+	srv.Use(rest.ReadOnlyMiddleware(leader, proxy))
+
+	go follower.Run(ctx)
+
+	return nil
+}
+
+// serveLeader exposes the transaction log to followers.
+func serveLeader(srv *rest.Server, leader *replication.Leader) {
+	srv.HandleFunc("/_replication/stream", leader.StreamHandler()).Methods("GET")
+	srv.HandleFunc("/_replication/snapshot", leader.SnapshotHandler()).Methods("GET")
+	srv.HandleFunc("/_replication/status", leader.StatusHandler()).Methods("GET")
+}
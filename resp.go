@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"cloud_native/api/resp"
+	"cloud_native/pkg/auth"
+)
+
+func serveRESP(addr string, tlsConfig *tls.Config, authenticator auth.Authenticator, policy auth.Policy) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for RESP: %w", err)
+	}
+
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+	}
+
+	srv := resp.NewServer(transact)
+	if readOnly() {
+		srv.ReadOnly()
+	}
+	if authenticator != nil {
+		srv.RequireAuth(authenticator, policy)
+	}
+
+	return srv.Serve(lis)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+
+	"cloud_native/pkg/certs"
+)
+
+func newTLSConfig(ctx context.Context) (*tls.Config, error) {
+	minVersion, err := certs.ParseMinVersion(*tlsMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth, err := certs.ParseClientAuth(*tlsClientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	if clientAuth != tls.NoClientCert && *tlsClientCA == "" {
+		return nil, fmt.Errorf("-tls-client-auth=%s needs -tls-client-ca", *tlsClientAuth)
+	}
+
+	if *tlsDev {
+		cert, err := certs.SelfSigned()
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("Serving an ephemeral self-signed certificate, do not use in production")
+
+		cfg := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   minVersion,
+			ClientAuth:   clientAuth,
+		}
+
+		if *tlsClientCA != "" {
+			if cfg.ClientCAs, err = certs.LoadCertPool(*tlsClientCA); err != nil {
+				return nil, err
+			}
+		}
+
+		return cfg, nil
+	}
+
+	reloader, err := certs.NewReloader(certs.Config{
+		CertFile:     *tlsCert,
+		KeyFile:      *tlsKey,
+		ClientCAFile: *tlsClientCA,
+		ClientAuth:   clientAuth,
+		MinVersion:   minVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go reloader.Watch(ctx, *tlsReload)
+
+	return reloader.TLSConfig(), nil
+}